@@ -0,0 +1,73 @@
+package kasper
+
+import (
+	"sync"
+	"time"
+)
+
+// batchSizeController adapts the batch size to Config.BatchLatencyTarget, the time allowed to process a batch and
+// produce its outgoing messages. When a batch takes longer than the target, the batch size is reduced in
+// proportion to the excess latency. When a full batch takes less than 3/4 of the target, the batch size grows
+// by 10%, up to Config.BatchSize. Batches cut short by BatchWaitDuration never grow the batch size.
+type batchSizeController struct {
+	sync.Mutex
+	target time.Duration
+	min    int
+	max    int
+	size   int
+	gauge  Gauge
+}
+
+func newBatchSizeController(config *Config) *batchSizeController {
+	if config.BatchLatencyTarget <= 0 {
+		return nil
+	}
+	gauge := config.MetricsProvider.NewGauge("batch_size", "Batch size adapted to the batch latency target")
+	gauge.Set(float64(config.BatchSize))
+	return &batchSizeController{
+		target: config.BatchLatencyTarget,
+		min:    config.MinBatchSize,
+		max:    config.BatchSize,
+		size:   config.BatchSize,
+		gauge:  gauge,
+	}
+}
+
+// batchSize returns the current maximum number of messages per batch.
+func (tp *TopicProcessor) batchSize() int {
+	c := tp.batchSizeController
+	if c == nil {
+		return tp.config.BatchSize
+	}
+	c.Lock()
+	defer c.Unlock()
+	return c.size
+}
+
+// observe updates the batch size with the latency of a batch of n messages.
+func (c *batchSizeController) observe(n int, latency time.Duration) {
+	if c == nil {
+		return
+	}
+	c.Lock()
+	defer c.Unlock()
+	size := c.size
+	if latency > c.target {
+		size = int(float64(n) * float64(c.target) / float64(latency))
+		if size > c.size {
+			size = c.size
+		}
+	} else if n >= c.size && latency < c.target*3/4 {
+		size = c.size + (c.size+9)/10
+	}
+	if size < c.min {
+		size = c.min
+	}
+	if size > c.max {
+		size = c.max
+	}
+	if size != c.size {
+		c.size = size
+		c.gauge.Set(float64(size))
+	}
+}
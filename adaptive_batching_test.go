@@ -0,0 +1,99 @@
+package kasper
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchSizeController(t *testing.T) {
+	config := &Config{
+		BatchSize:          100,
+		BatchLatencyTarget: 100 * time.Millisecond,
+		MinBatchSize:       10,
+		MetricsProvider:    &NoopMetricsProvider{},
+	}
+	tp := &TopicProcessor{config: config, batchSizeController: newBatchSizeController(config)}
+	assert.Equal(t, 100, tp.batchSize())
+
+	// Slow batches shrink the batch size in proportion to the excess latency
+	tp.batchSizeController.observe(100, 200*time.Millisecond)
+	assert.Equal(t, 50, tp.batchSize())
+	tp.batchSizeController.observe(50, time.Second)
+	assert.Equal(t, 10, tp.batchSize())
+
+	// Fast full batches grow the batch size up to BatchSize
+	tp.batchSizeController.observe(10, 10*time.Millisecond)
+	assert.Equal(t, 11, tp.batchSize())
+	tp.batchSizeController.observe(5, 10*time.Millisecond)
+	assert.Equal(t, 11, tp.batchSize())
+	for i := 0; i < 50; i++ {
+		tp.batchSizeController.observe(tp.batchSize(), 10*time.Millisecond)
+	}
+	assert.Equal(t, 100, tp.batchSize())
+}
+
+func TestBatchSizeController_Disabled(t *testing.T) {
+	tp := &TopicProcessor{config: &Config{BatchSize: 100}}
+	tp.batchSizeController.observe(100, time.Hour)
+	assert.Equal(t, 100, tp.batchSize())
+}
+
+// slowMessageProcessor records the offsets of each batch and advances clock by latency while processing it.
+type slowMessageProcessor struct {
+	clock   *FakeClock
+	latency time.Duration
+	batches chan []int64
+}
+
+func (p *slowMessageProcessor) Process(messages []*sarama.ConsumerMessage, sender Sender) error {
+	p.clock.Advance(p.latency)
+	var offsets []int64
+	for _, message := range messages {
+		offsets = append(offsets, message.Offset)
+	}
+	p.batches <- offsets
+	return nil
+}
+
+func TestTopicProcessor_RunLoop_AdaptiveBatchSize(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	config := &Config{
+		BatchSize:             4,
+		BatchWaitDuration:     time.Hour,
+		BatchLatencyTarget:    100 * time.Millisecond,
+		MinBatchSize:          1,
+		MetricsUpdateInterval: time.Hour,
+		MetricsProvider:       &NoopMetricsProvider{},
+		Clock:                 clock,
+	}
+	tp := newShutdownTestTopicProcessor(config)
+	tp.partitions = []int{0}
+	tp.incomingMessageCount = &noopMetric{}
+	tp.outgoingMessageCount = &noopMetric{}
+	tp.batchSizeController = newBatchSizeController(config)
+	processor := &slowMessageProcessor{clock, 400 * time.Millisecond, make(chan []int64, 10)}
+	pp := tp.partitionProcessors[0]
+	pp.messageProcessor = processor
+	pc := pp.partitionConsumers[0].(*fakePartitionConsumer)
+	pom := pp.offsetManagers["hello"].(*fakePartitionOffsetManager)
+	done := make(chan error)
+	go func() {
+		done <- tp.RunLoop()
+	}()
+
+	for offset := int64(1); offset <= 4; offset++ {
+		pc.messages <- &sarama.ConsumerMessage{Topic: "hello", Offset: offset}
+	}
+	assert.Equal(t, []int64{1, 2, 3, 4}, <-processor.batches)
+
+	// The batch size drops to 1: the next batch only holds the new message
+	pc.messages <- &sarama.ConsumerMessage{Topic: "hello", Offset: 5}
+	assert.Equal(t, []int64{5}, <-processor.batches)
+
+	close(tp.close)
+	assert.Nil(t, <-done)
+	assert.Equal(t, int64(6), pom.offset)
+}
@@ -0,0 +1,156 @@
+package kasper
+
+import (
+	"fmt"
+
+	"github.com/Shopify/sarama"
+)
+
+// Admin answers common operational queries about the consumer groups of TopicProcessors.
+//
+// Admin only uses requests supported by the vendored sarama client and Kafka 0.9+ brokers.
+// Deleting consumer groups and describing topic configs require a newer client and are not available.
+type Admin struct {
+	client sarama.Client
+}
+
+// NewAdmin creates an Admin using the given Kafka client.
+func NewAdmin(client sarama.Client) *Admin {
+	return &Admin{client}
+}
+
+// TopicProcessorConsumerGroup returns the Kafka consumer group used by the TopicProcessor with the given name.
+func TopicProcessorConsumerGroup(topicProcessorName string) string {
+	return (&Config{TopicProcessorName: topicProcessorName}).kafkaConsumerGroup()
+}
+
+// ListConsumerGroups returns the consumer groups known to the brokers of the cluster, with their protocol type.
+func (admin *Admin) ListConsumerGroups() (map[string]string, error) {
+	groups := make(map[string]string)
+	for _, broker := range admin.client.Brokers() {
+		err := broker.Open(admin.client.Config())
+		if err != nil && err != sarama.ErrAlreadyConnected {
+			return nil, err
+		}
+		response, err := broker.ListGroups(&sarama.ListGroupsRequest{})
+		if err != nil {
+			return nil, err
+		}
+		if response.Err != sarama.ErrNoError {
+			return nil, response.Err
+		}
+		for group, protocolType := range response.Groups {
+			groups[group] = protocolType
+		}
+	}
+	return groups, nil
+}
+
+// DescribeConsumerGroup returns the state and members of a consumer group.
+func (admin *Admin) DescribeConsumerGroup(group string) (*sarama.GroupDescription, error) {
+	broker, err := admin.client.Coordinator(group)
+	if err != nil {
+		return nil, err
+	}
+	response, err := broker.DescribeGroups(&sarama.DescribeGroupsRequest{Groups: []string{group}})
+	if err != nil {
+		return nil, err
+	}
+	for _, description := range response.Groups {
+		if description.GroupId != group {
+			continue
+		}
+		if description.Err != sarama.ErrNoError {
+			return nil, description.Err
+		}
+		return description, nil
+	}
+	return nil, sarama.ErrIncompleteResponse
+}
+
+// ConsumerGroupOffsets returns the committed offsets of a consumer group for all partitions of the given topics.
+// Partitions without a committed offset are reported as sarama.OffsetNewest (-1).
+func (admin *Admin) ConsumerGroupOffsets(group string, topics ...string) (map[string]map[int32]int64, error) {
+	request := &sarama.OffsetFetchRequest{ConsumerGroup: group, Version: 1}
+	for _, topic := range topics {
+		partitions, err := admin.client.Partitions(topic)
+		if err != nil {
+			return nil, err
+		}
+		for _, partition := range partitions {
+			request.AddPartition(topic, partition)
+		}
+	}
+	broker, err := admin.client.Coordinator(group)
+	if err != nil {
+		return nil, err
+	}
+	response, err := broker.FetchOffset(request)
+	if err != nil {
+		return nil, err
+	}
+	offsets := make(map[string]map[int32]int64)
+	for topic, blocks := range response.Blocks {
+		offsets[topic] = make(map[int32]int64, len(blocks))
+		for partition, block := range blocks {
+			if block.Err != sarama.ErrNoError {
+				return nil, fmt.Errorf("cannot fetch offset of %s/%d: %s", topic, partition, block.Err)
+			}
+			offsets[topic][partition] = block.Offset
+		}
+	}
+	return offsets, nil
+}
+
+// ResetConsumerGroupOffsets commits the given offsets on behalf of a consumer group.
+// Unlike sarama's offset manager, offsets can be moved backwards as well as forwards.
+// The TopicProcessors of the group must be stopped, otherwise they will overwrite the new offsets.
+func (admin *Admin) ResetConsumerGroupOffsets(group string, offsets map[string]map[int32]int64) error {
+	request := &sarama.OffsetCommitRequest{
+		ConsumerGroup:           group,
+		ConsumerGroupGeneration: sarama.GroupGenerationUndefined,
+		Version:                 1,
+	}
+	for topic, partitions := range offsets {
+		for partition, offset := range partitions {
+			request.AddBlock(topic, partition, offset, sarama.ReceiveTime, "")
+		}
+	}
+	broker, err := admin.client.Coordinator(group)
+	if err != nil {
+		return err
+	}
+	response, err := broker.CommitOffset(request)
+	if err != nil {
+		return err
+	}
+	for topic, partitions := range response.Errors {
+		for partition, kerr := range partitions {
+			if kerr != sarama.ErrNoError {
+				return fmt.Errorf("cannot reset offset of %s/%d: %s", topic, partition, kerr)
+			}
+		}
+	}
+	return nil
+}
+
+// ResetConsumerGroupOffsetsToTime moves the offsets of a consumer group for all partitions of the given topics
+// to the first message produced at or after time (in milliseconds), or to sarama.OffsetNewest / sarama.OffsetOldest.
+func (admin *Admin) ResetConsumerGroupOffsetsToTime(group string, time int64, topics ...string) error {
+	offsets := make(map[string]map[int32]int64)
+	for _, topic := range topics {
+		partitions, err := admin.client.Partitions(topic)
+		if err != nil {
+			return err
+		}
+		offsets[topic] = make(map[int32]int64, len(partitions))
+		for _, partition := range partitions {
+			offset, err := admin.client.GetOffset(topic, partition, time)
+			if err != nil {
+				return err
+			}
+			offsets[topic][partition] = offset
+		}
+	}
+	return admin.ResetConsumerGroupOffsets(group, offsets)
+}
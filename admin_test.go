@@ -0,0 +1,41 @@
+package kasper
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTopicProcessorConsumerGroup(t *testing.T) {
+	assert.Equal(t, "kasper-topic-processor-word-count", TopicProcessorConsumerGroup("word-count"))
+}
+
+func TestAdmin_ResetConsumerGroupOffsets(t *testing.T) {
+	if testing.Short() {
+		t.Skip()
+	}
+	host := fmt.Sprintf("%s:9092", getCIHost())
+	client, err := sarama.NewClient([]string{host}, sarama.NewConfig())
+	if err != nil {
+		t.Fatal("Could not connect to Kafka", err)
+	}
+	defer client.Close()
+
+	admin := NewAdmin(client)
+	group := TopicProcessorConsumerGroup(fmt.Sprintf("admin-integration-test-%d", time.Now().Unix()))
+	err = admin.ResetConsumerGroupOffsets(group, map[string]map[int32]int64{"hello": {0: 42}})
+	assert.NoError(t, err)
+
+	offsets, err := admin.ConsumerGroupOffsets(group, "hello")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42), offsets["hello"][0])
+
+	err = admin.ResetConsumerGroupOffsets(group, map[string]map[int32]int64{"hello": {0: 7}})
+	assert.NoError(t, err)
+	offsets, err = admin.ConsumerGroupOffsets(group, "hello")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(7), offsets["hello"][0])
+}
@@ -0,0 +1,156 @@
+package kasper
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/Shopify/sarama"
+)
+
+// Aggregation folds incoming messages into a per-key aggregate, see Aggregator.
+type Aggregation interface {
+	// Add folds message into the current state of its key (nil for a new key) and returns the new state.
+	Add(state []byte, message *sarama.ConsumerMessage) ([]byte, error)
+	// Result returns the value sent to the output topic for a state.
+	Result(state []byte) []byte
+}
+
+// NumericValueFunc extracts the number aggregated by Sum, Min and Max from an incoming message.
+type NumericValueFunc func(message *sarama.ConsumerMessage) (float64, error)
+
+// ItemFunc extracts the item counted by DistinctCount from an incoming message.
+type ItemFunc func(message *sarama.ConsumerMessage) []byte
+
+// ParseFloatValue is a NumericValueFunc parsing the message value as a decimal number.
+func ParseFloatValue(message *sarama.ConsumerMessage) (float64, error) {
+	return strconv.ParseFloat(string(message.Value), 64)
+}
+
+// Aggregator is a MessageProcessor that maintains an aggregate per message key in a Store.
+// At the end of each batch, the Store is updated and the new result of each updated key is sent to the output
+// topic, keyed by the message key. Tombstones are ignored.
+type Aggregator struct {
+	store       Store
+	topic       string
+	aggregation Aggregation
+}
+
+// NewAggregator creates an Aggregator keeping its state in store and sending results to topic.
+func NewAggregator(store Store, topic string, aggregation Aggregation) *Aggregator {
+	return &Aggregator{store, topic, aggregation}
+}
+
+// Process folds a batch of messages into their aggregates and sends one update per updated key,
+// in order of first appearance in the batch.
+func (a *Aggregator) Process(messages []*sarama.ConsumerMessage, sender Sender) error {
+	var keys []string
+	for _, message := range messages {
+		if !IsTombstone(message) {
+			keys = append(keys, string(message.Key))
+		}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	states, err := a.store.GetAll(keys)
+	if err != nil {
+		return err
+	}
+	updates := make(map[string][]byte)
+	var updatedKeys []string
+	for _, message := range messages {
+		if IsTombstone(message) {
+			continue
+		}
+		key := string(message.Key)
+		state, found := updates[key]
+		if !found {
+			state = states[key]
+			updatedKeys = append(updatedKeys, key)
+		}
+		updates[key], err = a.aggregation.Add(state, message)
+		if err != nil {
+			return err
+		}
+	}
+	err = a.store.PutAll(updates)
+	if err != nil {
+		return err
+	}
+	for _, key := range updatedKeys {
+		sender.Send(&sarama.ProducerMessage{
+			Topic: a.topic,
+			Key:   sarama.StringEncoder(key),
+			Value: sarama.ByteEncoder(a.aggregation.Result(updates[key])),
+		})
+	}
+	return nil
+}
+
+type numericAggregation struct {
+	value NumericValueFunc
+	fold  func(state, value float64) float64
+}
+
+func (n *numericAggregation) Add(state []byte, message *sarama.ConsumerMessage) ([]byte, error) {
+	value, err := n.value(message)
+	if err != nil {
+		return nil, err
+	}
+	if state != nil {
+		current, err := strconv.ParseFloat(string(state), 64)
+		if err != nil {
+			return nil, err
+		}
+		value = n.fold(current, value)
+	}
+	return []byte(strconv.FormatFloat(value, 'g', -1, 64)), nil
+}
+
+func (n *numericAggregation) Result(state []byte) []byte {
+	return state
+}
+
+// Count counts messages. Results are decimal integers.
+func Count() Aggregation {
+	return &numericAggregation{
+		func(*sarama.ConsumerMessage) (float64, error) { return 1, nil },
+		func(state, value float64) float64 { return state + value },
+	}
+}
+
+// Sum adds up the values extracted from messages. Results are decimal numbers.
+func Sum(value NumericValueFunc) Aggregation {
+	return &numericAggregation{value, func(state, value float64) float64 { return state + value }}
+}
+
+// Min keeps the smallest value extracted from messages. Results are decimal numbers.
+func Min(value NumericValueFunc) Aggregation {
+	return &numericAggregation{value, math.Min}
+}
+
+// Max keeps the largest value extracted from messages. Results are decimal numbers.
+func Max(value NumericValueFunc) Aggregation {
+	return &numericAggregation{value, math.Max}
+}
+
+type distinctCountAggregation struct {
+	item ItemFunc
+}
+
+// DistinctCount approximates the number of distinct items extracted from messages with a HyperLogLog sketch.
+// Each key's state is a 4 KB sketch and the standard error of the count is about 1.6%.
+// Results are decimal integers.
+func DistinctCount(item ItemFunc) Aggregation {
+	return &distinctCountAggregation{item}
+}
+
+func (d *distinctCountAggregation) Add(state []byte, message *sarama.ConsumerMessage) ([]byte, error) {
+	sketch := newHyperLogLog(state)
+	sketch.add(d.item(message))
+	return sketch.registers, nil
+}
+
+func (d *distinctCountAggregation) Result(state []byte) []byte {
+	return []byte(strconv.FormatUint(newHyperLogLog(state).count(), 10))
+}
@@ -0,0 +1,60 @@
+package kasper
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+func newAggregationTestMessages() []*sarama.ConsumerMessage {
+	return []*sarama.ConsumerMessage{
+		{Key: []byte("mars"), Value: []byte("4")},
+		{Key: []byte("venus"), Value: []byte("2.5")},
+		{Key: []byte("mars"), Value: []byte("-1")},
+		{Key: []byte("mars")},
+	}
+}
+
+func runAggregator(t *testing.T, aggregation Aggregation, batches int) map[string]string {
+	a := NewAggregator(NewMap(10), "results", aggregation)
+	results := make(map[string]string)
+	for i := 0; i < batches; i++ {
+		sender := &bufferSender{}
+		assert.Nil(t, a.Process(newAggregationTestMessages(), sender))
+		for _, message := range sender.messages {
+			key, _ := message.Key.Encode()
+			value, _ := message.Value.Encode()
+			results[string(key)] = string(value)
+		}
+	}
+	return results
+}
+
+func TestAggregator(t *testing.T) {
+	assert.Equal(t, map[string]string{"mars": "4", "venus": "2"}, runAggregator(t, Count(), 2))
+	assert.Equal(t, map[string]string{"mars": "6", "venus": "5"}, runAggregator(t, Sum(ParseFloatValue), 2))
+	assert.Equal(t, map[string]string{"mars": "-1", "venus": "2.5"}, runAggregator(t, Min(ParseFloatValue), 1))
+	assert.Equal(t, map[string]string{"mars": "4", "venus": "2.5"}, runAggregator(t, Max(ParseFloatValue), 1))
+
+	value := func(message *sarama.ConsumerMessage) []byte { return message.Value }
+	assert.Equal(t, map[string]string{"mars": "2", "venus": "1"}, runAggregator(t, DistinctCount(value), 3))
+}
+
+func TestAggregator_Error(t *testing.T) {
+	a := NewAggregator(NewMap(10), "results", Sum(ParseFloatValue))
+	err := a.Process([]*sarama.ConsumerMessage{{Key: []byte("mars"), Value: []byte("four")}}, &bufferSender{})
+	assert.NotNil(t, err)
+}
+
+func TestHyperLogLog(t *testing.T) {
+	h := newHyperLogLog(nil)
+	for i := 0; i < 100000; i++ {
+		h.add([]byte(fmt.Sprintf("item-%d", i%50000)))
+	}
+	count := h.count()
+	assert.InEpsilon(t, 50000, float64(count), 0.05, strconv.FormatUint(count, 10))
+	assert.Equal(t, h.count(), newHyperLogLog(h.registers).count())
+}
@@ -0,0 +1,59 @@
+package kasper
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ContainerIDFromHostname extracts the ordinal of a Kubernetes StatefulSet pod from its hostname,
+// e.g. "word-count-3" has container ID 3.
+func ContainerIDFromHostname(hostname string) (int, error) {
+	i := strings.LastIndex(hostname, "-")
+	if i == -1 {
+		return 0, fmt.Errorf("hostname %s does not end with a StatefulSet ordinal", hostname)
+	}
+	id, err := strconv.Atoi(hostname[i+1:])
+	if err != nil || id < 0 {
+		return 0, fmt.Errorf("hostname %s does not end with a StatefulSet ordinal", hostname)
+	}
+	return id, nil
+}
+
+// AssignPartitions returns the input partitions of containerID when partitionCount partitions are spread
+// over containerCount containers. Partition p is assigned to container p % containerCount, so the assignments
+// of all containers never overlap and cover every partition.
+// It returns an error if containerCount is not positive or if containerID is not between 0 and containerCount-1.
+func AssignPartitions(partitionCount, containerCount, containerID int) ([]int, error) {
+	if containerCount <= 0 {
+		return nil, fmt.Errorf("container count must be positive (got %d)", containerCount)
+	}
+	if containerID < 0 || containerID >= containerCount {
+		return nil, fmt.Errorf("container ID %d is out of range (container count is %d)", containerID, containerCount)
+	}
+	var partitions []int
+	for partition := containerID; partition < partitionCount; partition += containerCount {
+		partitions = append(partitions, partition)
+	}
+	return partitions, nil
+}
+
+// StatefulSetPartitions returns the input partitions of the current pod of a Kubernetes StatefulSet
+// with containerCount replicas, based on the ordinal suffix of its hostname. Set containerCount from the
+// StatefulSet's replica count (e.g. through an environment variable) so that scaling the StatefulSet
+// recomputes the assignments of all pods on restart:
+//
+//	partitions, err := kasper.StatefulSetPartitions(12, replicas)
+//	config.InputPartitions = partitions
+func StatefulSetPartitions(partitionCount, containerCount int) ([]int, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+	containerID, err := ContainerIDFromHostname(hostname)
+	if err != nil {
+		return nil, err
+	}
+	return AssignPartitions(partitionCount, containerCount, containerID)
+}
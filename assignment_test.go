@@ -0,0 +1,38 @@
+package kasper
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContainerIDFromHostname(t *testing.T) {
+	id, err := ContainerIDFromHostname("word-count-12")
+	assert.Nil(t, err)
+	assert.Equal(t, 12, id)
+
+	_, err = ContainerIDFromHostname("localhost")
+	assert.NotNil(t, err)
+	_, err = ContainerIDFromHostname("word-count-a")
+	assert.NotNil(t, err)
+}
+
+func TestAssignPartitions(t *testing.T) {
+	partitions, err := AssignPartitions(12, 3, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, []int{1, 4, 7, 10}, partitions)
+	partitions, _ = AssignPartitions(3, 5, 2)
+	assert.Equal(t, []int{2}, partitions)
+	partitions, err = AssignPartitions(3, 5, 4)
+	assert.Nil(t, err)
+	assert.Empty(t, partitions)
+}
+
+func TestAssignPartitions_Invalid(t *testing.T) {
+	_, err := AssignPartitions(12, 0, 0)
+	assert.EqualError(t, err, "container count must be positive (got 0)")
+	_, err = AssignPartitions(12, -3, 0)
+	assert.NotNil(t, err)
+	_, err = AssignPartitions(12, 3, 3)
+	assert.EqualError(t, err, "container ID 3 is out of range (container count is 3)")
+}
@@ -0,0 +1,205 @@
+package kasper
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// AuditRecord is a JSON record sent to the audit topic of an AuditLog for each audited operation.
+type AuditRecord struct {
+	// TopicProcessorName of the processor performing the operation
+	Processor string `json:"processor"`
+	// "put" or "delete" for Store operations, "send" for outgoing messages
+	Operation string `json:"operation"`
+	// Name of the Store for Store operations
+	Store string `json:"store,omitempty"`
+	// Output topic for outgoing messages
+	Topic string `json:"topic,omitempty"`
+	Key   string `json:"key"`
+	// Hex-encoded SHA-256 of the value, empty for deletions and tombstones
+	ValueHash string `json:"valueHash,omitempty"`
+	// Partition and offset of the last incoming message of the batch during which the operation happened
+	Partition int32     `json:"partition"`
+	Offset    int64     `json:"offset"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// AuditLog mirrors every Store mutation and outgoing message of a MessageProcessor to an audit topic,
+// so that state changes can be reconstructed for compliance purposes. Values are not copied to the audit
+// topic: only their hashes are.
+//
+// Wrap the Stores of a MessageProcessor with AuditLog.Store, and the MessageProcessor itself with
+// AuditLog.Processor. Audit records are sent at the end of each batch, along with the batch's outgoing messages,
+// so they are produced if and only if the batch's offsets are committed. Store mutations made outside of Process
+// are attributed to the next batch. Use one AuditLog per MessageProcessor instance.
+type AuditLog struct {
+	processor string
+	topic     string
+	records   []*AuditRecord
+	now       func() time.Time
+}
+
+// NewAuditLog creates an AuditLog sending records to topic, on behalf of config.TopicProcessorName.
+func NewAuditLog(config *Config, topic string) *AuditLog {
+	return &AuditLog{
+		processor: config.TopicProcessorName,
+		topic:     topic,
+		now:       config.clock().Now,
+	}
+}
+
+func hashAuditValue(value []byte) string {
+	if value == nil {
+		return ""
+	}
+	hash := sha256.Sum256(value)
+	return hex.EncodeToString(hash[:])
+}
+
+func (a *AuditLog) record(record *AuditRecord) {
+	record.Processor = a.processor
+	record.Timestamp = a.now()
+	a.records = append(a.records, record)
+}
+
+// Store wraps store so that its mutations are audited under the given name.
+func (a *AuditLog) Store(name string, store Store) Store {
+	return &auditStore{store, name, a}
+}
+
+// Processor wraps messageProcessor so that its outgoing messages are audited,
+// and sends the audit records of each batch.
+func (a *AuditLog) Processor(messageProcessor MessageProcessor) MessageProcessor {
+	return &auditProcessor{messageProcessor, a}
+}
+
+type auditProcessor struct {
+	messageProcessor MessageProcessor
+	log              *AuditLog
+}
+
+func (p *auditProcessor) Process(messages []*sarama.ConsumerMessage, sender Sender) error {
+	auditingSender := &auditSender{sender, p.log}
+	err := p.messageProcessor.Process(messages, auditingSender)
+	if err != nil {
+		p.log.records = nil
+		return err
+	}
+	var partition int32
+	var offset int64 = -1
+	if len(messages) > 0 {
+		partition = messages[len(messages)-1].Partition
+		offset = messages[len(messages)-1].Offset
+	}
+	for _, record := range p.log.records {
+		record.Partition = partition
+		record.Offset = offset
+		value, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		sender.Send(&sarama.ProducerMessage{
+			Topic:     p.log.topic,
+			Key:       sarama.StringEncoder(record.Key),
+			Value:     sarama.ByteEncoder(value),
+			Timestamp: record.Timestamp,
+		})
+	}
+	p.log.records = nil
+	return nil
+}
+
+type auditSender struct {
+	sender Sender
+	log    *AuditLog
+}
+
+func (s *auditSender) Send(msg *sarama.ProducerMessage) {
+	record := &AuditRecord{Operation: "send", Topic: msg.Topic}
+	if msg.Key != nil {
+		key, _ := msg.Key.Encode()
+		record.Key = string(key)
+	}
+	if msg.Value != nil {
+		value, _ := msg.Value.Encode()
+		record.ValueHash = hashAuditValue(value)
+	}
+	s.log.record(record)
+	s.sender.Send(msg)
+}
+
+func (s *auditSender) Context() context.Context {
+	return ContextOf(s.sender)
+}
+
+func (s *auditSender) Committer() Committer {
+	return CommitterOf(s.sender)
+}
+
+func (s *auditSender) Flags() *Flags {
+	return FlagsOf(s.sender)
+}
+
+func (s *auditSender) SendTombstone(topic string, key sarama.Encoder) {
+	s.Send(&sarama.ProducerMessage{Topic: topic, Key: key})
+}
+
+func (s *auditSender) Flush() error {
+	return s.sender.Flush()
+}
+
+type auditStore struct {
+	store Store
+	name  string
+	log   *AuditLog
+}
+
+func (s *auditStore) Get(key string) ([]byte, error) {
+	return s.store.Get(key)
+}
+
+func (s *auditStore) GetAll(keys []string) (map[string][]byte, error) {
+	return s.store.GetAll(keys)
+}
+
+func (s *auditStore) Put(key string, value []byte) error {
+	err := s.store.Put(key, value)
+	if err == nil {
+		s.log.record(&AuditRecord{Operation: "put", Store: s.name, Key: key, ValueHash: hashAuditValue(value)})
+	}
+	return err
+}
+
+func (s *auditStore) PutAll(kvs map[string][]byte) error {
+	err := s.store.PutAll(kvs)
+	if err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(kvs))
+	for key := range kvs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s.log.record(&AuditRecord{Operation: "put", Store: s.name, Key: key, ValueHash: hashAuditValue(kvs[key])})
+	}
+	return nil
+}
+
+func (s *auditStore) Delete(key string) error {
+	err := s.store.Delete(key)
+	if err == nil {
+		s.log.record(&AuditRecord{Operation: "delete", Store: s.name, Key: key})
+	}
+	return err
+}
+
+func (s *auditStore) Flush() error {
+	return s.store.Flush()
+}
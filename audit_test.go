@@ -0,0 +1,54 @@
+package kasper
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+type auditTestProcessor struct {
+	store Store
+}
+
+func (p *auditTestProcessor) Process(messages []*sarama.ConsumerMessage, sender Sender) error {
+	for _, message := range messages {
+		err := p.store.Put(string(message.Key), message.Value)
+		if err != nil {
+			return err
+		}
+		sender.SendTombstone("dragons", sarama.ByteEncoder(message.Key))
+	}
+	return p.store.Delete("falkor")
+}
+
+func TestAuditLog(t *testing.T) {
+	log := NewAuditLog(&Config{TopicProcessorName: "dragon-processor"}, "audit")
+	log.now = func() time.Time { return time.Unix(1500000000, 0).UTC() }
+	store := NewMap(10)
+	p := log.Processor(&auditTestProcessor{log.Store("dragons", store)})
+
+	sender := &bufferSender{}
+	assert.Nil(t, p.Process([]*sarama.ConsumerMessage{{Key: []byte("mushu"), Value: mushu, Partition: 3, Offset: 42}}, sender))
+	value, _ := store.Get("mushu")
+	assert.Equal(t, mushu, value)
+
+	assert.Len(t, sender.messages, 4)
+	assert.Equal(t, "dragons", sender.messages[0].Topic)
+	var records []AuditRecord
+	for _, message := range sender.messages[1:] {
+		assert.Equal(t, "audit", message.Topic)
+		value, _ := message.Value.Encode()
+		var record AuditRecord
+		assert.Nil(t, json.Unmarshal(value, &record))
+		records = append(records, record)
+	}
+	assert.Equal(t, AuditRecord{"dragon-processor", "put", "dragons", "", "mushu", hashAuditValue(mushu), 3, 42, time.Unix(1500000000, 0).UTC()}, records[0])
+	assert.Equal(t, "send", records[1].Operation)
+	assert.Equal(t, "", records[1].ValueHash)
+	assert.Equal(t, "delete", records[2].Operation)
+	assert.Equal(t, "falkor", records[2].Key)
+	assert.Empty(t, log.records)
+}
@@ -0,0 +1,373 @@
+package kasper
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+
+	"github.com/Shopify/sarama"
+	"github.com/golang/snappy"
+)
+
+var avroContainerMagic = []byte{'O', 'b', 'j', 1}
+
+var errInvalidAvro = errors.New("invalid Avro data")
+
+// AvroContainerReader is a RecordReader for Avro object container files, the files written by Avro tools,
+// Kafka Connect sinks and Hive. Each record is returned as a message whose value is the Avro binary encoding
+// of the record, without its schema, which can be decoded with Schema(). Messages have no key, and their
+// offsets are the positions of the records in the file.
+//
+// The null, deflate and snappy codecs are supported.
+type AvroContainerReader struct {
+	reader *bufio.Reader
+	topic  string
+	schema string
+	root   *avroSchema
+	codec  string
+	sync   []byte
+	block  []byte
+	left   int64
+	offset int64
+}
+
+// NewAvroContainerReader reads the header of an Avro object container file and returns a reader of its records,
+// attributed to topic.
+func NewAvroContainerReader(r io.Reader, topic string) (*AvroContainerReader, error) {
+	reader := bufio.NewReader(r)
+	magic := make([]byte, len(avroContainerMagic))
+	_, err := io.ReadFull(reader, magic)
+	if err != nil || !bytes.Equal(magic, avroContainerMagic) {
+		return nil, errors.New("not an Avro object container file")
+	}
+	metadata := make(map[string][]byte)
+	for {
+		count, err := readAvroBlockCount(reader)
+		if err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			break
+		}
+		for i := int64(0); i < count; i++ {
+			key, err := readAvroBytes(reader)
+			if err != nil {
+				return nil, err
+			}
+			value, err := readAvroBytes(reader)
+			if err != nil {
+				return nil, err
+			}
+			metadata[string(key)] = value
+		}
+	}
+	a := &AvroContainerReader{
+		reader: reader,
+		topic:  topic,
+		schema: string(metadata["avro.schema"]),
+		codec:  string(metadata["avro.codec"]),
+		sync:   make([]byte, 16),
+	}
+	if a.codec == "" {
+		a.codec = "null"
+	}
+	if a.codec != "null" && a.codec != "deflate" && a.codec != "snappy" {
+		return nil, fmt.Errorf("unsupported Avro codec %q", a.codec)
+	}
+	a.root, err = parseAvroSchema([]byte(a.schema))
+	if err != nil {
+		return nil, err
+	}
+	_, err = io.ReadFull(reader, a.sync)
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Schema returns the writer schema of the file, as JSON.
+func (a *AvroContainerReader) Schema() string {
+	return a.schema
+}
+
+// Next returns the next record of the file, or io.EOF after the last record.
+func (a *AvroContainerReader) Next() (*sarama.ConsumerMessage, error) {
+	for a.left == 0 {
+		err := a.readBlock()
+		if err != nil {
+			return nil, err
+		}
+	}
+	n, err := a.root.skip(a.block)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read Avro record %d: %s", a.offset, err)
+	}
+	message := &sarama.ConsumerMessage{Topic: a.topic, Value: a.block[:n], Offset: a.offset}
+	a.block = a.block[n:]
+	a.left--
+	a.offset++
+	return message, nil
+}
+
+func (a *AvroContainerReader) readBlock() error {
+	count, err := readAvroLong(a.reader)
+	if err == io.EOF {
+		return io.EOF
+	}
+	if err != nil {
+		return err
+	}
+	data, err := readAvroBytes(a.reader)
+	if err != nil {
+		return err
+	}
+	sync := make([]byte, len(a.sync))
+	_, err = io.ReadFull(a.reader, sync)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(sync, a.sync) {
+		return errors.New("invalid Avro sync marker")
+	}
+	switch a.codec {
+	case "deflate":
+		data, err = ioutil.ReadAll(flate.NewReader(bytes.NewReader(data)))
+	case "snappy":
+		if len(data) < 4 {
+			return errInvalidAvro
+		}
+		checksum := binary.BigEndian.Uint32(data[len(data)-4:])
+		data, err = snappy.Decode(nil, data[:len(data)-4])
+		if err == nil && crc32.ChecksumIEEE(data) != checksum {
+			err = errors.New("invalid Avro block checksum")
+		}
+	}
+	if err != nil {
+		return err
+	}
+	a.block = data
+	a.left = count
+	return nil
+}
+
+func readAvroLong(r io.ByteReader) (int64, error) {
+	return binary.ReadVarint(r)
+}
+
+func readAvroBytes(r *bufio.Reader) ([]byte, error) {
+	length, err := readAvroLong(r)
+	if err != nil {
+		return nil, err
+	}
+	if length < 0 {
+		return nil, errInvalidAvro
+	}
+	data := make([]byte, length)
+	_, err = io.ReadFull(r, data)
+	return data, err
+}
+
+// readAvroBlockCount reads the item count of a block of an Avro array or map, skipping the block size if present.
+func readAvroBlockCount(r *bufio.Reader) (int64, error) {
+	count, err := readAvroLong(r)
+	if err != nil || count >= 0 {
+		return count, err
+	}
+	_, err = readAvroLong(r)
+	return -count, err
+}
+
+// avroSchema is the subset of an Avro schema needed to find the boundaries of binary-encoded data.
+type avroSchema struct {
+	kind     string
+	fields   []*avroSchema
+	items    *avroSchema
+	branches []*avroSchema
+	size     int
+	ref      string
+	names    map[string]*avroSchema
+}
+
+func parseAvroSchema(data []byte) (*avroSchema, error) {
+	names := make(map[string]*avroSchema)
+	return parseAvroType(json.RawMessage(data), "", names)
+}
+
+func parseAvroType(data json.RawMessage, namespace string, names map[string]*avroSchema) (*avroSchema, error) {
+	var name string
+	if json.Unmarshal(data, &name) == nil {
+		switch name {
+		case "null", "boolean", "int", "long", "float", "double", "bytes", "string":
+			return &avroSchema{kind: name}, nil
+		}
+		if namespace != "" && !bytes.Contains([]byte(name), []byte(".")) {
+			if _, found := names[namespace+"."+name]; found {
+				name = namespace + "." + name
+			}
+		}
+		return &avroSchema{kind: "ref", ref: name, names: names}, nil
+	}
+	var union []json.RawMessage
+	if json.Unmarshal(data, &union) == nil {
+		s := &avroSchema{kind: "union"}
+		for _, branch := range union {
+			parsed, err := parseAvroType(branch, namespace, names)
+			if err != nil {
+				return nil, err
+			}
+			s.branches = append(s.branches, parsed)
+		}
+		return s, nil
+	}
+	var object struct {
+		Type      json.RawMessage `json:"type"`
+		Name      string          `json:"name"`
+		Namespace string          `json:"namespace"`
+		Fields    []struct {
+			Type json.RawMessage `json:"type"`
+		} `json:"fields"`
+		Items  json.RawMessage `json:"items"`
+		Values json.RawMessage `json:"values"`
+		Size   int             `json:"size"`
+	}
+	err := json.Unmarshal(data, &object)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Avro schema: %s", err)
+	}
+	var kind string
+	if json.Unmarshal(object.Type, &kind) != nil {
+		return parseAvroType(object.Type, namespace, names)
+	}
+	s := &avroSchema{kind: kind, size: object.Size}
+	switch kind {
+	case "record", "error", "enum", "fixed":
+		if object.Namespace != "" {
+			namespace = object.Namespace
+		}
+		fullName := object.Name
+		if namespace != "" && !bytes.Contains([]byte(fullName), []byte(".")) {
+			fullName = namespace + "." + fullName
+		}
+		names[fullName] = s
+		names[object.Name] = s
+		for _, field := range object.Fields {
+			parsed, err := parseAvroType(field.Type, namespace, names)
+			if err != nil {
+				return nil, err
+			}
+			s.fields = append(s.fields, parsed)
+		}
+	case "array":
+		s.items, err = parseAvroType(object.Items, namespace, names)
+	case "map":
+		s.items, err = parseAvroType(object.Values, namespace, names)
+	default:
+		return parseAvroType(object.Type, namespace, names)
+	}
+	return s, err
+}
+
+// skip returns the length of the datum of schema s at the start of data.
+func (s *avroSchema) skip(data []byte) (int, error) {
+	switch s.kind {
+	case "null":
+		return 0, nil
+	case "boolean":
+		return s.fixed(data, 1)
+	case "int", "long", "enum":
+		_, n := binary.Varint(data)
+		if n <= 0 {
+			return 0, errInvalidAvro
+		}
+		return n, nil
+	case "float":
+		return s.fixed(data, 4)
+	case "double":
+		return s.fixed(data, 8)
+	case "fixed":
+		return s.fixed(data, s.size)
+	case "bytes", "string":
+		length, n := binary.Varint(data)
+		if n <= 0 || length < 0 {
+			return 0, errInvalidAvro
+		}
+		return s.fixed(data, n+int(length))
+	case "record", "error":
+		total := 0
+		for _, field := range s.fields {
+			n, err := field.skip(data[total:])
+			if err != nil {
+				return 0, err
+			}
+			total += n
+		}
+		return total, nil
+	case "union":
+		index, n := binary.Varint(data)
+		if n <= 0 || index < 0 || int(index) >= len(s.branches) {
+			return 0, errInvalidAvro
+		}
+		m, err := s.branches[index].skip(data[n:])
+		return n + m, err
+	case "array", "map":
+		return s.skipBlocks(data)
+	case "ref":
+		named, found := s.names[s.ref]
+		if !found {
+			return 0, fmt.Errorf("unknown Avro type %q", s.ref)
+		}
+		return named.skip(data)
+	}
+	return 0, fmt.Errorf("unsupported Avro type %q", s.kind)
+}
+
+func (s *avroSchema) fixed(data []byte, n int) (int, error) {
+	if len(data) < n {
+		return 0, errInvalidAvro
+	}
+	return n, nil
+}
+
+func (s *avroSchema) skipBlocks(data []byte) (int, error) {
+	key := &avroSchema{kind: "string"}
+	total := 0
+	for {
+		count, n := binary.Varint(data[total:])
+		if n <= 0 {
+			return 0, errInvalidAvro
+		}
+		total += n
+		if count == 0 {
+			return total, nil
+		}
+		if count < 0 {
+			count = -count
+			_, n = binary.Varint(data[total:])
+			if n <= 0 {
+				return 0, errInvalidAvro
+			}
+			total += n
+		}
+		for i := int64(0); i < count; i++ {
+			if s.kind == "map" {
+				n, err := key.skip(data[total:])
+				if err != nil {
+					return 0, err
+				}
+				total += n
+			}
+			n, err := s.items.skip(data[total:])
+			if err != nil {
+				return 0, err
+			}
+			total += n
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package kasper
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// passthroughMessageProcessor forwards every incoming message to an output topic.
+type passthroughMessageProcessor struct {
+	topic string
+}
+
+func (p *passthroughMessageProcessor) Process(messages []*sarama.ConsumerMessage, sender Sender) error {
+	for _, message := range messages {
+		sender.Send(&sarama.ProducerMessage{
+			Topic: p.topic,
+			Key:   sarama.ByteEncoder(message.Key),
+			Value: sarama.ByteEncoder(message.Value),
+		})
+	}
+	return nil
+}
+
+func newBenchmarkTopicProcessor(producer sarama.SyncProducer, topic string) *TopicProcessor {
+	tp := &TopicProcessor{
+		config:                   &Config{ProducerStallThreshold: time.Minute},
+		producer:                 producer,
+		logger:                   &noopLogger{},
+		incomingMessageCount:     &noopMetric{},
+		outgoingMessageCount:     &noopMetric{},
+		rejectedMessageCount:     &noopMetric{},
+		producerInFlightMessages: &noopMetric{},
+		producerAckLatency:       &noopMetric{},
+		producerStallCount:       &noopMetric{},
+	}
+	tp.partitionProcessors = map[int32]*partitionProcessor{
+		0: {
+			topicProcessor:   tp,
+			offsetManagers:   map[string]sarama.PartitionOffsetManager{"bench-in": &fakePartitionOffsetManager{}},
+			messageProcessor: &passthroughMessageProcessor{topic},
+			logger:           tp.logger,
+		},
+	}
+	return tp
+}
+
+func newBenchmarkBatch(size int) []*sarama.ConsumerMessage {
+	batch := make([]*sarama.ConsumerMessage, size)
+	for i := range batch {
+		batch[i] = &sarama.ConsumerMessage{
+			Topic:  "bench-in",
+			Key:    []byte(fmt.Sprintf("key-%d", i)),
+			Value:  []byte(`{"color": "green", "name": "Vorgansharax"}`),
+			Offset: int64(i),
+		}
+	}
+	return batch
+}
+
+// runProcessingBenchmark processes b.N batches and reports throughput and p99 batch latency.
+func runProcessingBenchmark(b *testing.B, tp *TopicProcessor, batchSize int) {
+	batch := newBenchmarkBatch(batchSize)
+	latencies := make([]time.Duration, b.N)
+	b.ReportAllocs()
+	b.ResetTimer()
+	start := time.Now()
+	for i := 0; i < b.N; i++ {
+		batchStart := time.Now()
+		err := tp.processConsumerMessages(batch, 0)
+		if err != nil {
+			b.Fatal(err)
+		}
+		latencies[i] = time.Since(batchStart)
+	}
+	elapsed := time.Since(start)
+	b.StopTimer()
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	b.ReportMetric(float64(b.N*batchSize)/elapsed.Seconds(), "msgs/s")
+	b.ReportMetric(float64(latencies[b.N*99/100].Nanoseconds())/1e6, "p99-ms/batch")
+}
+
+// discardingSyncProducer acknowledges messages immediately, after an optional simulated broker latency.
+type discardingSyncProducer struct {
+	latency time.Duration
+}
+
+func (p *discardingSyncProducer) SendMessage(msg *sarama.ProducerMessage) (int32, int64, error) {
+	time.Sleep(p.latency)
+	return 0, 0, nil
+}
+
+func (p *discardingSyncProducer) SendMessages(msgs []*sarama.ProducerMessage) error {
+	time.Sleep(p.latency)
+	return nil
+}
+
+func (p *discardingSyncProducer) Close() error {
+	return nil
+}
+
+func BenchmarkTopicProcessor_InMemory(b *testing.B) {
+	for _, batchSize := range []int{1, 100, 1000, 10000} {
+		for _, latency := range []time.Duration{0, time.Millisecond} {
+			b.Run(fmt.Sprintf("batch=%d/ack=%s", batchSize, latency), func(b *testing.B) {
+				tp := newBenchmarkTopicProcessor(&discardingSyncProducer{latency}, "bench-out")
+				runProcessingBenchmark(b, tp, batchSize)
+			})
+		}
+	}
+}
+
+func BenchmarkTopicProcessor_Broker(b *testing.B) {
+	if testing.Short() {
+		b.Skip()
+	}
+	saramaConfig := sarama.NewConfig()
+	saramaConfig.Producer.RequiredAcks = sarama.WaitForAll
+	saramaConfig.Producer.Return.Successes = true
+	host := fmt.Sprintf("%s:9092", getCIHost())
+	client, err := sarama.NewClient([]string{host}, saramaConfig)
+	if err != nil {
+		b.Fatal("Could not connect to Kafka", err)
+	}
+	defer client.Close()
+	producer, err := sarama.NewSyncProducerFromClient(client)
+	if err != nil {
+		b.Fatal("Could not create Kafka producer", err)
+	}
+	defer producer.Close()
+	for _, batchSize := range []int{1, 100, 1000} {
+		b.Run(fmt.Sprintf("batch=%d", batchSize), func(b *testing.B) {
+			tp := newBenchmarkTopicProcessor(producer, "hello")
+			runProcessingBenchmark(b, tp, batchSize)
+		})
+	}
+}
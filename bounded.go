@@ -0,0 +1,114 @@
+package kasper
+
+import (
+	"github.com/Shopify/sarama"
+)
+
+// offsetBound tracks the progress of a topic partition towards its stop offset in bounded mode.
+type offsetBound struct {
+	// Offset of the first message that is not processed
+	end int64
+	// Offset following the last message received
+	position int64
+}
+
+func (config *Config) isBounded() bool {
+	return config.StopAtOffsets != nil || config.StopAtHighWaterMark
+}
+
+// mustGetOffsetBounds returns the stop offsets of a partition of the input topics, or nil when not in bounded mode.
+func mustGetOffsetBounds(tp *TopicProcessor, offsetManagers map[string]sarama.PartitionOffsetManager, partition int) map[string]*offsetBound {
+	config := tp.config
+	if !config.isBounded() {
+		return nil
+	}
+	client := config.Client
+	bounds := make(map[string]*offsetBound, len(tp.inputTopics))
+	for _, topic := range tp.inputTopics {
+		newestOffset, err := client.GetOffset(topic, int32(partition), sarama.OffsetNewest)
+		if err != nil {
+			tp.logger.Panic(err)
+		}
+		end, found := config.StopAtOffsets[topic][partition]
+		if !found {
+			if !config.StopAtHighWaterMark {
+				continue
+			}
+			end = newestOffset
+		}
+		position, _ := offsetManagers[topic].NextOffset()
+		if config.ReplayMode {
+			position = config.ReplayFromOffset
+		}
+		if position == sarama.OffsetOldest {
+			position, err = client.GetOffset(topic, int32(partition), sarama.OffsetOldest)
+			if err != nil {
+				tp.logger.Panic(err)
+			}
+		}
+		if position == sarama.OffsetNewest || position > newestOffset {
+			position = newestOffset
+		}
+		tp.logger.Infof("Consuming topic partition %s-%d up to offset %d", topic, partition, end)
+		bounds[topic] = &offsetBound{end, position}
+	}
+	return bounds
+}
+
+// dropBeyondBounds updates the position of each topic partition and returns the messages before their stop offsets.
+func (pp *partitionProcessor) dropBeyondBounds(messages []*sarama.ConsumerMessage) []*sarama.ConsumerMessage {
+	if pp.offsetBounds == nil {
+		return messages
+	}
+	bounded := messages[:0:0]
+	for _, message := range messages {
+		bound, found := pp.offsetBounds[message.Topic]
+		if !found {
+			bounded = append(bounded, message)
+			continue
+		}
+		if message.Offset+1 > bound.position {
+			bound.position = message.Offset + 1
+		}
+		if message.Offset < bound.end {
+			bounded = append(bounded, message)
+		}
+	}
+	return bounded
+}
+
+// isComplete returns true in bounded mode when all input topics have been processed up to their stop offsets.
+func (pp *partitionProcessor) isComplete() bool {
+	if pp.offsetBounds == nil {
+		return false
+	}
+	for _, bound := range pp.offsetBounds {
+		if bound.position < bound.end {
+			return false
+		}
+	}
+	return true
+}
+
+// isComplete returns true in bounded mode when all input partitions have been processed up to their stop offsets.
+func (tp *TopicProcessor) isComplete() bool {
+	if !tp.config.isBounded() {
+		return false
+	}
+	tp.partitionsMutex.RLock()
+	defer tp.partitionsMutex.RUnlock()
+	for _, partition := range tp.partitions {
+		pp := tp.partitionProcessors[int32(partition)]
+		if pp == nil || !pp.isComplete() {
+			return false
+		}
+	}
+	return true
+}
+
+func (tp *TopicProcessor) onComplete() {
+	tp.logger.Info("All input partitions have been processed up to their stop offsets")
+	if tp.config.OnComplete != nil {
+		tp.config.OnComplete()
+	}
+}
@@ -0,0 +1,46 @@
+package kasper
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPartitionProcessor_runLoop_Bounded(t *testing.T) {
+	tp := &TopicProcessor{
+		config:               &Config{BatchSize: 1, BatchWaitDuration: time.Hour, StopAtOffsets: map[string]map[int]int64{"hello": {0: 3}}},
+		partitions:           []int{0},
+		close:                make(chan struct{}),
+		logger:               &noopLogger{},
+		incomingMessageCount: &noopMetric{},
+		outgoingMessageCount: &noopMetric{},
+	}
+	processed := make(chan *sarama.ConsumerMessage, 10)
+	pp, pc, pom := newReassignTestPartitionProcessor(tp, 0, processed)
+	pp.offsetBounds = map[string]*offsetBound{"hello": {end: 3, position: 1}}
+	tp.partitionProcessors = map[int32]*partitionProcessor{0: pp}
+	assert.False(t, tp.isComplete())
+
+	for offset := int64(1); offset <= 4; offset++ {
+		pc.messages <- &sarama.ConsumerMessage{Topic: "hello", Partition: 0, Offset: offset}
+	}
+	done := make(chan error)
+	go func() {
+		done <- pp.runLoop(make(chan struct{}))
+	}()
+	select {
+	case err := <-done:
+		assert.Nil(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("bounded partition loop did not stop")
+	}
+	assert.Len(t, processed, 2)
+	assert.Equal(t, int64(3), pom.offset)
+	assert.True(t, tp.isComplete())
+
+	// Messages at or after the stop offset are dropped
+	assert.Empty(t, pp.dropBeyondBounds([]*sarama.ConsumerMessage{{Topic: "hello", Offset: 3}}))
+	close(tp.close)
+}
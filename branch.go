@@ -0,0 +1,37 @@
+package kasper
+
+import (
+	"github.com/Shopify/sarama"
+)
+
+// BranchMode controls how many routes a message is sent to by Branch.
+type BranchMode int
+
+const (
+	// BranchFirstMatch sends a message to the topic of the first matching route only.
+	BranchFirstMatch BranchMode = iota
+	// BranchAllMatches sends a message to the topics of all matching routes.
+	BranchAllMatches
+)
+
+// Branch evaluates the routes' predicates on msg and forwards it unchanged (same key and value)
+// to the topics of the matching routes, according to mode. It returns the number of messages sent.
+// Branch is meant to be called from MessageProcessor.Process to implement fan-out patterns:
+//
+//	for _, msg := range messages {
+//		kasper.Branch(msg, sender, kasper.BranchAllMatches, routes...)
+//	}
+func Branch(msg *sarama.ConsumerMessage, sender Sender, mode BranchMode, routes ...Route) int {
+	sent := 0
+	for _, route := range routes {
+		if !route.Predicate(msg) {
+			continue
+		}
+		sender.Send(forward(msg, route.Topic))
+		sent++
+		if mode == BranchFirstMatch {
+			break
+		}
+	}
+	return sent
+}
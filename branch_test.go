@@ -0,0 +1,33 @@
+package kasper
+
+import (
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBranch(t *testing.T) {
+	routes := []Route{
+		{KeyPrefix([]byte("m")), "m-planets"},
+		{KeyPrefix([]byte("ma")), "ma-planets"},
+	}
+	msg := &sarama.ConsumerMessage{Key: []byte("mars"), Value: mars}
+
+	s := &bufferSender{}
+	assert.Equal(t, 1, Branch(msg, s, BranchFirstMatch, routes...))
+	assert.Equal(t, []*sarama.ProducerMessage{
+		{Topic: "m-planets", Key: sarama.ByteEncoder("mars"), Value: sarama.ByteEncoder(mars)},
+	}, s.messages)
+
+	s = &bufferSender{}
+	assert.Equal(t, 2, Branch(msg, s, BranchAllMatches, routes...))
+	assert.Equal(t, []*sarama.ProducerMessage{
+		{Topic: "m-planets", Key: sarama.ByteEncoder("mars"), Value: sarama.ByteEncoder(mars)},
+		{Topic: "ma-planets", Key: sarama.ByteEncoder("mars"), Value: sarama.ByteEncoder(mars)},
+	}, s.messages)
+
+	s = &bufferSender{}
+	assert.Equal(t, 0, Branch(&sarama.ConsumerMessage{Key: []byte("venus")}, s, BranchAllMatches, routes...))
+	assert.Empty(t, s.messages)
+}
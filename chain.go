@@ -0,0 +1,86 @@
+package kasper
+
+import (
+	"github.com/Shopify/sarama"
+)
+
+// ChainStage is a stage of a ChainProcessor. It receives the messages sent to Topic by the previous stage.
+type ChainStage struct {
+	Topic     string
+	Processor MessageProcessor
+}
+
+// ChainProcessor is a MessageProcessor that runs several processing stages in-process, handing the output of
+// each stage directly to the next one instead of producing it to an intermediate topic and consuming it again.
+// This saves a round trip to Kafka for simple pipelines.
+//
+// The intermediate topic must be co-partitioned with the input topics, i.e. each stage must key its messages
+// so that they would be produced to the same partition as the incoming messages. Handed-off messages keep the
+// partition of the incoming batch and have an offset of -1. Messages sent to any other topic are passed on to
+// the TopicProcessor's Sender. Calling Flush() from a stage has no effect.
+type ChainProcessor struct {
+	first  MessageProcessor
+	stages []ChainStage
+}
+
+// NewChainProcessor creates a ChainProcessor that passes incoming messages to first, then to the given stages.
+func NewChainProcessor(first MessageProcessor, stages ...ChainStage) *ChainProcessor {
+	return &ChainProcessor{first, stages}
+}
+
+// Process runs all stages on messages, one after the other.
+func (c *ChainProcessor) Process(messages []*sarama.ConsumerMessage, sender Sender) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	partition := messages[0].Partition
+	processor := c.first
+	for _, stage := range c.stages {
+		buffer := &bufferSender{ctx: ContextOf(sender), committer: CommitterOf(sender), flags: FlagsOf(sender)}
+		err := processor.Process(messages, buffer)
+		if err != nil {
+			return err
+		}
+		var next []*sarama.ConsumerMessage
+		for _, message := range buffer.messages {
+			if message.Topic != stage.Topic {
+				sender.Send(message)
+				continue
+			}
+			handoff, err := handOff(message, partition)
+			if err != nil {
+				return err
+			}
+			next = append(next, handoff)
+		}
+		if len(next) == 0 {
+			return nil
+		}
+		messages = next
+		processor = stage.Processor
+	}
+	return processor.Process(messages, sender)
+}
+
+func handOff(message *sarama.ProducerMessage, partition int32) (*sarama.ConsumerMessage, error) {
+	handoff := &sarama.ConsumerMessage{
+		Topic:     message.Topic,
+		Partition: partition,
+		Offset:    -1,
+		Timestamp: message.Timestamp,
+	}
+	var err error
+	if message.Key != nil {
+		handoff.Key, err = message.Key.Encode()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if message.Value != nil {
+		handoff.Value, err = message.Value.Encode()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return handoff, nil
+}
@@ -0,0 +1,52 @@
+package kasper
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+type upperCaseMessageProcessor struct {
+	topic string
+}
+
+func (p *upperCaseMessageProcessor) Process(messages []*sarama.ConsumerMessage, sender Sender) error {
+	for _, message := range messages {
+		sender.Send(&sarama.ProducerMessage{
+			Topic: p.topic,
+			Key:   sarama.ByteEncoder(message.Key),
+			Value: sarama.StringEncoder(strings.ToUpper(string(message.Value))),
+		})
+		sender.Send(&sarama.ProducerMessage{Topic: "audit", Key: sarama.ByteEncoder(message.Key)})
+	}
+	return nil
+}
+
+func TestChainProcessor_Process(t *testing.T) {
+	last := &recordingMessageProcessor{}
+	chain := NewChainProcessor(
+		&upperCaseMessageProcessor{"upper"},
+		ChainStage{"upper", &upperCaseMessageProcessor{"final"}},
+		ChainStage{"final", last},
+	)
+	sender := &bufferSender{}
+	err := chain.Process([]*sarama.ConsumerMessage{
+		{Topic: "words", Partition: 3, Offset: 10, Key: []byte("a"), Value: []byte("hello")},
+		{Topic: "words", Partition: 3, Offset: 11, Key: []byte("b"), Value: []byte("world")},
+	}, sender)
+	assert.Nil(t, err)
+
+	assert.Len(t, last.messages, 2)
+	assert.Equal(t, "final", last.messages[0].Topic)
+	assert.Equal(t, int32(3), last.messages[0].Partition)
+	assert.Equal(t, int64(-1), last.messages[0].Offset)
+	assert.Equal(t, []byte("b"), last.messages[1].Key)
+	assert.Equal(t, []byte("WORLD"), last.messages[1].Value)
+
+	assert.Len(t, sender.messages, 4)
+	for _, message := range sender.messages {
+		assert.Equal(t, "audit", message.Topic)
+	}
+}
@@ -0,0 +1,223 @@
+package kasper
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/Shopify/sarama"
+)
+
+// chunkMagic prefixes the values of chunks, followed by the chunk header:
+// a random 8-byte message ID, then the chunk index and the chunk count as uvarints.
+var chunkMagic = []byte{0, 'K', 'C'}
+
+const chunkIDLength = 8
+
+// ChunkMessage splits a message whose value is larger than maxSize bytes into chunks of at most maxSize bytes,
+// for pipelines whose messages occasionally exceed the max.message.bytes setting of the brokers.
+// Chunks have the key of the original message, so they are produced to the same partition, in order.
+// Messages small enough are returned as is. Use a ChunkAssembler to reassemble chunks.
+func ChunkMessage(msg *sarama.ProducerMessage, maxSize int) ([]*sarama.ProducerMessage, error) {
+	if msg.Value == nil || msg.Value.Length() <= maxSize {
+		return []*sarama.ProducerMessage{msg}, nil
+	}
+	headerSize := len(chunkMagic) + chunkIDLength + 2*binary.MaxVarintLen64
+	if maxSize <= headerSize {
+		return nil, fmt.Errorf("chunks must be larger than %d bytes (got %d bytes)", headerSize, maxSize)
+	}
+	value, err := msg.Value.Encode()
+	if err != nil {
+		return nil, err
+	}
+	id := make([]byte, chunkIDLength)
+	_, err = rand.Read(id)
+	if err != nil {
+		return nil, err
+	}
+	partSize := maxSize - headerSize
+	count := (len(value) + partSize - 1) / partSize
+	chunks := make([]*sarama.ProducerMessage, count)
+	for i := range chunks {
+		end := (i + 1) * partSize
+		if end > len(value) {
+			end = len(value)
+		}
+		header := make([]byte, 0, headerSize)
+		header = append(header, chunkMagic...)
+		header = append(header, id...)
+		header = appendUvarint(header, uint64(i))
+		header = appendUvarint(header, uint64(count))
+		chunk := *msg
+		chunk.Value = sarama.ByteEncoder(append(header, value[i*partSize:end]...))
+		chunks[i] = &chunk
+	}
+	return chunks, nil
+}
+
+func appendUvarint(b []byte, x uint64) []byte {
+	buf := make([]byte, binary.MaxVarintLen64)
+	return append(b, buf[:binary.PutUvarint(buf, x)]...)
+}
+
+var errInvalidChunk = errors.New("invalid chunk header")
+
+// ChunkAssembler reassembles the chunks produced by ChunkMessage. Chunks are kept in a Store until all chunks
+// of a message have been received, so that partially received messages survive restarts.
+type ChunkAssembler struct {
+	store Store
+}
+
+// NewChunkAssembler creates a ChunkAssembler keeping chunks in store.
+func NewChunkAssembler(store Store) *ChunkAssembler {
+	return &ChunkAssembler{store}
+}
+
+// Assemble returns message as is if it is not a chunk. Otherwise, it keeps the chunk and returns nil, unless
+// it is the last missing chunk of a message, in which case it returns a copy of message with the reassembled
+// value. Call Flush at the end of each batch.
+func (a *ChunkAssembler) Assemble(message *sarama.ConsumerMessage) (*sarama.ConsumerMessage, error) {
+	if IsTombstone(message) || !bytes.HasPrefix(message.Value, chunkMagic) {
+		return message, nil
+	}
+	id, index, count, part, err := parseChunk(message.Value)
+	if err != nil {
+		return nil, fmt.Errorf("message at offset %d of %s/%d: %s", message.Offset, message.Topic, message.Partition, err)
+	}
+	keys := make([]string, count)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("kasper-chunk/%s/%d", id, i)
+	}
+	err = a.store.Put(keys[index], part)
+	if err != nil {
+		return nil, err
+	}
+	parts, err := a.store.GetAll(keys)
+	if err != nil || len(parts) < len(keys) {
+		return nil, err
+	}
+	var value []byte
+	for _, key := range keys {
+		value = append(value, parts[key]...)
+		err = a.store.Delete(key)
+		if err != nil {
+			return nil, err
+		}
+	}
+	assembled := *message
+	assembled.Value = value
+	return &assembled, nil
+}
+
+func parseChunk(value []byte) (id string, index, count uint64, part []byte, err error) {
+	rest := value[len(chunkMagic):]
+	if len(rest) < chunkIDLength {
+		return "", 0, 0, nil, errInvalidChunk
+	}
+	id = hex.EncodeToString(rest[:chunkIDLength])
+	rest = rest[chunkIDLength:]
+	index, n := binary.Uvarint(rest)
+	if n <= 0 {
+		return "", 0, 0, nil, errInvalidChunk
+	}
+	rest = rest[n:]
+	count, n = binary.Uvarint(rest)
+	if n <= 0 || index >= count {
+		return "", 0, 0, nil, errInvalidChunk
+	}
+	return id, index, count, rest[n:], nil
+}
+
+// Flush flushes the underlying Store.
+func (a *ChunkAssembler) Flush() error {
+	return a.store.Flush()
+}
+
+// ChunkingProcessor is a MessageProcessor wrapper that reassembles chunked incoming messages before passing
+// them to the underlying MessageProcessor, and splits its oversized outgoing messages into chunks
+// (see ChunkMessage and ChunkAssembler). Incoming messages are passed once all their chunks have been received,
+// with the offset of their last chunk.
+type ChunkingProcessor struct {
+	messageProcessor MessageProcessor
+	assembler        *ChunkAssembler
+	maxSize          int
+}
+
+// NewChunkingProcessor creates a ChunkingProcessor wrapping messageProcessor, which keeps incoming chunks in store
+// and splits outgoing messages larger than maxSize bytes.
+func NewChunkingProcessor(messageProcessor MessageProcessor, store Store, maxSize int) *ChunkingProcessor {
+	return &ChunkingProcessor{messageProcessor, NewChunkAssembler(store), maxSize}
+}
+
+// Process reassembles a batch of messages and passes the complete ones to the underlying MessageProcessor.
+func (p *ChunkingProcessor) Process(messages []*sarama.ConsumerMessage, sender Sender) error {
+	assembled := make([]*sarama.ConsumerMessage, 0, len(messages))
+	for _, message := range messages {
+		message, err := p.assembler.Assemble(message)
+		if err != nil {
+			return err
+		}
+		if message != nil {
+			assembled = append(assembled, message)
+		}
+	}
+	if len(assembled) > 0 {
+		chunkingSender := &chunkingSender{sender: sender, maxSize: p.maxSize}
+		err := p.messageProcessor.Process(assembled, chunkingSender)
+		if err == nil {
+			err = chunkingSender.err
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return p.assembler.Flush()
+}
+
+// chunkingSender is a Sender that splits oversized messages into chunks before passing them to another Sender.
+// Messages that cannot be split are dropped; the first error is kept in err and returned by Flush.
+type chunkingSender struct {
+	sender  Sender
+	maxSize int
+	err     error
+}
+
+func (s *chunkingSender) Send(msg *sarama.ProducerMessage) {
+	chunks, err := ChunkMessage(msg, s.maxSize)
+	if err != nil {
+		if s.err == nil {
+			s.err = err
+		}
+		return
+	}
+	for _, chunk := range chunks {
+		s.sender.Send(chunk)
+	}
+}
+
+func (s *chunkingSender) Context() context.Context {
+	return ContextOf(s.sender)
+}
+
+func (s *chunkingSender) Committer() Committer {
+	return CommitterOf(s.sender)
+}
+
+func (s *chunkingSender) Flags() *Flags {
+	return FlagsOf(s.sender)
+}
+
+func (s *chunkingSender) SendTombstone(topic string, key sarama.Encoder) {
+	s.sender.SendTombstone(topic, key)
+}
+
+func (s *chunkingSender) Flush() error {
+	if s.err != nil {
+		return s.err
+	}
+	return s.sender.Flush()
+}
@@ -0,0 +1,89 @@
+package kasper
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+func chunksToConsumerMessages(chunks []*sarama.ProducerMessage) []*sarama.ConsumerMessage {
+	messages := make([]*sarama.ConsumerMessage, len(chunks))
+	for i, chunk := range chunks {
+		key, _ := chunk.Key.Encode()
+		value, _ := chunk.Value.Encode()
+		messages[i] = &sarama.ConsumerMessage{Topic: chunk.Topic, Key: key, Value: value, Offset: int64(i)}
+	}
+	return messages
+}
+
+func TestChunkMessage(t *testing.T) {
+	value := bytes.Repeat(finFangFoom, 20)
+	chunks, err := ChunkMessage(&sarama.ProducerMessage{Topic: "dragons", Key: sarama.StringEncoder("foom"), Value: sarama.ByteEncoder(value)}, 100)
+	assert.Nil(t, err)
+	assert.Len(t, chunks, 13)
+	for _, chunk := range chunks {
+		assert.True(t, chunk.Value.Length() <= 100)
+	}
+
+	// Chunks are reassembled in any order, once all of them have been received
+	assembler := NewChunkAssembler(NewMap(10))
+	messages := chunksToConsumerMessages(chunks)
+	messages[0], messages[12] = messages[12], messages[0]
+	for _, message := range messages[:12] {
+		assembled, err := assembler.Assemble(message)
+		assert.Nil(t, err)
+		assert.Nil(t, assembled)
+	}
+	assembled, err := assembler.Assemble(messages[12])
+	assert.Nil(t, err)
+	assert.Equal(t, value, assembled.Value)
+	assert.Equal(t, []byte("foom"), assembled.Key)
+	assert.Equal(t, int64(0), assembled.Offset)
+	assert.Len(t, assembler.store.(*Map).GetMap(), 0)
+
+	// Small messages are not chunked
+	msg := &sarama.ProducerMessage{Topic: "dragons", Value: sarama.ByteEncoder(mushu)}
+	chunks, err = ChunkMessage(msg, 100)
+	assert.Nil(t, err)
+	assert.Equal(t, []*sarama.ProducerMessage{msg}, chunks)
+	_, err = ChunkMessage(&sarama.ProducerMessage{Value: sarama.ByteEncoder(value)}, 10)
+	assert.NotNil(t, err)
+}
+
+func TestChunkAssembler_Assemble_Invalid(t *testing.T) {
+	assembler := NewChunkAssembler(NewMap(10))
+	message := &sarama.ConsumerMessage{Value: mushu}
+	assembled, err := assembler.Assemble(message)
+	assert.Nil(t, err)
+	assert.Equal(t, message, assembled)
+	_, err = assembler.Assemble(&sarama.ConsumerMessage{Topic: "dragons", Value: append(chunkMagic, 1, 2)})
+	assert.EqualError(t, err, "message at offset 0 of dragons/0: invalid chunk header")
+}
+
+func TestChunkingProcessor_Process(t *testing.T) {
+	value := bytes.Repeat(saphira, 10)
+	chunks, _ := ChunkMessage(&sarama.ProducerMessage{Topic: "dragons", Key: sarama.StringEncoder("saphira"), Value: sarama.ByteEncoder(value)}, 100)
+	messages := chunksToConsumerMessages(chunks)
+	p := NewChunkingProcessor(NewRouterProcessor("eggs"), NewMap(10), 200)
+	sender := &bufferSender{}
+	assert.Nil(t, p.Process(messages[:2], sender))
+	assert.Len(t, sender.messages, 0)
+	assert.Nil(t, p.Process(append(messages[2:], &sarama.ConsumerMessage{Key: []byte("mushu"), Value: mushu}), sender))
+
+	// Outgoing messages are chunked again, with the larger size
+	assert.Len(t, sender.messages, 4)
+	assembler := NewChunkAssembler(NewMap(10))
+	var assembled []*sarama.ConsumerMessage
+	for _, message := range chunksToConsumerMessages(sender.messages) {
+		message, err := assembler.Assemble(message)
+		assert.Nil(t, err)
+		if message != nil {
+			assembled = append(assembled, message)
+		}
+	}
+	assert.Len(t, assembled, 2)
+	assert.Equal(t, value, assembled[0].Value)
+	assert.Equal(t, mushu, assembled[1].Value)
+}
@@ -0,0 +1,90 @@
+package kasper
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned by CircuitBreaker.Call while the circuit is open.
+// When MessageProcessor.Process returns ErrCircuitOpen, Kasper does not stop processing: it pauses the partition
+// and processes the same batch again after Config.CircuitBreakerRetryInterval, until Process succeeds or fails
+// with a different error. With the default shared run loop, all partitions are paused; set
+// Config.IndependentPartitionLoops to only pause the affected partition.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitBreaker protects calls to an external dependency (database, web service, etc.).
+// After FailureThreshold consecutive failures the circuit opens and calls fail fast with ErrCircuitOpen.
+// Once OpenDuration has elapsed, a single probe call is let through (half-open state):
+// the circuit closes again if it succeeds, and re-opens if it fails.
+// CircuitBreaker is safe for concurrent use.
+type CircuitBreaker struct {
+	failureThreshold int
+	openDuration     time.Duration
+	now              func() time.Time
+
+	mutex     sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+// NewCircuitBreaker creates a closed CircuitBreaker.
+func NewCircuitBreaker(failureThreshold int, openDuration time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		failureThreshold: failureThreshold,
+		openDuration:     openDuration,
+		now:              time.Now,
+	}
+}
+
+// SetClock sets the Clock used to time the open state, e.g. a FakeClock in tests.
+// It must be called before the CircuitBreaker is used.
+func (cb *CircuitBreaker) SetClock(clock Clock) {
+	cb.now = clock.Now
+}
+
+// Call invokes fn unless the circuit is open, and records its outcome.
+// It returns ErrCircuitOpen without invoking fn while the circuit is open.
+func (cb *CircuitBreaker) Call(fn func() error) error {
+	if !cb.allow() {
+		return ErrCircuitOpen
+	}
+	err := fn()
+	cb.record(err)
+	return err
+}
+
+// IsOpen returns true if calls are currently rejected.
+func (cb *CircuitBreaker) IsOpen() bool {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+	return cb.failures >= cb.failureThreshold && (cb.probing || cb.now().Before(cb.openUntil))
+}
+
+func (cb *CircuitBreaker) allow() bool {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+	if cb.failures < cb.failureThreshold {
+		return true
+	}
+	if cb.probing || cb.now().Before(cb.openUntil) {
+		return false
+	}
+	cb.probing = true
+	return true
+}
+
+func (cb *CircuitBreaker) record(err error) {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+	cb.probing = false
+	if err == nil {
+		cb.failures = 0
+		return
+	}
+	cb.failures++
+	if cb.failures >= cb.failureThreshold {
+		cb.openUntil = cb.now().Add(cb.openDuration)
+	}
+}
@@ -0,0 +1,69 @@
+package kasper
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCircuitBreaker_Call(t *testing.T) {
+	cb := NewCircuitBreaker(2, time.Minute)
+	now := time.Unix(1000, 0)
+	cb.now = func() time.Time { return now }
+	failure := errors.New("database unavailable")
+	calls := 0
+	fail := func() error { calls++; return failure }
+	succeed := func() error { calls++; return nil }
+
+	assert.Equal(t, failure, cb.Call(fail))
+	assert.False(t, cb.IsOpen())
+	assert.Equal(t, failure, cb.Call(fail))
+	assert.True(t, cb.IsOpen())
+	assert.Equal(t, ErrCircuitOpen, cb.Call(succeed))
+	assert.Equal(t, 2, calls)
+
+	// Half-open probe fails: the circuit opens again
+	now = now.Add(time.Minute)
+	assert.Equal(t, failure, cb.Call(fail))
+	assert.Equal(t, ErrCircuitOpen, cb.Call(succeed))
+	assert.Equal(t, 3, calls)
+
+	// Half-open probe succeeds: the circuit closes
+	now = now.Add(time.Minute)
+	assert.Nil(t, cb.Call(succeed))
+	assert.False(t, cb.IsOpen())
+	assert.Nil(t, cb.Call(succeed))
+	assert.Equal(t, 5, calls)
+}
+
+type circuitBreakerMessageProcessor struct {
+	breaker *CircuitBreaker
+	calls   int
+}
+
+func (p *circuitBreakerMessageProcessor) Process(messages []*sarama.ConsumerMessage, sender Sender) error {
+	return p.breaker.Call(func() error {
+		p.calls++
+		if p.calls == 1 {
+			return errors.New("database unavailable")
+		}
+		return nil
+	})
+}
+
+func TestTopicProcessor_CircuitBreakerPause(t *testing.T) {
+	tp, pom := newProcessingGuaranteeTopicProcessor(ProcessingGuaranteeAtLeastOnce)
+	tp.config.CircuitBreakerRetryInterval = time.Millisecond
+	tp.close = make(chan struct{})
+	mp := &circuitBreakerMessageProcessor{breaker: NewCircuitBreaker(1, 5*time.Millisecond)}
+	tp.partitionProcessors[0].messageProcessor = mp
+	messages := []*sarama.ConsumerMessage{{Topic: "hello", Offset: 41}}
+
+	assert.NotNil(t, tp.processConsumerMessages(messages, 0))
+	assert.Nil(t, tp.processConsumerMessages(messages, 0))
+	assert.Equal(t, 2, mp.calls)
+	assert.Equal(t, int64(42), pom.offset)
+}
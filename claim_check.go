@@ -0,0 +1,134 @@
+package kasper
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/Shopify/sarama"
+)
+
+// claimCheckMagic prefixes the values of messages whose payload has been offloaded by ClaimCheck,
+// followed by the key of the payload in the BlobStore.
+var claimCheckMagic = []byte{0, 'K', 'R'}
+
+// BlobStore stores large payloads outside Kafka, e.g. in S3 or GCS, see ClaimCheck.
+type BlobStore interface {
+	// Put stores data under key. Writing the same key twice must be harmless.
+	Put(key string, data []byte) error
+	// Get returns the data stored under key.
+	Get(key string) ([]byte, error)
+}
+
+type directoryBlobStore struct {
+	directory string
+}
+
+// NewDirectoryBlobStore returns a BlobStore storing payloads as files of a local or mounted directory.
+func NewDirectoryBlobStore(directory string) BlobStore {
+	return &directoryBlobStore{directory}
+}
+
+func (s *directoryBlobStore) Put(key string, data []byte) error {
+	path := filepath.Join(s.directory, key)
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	tmp, err := ioutil.TempFile(s.directory, key+".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+func (s *directoryBlobStore) Get(key string) ([]byte, error) {
+	return ioutil.ReadFile(filepath.Join(s.directory, key))
+}
+
+var errInvalidClaimCheck = errors.New("invalid claim check reference")
+
+// ClaimCheck implements the claim-check pattern: values larger than a threshold are written to a BlobStore
+// and replaced by a reference, which is resolved back into the value on the consuming side.
+// Payloads are stored under the hex-encoded SHA-256 of their content, so retries and duplicates
+// do not store the same payload twice. Payloads are never deleted by Kasper.
+type ClaimCheck struct {
+	blobs     BlobStore
+	threshold int
+}
+
+// NewClaimCheck creates a ClaimCheck offloading values larger than threshold bytes to blobs.
+func NewClaimCheck(blobs BlobStore, threshold int) *ClaimCheck {
+	return &ClaimCheck{blobs, threshold}
+}
+
+// Offload stores value in the BlobStore and returns a reference to it if value is larger than the threshold.
+// Smaller values are returned as is.
+func (c *ClaimCheck) Offload(value []byte) ([]byte, error) {
+	if len(value) <= c.threshold {
+		return value, nil
+	}
+	hash := sha256.Sum256(value)
+	key := hex.EncodeToString(hash[:])
+	err := c.blobs.Put(key, value)
+	if err != nil {
+		return nil, err
+	}
+	return append(append([]byte{}, claimCheckMagic...), key...), nil
+}
+
+// Resolve returns the value referenced by a reference returned by Offload. Other values are returned as is.
+func (c *ClaimCheck) Resolve(value []byte) ([]byte, error) {
+	if !bytes.HasPrefix(value, claimCheckMagic) {
+		return value, nil
+	}
+	key := string(value[len(claimCheckMagic):])
+	if len(key) != 2*sha256.Size {
+		return nil, errInvalidClaimCheck
+	}
+	return c.blobs.Get(key)
+}
+
+// ClaimCheckProcessor is a MessageProcessor that resolves the offloaded values of incoming messages before passing
+// them to an underlying MessageProcessor, and offloads the large values of the messages it sends (see ClaimCheck).
+// Keys and tombstones are never offloaded.
+type ClaimCheckProcessor struct {
+	messageProcessor MessageProcessor
+	claimCheck       *ClaimCheck
+}
+
+// NewClaimCheckProcessor creates a ClaimCheckProcessor wrapping messageProcessor.
+func NewClaimCheckProcessor(messageProcessor MessageProcessor, claimCheck *ClaimCheck) *ClaimCheckProcessor {
+	return &ClaimCheckProcessor{messageProcessor, claimCheck}
+}
+
+// Process resolves a batch of messages and passes it to the underlying MessageProcessor.
+func (p *ClaimCheckProcessor) Process(messages []*sarama.ConsumerMessage, sender Sender) error {
+	resolved, err := transformIncomingValues(messages, "resolve", p.claimCheck.Resolve)
+	if err != nil {
+		return err
+	}
+	offloadingSender := &transformingSender{sender: sender, transform: p.offload}
+	err = p.messageProcessor.Process(resolved, offloadingSender)
+	if err != nil {
+		return err
+	}
+	return offloadingSender.err
+}
+
+func (p *ClaimCheckProcessor) offload(msg *sarama.ProducerMessage, value []byte) ([]byte, error) {
+	return p.claimCheck.Offload(value)
+}
@@ -0,0 +1,60 @@
+package kasper
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClaimCheck(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kasper-claim-check")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	claimCheck := NewClaimCheck(NewDirectoryBlobStore(dir), 100)
+	value := bytes.Repeat(vorgansharax, 10)
+
+	reference, err := claimCheck.Offload(value)
+	assert.Nil(t, err)
+	assert.True(t, len(reference) < 100)
+	again, err := claimCheck.Offload(value)
+	assert.Nil(t, err)
+	assert.Equal(t, reference, again)
+	files, _ := ioutil.ReadDir(dir)
+	assert.Len(t, files, 1)
+	resolved, err := claimCheck.Resolve(reference)
+	assert.Nil(t, err)
+	assert.Equal(t, value, resolved)
+
+	// Small values are neither offloaded nor resolved
+	small, err := claimCheck.Offload(mushu)
+	assert.Nil(t, err)
+	assert.Equal(t, mushu, small)
+	resolved, err = claimCheck.Resolve(mushu)
+	assert.Nil(t, err)
+	assert.Equal(t, mushu, resolved)
+
+	_, err = claimCheck.Resolve(append(claimCheckMagic, "../etc/passwd"...))
+	assert.Equal(t, errInvalidClaimCheck, err)
+}
+
+func TestClaimCheckProcessor_Process(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kasper-claim-check")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	claimCheck := NewClaimCheck(NewDirectoryBlobStore(dir), 100)
+	value := bytes.Repeat(falkor, 10)
+	reference, _ := claimCheck.Offload(value)
+
+	p := NewClaimCheckProcessor(NewRouterProcessor("dragons"), claimCheck)
+	sender := &bufferSender{}
+	assert.Nil(t, p.Process([]*sarama.ConsumerMessage{{Value: reference}, {Value: saphira}}, sender))
+	assert.Len(t, sender.messages, 2)
+	outgoing, _ := sender.messages[0].Value.Encode()
+	assert.Equal(t, reference, outgoing)
+	outgoing, _ = sender.messages[1].Value.Encode()
+	assert.Equal(t, saphira, outgoing)
+}
@@ -0,0 +1,163 @@
+package kasper
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is the source of time of a TopicProcessor: batch and metrics tickers, retry backoffs, restart windows,
+// throttling and event timestamps all go through it. Tests can set Config.Clock to a FakeClock to control time.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+	Sleep(d time.Duration)
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker delivers ticks at intervals, like time.Ticker.
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// SystemClock is the Clock of the time package, used by default.
+type SystemClock struct{}
+
+// Now returns time.Now().
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+// After returns time.After(d).
+func (SystemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// Sleep calls time.Sleep(d).
+func (SystemClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+// NewTicker returns a Ticker backed by time.NewTicker(d).
+func (SystemClock) NewTicker(d time.Duration) Ticker {
+	return &systemTicker{time.NewTicker(d)}
+}
+
+type systemTicker struct {
+	ticker *time.Ticker
+}
+
+func (t *systemTicker) C() <-chan time.Time {
+	return t.ticker.C
+}
+
+func (t *systemTicker) Stop() {
+	t.ticker.Stop()
+}
+
+func (config *Config) clock() Clock {
+	if config.Clock == nil {
+		return SystemClock{}
+	}
+	return config.Clock
+}
+
+// FakeClock is a Clock for deterministic tests, whose time only moves forward when Advance is called.
+// Timers and tickers fire synchronously within Advance. As with time.Ticker, ticks are dropped for slow receivers.
+type FakeClock struct {
+	mutex   sync.Mutex
+	now     time.Time
+	waiters []*fakeClockWaiter
+}
+
+type fakeClockWaiter struct {
+	clock  *FakeClock
+	at     time.Time
+	period time.Duration
+	c      chan time.Time
+}
+
+// NewFakeClock creates a FakeClock set to now.
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+// Now returns the current time of the clock.
+func (c *FakeClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+// After returns a channel receiving the time once the clock has been advanced by d.
+func (c *FakeClock) After(d time.Duration) <-chan time.Time {
+	return c.addWaiter(d, 0).c
+}
+
+// Sleep blocks until another goroutine has advanced the clock by d.
+func (c *FakeClock) Sleep(d time.Duration) {
+	<-c.After(d)
+}
+
+// NewTicker returns a Ticker ticking each time the clock is advanced past a multiple of d.
+func (c *FakeClock) NewTicker(d time.Duration) Ticker {
+	return c.addWaiter(d, d)
+}
+
+// Waiters returns the number of pending timers and tickers, e.g. to wait until a goroutine sleeps before advancing.
+func (c *FakeClock) Waiters() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.waiters)
+}
+
+func (c *FakeClock) addWaiter(d, period time.Duration) *fakeClockWaiter {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	w := &fakeClockWaiter{c, c.now.Add(d), period, make(chan time.Time, 1)}
+	if d <= 0 && period == 0 {
+		w.c <- c.now
+		return w
+	}
+	c.waiters = append(c.waiters, w)
+	return w
+}
+
+// Advance moves the clock forward by d and fires the timers and tickers that are due.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.now = c.now.Add(d)
+	waiters := c.waiters[:0]
+	for _, w := range c.waiters {
+		for !w.at.After(c.now) {
+			select {
+			case w.c <- w.at:
+			default:
+			}
+			if w.period == 0 {
+				break
+			}
+			w.at = w.at.Add(w.period)
+		}
+		if w.period > 0 || w.at.After(c.now) {
+			waiters = append(waiters, w)
+		}
+	}
+	c.waiters = waiters
+}
+
+func (w *fakeClockWaiter) C() <-chan time.Time {
+	return w.c
+}
+
+func (w *fakeClockWaiter) Stop() {
+	w.clock.mutex.Lock()
+	defer w.clock.mutex.Unlock()
+	for i, waiter := range w.clock.waiters {
+		if waiter == w {
+			w.clock.waiters = append(w.clock.waiters[:i], w.clock.waiters[i+1:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package kasper
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2017, 4, 1, 12, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+	ticker := clock.NewTicker(time.Second)
+	after := clock.After(1500 * time.Millisecond)
+	assert.Equal(t, 2, clock.Waiters())
+
+	clock.Advance(time.Second)
+	assert.Equal(t, start.Add(time.Second), <-ticker.C())
+	assert.Len(t, after, 0)
+
+	// Ticks are dropped for slow receivers
+	clock.Advance(2 * time.Second)
+	assert.Equal(t, start.Add(2*time.Second), <-ticker.C())
+	assert.Len(t, ticker.C(), 0)
+	assert.Equal(t, start.Add(1500*time.Millisecond), <-after)
+	assert.Equal(t, 1, clock.Waiters())
+
+	ticker.Stop()
+	assert.Equal(t, 0, clock.Waiters())
+	assert.Equal(t, start.Add(3*time.Second), clock.Now())
+}
+
+func TestTopicProcessor_FakeClock(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	var events []Event
+	config := &Config{
+		TopicProcessorName:   "clock",
+		Clock:                clock,
+		EventListener:        func(event Event) { events = append(events, event) },
+		MaxMessagesPerSecond: 1,
+	}
+	tp := &TopicProcessor{config: config, logger: &noopLogger{}, close: make(chan struct{}), settings: newRuntimeSettings(config)}
+
+	config.emitEvent(Event{Type: EventPartitionRestarted})
+	assert.Equal(t, time.Unix(0, 0), events[0].Time)
+
+	throttled := make(chan bool)
+	go func() { throttled <- tp.throttle(2) }()
+	for clock.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	clock.Advance(time.Second)
+	assert.True(t, <-throttled)
+}
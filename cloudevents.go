@@ -0,0 +1,101 @@
+package kasper
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// CloudEventsSpecVersion is the version of the CloudEvents specification supported by Kasper.
+const CloudEventsSpecVersion = "1.0"
+
+// CloudEvent is an event in the CloudEvents format, for interoperability with eventing platforms.
+//
+// Only the structured content mode of the Kafka protocol binding is supported, where the whole event is
+// encoded as a JSON message value: the binary content mode maps attributes to Kafka record headers,
+// which the vendored sarama client does not support.
+type CloudEvent struct {
+	SpecVersion     string            `json:"specversion"`
+	ID              string            `json:"id"`
+	Source          string            `json:"source"`
+	Type            string            `json:"type"`
+	Subject         string            `json:"subject,omitempty"`
+	Time            *time.Time        `json:"time,omitempty"`
+	DataContentType string            `json:"datacontenttype,omitempty"`
+	DataSchema      string            `json:"dataschema,omitempty"`
+	Data            json.RawMessage   `json:"data,omitempty"`
+	DataBase64      []byte            `json:"data_base64,omitempty"`
+	Extensions      map[string]string `json:"-"`
+}
+
+var cloudEventAttributes = map[string]bool{
+	"specversion": true, "id": true, "source": true, "type": true, "subject": true, "time": true,
+	"datacontenttype": true, "dataschema": true, "data": true, "data_base64": true,
+}
+
+// ParseCloudEvent decodes a CloudEvent in structured JSON mode from the value of an incoming message.
+// Extension attributes with string values are kept in Extensions.
+func ParseCloudEvent(message *sarama.ConsumerMessage) (*CloudEvent, error) {
+	var event CloudEvent
+	err := json.Unmarshal(message.Value, &event)
+	if err != nil {
+		return nil, err
+	}
+	if event.SpecVersion != CloudEventsSpecVersion || event.ID == "" || event.Source == "" || event.Type == "" {
+		return nil, fmt.Errorf("message at offset %d of %s/%d is not a CloudEvent %s", message.Offset, message.Topic, message.Partition, CloudEventsSpecVersion)
+	}
+	var attributes map[string]interface{}
+	err = json.Unmarshal(message.Value, &attributes)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range attributes {
+		if s, ok := value.(string); ok && !cloudEventAttributes[name] {
+			if event.Extensions == nil {
+				event.Extensions = make(map[string]string)
+			}
+			event.Extensions[name] = s
+		}
+	}
+	return &event, nil
+}
+
+// NewCloudEventMessage encodes event in structured JSON mode as a message to topic.
+// SpecVersion defaults to CloudEventsSpecVersion, and the message timestamp is the event time, if set.
+func NewCloudEventMessage(topic string, key sarama.Encoder, event *CloudEvent) (*sarama.ProducerMessage, error) {
+	attributes := make(map[string]interface{}, len(event.Extensions)+10)
+	for name, value := range event.Extensions {
+		attributes[name] = value
+	}
+	standardEvent := *event
+	if standardEvent.SpecVersion == "" {
+		standardEvent.SpecVersion = CloudEventsSpecVersion
+	}
+	encoded, err := json.Marshal(&standardEvent)
+	if err != nil {
+		return nil, err
+	}
+	var standard map[string]json.RawMessage
+	err = json.Unmarshal(encoded, &standard)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range standard {
+		attributes[name] = value
+	}
+	value, err := json.Marshal(attributes)
+	if err != nil {
+		return nil, err
+	}
+	msg := &sarama.ProducerMessage{
+		Topic: topic,
+		Key:   key,
+		Value: sarama.ByteEncoder(value),
+	}
+	if event.Time != nil {
+		msg.Timestamp = *event.Time
+	}
+	return msg, nil
+}
@@ -0,0 +1,41 @@
+package kasper
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCloudEvent_RoundTrip(t *testing.T) {
+	eventTime := time.Date(2017, 5, 1, 12, 0, 0, 0, time.UTC)
+	msg, err := NewCloudEventMessage("events", sarama.StringEncoder("order-1"), &CloudEvent{
+		ID:              "1",
+		Source:          "/orders",
+		Type:            "order.created",
+		Time:            &eventTime,
+		DataContentType: "application/json",
+		Data:            json.RawMessage(`{"total":10}`),
+		Extensions:      map[string]string{"tenant": "acme"},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, eventTime, msg.Timestamp)
+	value, _ := msg.Value.Encode()
+
+	event, err := ParseCloudEvent(&sarama.ConsumerMessage{Value: value})
+	assert.Nil(t, err)
+	assert.Equal(t, CloudEventsSpecVersion, event.SpecVersion)
+	assert.Equal(t, "order.created", event.Type)
+	assert.True(t, eventTime.Equal(*event.Time))
+	assert.Equal(t, json.RawMessage(`{"total":10}`), event.Data)
+	assert.Equal(t, map[string]string{"tenant": "acme"}, event.Extensions)
+}
+
+func TestParseCloudEvent_Invalid(t *testing.T) {
+	_, err := ParseCloudEvent(&sarama.ConsumerMessage{Value: []byte(`{"specversion":"1.0","id":"1"}`)})
+	assert.NotNil(t, err)
+	_, err = ParseCloudEvent(&sarama.ConsumerMessage{Value: []byte(`not json`)})
+	assert.NotNil(t, err)
+}
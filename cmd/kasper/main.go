@@ -0,0 +1,163 @@
+// Command kasper provides operational tools for Kasper deployments.
+//
+// Usage:
+//
+//	kasper validate [-brokers host:port,...] topology.json
+//	kasper describe [-format dot|mermaid] topology.json
+//	kasper plan -containers n [-lag-target duration] [-tolerance fraction] loads.json
+//
+// validate checks a topology declared as JSON (see kasper.Topology) and exits with status 1 if problems
+// are found. With -brokers, topics are also checked against the live cluster.
+//
+// describe prints a graph of a topology in the GraphViz DOT (default) or Mermaid format.
+//
+// plan proposes a balanced assignment of partitions to n containers (see kasper.ReassignmentPlanner).
+// loads.json holds the current assignment and the load of each partition:
+//
+//	{"current": {"0": 0, "1": 0}, "loads": [{"partition": 0, "lag": 1200, "throughput": 35.5}, ...]}
+//
+// The assignment and the moved partitions are printed as JSON.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/movio/kasper"
+)
+
+const usage = `usage:
+  kasper validate [-brokers host:port,...] topology.json
+  kasper describe [-format dot|mermaid] topology.json
+  kasper plan -containers n [-lag-target duration] [-tolerance fraction] loads.json`
+
+func main() {
+	if len(os.Args) < 2 {
+		exitWithUsage()
+	}
+	switch os.Args[1] {
+	case "validate":
+		runValidate(os.Args[2:])
+	case "describe":
+		runDescribe(os.Args[2:])
+	case "plan":
+		runPlan(os.Args[2:])
+	default:
+		exitWithUsage()
+	}
+}
+
+func exitWithUsage() {
+	fmt.Fprintln(os.Stderr, usage)
+	os.Exit(2)
+}
+
+func exitWithError(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(2)
+}
+
+func runValidate(args []string) {
+	flags := flag.NewFlagSet("validate", flag.ExitOnError)
+	brokers := flags.String("brokers", "", "comma-separated Kafka brokers to validate the topology against")
+	_ = flags.Parse(args)
+	if flags.NArg() != 1 {
+		exitWithUsage()
+	}
+	topology, err := loadTopology(flags.Arg(0))
+	if err != nil {
+		exitWithError(err)
+	}
+	problems, err := validate(topology, *brokers)
+	if err != nil {
+		exitWithError(err)
+	}
+	for _, problem := range problems {
+		fmt.Println(problem)
+	}
+	if len(problems) > 0 {
+		os.Exit(1)
+	}
+	fmt.Println("Topology is valid")
+}
+
+func runDescribe(args []string) {
+	flags := flag.NewFlagSet("describe", flag.ExitOnError)
+	format := flags.String("format", "dot", "graph format: dot or mermaid")
+	_ = flags.Parse(args)
+	if flags.NArg() != 1 {
+		exitWithUsage()
+	}
+	topology, err := loadTopology(flags.Arg(0))
+	if err != nil {
+		exitWithError(err)
+	}
+	switch *format {
+	case "dot":
+		fmt.Print(topology.Describe(kasper.DiagramFormatDOT))
+	case "mermaid":
+		fmt.Print(topology.Describe(kasper.DiagramFormatMermaid))
+	default:
+		exitWithUsage()
+	}
+}
+
+func runPlan(args []string) {
+	flags := flag.NewFlagSet("plan", flag.ExitOnError)
+	containers := flags.Int("containers", 0, "number of containers")
+	planner := &kasper.ReassignmentPlanner{}
+	flags.DurationVar(&planner.LagTarget, "lag-target", time.Minute, "time within which lag should be consumed")
+	flags.Float64Var(&planner.Tolerance, "tolerance", 0.1, "minimum load reduction for a move, as a fraction of the average load")
+	_ = flags.Parse(args)
+	if flags.NArg() != 1 || *containers <= 0 {
+		exitWithUsage()
+	}
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		exitWithError(err)
+	}
+	defer file.Close()
+	var input struct {
+		Current kasper.PartitionToContainerID `json:"current"`
+		Loads   []kasper.PartitionLoad        `json:"loads"`
+	}
+	err = json.NewDecoder(file).Decode(&input)
+	if err != nil {
+		exitWithError(err)
+	}
+	plan := planner.Plan(input.Current, input.Loads, *containers)
+	output, err := json.MarshalIndent(map[string]interface{}{
+		"assignment": plan,
+		"moves":      plan.Moves(input.Current),
+	}, "", "  ")
+	if err != nil {
+		exitWithError(err)
+	}
+	fmt.Println(string(output))
+}
+
+func loadTopology(path string) (*kasper.Topology, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return kasper.LoadTopology(file)
+}
+
+func validate(topology *kasper.Topology, brokers string) ([]string, error) {
+	if brokers == "" {
+		return topology.Validate(), nil
+	}
+	client, err := sarama.NewClient(strings.Split(brokers, ","), sarama.NewConfig())
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+	return kasper.NewAdmin(client).ValidateTopology(topology)
+}
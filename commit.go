@@ -0,0 +1,135 @@
+package kasper
+
+import (
+	"sync"
+
+	"github.com/Shopify/sarama"
+)
+
+// Committer gives asynchronous MessageProcessors control over which offsets are safe to commit.
+// When Config.ManualCommit is set, the Sender given to MessageProcessor.Process implements Committer:
+//
+//	committer := kasper.CommitterOf(sender)
+//	token := committer.CommitToken(msg)
+//	go func() {
+//		// process msg asynchronously
+//		token.Ack()
+//	}()
+//
+// Kasper keeps track of acknowledged messages and only commits the contiguous low watermark,
+// i.e. the offset of the oldest message which hasn't been acknowledged yet.
+type Committer interface {
+	// CommitToken returns the token of an incoming message. The token can be held between calls to Process.
+	CommitToken(msg *sarama.ConsumerMessage) *CommitToken
+	// CommitUpTo acknowledges all incoming messages of the given topic up to and including offset.
+	CommitUpTo(topic string, offset int64)
+}
+
+// CommitterSource is implemented by Senders wrapping the Sender given to MessageProcessor.Process,
+// so that the MessageProcessors they are given can still reach its Committer.
+type CommitterSource interface {
+	Committer() Committer
+}
+
+// CommitterOf returns the Committer of the current Process call, or nil if sender doesn't provide one.
+func CommitterOf(sender Sender) Committer {
+	if source, ok := sender.(CommitterSource); ok {
+		return source.Committer()
+	}
+	committer, _ := sender.(Committer)
+	return committer
+}
+
+// CommitToken acknowledges a single incoming message. It is safe for concurrent use.
+type CommitToken struct {
+	tracker *offsetTracker
+	offset  int64
+}
+
+// Ack marks the message as processed. Its offset is committed once all older messages have been acknowledged.
+func (token *CommitToken) Ack() {
+	token.tracker.ack(token.offset)
+}
+
+type offsetTracker struct {
+	mutex   sync.Mutex
+	pom     sarama.PartitionOffsetManager
+	pending []int64
+	acked   map[int64]bool
+	topic   string
+	barrier *commitBarrier
+	fence   func() error
+}
+
+func newOffsetTracker(pom sarama.PartitionOffsetManager) *offsetTracker {
+	return &offsetTracker{
+		pom:   pom,
+		acked: make(map[int64]bool),
+	}
+}
+
+func (t *offsetTracker) track(offset int64) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.pending = append(t.pending, offset)
+}
+
+func (t *offsetTracker) ack(offset int64) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.acked[offset] = true
+	t.advance()
+}
+
+func (t *offsetTracker) ackUpTo(offset int64) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for _, pending := range t.pending {
+		if pending > offset {
+			break
+		}
+		t.acked[pending] = true
+	}
+	t.advance()
+}
+
+func (t *offsetTracker) advance() {
+	i := 0
+	for i < len(t.pending) && t.acked[t.pending[i]] {
+		i++
+	}
+	if i == 0 {
+		return
+	}
+	if t.fence != nil && t.fence() != nil {
+		return
+	}
+	for _, offset := range t.pending[:i] {
+		delete(t.acked, offset)
+	}
+	if t.barrier != nil {
+		t.barrier.advance(t.topic, t.pending[i-1]+1)
+	} else {
+		t.pom.MarkOffset(t.pending[i-1]+1, "")
+	}
+	t.pending = t.pending[i:]
+}
+
+func (pp *partitionProcessor) trackOffsets(messages []*sarama.ConsumerMessage) {
+	if len(messages) > 0 {
+		if barrier := pp.offsetTrackers[messages[0].Topic].barrier; barrier != nil {
+			barrier.addBatch(messages)
+		}
+	}
+	for _, message := range messages {
+		pp.offsetTrackers[message.Topic].track(message.Offset)
+	}
+}
+
+func (sender *sender) CommitToken(msg *sarama.ConsumerMessage) *CommitToken {
+	return &CommitToken{sender.pp.offsetTrackers[msg.Topic], msg.Offset}
+}
+
+func (sender *sender) CommitUpTo(topic string, offset int64) {
+	sender.pp.offsetTrackers[topic].ackUpTo(offset)
+}
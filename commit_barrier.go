@@ -0,0 +1,70 @@
+package kasper
+
+import (
+	"sync"
+
+	"github.com/Shopify/sarama"
+)
+
+// commitBarrier holds back the offsets of the input topics of a partition until every message of the batches
+// they were received in has been acknowledged, across all topics (see Config.CommitBarrier). Otherwise, when
+// several input topics are joined, a crash could leave one topic committed past messages whose counterparts in
+// another topic were never processed.
+type commitBarrier struct {
+	mutex   sync.Mutex
+	poms    map[string]sarama.PartitionOffsetManager
+	acked   map[string]int64
+	batches []map[string]int64
+}
+
+func newCommitBarrier(poms map[string]sarama.PartitionOffsetManager) *commitBarrier {
+	return &commitBarrier{
+		poms:  poms,
+		acked: make(map[string]int64),
+	}
+}
+
+// addBatch records the last offset of each topic of a batch of messages.
+func (b *commitBarrier) addBatch(messages []*sarama.ConsumerMessage) {
+	batch := make(map[string]int64)
+	for _, message := range messages {
+		if offset, found := batch[message.Topic]; !found || message.Offset > offset {
+			batch[message.Topic] = message.Offset
+		}
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.batches = append(b.batches, batch)
+}
+
+// advance records that all messages of topic before nextOffset have been acknowledged, and marks the offsets of
+// the batches which are now complete.
+func (b *commitBarrier) advance(topic string, nextOffset int64) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.acked[topic] = nextOffset
+	for len(b.batches) > 0 && b.isComplete(b.batches[0]) {
+		for topic, offset := range b.batches[0] {
+			b.poms[topic].MarkOffset(offset+1, "")
+		}
+		b.batches = b.batches[1:]
+	}
+}
+
+func (b *commitBarrier) isComplete(batch map[string]int64) bool {
+	for topic, offset := range batch {
+		if b.acked[topic] <= offset {
+			return false
+		}
+	}
+	return true
+}
+
+// setCommitBarrier makes the offset trackers of pp mark offsets through a commitBarrier.
+func (pp *partitionProcessor) setCommitBarrier() {
+	barrier := newCommitBarrier(pp.offsetManagers)
+	for topic, tracker := range pp.offsetTrackers {
+		tracker.topic = topic
+		tracker.barrier = barrier
+	}
+}
@@ -0,0 +1,32 @@
+package kasper
+
+import (
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommitBarrier(t *testing.T) {
+	hello := &fakePartitionOffsetManager{}
+	world := &fakePartitionOffsetManager{}
+	pp := &partitionProcessor{
+		offsetManagers: map[string]sarama.PartitionOffsetManager{"hello": hello, "world": world},
+		offsetTrackers: map[string]*offsetTracker{"hello": newOffsetTracker(hello), "world": newOffsetTracker(world)},
+	}
+	pp.setCommitBarrier()
+	first := []*sarama.ConsumerMessage{{Topic: "hello", Offset: 0}, {Topic: "world", Offset: 5}}
+	second := []*sarama.ConsumerMessage{{Topic: "hello", Offset: 1}}
+	pp.trackOffsets(first)
+	pp.trackOffsets(second)
+	sender := &sender{pp: pp}
+
+	sender.CommitToken(first[0]).Ack()
+	sender.CommitToken(second[0]).Ack()
+	assert.Equal(t, int64(0), hello.offset)
+	assert.Equal(t, int64(0), world.offset)
+
+	sender.CommitToken(first[1]).Ack()
+	assert.Equal(t, int64(2), hello.offset)
+	assert.Equal(t, int64(6), world.offset)
+}
@@ -0,0 +1,96 @@
+package kasper
+
+import (
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+func newCommitTestFixture() (*sender, *fakePartitionOffsetManager) {
+	pom := &fakePartitionOffsetManager{}
+	pp := &partitionProcessor{
+		topicProcessor: &TopicProcessor{},
+		offsetTrackers: map[string]*offsetTracker{"hello": newOffsetTracker(pom)},
+	}
+	return newSender(pp), pom
+}
+
+func TestCommitToken_Ack(t *testing.T) {
+	s, pom := newCommitTestFixture()
+	messages := []*sarama.ConsumerMessage{
+		{Topic: "hello", Offset: 10},
+		{Topic: "hello", Offset: 11},
+		{Topic: "hello", Offset: 13},
+	}
+	s.pp.trackOffsets(messages)
+	var committer Committer = s
+	tokens := make([]*CommitToken, len(messages))
+	for i, message := range messages {
+		tokens[i] = committer.CommitToken(message)
+	}
+
+	tokens[1].Ack()
+	assert.Equal(t, int64(0), pom.offset)
+	tokens[0].Ack()
+	assert.Equal(t, int64(12), pom.offset)
+	tokens[2].Ack()
+	assert.Equal(t, int64(14), pom.offset)
+}
+
+func TestCommitter_CommitUpTo(t *testing.T) {
+	s, pom := newCommitTestFixture()
+	s.pp.trackOffsets([]*sarama.ConsumerMessage{
+		{Topic: "hello", Offset: 10},
+		{Topic: "hello", Offset: 11},
+		{Topic: "hello", Offset: 12},
+	})
+	s.CommitUpTo("hello", 11)
+	assert.Equal(t, int64(12), pom.offset)
+	s.CommitToken(&sarama.ConsumerMessage{Topic: "hello", Offset: 12}).Ack()
+	assert.Equal(t, int64(13), pom.offset)
+}
+
+type committingMessageProcessor struct{}
+
+func (committingMessageProcessor) Process(messages []*sarama.ConsumerMessage, sender Sender) error {
+	for _, message := range messages {
+		CommitterOf(sender).CommitToken(message).Ack()
+	}
+	return nil
+}
+
+func TestCommitterOf(t *testing.T) {
+	s, pom := newCommitTestFixture()
+	assert.Nil(t, CommitterOf(&bufferSender{}))
+	assert.Equal(t, s, CommitterOf(s))
+	assert.Equal(t, s, CommitterOf(&auditSender{sender: s}))
+	assert.Equal(t, s, CommitterOf(&chunkingSender{sender: &transformingSender{sender: s}}))
+
+	// MessageProcessors wrapped in a ChainProcessor can still acknowledge messages
+	s.pp.trackOffsets([]*sarama.ConsumerMessage{{Topic: "hello", Offset: 10}})
+	chain := NewChainProcessor(committingMessageProcessor{}, ChainStage{"intermediate", committingMessageProcessor{}})
+	assert.Nil(t, chain.Process([]*sarama.ConsumerMessage{{Topic: "hello", Offset: 10}}, s))
+	assert.Equal(t, int64(11), pom.offset)
+}
+
+func TestCommitToken_Ack_Fenced(t *testing.T) {
+	store := NewMap(10)
+	config := &Config{TopicProcessorName: "test", Logger: &noopLogger{}, FencingStore: store}
+	pom := &fakePartitionOffsetManager{}
+	pp := &partitionProcessor{
+		topicProcessor: &TopicProcessor{config: config},
+		offsetTrackers: map[string]*offsetTracker{"hello": newOffsetTracker(pom)},
+		logger:         config.Logger,
+		generation:     mustAcquireGeneration(config, 0),
+	}
+	pp.fenceOffsetTrackers()
+	s := newSender(pp)
+	s.pp.trackOffsets([]*sarama.ConsumerMessage{{Topic: "hello", Offset: 10}, {Topic: "hello", Offset: 11}})
+
+	s.CommitUpTo("hello", 10)
+	assert.Equal(t, int64(11), pom.offset)
+	mustAcquireGeneration(config, 0)
+	s.CommitUpTo("hello", 11)
+	assert.Equal(t, int64(11), pom.offset)
+}
@@ -0,0 +1,108 @@
+package kasper
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/Shopify/sarama"
+	"github.com/golang/snappy"
+	"github.com/pierrec/lz4"
+)
+
+// compressedPayloadMagic prefixes payloads compressed by CompressPayload, followed by the codec.
+var compressedPayloadMagic = []byte{0, 'K', 'Z'}
+
+// CompressPayload compresses value with codec, for per-message compression when topic-level compression
+// cannot be enabled or when payloads are large pre-batched documents. GZIP, Snappy and LZ4 are supported.
+// The result is prefixed with a magic number identifying the codec, so that DecompressPayload can detect it.
+func CompressPayload(codec sarama.CompressionCodec, value []byte) ([]byte, error) {
+	var buffer bytes.Buffer
+	buffer.Write(compressedPayloadMagic)
+	buffer.WriteByte(byte(codec))
+	switch codec {
+	case sarama.CompressionGZIP:
+		writer := gzip.NewWriter(&buffer)
+		_, err := writer.Write(value)
+		if err == nil {
+			err = writer.Close()
+		}
+		if err != nil {
+			return nil, err
+		}
+	case sarama.CompressionSnappy:
+		buffer.Write(snappy.Encode(nil, value))
+	case sarama.CompressionLZ4:
+		writer := lz4.NewWriter(&buffer)
+		_, err := writer.Write(value)
+		if err == nil {
+			err = writer.Close()
+		}
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported payload compression codec %d", codec)
+	}
+	return buffer.Bytes(), nil
+}
+
+// DecompressPayload decompresses a payload compressed by CompressPayload.
+// Payloads without the magic prefix are returned unchanged, so compression can be enabled on existing topics.
+func DecompressPayload(value []byte) ([]byte, error) {
+	prefixLength := len(compressedPayloadMagic) + 1
+	if len(value) < prefixLength || !bytes.HasPrefix(value, compressedPayloadMagic) {
+		return value, nil
+	}
+	compressed := value[prefixLength:]
+	switch codec := sarama.CompressionCodec(value[prefixLength-1]); codec {
+	case sarama.CompressionGZIP:
+		reader, err := gzip.NewReader(bytes.NewReader(compressed))
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.ReadAll(reader)
+	case sarama.CompressionSnappy:
+		return snappy.Decode(nil, compressed)
+	case sarama.CompressionLZ4:
+		return ioutil.ReadAll(lz4.NewReader(bytes.NewReader(compressed)))
+	default:
+		return nil, fmt.Errorf("unsupported payload compression codec %d", codec)
+	}
+}
+
+// CompressingProcessor is a MessageProcessor that decompresses the values of incoming messages before passing
+// them to an underlying MessageProcessor, and compresses the values of the messages it sends.
+// Keys and tombstones are never compressed.
+type CompressingProcessor struct {
+	messageProcessor MessageProcessor
+	codec            sarama.CompressionCodec
+}
+
+// NewCompressingProcessor creates a CompressingProcessor wrapping messageProcessor and compressing
+// outgoing values with codec. If codec is sarama.CompressionNone, outgoing values are not compressed.
+func NewCompressingProcessor(messageProcessor MessageProcessor, codec sarama.CompressionCodec) *CompressingProcessor {
+	return &CompressingProcessor{messageProcessor, codec}
+}
+
+// Process decompresses a batch of messages, and fails if any of them cannot be decompressed.
+func (p *CompressingProcessor) Process(messages []*sarama.ConsumerMessage, sender Sender) error {
+	decompressed, err := transformIncomingValues(messages, "decompress", DecompressPayload)
+	if err != nil {
+		return err
+	}
+	if p.codec == sarama.CompressionNone {
+		return p.messageProcessor.Process(decompressed, sender)
+	}
+	compressingSender := &transformingSender{sender: sender, transform: p.compress}
+	err = p.messageProcessor.Process(decompressed, compressingSender)
+	if err != nil {
+		return err
+	}
+	return compressingSender.err
+}
+
+func (p *CompressingProcessor) compress(msg *sarama.ProducerMessage, value []byte) ([]byte, error) {
+	return CompressPayload(p.codec, value)
+}
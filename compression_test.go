@@ -0,0 +1,48 @@
+package kasper
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompressPayload(t *testing.T) {
+	value := bytes.Repeat(finFangFoom, 100)
+	for _, codec := range []sarama.CompressionCodec{sarama.CompressionGZIP, sarama.CompressionSnappy, sarama.CompressionLZ4} {
+		compressed, err := CompressPayload(codec, value)
+		assert.Nil(t, err)
+		assert.True(t, len(compressed) < len(value))
+		decompressed, err := DecompressPayload(compressed)
+		assert.Nil(t, err)
+		assert.Equal(t, value, decompressed)
+	}
+	_, err := CompressPayload(sarama.CompressionNone, value)
+	assert.NotNil(t, err)
+
+	// Uncompressed payloads are returned as is
+	decompressed, err := DecompressPayload(mushu)
+	assert.Nil(t, err)
+	assert.Equal(t, mushu, decompressed)
+}
+
+func TestCompressingProcessor_Process(t *testing.T) {
+	compressed, _ := CompressPayload(sarama.CompressionGZIP, vorgansharax)
+	p := NewCompressingProcessor(NewRouterProcessor("dragons"), sarama.CompressionSnappy)
+	sender := &bufferSender{}
+	assert.Nil(t, p.Process([]*sarama.ConsumerMessage{
+		{Value: compressed},
+		{Value: mushu},
+		{Key: []byte("falkor")},
+	}, sender))
+	assert.Len(t, sender.messages, 3)
+	for i, expected := range [][]byte{vorgansharax, mushu} {
+		value, _ := sender.messages[i].Value.Encode()
+		assert.Equal(t, byte(sarama.CompressionSnappy), value[3])
+		decompressed, err := DecompressPayload(value)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, decompressed)
+	}
+	assert.Nil(t, sender.messages[2].Value)
+}
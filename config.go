@@ -1,8 +1,10 @@
 package kasper
 
 import (
+	"errors"
 	"fmt"
 	"github.com/Shopify/sarama"
+	"net/http"
 	"time"
 )
 
@@ -12,22 +14,171 @@ type Config struct {
 	TopicProcessorName string
 	// Used for consuming and producing messages
 	Client sarama.Client
+	// Optional, identifies this instance in the pprof labels of processing goroutines (e.g. the hostname)
+	// and in ContainerMetadata (where it defaults to the hostname)
+	ContainerID string
 	// Input topics (all topics need to have the same number of partitions)
 	InputTopics []string
 	// Input partitions (cannot overlap between TopicProcessor instances)
 	InputPartitions []int
+	// Optional, input topics whose available messages are received before those of other input topics
+	HighPriorityTopics []string
+	// Maximum number of consecutive high priority messages received while other messages are waiting (defaults to 100)
+	PriorityStarvationLimit int
 	// Maximum number of messages processed in one go
 	BatchSize int
 	// Maximum amount of time spent waiting for a batch to be filled
 	BatchWaitDuration time.Duration
+	// Optional, batch sizes are adapted to keep processing and producing a batch under this latency (BatchSize becomes the maximum)
+	BatchLatencyTarget time.Duration
+	// Minimum batch size when BatchLatencyTarget is set (defaults to 1)
+	MinBatchSize int
+	// Optional, source of time of the TopicProcessor (defaults to SystemClock, see FakeClock for tests)
+	Clock Clock
 	// Use NewBasicLogger() or any other Logger
 	Logger Logger
 	// Use NewPrometheus() or any other MetricsProvider
 	MetricsProvider MetricsProvider
 	// 15 seconds is a sensible value
 	MetricsUpdateInterval time.Duration
+	// Time to catch up with lag at which ScalingSignal.Load reaches 1 (defaults to 1 minute)
+	ScalingLagTarget time.Duration
+	// Optional, producer shared with other TopicProcessors instead of creating one from Client (never closed by Kasper)
+	Producer sarama.SyncProducer
+	// Do not create a producer, for processors that only consume (sending messages then fails with ErrProducerDisabled)
+	DisableProducer bool
+	// Producing a batch of messages for longer than this is counted as a producer stall (defaults to 1 second)
+	ProducerStallThreshold time.Duration
+	// Optional, incoming messages are throttled to this rate (0 means unlimited)
+	MaxMessagesPerSecond float64
+	// Number of times a failed batch of outgoing messages is retried (on top of sarama's own retries)
+	ProducerRetryMax int
+	// Time to wait between two retries of a failed batch of outgoing messages
+	ProducerRetryBackoff time.Duration
+	// What to do when outgoing messages cannot be produced after all retries (defaults to ProducerFailurePolicyFail)
+	ProducerFailurePolicy ProducerFailurePolicy
+	// Directory of dead letter files, required by ProducerFailurePolicyDeadLetterFile
+	DeadLetterDirectory string
+	// Required by ProducerFailurePolicyCallback
+	ProducerFailureCallback ProducerFailureCallback
+	// Defaults to ProcessingGuaranteeAtLeastOnce
+	ProcessingGuarantee ProcessingGuarantee
+	// Offsets are only committed when acknowledged through the Committer interface (see Committer)
+	ManualCommit bool
+	// Requires ManualCommit, only commit the offsets of a batch once all of its messages have been acknowledged, across all input topics
+	CommitBarrier bool
+	// Process each input partition in its own goroutine instead of a single shared run loop
+	IndependentPartitionLoops bool
+	// Maximum number of messages prefetched per input topic partition ahead of processing (0 disables prefetching)
+	PrefetchHighWatermark int
+	// Number of prefetched messages below which fetching resumes (defaults to half of PrefetchHighWatermark)
+	PrefetchLowWatermark int
+	// Optional, approximate number of bytes of in-flight messages and in-memory stores above which consumption
+	// waits for in-flight messages to be processed (see MemoryReporter)
+	MemoryBudget int64
+	// Maximum number of times a failed partition is restarted within PartitionRestartWindow (0 disables restarts)
+	PartitionRestartMax int
+	// Time window over which partition restarts are counted (restarts are counted forever if 0)
+	PartitionRestartWindow time.Duration
+	// Time to wait before restarting a failed partition
+	PartitionRestartBackoff time.Duration
+	// Optional, invoked before a failed partition is restarted, e.g. to restore its Stores
+	OnPartitionRestart func(partition int) error
+	// Optional, receives internal events such as partition starts, offset commits and producer errors
+	EventListener EventListener
+	// Optional, maximum time between the production and the end of processing of messages, by input topic
+	// (see EventSLAViolated)
+	SLAs map[string]time.Duration
+	// Optional, source of the feature flags returned by TopicProcessor.Flags()
+	FlagProvider FlagProvider
+	// Time between two refreshes of the feature flags (defaults to 30 seconds)
+	FlagRefreshInterval time.Duration
+	// Optional, topic of ControlCommands consumed by every instance from the newest offset (see ControlCommand)
+	ControlTopic string
+	// Optional, handlers of control commands not applied by Kasper (see ControlCommand), by command name
+	ControlHandlers map[string]ControlHandler
+	// Optional, compacted topic where each instance publishes its ContainerMetadata (see MetadataClient)
+	MetadataTopic string
+	// Optional, version of the application, published to MetadataTopic
+	Version string
+	// Optional, base URL at which other containers reach the embedded HTTP server, published to MetadataTopic
+	AdvertisedURL string
+	// Optional, address of the embedded HTTP server (e.g. "localhost:6060"), see TopicProcessor.HTTPHandler()
+	HTTPAddress string
+	// Optional, additional routes of the embedded HTTP server by pattern, e.g. interactive queries (see NewStoreQueryHandler)
+	HTTPRoutes map[string]http.Handler
+	// Deprecated: use HTTPAddress
+	DiagnosticsAddress string
+	// Optional, MessageProcessor.Process calls running longer than this are cancelled (see ContextSource)
+	ProcessTimeout time.Duration
+	// What to do with batches whose processing timed out (defaults to ProcessTimeoutPolicyFail)
+	ProcessTimeoutPolicy ProcessTimeoutPolicy
+	// Time to wait before processing a batch again when MessageProcessor.Process returns ErrCircuitOpen (defaults to 1 second)
+	CircuitBreakerRetryInterval time.Duration
+	// Optional, where input offsets are committed instead of the Kafka consumer group (see OffsetStore)
+	OffsetStore OffsetStore
+	// Optional, shared between all instances to fence off zombie instances of the same TopicProcessorName (see ErrFenced
+	// and CompareAndSetStore)
+	FencingStore Store
+	// On Close(), process buffered messages and hand off partitions to the next instance (requires FencingStore)
+	GracefulHandoff bool
+	// Maximum time to wait for the previous instance to hand off a partition (defaults to 30 seconds)
+	HandoffTimeout time.Duration
+	// Optional, invoked by shutdown stage after the built-in steps of the stage (see ShutdownStage)
+	ShutdownHooks map[ShutdownStage][]ShutdownHook
+	// Maximum time to wait for each shutdown stage before moving on to the next one (defaults to 30 seconds)
+	ShutdownStageTimeout time.Duration
+	// Optional, invoked on every outgoing message before it is produced
+	MessageValidator MessageValidator
+	// What to do with messages rejected by MessageValidator (defaults to ValidationFailurePolicyFail)
+	ValidationFailurePolicy ValidationFailurePolicy
+	// Optional, store schema migrations run by NewTopicProcessor before processing starts
+	StoreMigrators []*StoreMigrator
+	// Consume input partitions from ReplayFromOffset instead of the committed consumer group offsets
+	ReplayMode bool
+	// Offset to replay from when ReplayMode is set (e.g. sarama.OffsetOldest)
+	ReplayFromOffset int64
+	// Log and count skipped and reprocessed input offsets (see offset_gap_count and offset_duplicate_count);
+	// skipped offsets are expected on compacted topics
+	DetectOffsetAnomalies bool
+	// On start, reprocess this many messages before the committed offset of each input topic partition, to heal
+	// gaps caused by crash timing in MessageProcessors with idempotent side effects
+	RewindMessages int64
+	// On start, reprocess the messages produced during this duration, if they precede the committed offsets
+	// (with RewindMessages, the earliest of both positions is used)
+	RewindDuration time.Duration
+	// Optional, offset of each input topic and partition at which processing stops (bounded mode, see OnComplete)
+	StopAtOffsets map[string]map[int]int64
+	// Stop input partitions missing from StopAtOffsets at their high water mark when the TopicProcessor is created
+	StopAtHighWaterMark bool
+	// Optional, invoked in bounded mode when all input partitions have reached their stop offsets, before RunLoop returns nil
+	OnComplete func()
+	// Discard all outgoing messages instead of producing them (useful with ReplayMode to rebuild state stores)
+	SuppressOutput bool
+	// Optional, appended to the topic of every outgoing message to run the processor in shadow mode. Also appended to
+	// TopicProcessorName, so that the shadow processor has its own consumer group, fencing generations and metadata.
+	// Stores are still written to: give the shadow processor its own Stores
+	ShadowTopicSuffix string
+	// Optional, for chaos testing only: injects producer, deserialization and commit failures at random
+	FaultInjection *FaultInjection
+	// Fraction of incoming messages passed to SampleHook, between 0 and 1
+	SampleRate float64
+	// Optional, invoked with sampled incoming messages and the outgoing messages sent while processing them
+	SampleHook SampleHook
 }
 
+// ProcessingGuarantee controls when the offsets of incoming messages are marked for commit.
+type ProcessingGuarantee int
+
+const (
+	// ProcessingGuaranteeAtLeastOnce marks offsets after messages have been processed and all outgoing messages
+	// have been produced. Messages may be processed more than once after a crash, but are never lost.
+	ProcessingGuaranteeAtLeastOnce ProcessingGuarantee = iota
+	// ProcessingGuaranteeAtMostOnce marks offsets before messages are processed. Messages are never processed
+	// twice, but may be lost after a crash. Useful when duplicates are worse than loss, e.g. metrics sampling.
+	ProcessingGuaranteeAtMostOnce
+)
+
 func (config *Config) kafkaConsumerGroup() string {
 	return fmt.Sprintf("kasper-topic-processor-%s", config.TopicProcessorName)
 }
@@ -37,12 +188,28 @@ func (config *Config) producerClientID() string {
 }
 
 func (config *Config) setDefaults() {
+	config.TopicProcessorName = config.shadowName()
 	if config.BatchSize == 0 {
 		config.BatchSize = 1000
 	}
 	if config.BatchWaitDuration == 0 {
 		config.BatchWaitDuration = 5 * time.Second
 	}
+	if config.BatchLatencyTarget > 0 && config.MinBatchSize == 0 {
+		config.MinBatchSize = 1
+	}
+	if len(config.HighPriorityTopics) > 0 && config.PriorityStarvationLimit == 0 {
+		config.PriorityStarvationLimit = 100
+	}
+	if config.FlagProvider != nil && config.FlagRefreshInterval == 0 {
+		config.FlagRefreshInterval = 30 * time.Second
+	}
+	if config.HTTPAddress == "" {
+		config.HTTPAddress = config.DiagnosticsAddress
+	}
+	if config.Clock == nil {
+		config.Clock = SystemClock{}
+	}
 	if config.Logger == nil {
 		config.Logger = NewBasicLogger(false)
 	}
@@ -52,8 +219,43 @@ func (config *Config) setDefaults() {
 	if config.MetricsUpdateInterval == 0 {
 		config.MetricsUpdateInterval = 15 * time.Second
 	}
+	if config.CircuitBreakerRetryInterval == 0 {
+		config.CircuitBreakerRetryInterval = time.Second
+	}
+	if config.HandoffTimeout == 0 {
+		config.HandoffTimeout = 30 * time.Second
+	}
+	if config.ScalingLagTarget == 0 {
+		config.ScalingLagTarget = time.Minute
+	}
+	if config.ShutdownStageTimeout == 0 {
+		config.ShutdownStageTimeout = 30 * time.Second
+	}
+	if config.PrefetchHighWatermark > 0 && config.PrefetchLowWatermark == 0 {
+		config.PrefetchLowWatermark = config.PrefetchHighWatermark / 2
+	}
+	if config.ProducerStallThreshold == 0 {
+		config.ProducerStallThreshold = time.Second
+	}
 	if !config.Client.Config().Producer.Return.Successes {
 		// Required by sarama.SyncProducer
 		config.Client.Config().Producer.Return.Successes = true
 	}
 }
+
+// validate returns an error if settings which depend on each other are inconsistent.
+func (config *Config) validate() error {
+	if config.GracefulHandoff && config.FencingStore == nil {
+		return errors.New("GracefulHandoff requires a FencingStore")
+	}
+	if config.CommitBarrier && !config.ManualCommit {
+		return errors.New("CommitBarrier requires ManualCommit")
+	}
+	if config.ProducerFailurePolicy == ProducerFailurePolicyDeadLetterFile && config.DeadLetterDirectory == "" {
+		return errors.New("ProducerFailurePolicyDeadLetterFile requires a DeadLetterDirectory")
+	}
+	if config.ProducerFailurePolicy == ProducerFailurePolicyCallback && config.ProducerFailureCallback == nil {
+		return errors.New("ProducerFailurePolicyCallback requires a ProducerFailureCallback")
+	}
+	return nil
+}
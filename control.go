@@ -0,0 +1,154 @@
+package kasper
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/Shopify/sarama"
+)
+
+// Names of control commands. ControlPause, ControlResume, ControlSetLogLevel and ControlUpdateSettings are applied
+// by Kasper, other commands are applied by the matching Config.ControlHandlers.
+const (
+	// ControlPause pauses input partitions, see TopicProcessor.Pause()
+	ControlPause = "pause"
+	// ControlResume resumes paused input partitions, see TopicProcessor.Resume()
+	ControlResume = "resume"
+	// ControlFlushStores asks for Stores to be flushed
+	ControlFlushStores = "flush-stores"
+	// ControlSetLogLevel sets the log level to ControlCommand.Value, see RuntimeSettings.LogLevel
+	ControlSetLogLevel = "set-log-level"
+	// ControlUpdateSettings updates the RuntimeSettings set in ControlCommand.Value, a JSON-encoded RuntimeSettings
+	ControlUpdateSettings = "update-settings"
+	// ControlSnapshot asks for a snapshot of Stores to be taken
+	ControlSnapshot = "snapshot"
+)
+
+// ControlCommand is a runtime command sent to a fleet of TopicProcessors through Config.ControlTopic,
+// e.g. to pause processing during a maintenance window without redeploying.
+// Commands are JSON-encoded, see NewControlMessage().
+type ControlCommand struct {
+	// Name of the command, e.g. ControlPause
+	Command string `json:"command"`
+	// Optional, only TopicProcessors with this Config.TopicProcessorName apply the command
+	TopicProcessorName string `json:"topic_processor_name,omitempty"`
+	// Optional, input partitions the command applies to (all partitions of each instance if empty)
+	Partitions []int `json:"partitions,omitempty"`
+	// Optional, argument of the command, e.g. a log level
+	Value string `json:"value,omitempty"`
+}
+
+// ControlHandler applies a ControlCommand. Handlers are called from the goroutine consuming the control topic,
+// concurrently with the run loop.
+type ControlHandler func(command ControlCommand) error
+
+// NewControlMessage returns a message carrying command, to be sent to a control topic.
+func NewControlMessage(topic string, command ControlCommand) (*sarama.ProducerMessage, error) {
+	value, err := json.Marshal(command)
+	if err != nil {
+		return nil, err
+	}
+	return &sarama.ProducerMessage{Topic: topic, Value: sarama.ByteEncoder(value)}, nil
+}
+
+func (tp *TopicProcessor) mustStartControlConsumer() {
+	if tp.config.ControlTopic == "" {
+		return
+	}
+	consumer, err := sarama.NewConsumerFromClient(tp.config.Client)
+	if err != nil {
+		tp.logger.Panic(err)
+	}
+	partitions, err := consumer.Partitions(tp.config.ControlTopic)
+	if err != nil {
+		tp.logger.Panic(err)
+	}
+	tp.controlConsumer = consumer
+	for _, partition := range partitions {
+		pc, err := consumer.ConsumePartition(tp.config.ControlTopic, partition, sarama.OffsetNewest)
+		if err != nil {
+			tp.stopControlConsumer()
+			tp.logger.Panic(err)
+		}
+		tp.controlPartitionConsumers = append(tp.controlPartitionConsumers, pc)
+		tp.waitGroup.Add(1)
+		go tp.consumeControlCommands(pc.Messages())
+	}
+}
+
+func (tp *TopicProcessor) consumeControlCommands(messages <-chan *sarama.ConsumerMessage) {
+	defer tp.waitGroup.Done()
+	for {
+		select {
+		case message, ok := <-messages:
+			if !ok {
+				return
+			}
+			var command ControlCommand
+			err := json.Unmarshal(message.Value, &command)
+			if err == nil {
+				err = tp.applyControlCommand(command)
+			}
+			if err != nil {
+				tp.logger.Errorf("Cannot apply control command at offset %d of %s-%d: %s", message.Offset, message.Topic, message.Partition, err)
+			}
+		case <-tp.close:
+			return
+		}
+	}
+}
+
+func (tp *TopicProcessor) applyControlCommand(command ControlCommand) error {
+	if command.TopicProcessorName != "" && command.TopicProcessorName != tp.config.TopicProcessorName {
+		return nil
+	}
+	partitions := command.Partitions
+	if len(partitions) == 0 {
+		tp.partitionsMutex.RLock()
+		partitions = tp.partitions
+		tp.partitionsMutex.RUnlock()
+	}
+	tp.logger.Infof("Applying control command %q", command.Command)
+	switch command.Command {
+	case ControlPause:
+		tp.Pause(partitions...)
+	case ControlResume:
+		tp.Resume(partitions...)
+	case ControlSetLogLevel:
+		settings := tp.Settings()
+		settings.LogLevel = command.Value
+		return tp.UpdateSettings(settings)
+	case ControlUpdateSettings:
+		settings := tp.Settings()
+		err := json.Unmarshal([]byte(command.Value), &settings)
+		if err != nil {
+			return err
+		}
+		return tp.UpdateSettings(settings)
+	default:
+		handler, found := tp.config.ControlHandlers[command.Command]
+		if !found {
+			return fmt.Errorf("unsupported control command %q", command.Command)
+		}
+		return handler(command)
+	}
+	return nil
+}
+
+// stopControlConsumer closes the partition consumers of the control topic, then the control consumer.
+// Closing a consumer created from an existing client doesn't close its partition consumers.
+func (tp *TopicProcessor) stopControlConsumer() {
+	if tp.controlConsumer == nil {
+		return
+	}
+	for _, pc := range tp.controlPartitionConsumers {
+		err := pc.Close()
+		if err != nil {
+			tp.logger.Errorf("Cannot close control partition consumer: %s", err)
+		}
+	}
+	err := tp.controlConsumer.Close()
+	if err != nil {
+		tp.logger.Errorf("Cannot close control consumer: %s", err)
+	}
+}
@@ -0,0 +1,94 @@
+package kasper
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+func newControlTestTopicProcessor() *TopicProcessor {
+	return &TopicProcessor{
+		config:     &Config{TopicProcessorName: "mushu"},
+		partitions: []int{0, 1},
+		close:      make(chan struct{}),
+		logger:     &noopLogger{},
+	}
+}
+
+func TestTopicProcessor_Pause(t *testing.T) {
+	tp := newControlTestTopicProcessor()
+	defer close(tp.close)
+	messages := make(chan *sarama.ConsumerMessage, 10)
+	consumerChan := tp.getConsumerMessagesChan([]<-chan *sarama.ConsumerMessage{messages})
+	tp.Pause(1)
+	messages <- &sarama.ConsumerMessage{Partition: 1, Offset: 7}
+	select {
+	case <-consumerChan:
+		t.Fatal("Expected partition 1 to be paused")
+	case <-time.After(50 * time.Millisecond):
+	}
+	tp.Resume(1)
+	assert.Equal(t, int64(7), (<-consumerChan).Offset)
+}
+
+func TestTopicProcessor_waitUntilResumed_Close(t *testing.T) {
+	tp := newControlTestTopicProcessor()
+	tp.Pause(0)
+	close(tp.close)
+	assert.False(t, tp.waitUntilResumed(0))
+	assert.True(t, tp.waitUntilResumed(1))
+}
+
+func TestTopicProcessor_applyControlCommand(t *testing.T) {
+	tp := newControlTestTopicProcessor()
+	var flushed []ControlCommand
+	tp.config.ControlHandlers = map[string]ControlHandler{
+		ControlFlushStores: func(command ControlCommand) error {
+			flushed = append(flushed, command)
+			return nil
+		},
+		ControlSnapshot: func(ControlCommand) error {
+			return errors.New("no snapshot store")
+		},
+	}
+
+	assert.Nil(t, tp.applyControlCommand(ControlCommand{Command: ControlPause}))
+	assert.Len(t, tp.paused, 2)
+	assert.Nil(t, tp.applyControlCommand(ControlCommand{Command: ControlResume, Partitions: []int{0}}))
+	assert.Len(t, tp.paused, 1)
+	assert.Nil(t, tp.applyControlCommand(ControlCommand{Command: ControlResume, TopicProcessorName: "falkor"}))
+	assert.Len(t, tp.paused, 1)
+
+	assert.Nil(t, tp.applyControlCommand(ControlCommand{Command: ControlFlushStores}))
+	assert.Len(t, flushed, 1)
+	assert.EqualError(t, tp.applyControlCommand(ControlCommand{Command: ControlSnapshot}), "no snapshot store")
+	assert.EqualError(t, tp.applyControlCommand(ControlCommand{Command: "dance"}), `unsupported control command "dance"`)
+}
+
+func TestTopicProcessor_stopControlConsumer(t *testing.T) {
+	tp := newControlTestTopicProcessor()
+	pc := &closablePartitionConsumer{fakePartitionConsumer: fakePartitionConsumer{make(chan *sarama.ConsumerMessage)}}
+	tp.controlConsumer = &fakeConsumer{}
+	tp.controlPartitionConsumers = []sarama.PartitionConsumer{pc}
+	tp.waitGroup.Add(1)
+	go tp.consumeControlCommands(pc.Messages())
+
+	tp.stopControlConsumer()
+	assert.True(t, pc.closed)
+	// The control commands are no longer consumed, even though the TopicProcessor is not closed
+	tp.waitGroup.Wait()
+}
+
+func TestNewControlMessage(t *testing.T) {
+	message, err := NewControlMessage("control", ControlCommand{Command: ControlSetLogLevel, Value: "debug"})
+	assert.Nil(t, err)
+	assert.Equal(t, "control", message.Topic)
+	value, _ := message.Value.Encode()
+	var command ControlCommand
+	assert.Nil(t, json.Unmarshal(value, &command))
+	assert.Equal(t, ControlCommand{Command: ControlSetLogLevel, Value: "debug"}, command)
+}
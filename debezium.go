@@ -0,0 +1,149 @@
+package kasper
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// ChangeOperation is the operation of a ChangeEvent, as encoded in the "op" field of Debezium envelopes.
+type ChangeOperation string
+
+const (
+	// ChangeCreate is a row insertion.
+	ChangeCreate ChangeOperation = "c"
+	// ChangeUpdate is a row update.
+	ChangeUpdate ChangeOperation = "u"
+	// ChangeDelete is a row deletion. After is null.
+	ChangeDelete ChangeOperation = "d"
+	// ChangeRead is a row read during an initial snapshot. Before is null.
+	ChangeRead ChangeOperation = "r"
+)
+
+// ChangeEvent is a change data capture event, decoded from a Debezium envelope.
+type ChangeEvent struct {
+	Operation ChangeOperation
+	// Row state before the change, as JSON (null for creations and snapshot reads)
+	Before json.RawMessage
+	// Row state after the change, as JSON (null for deletions)
+	After json.RawMessage
+	// Connector-specific source metadata, as JSON
+	Source json.RawMessage
+	// Time at which the connector processed the change
+	Timestamp time.Time
+	// Incoming message the event was decoded from
+	Message *sarama.ConsumerMessage
+}
+
+type debeziumEnvelope struct {
+	Op     ChangeOperation `json:"op"`
+	Before json.RawMessage `json:"before"`
+	After  json.RawMessage `json:"after"`
+	Source json.RawMessage `json:"source"`
+	TsMs   int64           `json:"ts_ms"`
+}
+
+// ParseDebeziumEnvelope decodes the Debezium JSON envelope of an incoming message, with or without
+// its schema (see the JsonConverter schemas.enable option). Returns (nil, nil) for the tombstones
+// Debezium emits after deletions.
+func ParseDebeziumEnvelope(message *sarama.ConsumerMessage) (*ChangeEvent, error) {
+	if IsTombstone(message) {
+		return nil, nil
+	}
+	var withSchema struct {
+		Schema  json.RawMessage `json:"schema"`
+		Payload json.RawMessage `json:"payload"`
+	}
+	err := json.Unmarshal(message.Value, &withSchema)
+	if err != nil {
+		return nil, err
+	}
+	value := []byte(message.Value)
+	if withSchema.Schema != nil && withSchema.Payload != nil {
+		value = withSchema.Payload
+	}
+	var envelope debeziumEnvelope
+	err = json.Unmarshal(value, &envelope)
+	if err != nil {
+		return nil, err
+	}
+	switch envelope.Op {
+	case ChangeCreate, ChangeUpdate, ChangeDelete, ChangeRead:
+	default:
+		return nil, fmt.Errorf("message at offset %d of %s/%d is not a Debezium envelope (op is %q)", message.Offset, message.Topic, message.Partition, envelope.Op)
+	}
+	return &ChangeEvent{
+		envelope.Op,
+		envelope.Before,
+		envelope.After,
+		envelope.Source,
+		time.Unix(0, envelope.TsMs*int64(time.Millisecond)),
+		message,
+	}, nil
+}
+
+// ChangeEventProcessor processes change events decoded by a DebeziumProcessor.
+type ChangeEventProcessor interface {
+	// ProcessChanges processes a batch of change events, in incoming message order.
+	ProcessChanges(events []*ChangeEvent, sender Sender) error
+}
+
+// DebeziumProcessor is a MessageProcessor that decodes the Debezium envelopes of incoming messages and
+// passes the resulting change events to a ChangeEventProcessor, so that CDC pipelines don't have to parse
+// envelopes themselves. Tombstones are skipped. A message that is not a valid envelope fails the batch.
+type DebeziumProcessor struct {
+	changeEventProcessor ChangeEventProcessor
+}
+
+// NewDebeziumProcessor creates a DebeziumProcessor passing change events to changeEventProcessor.
+func NewDebeziumProcessor(changeEventProcessor ChangeEventProcessor) *DebeziumProcessor {
+	return &DebeziumProcessor{changeEventProcessor}
+}
+
+// Process decodes a batch of messages and passes their change events to the ChangeEventProcessor.
+func (p *DebeziumProcessor) Process(messages []*sarama.ConsumerMessage, sender Sender) error {
+	events := make([]*ChangeEvent, 0, len(messages))
+	for _, message := range messages {
+		event, err := ParseDebeziumEnvelope(message)
+		if err != nil {
+			return err
+		}
+		if event != nil {
+			events = append(events, event)
+		}
+	}
+	if len(events) == 0 {
+		return nil
+	}
+	return p.changeEventProcessor.ProcessChanges(events, sender)
+}
+
+type debeziumUnwrapper struct {
+	topic string
+}
+
+// NewDebeziumUnwrapper creates a MessageProcessor that unwraps Debezium envelopes into plain row states:
+// the "after" state of each change is sent to topic with the key and timestamp of the incoming message,
+// and deletions are sent as tombstones, so that topic can be compacted into a table of current rows.
+func NewDebeziumUnwrapper(topic string) *DebeziumProcessor {
+	return NewDebeziumProcessor(&debeziumUnwrapper{topic})
+}
+
+func (u *debeziumUnwrapper) ProcessChanges(events []*ChangeEvent, sender Sender) error {
+	for _, event := range events {
+		key := sarama.ByteEncoder(event.Message.Key)
+		if event.Operation == ChangeDelete {
+			sender.SendTombstone(u.topic, key)
+			continue
+		}
+		sender.Send(&sarama.ProducerMessage{
+			Topic:     u.topic,
+			Key:       key,
+			Value:     sarama.ByteEncoder(event.After),
+			Timestamp: event.Message.Timestamp,
+		})
+	}
+	return nil
+}
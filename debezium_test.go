@@ -0,0 +1,47 @@
+package kasper
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDebeziumEnvelope(t *testing.T) {
+	event, err := ParseDebeziumEnvelope(&sarama.ConsumerMessage{
+		Value: []byte(`{"schema":{"type":"struct"},"payload":{"op":"u","before":{"id":1,"name":"a"},"after":{"id":1,"name":"b"},"source":{"table":"users"},"ts_ms":1500000000123}}`),
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, ChangeUpdate, event.Operation)
+	assert.Equal(t, json.RawMessage(`{"id":1,"name":"a"}`), event.Before)
+	assert.Equal(t, json.RawMessage(`{"id":1,"name":"b"}`), event.After)
+	assert.Equal(t, json.RawMessage(`{"table":"users"}`), event.Source)
+	assert.Equal(t, time.Unix(1500000000, 123000000), event.Timestamp)
+
+	event, err = ParseDebeziumEnvelope(&sarama.ConsumerMessage{Value: []byte(`{"op":"c","before":null,"after":{"id":2}}`)})
+	assert.Nil(t, err)
+	assert.Equal(t, ChangeCreate, event.Operation)
+
+	event, err = ParseDebeziumEnvelope(&sarama.ConsumerMessage{Key: []byte("1")})
+	assert.Nil(t, err)
+	assert.Nil(t, event)
+
+	_, err = ParseDebeziumEnvelope(&sarama.ConsumerMessage{Value: []byte(`{"id":3}`)})
+	assert.NotNil(t, err)
+}
+
+func TestDebeziumUnwrapper(t *testing.T) {
+	sender := &bufferSender{}
+	assert.Nil(t, NewDebeziumUnwrapper("users").Process([]*sarama.ConsumerMessage{
+		{Key: []byte("1"), Value: []byte(`{"op":"r","after":{"id":1}}`)},
+		{Key: []byte("1"), Value: []byte(`{"op":"d","before":{"id":1},"after":null}`)},
+		{Key: []byte("1")},
+	}, sender))
+	assert.Len(t, sender.messages, 2)
+	value, _ := sender.messages[0].Value.Encode()
+	assert.Equal(t, []byte(`{"id":1}`), value)
+	assert.Nil(t, sender.messages[1].Value)
+	assert.Equal(t, "users", sender.messages[1].Topic)
+}
@@ -0,0 +1,92 @@
+package kasper
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// DedupIDFunc extracts the deduplication ID of an incoming message.
+// Two messages with the same key and deduplication ID are considered to be duplicates.
+type DedupIDFunc func(*sarama.ConsumerMessage) string
+
+// Deduplicator is a MessageProcessor that drops incoming messages whose (key, deduplication ID) pair
+// has already been seen within a given window, and passes all other messages to an underlying MessageProcessor.
+// Seen pairs are kept in a TTLStore expiring them after the window, so deduplication survives restarts when
+// the underlying Store is persistent (e.g. Redis).
+// This gives cheap effectively-exactly-once processing for idempotent pipelines.
+//
+// Pairs are only recorded once the outgoing messages of the batch have been produced (the Sender is flushed
+// first), so that messages redelivered after a failed produce are processed again. Messages redelivered after
+// their outgoing messages were produced but before their offsets were committed are dropped as duplicates.
+type Deduplicator struct {
+	messageProcessor MessageProcessor
+	store            *TTLStore
+	dedupID          DedupIDFunc
+}
+
+// NewDeduplicator creates a Deduplicator wrapping messageProcessor and keeping seen pairs in store for window.
+// If dedupID is nil, messages are deduplicated on their key only.
+func NewDeduplicator(messageProcessor MessageProcessor, store Store, window time.Duration, dedupID DedupIDFunc) *Deduplicator {
+	if dedupID == nil {
+		dedupID = func(*sarama.ConsumerMessage) string { return "" }
+	}
+	return &Deduplicator{
+		messageProcessor,
+		NewTTLStore(store, window, TTLWallClock),
+		dedupID,
+	}
+}
+
+// SetClock sets the Clock used to age entries, e.g. a FakeClock in tests.
+func (d *Deduplicator) SetClock(clock Clock) {
+	d.store.SetClock(clock)
+}
+
+// Process drops duplicate messages, passes the remaining ones to the underlying MessageProcessor,
+// and records them in the Store once their outgoing messages have been produced.
+func (d *Deduplicator) Process(messages []*sarama.ConsumerMessage, sender Sender) error {
+	keys := make([]string, len(messages))
+	for i, message := range messages {
+		keys[i] = d.storeKey(message)
+	}
+	seen, err := d.store.GetAll(keys)
+	if err != nil {
+		return err
+	}
+	unique := make([]*sarama.ConsumerMessage, 0, len(messages))
+	updates := make(map[string][]byte)
+	for i, message := range messages {
+		key := keys[i]
+		if _, found := updates[key]; found {
+			continue
+		}
+		if _, found := seen[key]; found {
+			continue
+		}
+		unique = append(unique, message)
+		updates[key] = []byte{}
+	}
+	if len(unique) > 0 {
+		err = d.messageProcessor.Process(unique, sender)
+		if err != nil {
+			return err
+		}
+		err = sender.Flush()
+		if err != nil {
+			return err
+		}
+	}
+	err = d.store.PutAll(updates)
+	if err != nil {
+		return err
+	}
+	_, err = d.store.Expire()
+	return err
+}
+
+// storeKey prefixes the message key with its length, so that keys containing the separator are not ambiguous.
+func (d *Deduplicator) storeKey(message *sarama.ConsumerMessage) string {
+	return fmt.Sprintf("%d:%s/%s", len(message.Key), message.Key, d.dedupID(message))
+}
@@ -0,0 +1,98 @@
+package kasper
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingMessageProcessor struct {
+	messages []*sarama.ConsumerMessage
+}
+
+func (p *recordingMessageProcessor) Process(messages []*sarama.ConsumerMessage, sender Sender) error {
+	p.messages = append(p.messages, messages...)
+	return nil
+}
+
+func TestDeduplicator_Process(t *testing.T) {
+	mp := &recordingMessageProcessor{}
+	store := NewMap(10)
+	d := NewDeduplicator(mp, store, time.Minute, func(msg *sarama.ConsumerMessage) string {
+		return string(msg.Value)
+	})
+	clock := NewFakeClock(time.Unix(1000, 0))
+	d.SetClock(clock)
+	sender := &bufferSender{}
+
+	first := []*sarama.ConsumerMessage{
+		{Key: []byte("a"), Value: []byte("1"), Offset: 0},
+		{Key: []byte("a"), Value: []byte("1"), Offset: 1},
+		{Key: []byte("a"), Value: []byte("2"), Offset: 2},
+		{Key: []byte("b"), Value: []byte("1"), Offset: 3},
+	}
+	assert.Nil(t, d.Process(first, sender))
+	assert.Equal(t, []*sarama.ConsumerMessage{first[0], first[2], first[3]}, mp.messages)
+
+	mp.messages = nil
+	clock.Advance(30 * time.Second)
+	second := []*sarama.ConsumerMessage{
+		{Key: []byte("b"), Value: []byte("1"), Offset: 4},
+		{Key: []byte("c"), Value: []byte("1"), Offset: 5},
+	}
+	assert.Nil(t, d.Process(second, sender))
+	assert.Equal(t, []*sarama.ConsumerMessage{second[1]}, mp.messages)
+
+	// Entries expire after the window
+	mp.messages = nil
+	clock.Advance(2 * time.Minute)
+	assert.Nil(t, d.Process(first[:1], sender))
+	assert.Equal(t, first[:1], mp.messages)
+	assert.Equal(t, 1, len(store.GetMap()))
+}
+
+func TestDeduplicator_Process_KeyOnly(t *testing.T) {
+	mp := &recordingMessageProcessor{}
+	d := NewDeduplicator(mp, NewMap(10), time.Minute, nil)
+	messages := []*sarama.ConsumerMessage{
+		{Key: []byte("a"), Value: []byte("1")},
+		{Key: []byte("a"), Value: []byte("2")},
+	}
+	assert.Nil(t, d.Process(messages, &bufferSender{}))
+	assert.Equal(t, messages[:1], mp.messages)
+}
+
+func TestDeduplicator_Process_AmbiguousKeys(t *testing.T) {
+	mp := &recordingMessageProcessor{}
+	d := NewDeduplicator(mp, NewMap(10), time.Minute, func(msg *sarama.ConsumerMessage) string {
+		return string(msg.Value)
+	})
+	messages := []*sarama.ConsumerMessage{
+		{Key: []byte("a/b"), Value: []byte("c")},
+		{Key: []byte("a"), Value: []byte("b/c")},
+	}
+	assert.Nil(t, d.Process(messages, &bufferSender{}))
+	assert.Equal(t, messages, mp.messages)
+}
+
+type failingFlushSender struct {
+	bufferSender
+}
+
+func (s *failingFlushSender) Flush() error {
+	return errors.New("produce failed")
+}
+
+func TestDeduplicator_Process_ProduceFailure(t *testing.T) {
+	mp := &recordingMessageProcessor{}
+	d := NewDeduplicator(mp, NewMap(10), time.Minute, nil)
+	messages := []*sarama.ConsumerMessage{{Key: []byte("a")}}
+	assert.NotNil(t, d.Process(messages, &failingFlushSender{}))
+
+	// Redelivered messages are processed again
+	assert.Nil(t, d.Process(messages, &bufferSender{}))
+	assert.Len(t, mp.messages, 2)
+}
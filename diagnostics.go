@@ -0,0 +1,107 @@
+package kasper
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/pprof"
+	"sort"
+	"sync/atomic"
+
+	"github.com/Shopify/sarama"
+)
+
+// PartitionDiagnostics describes the state of a single input partition of a TopicProcessor.
+type PartitionDiagnostics struct {
+	Partition int                         `json:"partition"`
+	Stopped   bool                        `json:"stopped"`
+	Topics    map[string]TopicDiagnostics `json:"topics"`
+}
+
+// TopicDiagnostics describes the consumption state of a single topic partition.
+type TopicDiagnostics struct {
+	NextOffset       int64 `json:"nextOffset"`
+	HighWaterMark    int64 `json:"highWaterMark"`
+	PendingCommits   int   `json:"pendingCommits"`
+	MessagesBehind   int64 `json:"messagesBehind"`
+	ConsumerBuffered int   `json:"consumerBuffered"`
+}
+
+// Diagnostics describes the internal state of a TopicProcessor.
+type Diagnostics struct {
+	TopicProcessorName string                 `json:"topicProcessorName"`
+	InFlightMessages   int64                  `json:"inFlightMessages"`
+	Partitions         []PartitionDiagnostics `json:"partitions"`
+}
+
+// Diagnostics returns a snapshot of the internal queue depths of the TopicProcessor.
+// It is safe to call from any goroutine.
+func (tp *TopicProcessor) Diagnostics() *Diagnostics {
+	diagnostics := &Diagnostics{
+		TopicProcessorName: tp.config.TopicProcessorName,
+		InFlightMessages:   atomic.LoadInt64(&tp.inFlightMessages),
+	}
+	tp.partitionsMutex.RLock()
+	for _, pp := range tp.partitionProcessors {
+		diagnostics.Partitions = append(diagnostics.Partitions, pp.diagnostics())
+	}
+	tp.partitionsMutex.RUnlock()
+	sort.Slice(diagnostics.Partitions, func(i, j int) bool {
+		return diagnostics.Partitions[i].Partition < diagnostics.Partitions[j].Partition
+	})
+	return diagnostics
+}
+
+func (pp *partitionProcessor) diagnostics() PartitionDiagnostics {
+	highWaterMarks := pp.consumer.HighWaterMarks()
+	topics := make(map[string]TopicDiagnostics, len(pp.inputTopics))
+	for i, topic := range pp.inputTopics {
+		nextOffset, _ := pp.offsetManagers[topic].NextOffset()
+		highWaterMark := highWaterMarks[topic][int32(pp.partition)]
+		var messagesBehind int64
+		if nextOffset != sarama.OffsetNewest && nextOffset != sarama.OffsetOldest {
+			messagesBehind = highWaterMark - nextOffset
+		}
+		tracker := pp.offsetTrackers[topic]
+		tracker.mutex.Lock()
+		pendingCommits := len(tracker.pending)
+		tracker.mutex.Unlock()
+		topics[topic] = TopicDiagnostics{
+			NextOffset:       nextOffset,
+			HighWaterMark:    highWaterMark,
+			PendingCommits:   pendingCommits,
+			MessagesBehind:   messagesBehind,
+			ConsumerBuffered: len(pp.partitionConsumers[i].Messages()),
+		}
+	}
+	return PartitionDiagnostics{
+		Partition: pp.partition,
+		Stopped:   pp.isStopped(),
+		Topics:    topics,
+	}
+}
+
+// DiagnosticsHandler returns an http.Handler that exposes:
+//
+//	/debug/kasper            the output of Diagnostics() as JSON
+//	/debug/kasper/settings   the RuntimeSettings as JSON, updated by PUT or POST requests
+//	/debug/pprof/...         the standard net/http/pprof endpoints
+//
+// Goroutine profiles (/debug/pprof/goroutine?debug=1) show the topic_processor, topics, partition and container_id
+// labels of processing goroutines.
+func (tp *TopicProcessor) DiagnosticsHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/kasper", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		err := json.NewEncoder(w).Encode(tp.Diagnostics())
+		if err != nil {
+			tp.logger.Errorf("Cannot encode diagnostics: %s", err)
+		}
+	})
+	mux.HandleFunc("/debug/kasper/settings", tp.settingsHandler)
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
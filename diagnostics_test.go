@@ -0,0 +1,61 @@
+package kasper
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTopicProcessor_DiagnosticsHandler(t *testing.T) {
+	tp := &TopicProcessor{
+		config: &Config{TopicProcessorName: "diagnostics"},
+		logger: &noopLogger{},
+	}
+	pom := &fakePartitionOffsetManager{offset: 40}
+	consumer := &fakePartitionConsumer{make(chan *sarama.ConsumerMessage, 10)}
+	consumer.messages <- &sarama.ConsumerMessage{}
+	tracker := newOffsetTracker(pom)
+	tracker.track(40)
+	tp.partitionProcessors = map[int32]*partitionProcessor{
+		3: {
+			topicProcessor:     tp,
+			consumer:           &fakeConsumer{map[string]map[int32]int64{"hello": {3: 42}}},
+			partitionConsumers: []sarama.PartitionConsumer{consumer},
+			offsetManagers:     map[string]sarama.PartitionOffsetManager{"hello": pom},
+			offsetTrackers:     map[string]*offsetTracker{"hello": tracker},
+			inputTopics:        []string{"hello"},
+			partition:          3,
+		},
+	}
+
+	recorder := httptest.NewRecorder()
+	tp.DiagnosticsHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/debug/kasper", nil))
+	assert.Equal(t, 200, recorder.Code)
+	var actual Diagnostics
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &actual))
+	expected := Diagnostics{
+		TopicProcessorName: "diagnostics",
+		Partitions: []PartitionDiagnostics{
+			{
+				Partition: 3,
+				Topics: map[string]TopicDiagnostics{
+					"hello": {
+						NextOffset:       40,
+						HighWaterMark:    42,
+						PendingCommits:   1,
+						MessagesBehind:   2,
+						ConsumerBuffered: 1,
+					},
+				},
+			},
+		},
+	}
+	assert.Equal(t, expected, actual)
+
+	recorder = httptest.NewRecorder()
+	tp.DiagnosticsHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/debug/pprof/", nil))
+	assert.Equal(t, 200, recorder.Code)
+}
@@ -0,0 +1,24 @@
+package kasper
+
+import (
+	"sync/atomic"
+)
+
+// Drain shuts down the TopicProcessor for planned maintenance: it stops consuming new messages, processes the
+// messages already received, produces their outgoing messages, and commits their offsets. Drain returns once
+// RunLoop has returned (immediately if RunLoop is not running). The error of the final batches, if any, is
+// returned by RunLoop.
+//
+// Unlike Close, which discards received messages that have not been processed yet unless Config.GracefulHandoff
+// is set, Drain never leaves work behind, so that the next instance starts exactly where this one stopped.
+func (tp *TopicProcessor) Drain() {
+	tp.logger.Info("Received drain request")
+	atomic.StoreInt32(&tp.draining, 1)
+	tp.Close()
+	tp.running.Wait()
+	tp.logger.Info("Drain complete")
+}
+
+func (tp *TopicProcessor) isDraining() bool {
+	return atomic.LoadInt32(&tp.draining) == 1
+}
@@ -0,0 +1,41 @@
+package kasper
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTopicProcessor_Drain(t *testing.T) {
+	tp := &TopicProcessor{
+		config:               &Config{BatchSize: 2, BatchWaitDuration: time.Hour},
+		partitions:           []int{0},
+		close:                make(chan struct{}),
+		logger:               &noopLogger{},
+		incomingMessageCount: &noopMetric{},
+		outgoingMessageCount: &noopMetric{},
+	}
+	processed := make(chan *sarama.ConsumerMessage, 10)
+	pp, pc, pom := newReassignTestPartitionProcessor(tp, 0, processed)
+	tp.partitionProcessors = map[int32]*partitionProcessor{0: pp}
+	done := make(chan error)
+	go func() {
+		err := pp.runLoop(make(chan struct{}))
+		close(pc.messages)
+		done <- err
+	}()
+	for offset := int64(5); offset <= 7; offset++ {
+		pc.messages <- &sarama.ConsumerMessage{Topic: "hello", Partition: 0, Offset: offset}
+	}
+	<-processed
+	<-processed
+	time.Sleep(100 * time.Millisecond)
+
+	// The pending batch is processed and committed
+	tp.Drain()
+	assert.Nil(t, <-done)
+	assert.Len(t, processed, 1)
+	assert.Equal(t, int64(8), pom.offset)
+}
@@ -0,0 +1,205 @@
+package kasper
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/Shopify/sarama"
+)
+
+const encryptedPayloadVersion = 1
+
+// ErrNotEncrypted is returned by Encryptor.Decrypt for payloads that were not encrypted by an Encryptor.
+var ErrNotEncrypted = errors.New("payload is not encrypted")
+
+// KeyProvider provides the AES keys (16, 24 or 32 bytes long) used by an Encryptor.
+// Implementations typically fetch data keys from a KMS and cache them.
+type KeyProvider interface {
+	// CurrentKey returns the key used to encrypt new payloads, and its ID.
+	CurrentKey() (id string, key []byte, err error)
+	// Key returns the key with the given ID, to decrypt payloads encrypted with it.
+	Key(id string) ([]byte, error)
+}
+
+type staticKeyProvider struct {
+	currentID string
+	keys      map[string][]byte
+}
+
+// NewStaticKeyProvider creates a KeyProvider from a fixed set of keys, encrypting with the key of currentID.
+// Keeping old keys in the set allows to rotate keys without losing access to existing payloads.
+func NewStaticKeyProvider(currentID string, keys map[string][]byte) KeyProvider {
+	return &staticKeyProvider{currentID, keys}
+}
+
+func (p *staticKeyProvider) CurrentKey() (string, []byte, error) {
+	key, err := p.Key(p.currentID)
+	return p.currentID, key, err
+}
+
+func (p *staticKeyProvider) Key(id string) ([]byte, error) {
+	key, found := p.keys[id]
+	if !found {
+		return nil, fmt.Errorf("unknown encryption key %q", id)
+	}
+	return key, nil
+}
+
+// Encryptor encrypts and decrypts payloads with AES-GCM.
+// Encrypted payloads contain the ID of their key, so that keys can be rotated.
+type Encryptor struct {
+	keys KeyProvider
+}
+
+// NewEncryptor creates an Encryptor using the keys of keys.
+func NewEncryptor(keys KeyProvider) *Encryptor {
+	return &Encryptor{keys}
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Encrypt encrypts plaintext with the current key. The key ID is authenticated along with the ciphertext.
+func (e *Encryptor) Encrypt(plaintext []byte) ([]byte, error) {
+	id, key, err := e.keys.CurrentKey()
+	if err != nil {
+		return nil, err
+	}
+	if len(id) > 255 {
+		return nil, fmt.Errorf("encryption key ID %q is longer than 255 bytes", id)
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	header := append([]byte{encryptedPayloadVersion, byte(len(id))}, id...)
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return nil, err
+	}
+	payload := append(header, nonce...)
+	return gcm.Seal(payload, nonce, plaintext, header), nil
+}
+
+// Decrypt decrypts a payload encrypted by Encrypt, with the key it was encrypted with.
+func (e *Encryptor) Decrypt(payload []byte) ([]byte, error) {
+	if len(payload) < 2 || payload[0] != encryptedPayloadVersion || len(payload) < 2+int(payload[1]) {
+		return nil, ErrNotEncrypted
+	}
+	headerLength := 2 + int(payload[1])
+	header := payload[:headerLength]
+	key, err := e.keys.Key(string(payload[2:headerLength]))
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(payload) < headerLength+gcm.NonceSize() {
+		return nil, ErrNotEncrypted
+	}
+	nonce := payload[headerLength : headerLength+gcm.NonceSize()]
+	return gcm.Open(nil, nonce, payload[headerLength+gcm.NonceSize():], header)
+}
+
+// EncryptJSONFields encrypts the given top-level fields of a JSON object, for field-level encryption of
+// sensitive data. Each field value is replaced by its encrypted JSON encoding, as a base64 string.
+// Missing fields are ignored.
+func (e *Encryptor) EncryptJSONFields(value []byte, fields ...string) ([]byte, error) {
+	return e.transformJSONFields(value, fields, func(field json.RawMessage) (json.RawMessage, error) {
+		encrypted, err := e.Encrypt(field)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(base64.StdEncoding.EncodeToString(encrypted))
+	})
+}
+
+// DecryptJSONFields decrypts fields encrypted by EncryptJSONFields.
+func (e *Encryptor) DecryptJSONFields(value []byte, fields ...string) ([]byte, error) {
+	return e.transformJSONFields(value, fields, func(field json.RawMessage) (json.RawMessage, error) {
+		var encoded string
+		err := json.Unmarshal(field, &encoded)
+		if err != nil {
+			return nil, ErrNotEncrypted
+		}
+		encrypted, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, ErrNotEncrypted
+		}
+		return e.Decrypt(encrypted)
+	})
+}
+
+func (e *Encryptor) transformJSONFields(value []byte, fields []string, transform func(json.RawMessage) (json.RawMessage, error)) ([]byte, error) {
+	var object map[string]json.RawMessage
+	err := json.Unmarshal(value, &object)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range fields {
+		field, found := object[name]
+		if !found {
+			continue
+		}
+		object[name], err = transform(field)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(object)
+}
+
+// EncryptingProcessor is a MessageProcessor that transparently decrypts the values of incoming messages
+// before passing them to an underlying MessageProcessor, and encrypts the values of the messages it sends,
+// for end-to-end encryption of sensitive topics. Keys are never encrypted, so that partitioning and
+// compaction keep working, and tombstones are passed through as is.
+type EncryptingProcessor struct {
+	messageProcessor MessageProcessor
+	encryptor        *Encryptor
+	topics           map[string]bool
+}
+
+// NewEncryptingProcessor creates an EncryptingProcessor wrapping messageProcessor.
+// Only messages sent to the given output topics are encrypted, or all messages if no topic is given.
+func NewEncryptingProcessor(messageProcessor MessageProcessor, encryptor *Encryptor, topics ...string) *EncryptingProcessor {
+	encryptedTopics := make(map[string]bool, len(topics))
+	for _, topic := range topics {
+		encryptedTopics[topic] = true
+	}
+	return &EncryptingProcessor{messageProcessor, encryptor, encryptedTopics}
+}
+
+// Process decrypts a batch of messages, and fails if any of them cannot be decrypted.
+func (p *EncryptingProcessor) Process(messages []*sarama.ConsumerMessage, sender Sender) error {
+	decrypted, err := transformIncomingValues(messages, "decrypt", p.encryptor.Decrypt)
+	if err != nil {
+		return err
+	}
+	encryptingSender := &transformingSender{sender: sender, transform: p.encrypt}
+	err = p.messageProcessor.Process(decrypted, encryptingSender)
+	if err != nil {
+		return err
+	}
+	return encryptingSender.err
+}
+
+func (p *EncryptingProcessor) encrypt(msg *sarama.ProducerMessage, value []byte) ([]byte, error) {
+	if len(p.topics) > 0 && !p.topics[msg.Topic] {
+		return value, nil
+	}
+	return p.encryptor.Encrypt(value)
+}
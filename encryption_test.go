@@ -0,0 +1,64 @@
+package kasper
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestEncryptor(currentID string) *Encryptor {
+	return NewEncryptor(NewStaticKeyProvider(currentID, map[string][]byte{
+		"k1": bytes.Repeat([]byte{1}, 32),
+		"k2": bytes.Repeat([]byte{2}, 16),
+	}))
+}
+
+func TestEncryptor_EncryptDecrypt(t *testing.T) {
+	encrypted, err := newTestEncryptor("k1").Encrypt(saphira)
+	assert.Nil(t, err)
+	assert.False(t, bytes.Contains(encrypted, []byte("Saphira")))
+
+	// Payloads encrypted with an old key can still be decrypted after rotation
+	decrypted, err := newTestEncryptor("k2").Decrypt(encrypted)
+	assert.Nil(t, err)
+	assert.Equal(t, saphira, decrypted)
+
+	encrypted[len(encrypted)-1]++
+	_, err = newTestEncryptor("k1").Decrypt(encrypted)
+	assert.NotNil(t, err)
+	_, err = newTestEncryptor("k1").Decrypt(saphira)
+	assert.Equal(t, ErrNotEncrypted, err)
+}
+
+func TestEncryptor_JSONFields(t *testing.T) {
+	e := newTestEncryptor("k1")
+	encrypted, err := e.EncryptJSONFields(saphira, "name", "age")
+	assert.Nil(t, err)
+	assert.False(t, bytes.Contains(encrypted, []byte("Saphira")))
+	assert.True(t, bytes.Contains(encrypted, []byte(`"color":"blue"`)))
+	decrypted, err := e.DecryptJSONFields(encrypted, "name", "age")
+	assert.Nil(t, err)
+	assert.JSONEq(t, string(saphira), string(decrypted))
+}
+
+func TestEncryptingProcessor_Process(t *testing.T) {
+	e := newTestEncryptor("k1")
+	encrypted, _ := e.Encrypt(falkor)
+	p := NewEncryptingProcessor(NewRouterProcessor("dragons"), e, "dragons")
+	sender := &bufferSender{}
+	assert.Nil(t, p.Process([]*sarama.ConsumerMessage{
+		{Key: []byte("falkor"), Value: encrypted},
+		{Key: []byte("mushu")},
+	}, sender))
+	assert.Len(t, sender.messages, 2)
+	value, _ := sender.messages[0].Value.Encode()
+	assert.NotEqual(t, falkor, value)
+	decrypted, err := e.Decrypt(value)
+	assert.Nil(t, err)
+	assert.Equal(t, falkor, decrypted)
+	assert.Nil(t, sender.messages[1].Value)
+
+	assert.NotNil(t, p.Process([]*sarama.ConsumerMessage{{Key: []byte("falkor"), Value: falkor}}, sender))
+}
@@ -0,0 +1,96 @@
+package kasper
+
+import (
+	"time"
+)
+
+// EventType identifies the kind of an internal Kasper Event.
+type EventType int
+
+const (
+	// EventPartitionStarted is emitted when a TopicProcessor starts consuming an input partition.
+	EventPartitionStarted EventType = iota
+	// EventPartitionStopped is emitted when a TopicProcessor stops consuming an input partition.
+	EventPartitionStopped
+	// EventOffsetCommitted is emitted when the offset of a topic partition is marked for commit after processing.
+	EventOffsetCommitted
+	// EventProducerError is emitted each time a batch of outgoing messages fails to be produced.
+	EventProducerError
+	// EventProducerRetriesExhausted is emitted when a batch of outgoing messages could not be produced after
+	// Config.ProducerRetryMax retries, before Config.ProducerFailurePolicy is applied.
+	EventProducerRetriesExhausted
+	// EventStoreMigrated is emitted when a Store has been migrated by one of Config.StoreMigrators.
+	EventStoreMigrated
+	// EventPartitionRestarted is emitted when a failed partition has been restarted (see Config.PartitionRestartMax).
+	EventPartitionRestarted
+	// EventProcessTimeout is emitted when MessageProcessor.Process has run for longer than Config.ProcessTimeout.
+	EventProcessTimeout
+	// EventSLAViolated is emitted when a batch contains messages processed later than the SLA of their topic
+	// (see Config.SLAs), once per topic and batch.
+	EventSLAViolated
+)
+
+var eventTypeNames = []string{
+	"PartitionStarted",
+	"PartitionStopped",
+	"OffsetCommitted",
+	"ProducerError",
+	"ProducerRetriesExhausted",
+	"StoreMigrated",
+	"PartitionRestarted",
+	"ProcessTimeout",
+	"SLAViolated",
+}
+
+func (t EventType) String() string {
+	if int(t) < len(eventTypeNames) {
+		return eventTypeNames[t]
+	}
+	return "Unknown"
+}
+
+// Event describes something that happened inside a TopicProcessor.
+// Fields which do not apply to the event type are left to their zero value.
+type Event struct {
+	Type               EventType
+	Time               time.Time
+	TopicProcessorName string
+	Partition          int
+	Topic              string
+	Offset             int64
+	// Number of outgoing messages, for producer events, or incoming messages, for EventProcessTimeout and
+	// EventSLAViolated (the number of late messages)
+	Messages int
+	// Producer error, for producer events, or processing error, for EventPartitionRestarted and EventProcessTimeout
+	Err error
+	// Store schema version key and version, for EventStoreMigrated
+	VersionKey string
+	Version    int
+	// Time between the production and the end of processing of the latest message, for EventSLAViolated
+	Latency time.Duration
+}
+
+// EventListener receives internal Kasper events, see Config.EventListener.
+// With Config.IndependentPartitionLoops, it is called from several goroutines and must be safe for concurrent use.
+// It is called synchronously and should return quickly.
+type EventListener func(event Event)
+
+// ChannelEventListener returns an EventListener that sends events to a channel, so that they can be consumed
+// from another goroutine. Events are dropped when the channel is full, so a slow consumer never blocks processing.
+func ChannelEventListener(events chan<- Event) EventListener {
+	return func(event Event) {
+		select {
+		case events <- event:
+		default:
+		}
+	}
+}
+
+func (config *Config) emitEvent(event Event) {
+	if config.EventListener == nil {
+		return
+	}
+	event.Time = config.clock().Now()
+	event.TopicProcessorName = config.TopicProcessorName
+	config.EventListener(event)
+}
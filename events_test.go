@@ -0,0 +1,54 @@
+package kasper
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvents_Producer(t *testing.T) {
+	failure := errors.New("broker unavailable")
+	f := newProducerFailureFixture(ProducerFailurePolicyCallback, failure, failure)
+	tp := f.pp.topicProcessor
+	tp.config.ProducerRetryMax = 1
+	tp.config.ProducerFailureCallback = func(messages []*sarama.ProducerMessage, err error) error { return nil }
+	events := make(chan Event, 10)
+	tp.config.EventListener = ChannelEventListener(events)
+
+	assert.Nil(t, tp.produce(newProducerFailureTestMessages(), 0))
+	close(events)
+	var types []EventType
+	for event := range events {
+		assert.Equal(t, "test", event.TopicProcessorName)
+		assert.Equal(t, failure, event.Err)
+		assert.Equal(t, 1, event.Messages)
+		types = append(types, event.Type)
+	}
+	assert.Equal(t, []EventType{EventProducerError, EventProducerError, EventProducerRetriesExhausted}, types)
+	assert.Equal(t, "ProducerRetriesExhausted", EventProducerRetriesExhausted.String())
+}
+
+func TestEvents_OffsetCommitted(t *testing.T) {
+	tp, pom := newProcessingGuaranteeTopicProcessor(ProcessingGuaranteeAtLeastOnce)
+	var received []Event
+	tp.config.EventListener = func(event Event) {
+		received = append(received, event)
+	}
+	tp.partitionProcessors[0].markOffsets([]*sarama.ConsumerMessage{{Topic: "hello", Offset: 41}})
+	assert.Equal(t, int64(42), pom.offset)
+	assert.Len(t, received, 1)
+	assert.Equal(t, EventOffsetCommitted, received[0].Type)
+	assert.Equal(t, "hello", received[0].Topic)
+	assert.Equal(t, int64(42), received[0].Offset)
+}
+
+func TestChannelEventListener_Full(t *testing.T) {
+	events := make(chan Event, 1)
+	listener := ChannelEventListener(events)
+	listener(Event{Type: EventPartitionStarted})
+	listener(Event{Type: EventPartitionStopped})
+	assert.Equal(t, EventPartitionStarted, (<-events).Type)
+	assert.Len(t, events, 0)
+}
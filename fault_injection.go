@@ -0,0 +1,134 @@
+package kasper
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// ErrInjectedFault is the error of failures injected by FaultInjection.
+var ErrInjectedFault = errors.New("kasper: injected fault")
+
+// FaultInjection injects failures at random, so that applications can verify that their retry, dead letter and
+// recovery policies actually work (see Config.FaultInjection). Rates are fractions between 0 and 1.
+// It is meant for chaos testing and must never be used in production.
+type FaultInjection struct {
+	// Fraction of produce attempts failing with ErrInjectedFault (subject to Config.ProducerRetryMax and ProducerFailurePolicy)
+	ProducerErrorRate float64
+	// Fraction of incoming messages whose value is replaced by bytes that no decoder accepts
+	DeserializationErrorRate float64
+	// Fraction of offset commits which are dropped, as if they had failed (see FaultInjectingStore for store faults)
+	CommitFailureRate float64
+	// Fraction of operations of a FaultInjectingStore which are delayed by StoreLatency
+	StoreLatencyRate float64
+	// Latency spike of delayed store operations
+	StoreLatency time.Duration
+	// Seed of the random failures, so that failing runs can be reproduced
+	Seed int64
+
+	mutex  sync.Mutex
+	random *rand.Rand
+}
+
+// corruptedValue replaces the values of messages with injected deserialization errors:
+// it is neither valid UTF-8, JSON, Avro with a schema registry prefix, nor a Kasper value prefix.
+var corruptedValue = []byte{0xff, 0xfe, 'k', 'a', 's', 'p', 'e', 'r', 0xc0}
+
+func (f *FaultInjection) inject(rate float64) bool {
+	if f == nil || rate <= 0 {
+		return false
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.random == nil {
+		f.random = rand.New(rand.NewSource(f.Seed))
+	}
+	return f.random.Float64() < rate
+}
+
+func (f *FaultInjection) injectProducerError() bool {
+	return f != nil && f.inject(f.ProducerErrorRate)
+}
+
+func (f *FaultInjection) injectCommitFailure() bool {
+	return f != nil && f.inject(f.CommitFailureRate)
+}
+
+func (f *FaultInjection) injectStoreLatency() bool {
+	return f != nil && f.inject(f.StoreLatencyRate)
+}
+
+// corruptMessages returns messages with the values of some of them corrupted, according to DeserializationErrorRate.
+// Corrupted messages are copies: the original messages are left untouched.
+func (f *FaultInjection) corruptMessages(messages []*sarama.ConsumerMessage) []*sarama.ConsumerMessage {
+	if f == nil || f.DeserializationErrorRate <= 0 {
+		return messages
+	}
+	corrupted := make([]*sarama.ConsumerMessage, len(messages))
+	for i, message := range messages {
+		corrupted[i] = message
+		if f.inject(f.DeserializationErrorRate) {
+			copied := *message
+			copied.Value = corruptedValue
+			corrupted[i] = &copied
+		}
+	}
+	return corrupted
+}
+
+// FaultInjectingStore is a Store whose operations are randomly delayed according to a FaultInjection,
+// to test the behaviour of processors when their store is slow.
+type FaultInjectingStore struct {
+	store  Store
+	faults *FaultInjection
+}
+
+// NewFaultInjectingStore creates a FaultInjectingStore wrapping store.
+func NewFaultInjectingStore(store Store, faults *FaultInjection) *FaultInjectingStore {
+	return &FaultInjectingStore{store, faults}
+}
+
+func (s *FaultInjectingStore) delay() {
+	if s.faults.injectStoreLatency() {
+		time.Sleep(s.faults.StoreLatency)
+	}
+}
+
+// Get gets a value by key.
+func (s *FaultInjectingStore) Get(key string) ([]byte, error) {
+	s.delay()
+	return s.store.Get(key)
+}
+
+// GetAll gets multiple values by key.
+func (s *FaultInjectingStore) GetAll(keys []string) (map[string][]byte, error) {
+	s.delay()
+	return s.store.GetAll(keys)
+}
+
+// Put inserts or updates a value by key.
+func (s *FaultInjectingStore) Put(key string, value []byte) error {
+	s.delay()
+	return s.store.Put(key, value)
+}
+
+// PutAll inserts or updates multiple key-value pairs.
+func (s *FaultInjectingStore) PutAll(kvs map[string][]byte) error {
+	s.delay()
+	return s.store.PutAll(kvs)
+}
+
+// Delete deletes a key.
+func (s *FaultInjectingStore) Delete(key string) error {
+	s.delay()
+	return s.store.Delete(key)
+}
+
+// Flush flushes the underlying Store.
+func (s *FaultInjectingStore) Flush() error {
+	s.delay()
+	return s.store.Flush()
+}
@@ -0,0 +1,58 @@
+package kasper
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFaultInjection_ProducerError(t *testing.T) {
+	f := newProducerFailureFixture(ProducerFailurePolicyFail)
+	tp := f.pp.topicProcessor
+	tp.config.FaultInjection = &FaultInjection{ProducerErrorRate: 1}
+	assert.Equal(t, ErrInjectedFault, tp.produce(newProducerFailureTestMessages(), 0))
+	tp.config.FaultInjection.ProducerErrorRate = 0
+	assert.Nil(t, tp.produce(newProducerFailureTestMessages(), 0))
+}
+
+func TestFaultInjection_DeserializationError(t *testing.T) {
+	faults := &FaultInjection{DeserializationErrorRate: 0.5, Seed: 42}
+	messages := make([]*sarama.ConsumerMessage, 100)
+	for i := range messages {
+		messages[i] = &sarama.ConsumerMessage{Value: mushu}
+	}
+	corrupted := 0
+	for i, message := range faults.corruptMessages(messages) {
+		assert.Equal(t, mushu, messages[i].Value)
+		if string(message.Value) != string(mushu) {
+			corrupted++
+		}
+	}
+	assert.True(t, corrupted > 30 && corrupted < 70)
+	assert.Equal(t, messages, (*FaultInjection)(nil).corruptMessages(messages))
+}
+
+func TestFaultInjection_CommitFailure(t *testing.T) {
+	tp := &TopicProcessor{
+		config: &Config{FaultInjection: &FaultInjection{CommitFailureRate: 1}},
+		logger: &noopLogger{},
+	}
+	pp, _, pom := newReassignTestPartitionProcessor(tp, 0, nil)
+	pp.markOffsets([]*sarama.ConsumerMessage{{Topic: "hello", Offset: 7}})
+	assert.Equal(t, int64(0), pom.offset)
+	tp.config.FaultInjection.CommitFailureRate = 0
+	pp.markOffsets([]*sarama.ConsumerMessage{{Topic: "hello", Offset: 7}})
+	assert.Equal(t, int64(8), pom.offset)
+}
+
+func TestFaultInjectingStore(t *testing.T) {
+	store := NewFaultInjectingStore(NewMap(10), &FaultInjection{StoreLatencyRate: 1, StoreLatency: 20 * time.Millisecond})
+	start := time.Now()
+	assert.Nil(t, store.Put("mushu", mushu))
+	assert.True(t, time.Since(start) >= 20*time.Millisecond)
+	value, err := store.Get("mushu")
+	assert.Nil(t, err)
+	assert.Equal(t, mushu, value)
+}
@@ -0,0 +1,116 @@
+package kasper
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// ErrFenced is returned by TopicProcessor.RunLoop when another TopicProcessor instance has since taken over one of
+// its input partitions. The fenced instance stops before producing messages or committing offsets.
+var ErrFenced = errors.New("partition has been taken over by a newer topic processor generation")
+
+func (config *Config) generationKey(partition int) string {
+	return fmt.Sprintf("kasper-generation/%s/%d", config.TopicProcessorName, partition)
+}
+
+// CompareAndSetStore is a Store which can atomically replace a value. When Config.FencingStore implements
+// CompareAndSetStore, generations are acquired atomically, so that instances starting concurrently never own the same
+// generation. Otherwise, instances of the same TopicProcessorName must not start concurrently.
+type CompareAndSetStore interface {
+	Store
+	// CompareAndSet sets key to value if its current value is old (nil for a missing key), and returns whether it did.
+	CompareAndSet(key string, old, value []byte) (bool, error)
+}
+
+func readGeneration(store Store, key string) (int64, error) {
+	value, err := store.Get(key)
+	if err != nil {
+		return 0, err
+	}
+	return parseGeneration(value)
+}
+
+func parseGeneration(value []byte) (int64, error) {
+	if value == nil {
+		return 0, nil
+	}
+	return strconv.ParseInt(string(value), 10, 64)
+}
+
+// mustAcquireGeneration increments the generation of a partition in Config.FencingStore
+// and returns the new generation, which this TopicProcessor instance then owns.
+func mustAcquireGeneration(config *Config, partition int) int64 {
+	if config.FencingStore == nil {
+		return 0
+	}
+	generation, err := acquireGeneration(config, partition)
+	if err != nil {
+		config.Logger.Panic(err)
+	}
+	config.Logger.Infof("Acquired generation %d of partition %d", generation, partition)
+	return generation
+}
+
+func acquireGeneration(config *Config, partition int) (int64, error) {
+	store := config.FencingStore
+	key := config.generationKey(partition)
+	for {
+		current, err := store.Get(key)
+		if err != nil {
+			return 0, err
+		}
+		generation, err := parseGeneration(current)
+		if err != nil {
+			return 0, err
+		}
+		waitForHandoff(config, partition, generation)
+		next := []byte(strconv.FormatInt(generation+1, 10))
+		cas, ok := store.(CompareAndSetStore)
+		if !ok {
+			err = store.Put(key, next)
+		} else {
+			var set bool
+			set, err = cas.CompareAndSet(key, current, next)
+			if err == nil && !set {
+				config.Logger.Infof("Generation %d of partition %d was acquired concurrently, retrying", generation+1, partition)
+				continue
+			}
+		}
+		if err == nil {
+			err = store.Flush()
+		}
+		return generation + 1, err
+	}
+}
+
+// checkGeneration returns ErrFenced if another instance has acquired the partition since this one did.
+func (pp *partitionProcessor) checkGeneration() error {
+	config := pp.topicProcessor.config
+	if config.FencingStore == nil {
+		return nil
+	}
+	generation, err := readGeneration(config.FencingStore, config.generationKey(pp.partition))
+	if err != nil {
+		return err
+	}
+	if generation != pp.generation {
+		pp.logger.Errorf("Partition %d is owned by generation %d (this instance has generation %d)", pp.partition, generation, pp.generation)
+		return ErrFenced
+	}
+	return nil
+}
+
+// fenceOffsetTrackers makes the offset trackers of pp check the generation before marking acknowledged offsets,
+// since manual commits happen outside of processConsumerMessages.
+func (pp *partitionProcessor) fenceOffsetTrackers() {
+	for _, tracker := range pp.offsetTrackers {
+		tracker.fence = func() error {
+			err := pp.checkGeneration()
+			if err != nil {
+				pp.logger.Errorf("Cannot commit acknowledged offsets of partition %d: %s", pp.partition, err)
+			}
+			return err
+		}
+	}
+}
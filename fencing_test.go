@@ -0,0 +1,97 @@
+package kasper
+
+import (
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPartitionProcessor_checkGeneration(t *testing.T) {
+	store := NewMap(10)
+	config := &Config{TopicProcessorName: "test", Logger: &noopLogger{}, FencingStore: store}
+	tp := &TopicProcessor{config: config}
+	zombie := &partitionProcessor{topicProcessor: tp, partition: 3, logger: config.Logger}
+	zombie.generation = mustAcquireGeneration(config, 3)
+	assert.Equal(t, int64(1), zombie.generation)
+	assert.Nil(t, zombie.checkGeneration())
+
+	successor := &partitionProcessor{topicProcessor: tp, partition: 3, logger: config.Logger}
+	successor.generation = mustAcquireGeneration(config, 3)
+	assert.Equal(t, int64(2), successor.generation)
+	assert.Nil(t, successor.checkGeneration())
+	assert.Equal(t, ErrFenced, zombie.checkGeneration())
+}
+
+func TestPartitionProcessor_checkGeneration_Disabled(t *testing.T) {
+	tp := &TopicProcessor{config: &Config{}}
+	pp := &partitionProcessor{topicProcessor: tp}
+	assert.Nil(t, pp.checkGeneration())
+}
+
+// racingStore simulates another instance acquiring the generation right before the first CompareAndSet.
+type racingStore struct {
+	*Map
+	raced bool
+}
+
+func (s *racingStore) CompareAndSet(key string, old, value []byte) (bool, error) {
+	if !s.raced {
+		s.raced = true
+		_ = s.Put(key, value)
+	}
+	return s.Map.CompareAndSet(key, old, value)
+}
+
+func TestAcquireGeneration_Concurrent(t *testing.T) {
+	store := &racingStore{Map: NewMap(10)}
+	config := &Config{TopicProcessorName: "test", Logger: &noopLogger{}, FencingStore: store}
+	assert.Equal(t, int64(2), mustAcquireGeneration(config, 3))
+	assert.True(t, store.raced)
+}
+
+func TestMap_CompareAndSet(t *testing.T) {
+	m := NewMap(10)
+	set, err := m.CompareAndSet("dragon", []byte("mushu"), falkor)
+	assert.Nil(t, err)
+	assert.False(t, set)
+	set, _ = m.CompareAndSet("dragon", nil, mushu)
+	assert.True(t, set)
+	set, _ = m.CompareAndSet("dragon", nil, falkor)
+	assert.False(t, set)
+	set, _ = m.CompareAndSet("dragon", mushu, falkor)
+	assert.True(t, set)
+	value, _ := m.Get("dragon")
+	assert.Equal(t, falkor, value)
+}
+
+// takeoverSyncProducer simulates another instance taking over a partition while messages are produced.
+type takeoverSyncProducer struct {
+	fakeSyncProducer
+	config    *Config
+	partition int
+}
+
+func (p *takeoverSyncProducer) SendMessages(msgs []*sarama.ProducerMessage) error {
+	mustAcquireGeneration(p.config, p.partition)
+	return p.fakeSyncProducer.SendMessages(msgs)
+}
+
+func TestTopicProcessor_processPartitionMessages_FencedBeforeCommit(t *testing.T) {
+	config := &Config{TopicProcessorName: "test", Logger: &noopLogger{}, FencingStore: NewMap(10)}
+	tp := newShutdownTestTopicProcessor(config)
+	tp.incomingMessageCount = &noopMetric{}
+	tp.producerInFlightMessages = &noopMetric{}
+	tp.producerAckLatency = &noopMetric{}
+	tp.producerStallCount = &noopMetric{}
+	producer := &takeoverSyncProducer{config: config}
+	tp.producer = producer
+	pp := tp.partitionProcessors[0]
+	pp.messageProcessor = NewRouterProcessor("out")
+	pp.generation = mustAcquireGeneration(config, 0)
+	pom := pp.offsetManagers["hello"].(*fakePartitionOffsetManager)
+	err := tp.processPartitionMessages([]*sarama.ConsumerMessage{{Topic: "hello", Offset: 3, Value: mushu}}, 0)
+	assert.Equal(t, ErrFenced, err)
+	assert.Len(t, producer.messages, 1)
+	assert.Equal(t, int64(0), pom.offset)
+}
@@ -0,0 +1,111 @@
+package kasper
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/Shopify/sarama"
+)
+
+// RecordReader reads records from an auxiliary source, e.g. archived files, as incoming messages.
+type RecordReader interface {
+	// Next returns the next record, or io.EOF after the last record.
+	Next() (*sarama.ConsumerMessage, error)
+}
+
+// LineReader is a RecordReader for text files with one record per line, such as JSON lines exports.
+// GZIP-compressed files are decompressed transparently. Each line is returned as a message value, without
+// its line terminator. Messages have no key, and their offsets are the line numbers, starting at 0.
+type LineReader struct {
+	scanner *bufio.Scanner
+	topic   string
+	offset  int64
+}
+
+// NewLineReader returns a reader of the lines of r, attributed to topic. Lines are limited to maxLineSize bytes.
+func NewLineReader(r io.Reader, topic string, maxLineSize int) (*LineReader, error) {
+	reader := bufio.NewReader(r)
+	magic, err := reader.Peek(2)
+	if err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gzipReader, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, err
+		}
+		r = gzipReader
+	} else {
+		r = reader
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	return &LineReader{scanner, topic, 0}, nil
+}
+
+// Next returns the next line, or io.EOF after the last line.
+func (l *LineReader) Next() (*sarama.ConsumerMessage, error) {
+	if !l.scanner.Scan() {
+		if err := l.scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+	value := append([]byte{}, l.scanner.Bytes()...)
+	message := &sarama.ConsumerMessage{Topic: l.topic, Value: value, Offset: l.offset}
+	l.offset++
+	return message, nil
+}
+
+// OpenRecordFile opens a local file as a RecordReader attributed to topic: an AvroContainerReader for ".avro"
+// files, and a LineReader with lines of up to 1 MB otherwise. The returned io.Closer closes the file.
+// Files stored elsewhere, e.g. in S3, can be read by passing their content to NewLineReader or
+// NewAvroContainerReader.
+func OpenRecordFile(path, topic string) (RecordReader, io.Closer, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	var reader RecordReader
+	if strings.HasSuffix(path, ".avro") {
+		reader, err = NewAvroContainerReader(file, topic)
+	} else {
+		reader, err = NewLineReader(file, topic, 1024*1024)
+	}
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	return reader, file, nil
+}
+
+// ReplayRecords feeds the records of reader to messageProcessor in batches of up to batchSize messages, so that
+// archived data can be replayed through the same processing logic as Kafka input. sender.Flush() is called
+// after each batch, e.g. with a StandaloneSender. ReplayRecords returns the number of records replayed.
+func ReplayRecords(reader RecordReader, messageProcessor MessageProcessor, sender Sender, batchSize int) (int, error) {
+	count := 0
+	batch := make([]*sarama.ConsumerMessage, 0, batchSize)
+	for {
+		message, err := reader.Next()
+		if err != nil && err != io.EOF {
+			return count, err
+		}
+		if message != nil {
+			batch = append(batch, message)
+		}
+		if len(batch) > 0 && (len(batch) == batchSize || err == io.EOF) {
+			err := messageProcessor.Process(batch, sender)
+			if err == nil {
+				err = sender.Flush()
+			}
+			if err != nil {
+				return count, err
+			}
+			count += len(batch)
+			batch = batch[:0]
+		}
+		if err == io.EOF {
+			return count, nil
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package kasper
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+const dragonSchema = `{"type": "record", "name": "Dragon", "namespace": "kasper", "fields": [
+	{"name": "name", "type": "string"},
+	{"name": "color", "type": {"type": "string"}},
+	{"name": "wings", "type": ["null", "int"]},
+	{"name": "tags", "type": {"type": "array", "items": "string"}},
+	{"name": "attrs", "type": {"type": "map", "values": "long"}},
+	{"name": "friend", "type": ["null", "Dragon"]}
+]}`
+
+var dragonRecords = []string{
+	"0a4d757368750672656400020a736d616c6c000206616765b8170000",
+	"0c46616c6b6f720a776869746502040000020e5361706869726108626c75650204000000",
+	"0e5361706869726108626c7565020404086669726506696365000406616765020873697a65050000",
+}
+
+func appendAvroBytes(b []byte, data []byte) []byte {
+	b = appendAvroLong(b, int64(len(data)))
+	return append(b, data...)
+}
+
+func appendAvroLong(b []byte, n int64) []byte {
+	buf := make([]byte, binary.MaxVarintLen64)
+	return append(b, buf[:binary.PutVarint(buf, n)]...)
+}
+
+// newAvroContainer encodes records in an Avro object container file, with one block per slice of records.
+func newAvroContainer(codec string, blocks ...[]string) []byte {
+	sync := []byte("0123456789abcdef")
+	container := append([]byte{}, avroContainerMagic...)
+	container = appendAvroLong(container, 2)
+	container = appendAvroBytes(container, []byte("avro.schema"))
+	container = appendAvroBytes(container, []byte(dragonSchema))
+	container = appendAvroBytes(container, []byte("avro.codec"))
+	container = appendAvroBytes(container, []byte(codec))
+	container = appendAvroLong(container, 0)
+	container = append(container, sync...)
+	for _, records := range blocks {
+		var data []byte
+		for _, record := range records {
+			decoded, _ := hex.DecodeString(record)
+			data = append(data, decoded...)
+		}
+		if codec == "deflate" {
+			var buffer bytes.Buffer
+			writer, _ := flate.NewWriter(&buffer, flate.BestCompression)
+			writer.Write(data)
+			writer.Close()
+			data = buffer.Bytes()
+		}
+		container = appendAvroLong(container, int64(len(records)))
+		container = appendAvroBytes(container, data)
+		container = append(container, sync...)
+	}
+	return container
+}
+
+func readAllRecords(t *testing.T, reader RecordReader) []*sarama.ConsumerMessage {
+	var messages []*sarama.ConsumerMessage
+	for {
+		message, err := reader.Next()
+		if err == io.EOF {
+			return messages
+		}
+		assert.Nil(t, err)
+		if err != nil {
+			return messages
+		}
+		messages = append(messages, message)
+	}
+}
+
+func TestAvroContainerReader(t *testing.T) {
+	for _, container := range [][]byte{
+		newAvroContainer("null", dragonRecords[:2], dragonRecords[2:]),
+		newAvroContainer("deflate", dragonRecords[:1], dragonRecords[1:]),
+	} {
+		reader, err := NewAvroContainerReader(bytes.NewReader(container), "dragons")
+		assert.Nil(t, err)
+		assert.Equal(t, dragonSchema, reader.Schema())
+		messages := readAllRecords(t, reader)
+		assert.Len(t, messages, 3)
+		for i, message := range messages {
+			assert.Equal(t, "dragons", message.Topic)
+			assert.Equal(t, int64(i), message.Offset)
+			assert.Equal(t, dragonRecords[i], hex.EncodeToString(message.Value))
+		}
+	}
+
+	_, err := NewAvroContainerReader(bytes.NewReader(mushu), "dragons")
+	assert.NotNil(t, err)
+	_, err = NewAvroContainerReader(bytes.NewReader(newAvroContainer("bzip2")), "dragons")
+	assert.EqualError(t, err, `unsupported Avro codec "bzip2"`)
+}
+
+func TestLineReader(t *testing.T) {
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	writer.Write([]byte("mushu\nfalkor\n"))
+	writer.Close()
+	for _, data := range [][]byte{[]byte("mushu\nfalkor"), compressed.Bytes()} {
+		reader, err := NewLineReader(bytes.NewReader(data), "dragons", 100)
+		assert.Nil(t, err)
+		messages := readAllRecords(t, reader)
+		assert.Len(t, messages, 2)
+		assert.Equal(t, []byte("falkor"), messages[1].Value)
+		assert.Equal(t, int64(1), messages[1].Offset)
+	}
+}
+
+func TestReplayRecords(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kasper-replay")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "dragons.avro")
+	assert.Nil(t, ioutil.WriteFile(path, newAvroContainer("null", dragonRecords), 0644))
+
+	reader, closer, err := OpenRecordFile(path, "dragons")
+	assert.Nil(t, err)
+	defer closer.Close()
+	sender := &bufferSender{}
+	count, err := ReplayRecords(reader, NewRouterProcessor("eggs"), sender, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, count)
+	assert.Len(t, sender.messages, 3)
+	assert.Equal(t, "eggs", sender.messages[2].Topic)
+
+	_, _, err = OpenRecordFile(filepath.Join(dir, "missing.json"), "dragons")
+	assert.NotNil(t, err)
+}
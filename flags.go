@@ -0,0 +1,183 @@
+package kasper
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// FlagProvider is a source of feature flags, e.g. environment variables, a file, or a client of a feature
+// flag service. Flags returns the raw value of every flag, see Flags for how values are evaluated.
+type FlagProvider interface {
+	Flags() (map[string]string, error)
+}
+
+// FlagSource gives MessageProcessors access to feature flags.
+// The Sender given to MessageProcessor.Process implements FlagSource, and so do the Senders wrapping it:
+//
+//	flags := kasper.FlagsOf(sender)
+//	if flags.EnabledFor("new-pricing", string(msg.Key)) {
+//		// new logic
+//	}
+type FlagSource interface {
+	Flags() *Flags
+}
+
+// FlagsOf returns the feature flags of the current Process call if sender implements FlagSource, and nil otherwise.
+func FlagsOf(sender Sender) *Flags {
+	source, ok := sender.(FlagSource)
+	if !ok {
+		return nil
+	}
+	return source.Flags()
+}
+
+// Flags is a snapshot of feature flags, refreshed every Config.FlagRefreshInterval from Config.FlagProvider.
+// It is safe for concurrent use. A nil *Flags has no flags, so that processors work without a FlagProvider.
+//
+// A flag value is either a boolean ("true", "false"), a percentage of keys ("25%"), or a comma-separated
+// list of keys ("tenant-a,tenant-b"). Percentages are stable: a key stays enabled when the percentage grows.
+type Flags struct {
+	mutex  sync.RWMutex
+	values map[string]string
+}
+
+// Value returns the raw value of a flag, or "" if it is not set.
+func (f *Flags) Value(name string) string {
+	if f == nil {
+		return ""
+	}
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+	return f.values[name]
+}
+
+// Enabled returns true if a flag is enabled for all keys.
+func (f *Flags) Enabled(name string) bool {
+	value, _ := strconv.ParseBool(f.Value(name))
+	return value
+}
+
+// EnabledFor returns true if a flag is enabled for a key, e.g. a message key or a tenant.
+func (f *Flags) EnabledFor(name, key string) bool {
+	value := strings.TrimSpace(f.Value(name))
+	if enabled, err := strconv.ParseBool(value); err == nil {
+		return enabled
+	}
+	if strings.HasSuffix(value, "%") {
+		percentage, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+		if err != nil {
+			return false
+		}
+		hash := fnv.New32a()
+		_, _ = hash.Write([]byte(name + "/" + key))
+		return float64(hash.Sum32()%10000) < percentage*100
+	}
+	for _, k := range strings.Split(value, ",") {
+		if strings.TrimSpace(k) == key {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *Flags) set(values map[string]string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.values = values
+}
+
+// Flags returns the feature flags of the TopicProcessor (nil without Config.FlagProvider).
+func (tp *TopicProcessor) Flags() *Flags {
+	return tp.flags
+}
+
+// Flags returns the feature flags of the TopicProcessor, see FlagSource.
+func (sender *sender) Flags() *Flags {
+	return sender.pp.topicProcessor.flags
+}
+
+func (tp *TopicProcessor) mustStartFlagRefresh() {
+	provider := tp.config.FlagProvider
+	if provider == nil {
+		return
+	}
+	values, err := provider.Flags()
+	if err != nil {
+		tp.logger.Panicf("Cannot load feature flags: %s", err)
+	}
+	tp.flags = &Flags{values: values}
+	tp.waitGroup.Add(1)
+	go func() {
+		defer tp.waitGroup.Done()
+		ticker := tp.config.clock().NewTicker(tp.config.FlagRefreshInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C():
+				tp.refreshFlags()
+			case <-tp.close:
+				return
+			case <-tp.loopDone:
+				return
+			}
+		}
+	}()
+}
+
+// refreshFlags reloads the feature flags, or keeps the previous flags if the FlagProvider fails.
+func (tp *TopicProcessor) refreshFlags() {
+	values, err := tp.config.FlagProvider.Flags()
+	if err != nil {
+		tp.logger.Errorf("Cannot refresh feature flags: %s", err)
+		return
+	}
+	tp.flags.set(values)
+}
+
+type envFlagProvider struct {
+	prefix string
+}
+
+// NewEnvFlagProvider returns a FlagProvider reading flags from the environment variables starting with prefix.
+// Flag names are the rest of the variable name, e.g. the flag "NEW_PRICING" of variable "KASPER_FLAG_NEW_PRICING"
+// with prefix "KASPER_FLAG_".
+func NewEnvFlagProvider(prefix string) FlagProvider {
+	return &envFlagProvider{prefix}
+}
+
+func (p *envFlagProvider) Flags() (map[string]string, error) {
+	values := make(map[string]string)
+	for _, variable := range os.Environ() {
+		i := strings.Index(variable, "=")
+		if i < 0 || !strings.HasPrefix(variable[:i], p.prefix) {
+			continue
+		}
+		values[variable[len(p.prefix):i]] = variable[i+1:]
+	}
+	return values, nil
+}
+
+type fileFlagProvider struct {
+	path string
+}
+
+// NewFileFlagProvider returns a FlagProvider reading flags from a JSON file mapping flag names to values,
+// e.g. {"new-pricing": "25%"}. The file is read again on every refresh.
+func NewFileFlagProvider(path string) FlagProvider {
+	return &fileFlagProvider{path}
+}
+
+func (p *fileFlagProvider) Flags() (map[string]string, error) {
+	data, err := ioutil.ReadFile(p.path)
+	if err != nil {
+		return nil, err
+	}
+	var values map[string]string
+	err = json.Unmarshal(data, &values)
+	return values, err
+}
@@ -0,0 +1,125 @@
+package kasper
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeFlagProvider struct {
+	values map[string]string
+	err    error
+}
+
+func (p *fakeFlagProvider) Flags() (map[string]string, error) {
+	return p.values, p.err
+}
+
+func TestFlags(t *testing.T) {
+	flags := &Flags{values: map[string]string{
+		"dragons": "true",
+		"fire":    "mushu, falkor",
+		"wings":   "50%",
+		"claws":   "0%",
+	}}
+	assert.True(t, flags.Enabled("dragons"))
+	assert.False(t, flags.Enabled("fire"))
+	assert.False(t, flags.Enabled("unknown"))
+	assert.Equal(t, "50%", flags.Value("wings"))
+
+	assert.True(t, flags.EnabledFor("dragons", "saphira"))
+	assert.True(t, flags.EnabledFor("fire", "falkor"))
+	assert.False(t, flags.EnabledFor("fire", "saphira"))
+	assert.False(t, flags.EnabledFor("claws", "saphira"))
+	enabled := 0
+	for i := 0; i < 1000; i++ {
+		if flags.EnabledFor("wings", strconv.Itoa(i)) {
+			enabled++
+		}
+	}
+	assert.InDelta(t, 500, enabled, 60)
+
+	var none *Flags
+	assert.False(t, none.Enabled("dragons"))
+	assert.False(t, none.EnabledFor("dragons", "mushu"))
+}
+
+func TestTopicProcessor_refreshFlags(t *testing.T) {
+	provider := &fakeFlagProvider{values: map[string]string{"dragons": "true"}}
+	tp := &TopicProcessor{
+		config: &Config{FlagProvider: provider, FlagRefreshInterval: 1},
+		close:  make(chan struct{}),
+		logger: &noopLogger{},
+	}
+	tp.mustStartFlagRefresh()
+	assert.True(t, tp.Flags().Enabled("dragons"))
+	close(tp.close)
+	tp.waitGroup.Wait()
+
+	provider.values = map[string]string{"dragons": "false"}
+	tp.refreshFlags()
+	assert.False(t, tp.Flags().Enabled("dragons"))
+
+	// The previous flags are kept when the provider fails
+	provider.err = errors.New("unavailable")
+	tp.refreshFlags()
+	assert.Equal(t, "false", tp.Flags().Value("dragons"))
+}
+
+func TestTopicProcessor_mustStartFlagRefresh_RunLoopReturned(t *testing.T) {
+	tp := &TopicProcessor{
+		config:   &Config{FlagProvider: &fakeFlagProvider{}, FlagRefreshInterval: time.Hour},
+		close:    make(chan struct{}),
+		loopDone: make(chan struct{}),
+		logger:   &noopLogger{},
+	}
+	tp.mustStartFlagRefresh()
+	close(tp.loopDone)
+	stopped := make(chan struct{})
+	go func() {
+		tp.waitGroup.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("flag refresh still running after RunLoop returned")
+	}
+}
+
+func TestFlagsOf(t *testing.T) {
+	flags := &Flags{values: map[string]string{"dragons": "true"}}
+	s := newSender(&partitionProcessor{topicProcessor: &TopicProcessor{flags: flags}})
+	assert.Nil(t, FlagsOf(&bufferSender{}))
+	assert.Equal(t, flags, FlagsOf(s))
+	assert.Equal(t, flags, FlagsOf(&auditSender{sender: &transformingSender{sender: s}}))
+	assert.True(t, FlagsOf(&chunkingSender{sender: s}).Enabled("dragons"))
+}
+
+func TestNewEnvFlagProvider(t *testing.T) {
+	os.Setenv("KASPER_TEST_FLAG_DRAGONS", "true")
+	defer os.Unsetenv("KASPER_TEST_FLAG_DRAGONS")
+	values, err := NewEnvFlagProvider("KASPER_TEST_FLAG_").Flags()
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"DRAGONS": "true"}, values)
+}
+
+func TestNewFileFlagProvider(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kasper-flags")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "flags.json")
+	assert.Nil(t, ioutil.WriteFile(path, []byte(`{"fire": "25%"}`), 0644))
+	values, err := NewFileFlagProvider(path).Flags()
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"fire": "25%"}, values)
+
+	_, err = NewFileFlagProvider(filepath.Join(dir, "missing.json")).Flags()
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,173 @@
+package kasper
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// TestingT is the subset of testing.TB used by RunGoldenTest.
+type TestingT interface {
+	Errorf(format string, args ...interface{})
+}
+
+// GoldenRecord is a message of the fixtures and golden files of RunGoldenTest, stored as one JSON object per line.
+// A nil Value is a tombstone.
+type GoldenRecord struct {
+	Topic     string     `json:"topic"`
+	Partition int32      `json:"partition,omitempty"`
+	Key       string     `json:"key,omitempty"`
+	Value     *string    `json:"value"`
+	Timestamp *time.Time `json:"timestamp,omitempty"`
+}
+
+// RunGoldenTest regression-tests the logic of a MessageProcessor against recorded fixtures in dir:
+//
+//	input.jsonl    incoming messages (GoldenRecords), processed in batches of up to batchSize messages
+//	output.jsonl   golden outgoing messages (GoldenRecords), in the order they were sent
+//	stores.json    golden final contents of stores, by store name and key
+//
+// Mismatches are reported through t with a unified diff. When update is true (e.g. set by an -update test flag),
+// the golden files are rewritten with the actual results instead. Incoming messages are numbered from offset 0
+// in each topic partition.
+func RunGoldenTest(t TestingT, dir string, messageProcessor MessageProcessor, stores map[string]*Map, batchSize int, update bool) {
+	file, err := os.Open(filepath.Join(dir, "input.jsonl"))
+	if err != nil {
+		t.Errorf("Cannot open golden test input: %s", err)
+		return
+	}
+	defer file.Close()
+	sender := &bufferSender{}
+	_, err = ReplayRecords(newGoldenReader(file), messageProcessor, sender, batchSize)
+	if err != nil {
+		t.Errorf("Cannot process golden test input: %s", err)
+		return
+	}
+	var output bytes.Buffer
+	encoder := json.NewEncoder(&output)
+	for _, msg := range sender.messages {
+		err = encoder.Encode(newGoldenRecord(msg))
+		if err != nil {
+			t.Errorf("Cannot encode outgoing message: %s", err)
+			return
+		}
+	}
+	contents := make(map[string]map[string]string, len(stores))
+	for name, store := range stores {
+		contents[name] = make(map[string]string)
+		for key, value := range store.GetMap() {
+			contents[name][key] = string(value)
+		}
+	}
+	storesJSON, err := json.MarshalIndent(contents, "", "  ")
+	if err != nil {
+		t.Errorf("Cannot encode store contents: %s", err)
+		return
+	}
+	compareGolden(t, filepath.Join(dir, "output.jsonl"), output.Bytes(), update)
+	compareGolden(t, filepath.Join(dir, "stores.json"), append(storesJSON, '\n'), update)
+}
+
+func compareGolden(t TestingT, path string, actual []byte, update bool) {
+	if update {
+		err := ioutil.WriteFile(path, actual, 0644)
+		if err != nil {
+			t.Errorf("Cannot update golden file: %s", err)
+		}
+		return
+	}
+	expected, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Errorf("Cannot read golden file: %s", err)
+		return
+	}
+	if bytes.Equal(expected, actual) {
+		return
+	}
+	diff, _ := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(expected)),
+		B:        difflib.SplitLines(string(actual)),
+		FromFile: path,
+		ToFile:   "actual",
+		Context:  2,
+	})
+	t.Errorf("Golden file %s does not match:\n%s", path, diff)
+}
+
+func newGoldenRecord(msg *sarama.ProducerMessage) *GoldenRecord {
+	record := &GoldenRecord{Topic: msg.Topic, Partition: msg.Partition}
+	if msg.Key != nil {
+		key, _ := msg.Key.Encode()
+		record.Key = string(key)
+	}
+	if msg.Value != nil {
+		value, _ := msg.Value.Encode()
+		s := string(value)
+		record.Value = &s
+	}
+	if !msg.Timestamp.IsZero() {
+		timestamp := msg.Timestamp.UTC()
+		record.Timestamp = &timestamp
+	}
+	return record
+}
+
+// goldenReader is a RecordReader of GoldenRecords.
+type goldenReader struct {
+	scanner *bufio.Scanner
+	offsets map[string]map[int32]int64
+	line    int
+}
+
+func newGoldenReader(r io.Reader) *goldenReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	return &goldenReader{scanner, make(map[string]map[int32]int64), 0}
+}
+
+func (g *goldenReader) Next() (*sarama.ConsumerMessage, error) {
+	for g.scanner.Scan() {
+		g.line++
+		line := bytes.TrimSpace(g.scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var record GoldenRecord
+		err := json.Unmarshal(line, &record)
+		if err != nil {
+			return nil, fmt.Errorf("invalid record on line %d: %s", g.line, err)
+		}
+		if g.offsets[record.Topic] == nil {
+			g.offsets[record.Topic] = make(map[int32]int64)
+		}
+		message := &sarama.ConsumerMessage{
+			Topic:     record.Topic,
+			Partition: record.Partition,
+			Offset:    g.offsets[record.Topic][record.Partition],
+		}
+		g.offsets[record.Topic][record.Partition]++
+		if record.Key != "" {
+			message.Key = []byte(record.Key)
+		}
+		if record.Value != nil {
+			message.Value = []byte(*record.Value)
+		}
+		if record.Timestamp != nil {
+			message.Timestamp = *record.Timestamp
+		}
+		return message, nil
+	}
+	if err := g.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
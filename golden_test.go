@@ -0,0 +1,68 @@
+package kasper
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingT struct {
+	errors []string
+}
+
+func (t *recordingT) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+type materializingRouter struct {
+	table  *TableMaterializer
+	router *RouterProcessor
+}
+
+func (p *materializingRouter) Process(messages []*sarama.ConsumerMessage, sender Sender) error {
+	err := p.table.Process(messages, sender)
+	if err != nil {
+		return err
+	}
+	return p.router.Process(messages, sender)
+}
+
+func TestRunGoldenTest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kasper-golden")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	input := `{"topic": "dragons", "key": "mushu", "value": "red"}
+{"topic": "dragons", "key": "falkor", "value": "white"}
+{"topic": "dragons", "key": "mushu", "value": null}
+`
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "input.jsonl"), []byte(input), 0644))
+
+	run := func(topic string, update bool) *recordingT {
+		store := NewMap(10)
+		recorder := &recordingT{}
+		mp := &materializingRouter{NewTableMaterializer(store), NewRouterProcessor(topic)}
+		RunGoldenTest(recorder, dir, mp, map[string]*Map{"dragons": store}, 2, update)
+		return recorder
+	}
+	assert.Empty(t, run("colors", true).errors)
+	output, err := ioutil.ReadFile(filepath.Join(dir, "output.jsonl"))
+	assert.Nil(t, err)
+	assert.Equal(t, `{"topic":"colors","key":"mushu","value":"red"}
+{"topic":"colors","key":"falkor","value":"white"}
+{"topic":"colors","key":"mushu","value":null}
+`, string(output))
+	stores, err := ioutil.ReadFile(filepath.Join(dir, "stores.json"))
+	assert.Nil(t, err)
+	assert.Equal(t, "{\n  \"dragons\": {\n    \"falkor\": \"white\"\n  }\n}\n", string(stores))
+
+	assert.Empty(t, run("colors", false).errors)
+	errors := run("hues", false).errors
+	assert.Len(t, errors, 1)
+	assert.True(t, strings.Contains(errors[0], `+{"topic":"hues","key":"falkor","value":"white"}`))
+}
@@ -0,0 +1,141 @@
+package kasper
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// GRPCStream is a client-side gRPC stream of records, typically a thin adapter around a generated
+// client-streaming or bidirectional stream which converts messages to the service's record type.
+// Send blocks when the stream's HTTP/2 flow control window is exhausted, which in turn blocks processing.
+type GRPCStream interface {
+	Send(message *sarama.ConsumerMessage) error
+	CloseSend() error
+}
+
+// GRPCAckingStream is a bidirectional GRPCStream on which the server acknowledges records in order.
+type GRPCAckingStream interface {
+	GRPCStream
+	// RecvAck blocks until the server acknowledges records and returns how many were acknowledged.
+	RecvAck() (int, error)
+}
+
+// GRPCStreamDialer opens a new GRPCStream.
+type GRPCStreamDialer func() (GRPCStream, error)
+
+// GRPCStreamSink is a MessageProcessor that streams incoming messages to a gRPC server.
+//
+// If the stream is a GRPCAckingStream, at most window records are in flight without acknowledgement, and a batch is
+// only complete (and its offsets committable) once all of its records have been acknowledged. Otherwise, records are
+// considered delivered once sent. When the stream fails, it is closed and dialed again up to maxRetries times, waiting
+// backoff in between, and the unacknowledged records of the batch are sent again, so records may be duplicated.
+// The wait is cut short when the context of the Process call is done (see ContextSource).
+type GRPCStreamSink struct {
+	dial       GRPCStreamDialer
+	window     int
+	maxRetries int
+	backoff    time.Duration
+	stream     GRPCStream
+	pending    []*sarama.ConsumerMessage
+	clock      Clock
+}
+
+// NewGRPCStreamSink creates a GRPCStreamSink opening streams with dial.
+func NewGRPCStreamSink(dial GRPCStreamDialer, window, maxRetries int, backoff time.Duration) *GRPCStreamSink {
+	return &GRPCStreamSink{
+		dial:       dial,
+		window:     window,
+		maxRetries: maxRetries,
+		backoff:    backoff,
+		clock:      SystemClock{},
+	}
+}
+
+// SetClock sets the Clock used to wait between retries, e.g. a FakeClock in tests.
+func (s *GRPCStreamSink) SetClock(clock Clock) {
+	s.clock = clock
+}
+
+// Process streams a batch of messages and waits until they have been acknowledged.
+func (s *GRPCStreamSink) Process(messages []*sarama.ConsumerMessage, sender Sender) error {
+	queue := messages
+	var err error
+	for retry := 0; ; retry++ {
+		err = s.deliver(&queue)
+		if err == nil {
+			return nil
+		}
+		s.Close()
+		queue = append(s.pending, queue...)
+		s.pending = nil
+		if retry >= s.maxRetries {
+			return fmt.Errorf("cannot stream records to gRPC server: %s", err)
+		}
+		ctx := ContextOf(sender)
+		select {
+		case <-s.clock.After(s.backoff):
+		case <-ctx.Done():
+			return fmt.Errorf("cannot stream records to gRPC server: %s (%s)", err, ctx.Err())
+		}
+	}
+}
+
+// deliver sends the queued messages, dialing a stream if needed, and waits for their acknowledgement.
+func (s *GRPCStreamSink) deliver(queue *[]*sarama.ConsumerMessage) error {
+	if s.stream == nil {
+		stream, err := s.dial()
+		if err != nil {
+			return err
+		}
+		s.stream = stream
+	}
+	acking, isAcking := s.stream.(GRPCAckingStream)
+	for len(*queue) > 0 {
+		if isAcking && len(s.pending) >= s.window {
+			err := s.recvAck(acking)
+			if err != nil {
+				return err
+			}
+		}
+		message := (*queue)[0]
+		err := s.stream.Send(message)
+		if err != nil {
+			return err
+		}
+		*queue = (*queue)[1:]
+		if isAcking {
+			s.pending = append(s.pending, message)
+		}
+	}
+	for isAcking && len(s.pending) > 0 {
+		err := s.recvAck(acking)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *GRPCStreamSink) recvAck(stream GRPCAckingStream) error {
+	n, err := stream.RecvAck()
+	if err != nil {
+		return err
+	}
+	if n > len(s.pending) {
+		n = len(s.pending)
+	}
+	s.pending = s.pending[n:]
+	return nil
+}
+
+// Close closes the current stream, if any. A new stream is dialed on the next batch.
+func (s *GRPCStreamSink) Close() error {
+	if s.stream == nil {
+		return nil
+	}
+	err := s.stream.CloseSend()
+	s.stream = nil
+	return err
+}
@@ -0,0 +1,106 @@
+package kasper
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeGRPCStream struct {
+	sent   []string
+	acks   int
+	failAt int
+	closed bool
+}
+
+func (s *fakeGRPCStream) Send(message *sarama.ConsumerMessage) error {
+	if len(s.sent) == s.failAt {
+		return errors.New("stream reset")
+	}
+	s.sent = append(s.sent, string(message.Value))
+	return nil
+}
+
+func (s *fakeGRPCStream) CloseSend() error {
+	s.closed = true
+	return nil
+}
+
+type fakeGRPCAckingStream struct {
+	fakeGRPCStream
+}
+
+func (s *fakeGRPCAckingStream) RecvAck() (int, error) {
+	s.acks++
+	return 1, nil
+}
+
+func grpcTestMessages(values ...string) []*sarama.ConsumerMessage {
+	messages := make([]*sarama.ConsumerMessage, len(values))
+	for i, value := range values {
+		messages[i] = &sarama.ConsumerMessage{Value: []byte(value)}
+	}
+	return messages
+}
+
+func TestGRPCStreamSink_Acking(t *testing.T) {
+	stream := &fakeGRPCAckingStream{fakeGRPCStream{failAt: -1}}
+	sink := NewGRPCStreamSink(func() (GRPCStream, error) { return stream, nil }, 2, 0, 0)
+	assert.Nil(t, sink.Process(grpcTestMessages("mushu", "falkor", "saphira"), &bufferSender{}))
+	assert.Equal(t, []string{"mushu", "falkor", "saphira"}, stream.sent)
+	assert.Equal(t, 3, stream.acks)
+	assert.Empty(t, sink.pending)
+}
+
+func TestGRPCStreamSink_Reconnect(t *testing.T) {
+	streams := []*fakeGRPCStream{{failAt: 1}, {failAt: -1}}
+	dials := 0
+	sink := NewGRPCStreamSink(func() (GRPCStream, error) {
+		stream := streams[dials]
+		dials++
+		return stream, nil
+	}, 10, 1, 0)
+	assert.Nil(t, sink.Process(grpcTestMessages("mushu", "falkor"), &bufferSender{}))
+	assert.True(t, streams[0].closed)
+	assert.Equal(t, []string{"falkor"}, streams[1].sent)
+}
+
+func TestGRPCStreamSink_Error(t *testing.T) {
+	sink := NewGRPCStreamSink(func() (GRPCStream, error) { return nil, errors.New("connection refused") }, 10, 2, 0)
+	err := sink.Process(grpcTestMessages("mushu"), &bufferSender{})
+	assert.EqualError(t, err, "cannot stream records to gRPC server: connection refused")
+}
+
+func TestGRPCStreamSink_Backoff(t *testing.T) {
+	streams := []*fakeGRPCStream{{failAt: 0}, {failAt: -1}}
+	dials := 0
+	sink := NewGRPCStreamSink(func() (GRPCStream, error) {
+		stream := streams[dials]
+		dials++
+		return stream, nil
+	}, 10, 1, time.Second)
+	clock := NewFakeClock(time.Unix(0, 0))
+	sink.SetClock(clock)
+	done := make(chan error)
+	go func() {
+		done <- sink.Process(grpcTestMessages("mushu"), &bufferSender{})
+	}()
+	for clock.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	clock.Advance(time.Second)
+	assert.Nil(t, <-done)
+	assert.Equal(t, []string{"mushu"}, streams[1].sent)
+
+	// The backoff is cut short when the Process call is cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	sink = NewGRPCStreamSink(func() (GRPCStream, error) { return nil, errors.New("connection refused") }, 10, 1, time.Hour)
+	sink.SetClock(clock)
+	err := sink.Process(grpcTestMessages("mushu"), &bufferSender{ctx: ctx})
+	assert.EqualError(t, err, "cannot stream records to gRPC server: connection refused (context canceled)")
+}
@@ -0,0 +1,67 @@
+package kasper
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+func (config *Config) handoffKey(partition int) string {
+	return fmt.Sprintf("kasper-handoff/%s/%d", config.TopicProcessorName, partition)
+}
+
+// waitForHandoff blocks until the owner of the given generation has released the partition,
+// or until Config.HandoffTimeout has elapsed.
+func waitForHandoff(config *Config, partition int, generation int64) {
+	if !config.GracefulHandoff || generation == 0 {
+		return
+	}
+	key := config.handoffKey(partition)
+	deadline := config.clock().Now().Add(config.HandoffTimeout)
+	config.Logger.Infof("Waiting for generation %d to hand off partition %d...", generation, partition)
+	for {
+		released, err := readGeneration(config.FencingStore, key)
+		if err != nil {
+			config.Logger.Panic(err)
+		}
+		if released >= generation {
+			config.Logger.Infof("Generation %d has handed off partition %d", generation, partition)
+			return
+		}
+		if config.clock().Now().After(deadline) {
+			config.Logger.Infof("Generation %d did not hand off partition %d within %s, taking over", generation, partition, config.HandoffTimeout)
+			return
+		}
+		config.clock().Sleep(100 * time.Millisecond)
+	}
+}
+
+// handOff commits the offsets of pp and then releases the partition.
+// The partition is not released when the commit fails, so that the next owner doesn't start from stale offsets
+// before Config.HandoffTimeout has elapsed.
+func (pp *partitionProcessor) handOff() error {
+	err := pp.commitOffsets()
+	if err != nil {
+		return err
+	}
+	pp.releasePartition()
+	return nil
+}
+
+// releasePartition writes the handoff marker of the partition, telling the next owner it can start.
+// It must be called once all offsets have been committed, see handOff.
+func (pp *partitionProcessor) releasePartition() {
+	config := pp.topicProcessor.config
+	if !config.GracefulHandoff {
+		return
+	}
+	err := config.FencingStore.Put(config.handoffKey(pp.partition), []byte(strconv.FormatInt(pp.generation, 10)))
+	if err == nil {
+		err = config.FencingStore.Flush()
+	}
+	if err != nil {
+		pp.logger.Errorf("Cannot write handoff marker of partition %d: %s", pp.partition, err)
+		return
+	}
+	pp.logger.Infof("Handed off partition %d (generation %d)", pp.partition, pp.generation)
+}
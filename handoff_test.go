@@ -0,0 +1,115 @@
+package kasper
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGracefulHandoff(t *testing.T) {
+	store := &lockedStore{Store: NewMap(10)}
+	config := &Config{
+		TopicProcessorName: "test",
+		Logger:             &noopLogger{},
+		FencingStore:       store,
+		GracefulHandoff:    true,
+		HandoffTimeout:     time.Minute,
+	}
+	tp := &TopicProcessor{config: config}
+	old := &partitionProcessor{topicProcessor: tp, partition: 0, logger: config.Logger}
+	old.generation = mustAcquireGeneration(config, 0)
+
+	acquired := make(chan int64)
+	go func() {
+		acquired <- mustAcquireGeneration(config, 0)
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("partition acquired before handoff")
+	case <-time.After(200 * time.Millisecond):
+	}
+	old.releasePartition()
+	assert.Equal(t, int64(2), <-acquired)
+}
+
+func TestGracefulHandoff_Timeout(t *testing.T) {
+	store := NewMap(10)
+	store.Put("kasper-generation/test/0", []byte("1"))
+	config := &Config{
+		TopicProcessorName: "test",
+		Logger:             &noopLogger{},
+		FencingStore:       store,
+		GracefulHandoff:    true,
+		HandoffTimeout:     time.Millisecond,
+	}
+	assert.Equal(t, int64(2), mustAcquireGeneration(config, 0))
+}
+
+type lockedStore struct {
+	mutex sync.Mutex
+	Store
+}
+
+func (s *lockedStore) Get(key string) ([]byte, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.Store.Get(key)
+}
+
+func (s *lockedStore) Put(key string, value []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.Store.Put(key, value)
+}
+
+func TestPartitionProcessor_handOff(t *testing.T) {
+	broker := sarama.NewMockBroker(t, 1)
+	defer broker.Close()
+	group := TopicProcessorConsumerGroup("test")
+	commits := sarama.NewMockOffsetCommitResponse(t)
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest":         sarama.NewMockMetadataResponse(t).SetBroker(broker.Addr(), broker.BrokerID()),
+		"ConsumerMetadataRequest": sarama.NewMockConsumerMetadataResponse(t).SetCoordinator(group, broker),
+		"OffsetCommitRequest":     commits,
+	})
+	client, err := sarama.NewClient([]string{broker.Addr()}, sarama.NewConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	offsetManager, err := sarama.NewOffsetManagerFromClient(group, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := NewMap(10)
+	config := &Config{
+		TopicProcessorName: "test",
+		Client:             client,
+		Logger:             &noopLogger{},
+		FencingStore:       store,
+		GracefulHandoff:    true,
+	}
+	tp := &TopicProcessor{config: config, offsetManager: offsetManager}
+	pp := &partitionProcessor{
+		topicProcessor: tp,
+		offsetManagers: map[string]sarama.PartitionOffsetManager{"hello": &fakePartitionOffsetManager{offset: 42}},
+		partition:      0,
+		logger:         config.Logger,
+		generation:     1,
+	}
+
+	commits.SetError(group, "hello", 0, sarama.ErrNotCoordinatorForConsumer)
+	assert.Error(t, pp.handOff())
+	marker, _ := store.Get(config.handoffKey(0))
+	assert.Nil(t, marker)
+
+	commits.SetError(group, "hello", 0, sarama.ErrNoError)
+	assert.NoError(t, pp.handOff())
+	marker, _ = store.Get(config.handoffKey(0))
+	assert.Equal(t, "1", string(marker))
+	request := broker.History()[len(broker.History())-1].Request.(*sarama.OffsetCommitRequest)
+	assert.Equal(t, group, request.ConsumerGroup)
+}
@@ -0,0 +1,125 @@
+package kasper
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/prometheus/common/expfmt"
+)
+
+// HTTPHandler returns the http.Handler of the embedded HTTP server (see Config.HTTPAddress), which serves:
+//
+//	/health          200 while the TopicProcessor is running, 503 once it is draining or closed
+//	/metrics         the metrics in Prometheus format, if Config.MetricsProvider is a *Prometheus
+//	/scaling         the ScalingSignal as JSON
+//	/debug/...       the routes of DiagnosticsHandler
+//
+// as well as the routes of Config.HTTPRoutes, which take precedence.
+func (tp *TopicProcessor) HTTPHandler() http.Handler {
+	routes := map[string]http.Handler{
+		"/health":  http.HandlerFunc(tp.healthHandler),
+		"/debug/":  tp.DiagnosticsHandler(),
+		"/scaling": http.HandlerFunc(tp.scalingHandler),
+	}
+	if prometheus, ok := tp.config.MetricsProvider.(*Prometheus); ok {
+		routes["/metrics"] = prometheusHandler(prometheus)
+	}
+	for pattern, handler := range tp.config.HTTPRoutes {
+		routes[pattern] = handler
+	}
+	mux := http.NewServeMux()
+	for pattern, handler := range routes {
+		mux.Handle(pattern, handler)
+	}
+	return mux
+}
+
+func (tp *TopicProcessor) healthHandler(w http.ResponseWriter, r *http.Request) {
+	if tp.isClosed() || tp.isDraining() {
+		http.Error(w, "stopping", http.StatusServiceUnavailable)
+		return
+	}
+	_, _ = w.Write([]byte("ok\n"))
+}
+
+func prometheusHandler(provider *Prometheus) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		families, err := provider.Registry.Gather()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		format := expfmt.Negotiate(r.Header)
+		w.Header().Set("Content-Type", string(format))
+		encoder := expfmt.NewEncoder(w, format)
+		for _, family := range families {
+			err := encoder.Encode(family)
+			if err != nil {
+				return
+			}
+		}
+	})
+}
+
+// NewStoreQueryHandler returns an http.Handler for interactive queries of a Store, to be added to Config.HTTPRoutes.
+// GET requests return the value of the "key" query parameter as is, or 404 if it is not found. When "key" is repeated,
+// the found values are returned as a JSON object of strings.
+func NewStoreQueryHandler(store Store) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys := r.URL.Query()["key"]
+		switch {
+		case r.Method != "GET":
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		case len(keys) == 0:
+			http.Error(w, "missing key", http.StatusBadRequest)
+		case len(keys) == 1:
+			value, err := store.Get(keys[0])
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			} else if value == nil {
+				http.NotFound(w, r)
+			} else {
+				_, _ = w.Write(value)
+			}
+		default:
+			values, err := store.GetAll(keys)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			result := make(map[string]string, len(values))
+			for key, value := range values {
+				result[key] = string(value)
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(result)
+		}
+	})
+}
+
+func (tp *TopicProcessor) startHTTPServer() {
+	if tp.config.HTTPAddress == "" {
+		return
+	}
+	tp.httpServer = &http.Server{
+		Addr:    tp.config.HTTPAddress,
+		Handler: tp.HTTPHandler(),
+	}
+	tp.logger.Infof("Serving HTTP on %s", tp.config.HTTPAddress)
+	go func() {
+		err := tp.httpServer.ListenAndServe()
+		if err != nil && err != http.ErrServerClosed {
+			tp.logger.Errorf("HTTP server failed: %s", err)
+		}
+	}()
+}
+
+func (tp *TopicProcessor) stopHTTPServer() {
+	if tp.httpServer == nil {
+		return
+	}
+	err := tp.httpServer.Close()
+	if err != nil {
+		tp.logger.Errorf("Cannot close HTTP server: %s", err)
+	}
+}
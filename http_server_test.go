@@ -0,0 +1,42 @@
+package kasper
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTopicProcessor_HTTPHandler(t *testing.T) {
+	prometheus := NewPrometheus("http")
+	prometheus.NewCounter("dragon_count", "Number of dragons").Inc()
+	store := NewMap(10)
+	assert.Nil(t, store.Put("mushu", mushu))
+	assert.Nil(t, store.Put("saphira", []byte("blue")))
+	tp := &TopicProcessor{
+		config: &Config{
+			MetricsProvider: prometheus,
+			HTTPRoutes:      map[string]http.Handler{"/dragons": NewStoreQueryHandler(store)},
+		},
+		logger: &noopLogger{},
+		close:  make(chan struct{}),
+	}
+	handler := tp.HTTPHandler()
+	get := func(target string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest("GET", target, nil))
+		return recorder
+	}
+
+	assert.Equal(t, http.StatusOK, get("/health").Code)
+	assert.True(t, strings.Contains(get("/metrics").Body.String(), `kasper_dragon_count{label="http"} 1`))
+	assert.Equal(t, http.StatusOK, get("/debug/pprof/").Code)
+	assert.Equal(t, string(mushu), get("/dragons?key=mushu").Body.String())
+	assert.Equal(t, http.StatusNotFound, get("/dragons?key=falkor").Code)
+	assert.Equal(t, "{\"saphira\":\"blue\"}\n", get("/dragons?key=saphira&key=falkor").Body.String())
+
+	close(tp.close)
+	assert.Equal(t, http.StatusServiceUnavailable, get("/health").Code)
+}
@@ -0,0 +1,66 @@
+package kasper
+
+import (
+	"hash/fnv"
+	"math"
+	"math/bits"
+)
+
+const (
+	hyperLogLogPrecision = 12
+	hyperLogLogRegisters = 1 << hyperLogLogPrecision
+)
+
+// hyperLogLog is a HyperLogLog sketch with one byte per register, so that it can be stored as is.
+type hyperLogLog struct {
+	registers []byte
+}
+
+// newHyperLogLog creates a sketch from its registers, or an empty sketch if registers is not a valid sketch.
+func newHyperLogLog(registers []byte) *hyperLogLog {
+	if len(registers) != hyperLogLogRegisters {
+		return &hyperLogLog{make([]byte, hyperLogLogRegisters)}
+	}
+	copied := make([]byte, hyperLogLogRegisters)
+	copy(copied, registers)
+	return &hyperLogLog{copied}
+}
+
+func (h *hyperLogLog) add(item []byte) {
+	hash := fnv.New64a()
+	_, _ = hash.Write(item)
+	x := mix64(hash.Sum64())
+	index := x >> (64 - hyperLogLogPrecision)
+	rank := byte(bits.LeadingZeros64(x<<hyperLogLogPrecision|1<<(hyperLogLogPrecision-1)) + 1)
+	if rank > h.registers[index] {
+		h.registers[index] = rank
+	}
+}
+
+func (h *hyperLogLog) count() uint64 {
+	sum := 0.0
+	zeros := 0
+	for _, register := range h.registers {
+		sum += 1 / float64(uint64(1)<<register)
+		if register == 0 {
+			zeros++
+		}
+	}
+	m := float64(hyperLogLogRegisters)
+	estimate := 0.7213 / (1 + 1.079/m) * m * m / sum
+	if estimate <= 2.5*m && zeros > 0 {
+		// Small range correction (linear counting)
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return uint64(estimate + 0.5)
+}
+
+// mix64 is the finalizer of MurmurHash3, which spreads the bits of FNV hashes evenly.
+func mix64(x uint64) uint64 {
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
@@ -0,0 +1,110 @@
+package kasper
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"sync"
+
+	"github.com/Shopify/sarama"
+)
+
+// KeyAffinityProcessor is a MessageProcessor that processes a batch of messages in parallel while preserving
+// per-key ordering. Each message is dispatched to a fixed worker chosen by hashing its key, so all messages with
+// the same key are processed by the same worker, in order. This is useful for I/O heavy enrichments.
+//
+// Workers run in their own goroutines and must be safe to run concurrently with each other.
+// Messages sent by workers are buffered and passed on to the TopicProcessor's Sender, worker by worker,
+// once all workers have returned. Calling Flush() from a worker has no effect.
+type KeyAffinityProcessor struct {
+	workers []MessageProcessor
+}
+
+// NewKeyAffinityProcessor creates a KeyAffinityProcessor that dispatches messages to the given workers.
+// At least one worker is required.
+func NewKeyAffinityProcessor(workers ...MessageProcessor) (*KeyAffinityProcessor, error) {
+	if len(workers) == 0 {
+		return nil, errors.New("KeyAffinityProcessor requires at least one worker")
+	}
+	return &KeyAffinityProcessor{workers}, nil
+}
+
+// Process splits messages by key and runs all workers concurrently.
+// If several workers fail, the error of the first failing worker (by index) is returned
+// and no messages are passed on to sender.
+func (p *KeyAffinityProcessor) Process(messages []*sarama.ConsumerMessage, sender Sender) error {
+	batches := make([][]*sarama.ConsumerMessage, len(p.workers))
+	for _, message := range messages {
+		worker := p.workerIndex(message.Key)
+		batches[worker] = append(batches[worker], message)
+	}
+	senders := make([]*bufferSender, len(p.workers))
+	errs := make([]error, len(p.workers))
+	var wg sync.WaitGroup
+	for i, batch := range batches {
+		if len(batch) == 0 {
+			continue
+		}
+		senders[i] = &bufferSender{ctx: ContextOf(sender), committer: CommitterOf(sender), flags: FlagsOf(sender)}
+		wg.Add(1)
+		go func(i int, batch []*sarama.ConsumerMessage) {
+			defer wg.Done()
+			errs[i] = p.workers[i].Process(batch, senders[i])
+		}(i, batch)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	for _, s := range senders {
+		if s == nil {
+			continue
+		}
+		for _, message := range s.messages {
+			sender.Send(message)
+		}
+	}
+	return nil
+}
+
+func (p *KeyAffinityProcessor) workerIndex(key []byte) int {
+	h := fnv.New32a()
+	_, _ = h.Write(key)
+	return int(h.Sum32() % uint32(len(p.workers)))
+}
+
+type bufferSender struct {
+	messages  []*sarama.ProducerMessage
+	ctx       context.Context
+	committer Committer
+	flags     *Flags
+}
+
+func (s *bufferSender) Send(msg *sarama.ProducerMessage) {
+	s.messages = append(s.messages, msg)
+}
+
+func (s *bufferSender) SendTombstone(topic string, key sarama.Encoder) {
+	s.Send(&sarama.ProducerMessage{Topic: topic, Key: key})
+}
+
+func (s *bufferSender) Flush() error {
+	return nil
+}
+
+func (s *bufferSender) Context() context.Context {
+	if s.ctx == nil {
+		return context.Background()
+	}
+	return s.ctx
+}
+
+func (s *bufferSender) Committer() Committer {
+	return s.committer
+}
+
+func (s *bufferSender) Flags() *Flags {
+	return s.flags
+}
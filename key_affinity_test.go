@@ -0,0 +1,68 @@
+package kasper
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+type keyOrderProcessor struct {
+	mutex sync.Mutex
+	seen  map[string][]int64
+}
+
+func (p *keyOrderProcessor) Process(messages []*sarama.ConsumerMessage, sender Sender) error {
+	for _, message := range messages {
+		p.mutex.Lock()
+		p.seen[string(message.Key)] = append(p.seen[string(message.Key)], message.Offset)
+		p.mutex.Unlock()
+		sender.Send(&sarama.ProducerMessage{Topic: "out", Key: sarama.ByteEncoder(message.Key)})
+	}
+	return nil
+}
+
+func TestKeyAffinityProcessor_Process(t *testing.T) {
+	worker := &keyOrderProcessor{seen: make(map[string][]int64)}
+	p, err := NewKeyAffinityProcessor(worker, worker, worker, worker)
+	assert.Nil(t, err)
+	var messages []*sarama.ConsumerMessage
+	for i := 0; i < 100; i++ {
+		key := []byte(fmt.Sprintf("key-%d", i%10))
+		messages = append(messages, &sarama.ConsumerMessage{Key: key, Offset: int64(i)})
+	}
+	s := &bufferSender{}
+	assert.Nil(t, p.Process(messages, s))
+	assert.Len(t, s.messages, 100)
+	assert.Len(t, worker.seen, 10)
+	for key, offsets := range worker.seen {
+		assert.Len(t, offsets, 10, key)
+		for i := 1; i < len(offsets); i++ {
+			assert.True(t, offsets[i-1] < offsets[i], key)
+		}
+	}
+}
+
+type failingMessageProcessor struct{}
+
+func (failingMessageProcessor) Process([]*sarama.ConsumerMessage, Sender) error {
+	return errors.New("failed")
+}
+
+func TestKeyAffinityProcessor_Process_Error(t *testing.T) {
+	p, err := NewKeyAffinityProcessor(failingMessageProcessor{})
+	assert.Nil(t, err)
+	s := &bufferSender{}
+	err = p.Process([]*sarama.ConsumerMessage{{Key: []byte("a")}}, s)
+	assert.NotNil(t, err)
+	assert.Empty(t, s.messages)
+}
+
+func TestNewKeyAffinityProcessor_NoWorkers(t *testing.T) {
+	p, err := NewKeyAffinityProcessor()
+	assert.Nil(t, p)
+	assert.EqualError(t, err, "KeyAffinityProcessor requires at least one worker")
+}
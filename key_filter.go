@@ -0,0 +1,90 @@
+package kasper
+
+import (
+	"github.com/Shopify/sarama"
+)
+
+// KeyPredicate is a condition on the topic and key of an incoming message, which never looks at its value.
+// Keys can be matched on a prefix (see bytes.HasPrefix) or deserialized on their own.
+type KeyPredicate func(topic string, key []byte) bool
+
+// KeyFilter is a MessageProcessor that passes to another MessageProcessor only the incoming messages whose key
+// matches a KeyPredicate, for filter-heavy pipelines where most messages are discarded.
+//
+// When KeyFilter wraps value-decoding MessageProcessors such as CompressingProcessor, EncryptingProcessor or
+// SigningProcessor, the values of filtered out messages are never decoded. Within Process, deserialization of
+// the remaining values can be deferred until they are accessed with LazyValue.
+// Offsets of filtered out messages are committed as usual.
+type KeyFilter struct {
+	messageProcessor MessageProcessor
+	predicate        KeyPredicate
+}
+
+// NewKeyFilter creates a KeyFilter passing the messages matching predicate to messageProcessor.
+func NewKeyFilter(messageProcessor MessageProcessor, predicate KeyPredicate) *KeyFilter {
+	return &KeyFilter{messageProcessor, predicate}
+}
+
+// Process filters a batch of messages and processes the remaining ones, if any.
+func (f *KeyFilter) Process(messages []*sarama.ConsumerMessage, sender Sender) error {
+	filtered := make([]*sarama.ConsumerMessage, 0, len(messages))
+	for _, message := range messages {
+		if f.predicate(message.Topic, message.Key) {
+			filtered = append(filtered, message)
+		}
+	}
+	if len(filtered) == 0 {
+		return nil
+	}
+	return f.messageProcessor.Process(filtered, sender)
+}
+
+// ValueDecoder deserializes the value of a message, e.g. with json.Unmarshal.
+type ValueDecoder func(value []byte) (interface{}, error)
+
+// LazyValue defers the deserialization of a message value until it is first accessed, so that messages skipped
+// by routing or filtering decisions made on their key are never deserialized. The result is cached.
+// A LazyValue is not safe for concurrent use.
+type LazyValue struct {
+	raw     []byte
+	decode  ValueDecoder
+	decoded bool
+	value   interface{}
+	err     error
+}
+
+// NewLazyValue creates a LazyValue deserializing raw with decode.
+func NewLazyValue(raw []byte, decode ValueDecoder) *LazyValue {
+	return &LazyValue{raw: raw, decode: decode}
+}
+
+// LazyValues creates a LazyValue for the value of each message, in order.
+func LazyValues(messages []*sarama.ConsumerMessage, decode ValueDecoder) []*LazyValue {
+	values := make([]*LazyValue, len(messages))
+	for i, message := range messages {
+		values[i] = NewLazyValue(message.Value, decode)
+	}
+	return values
+}
+
+// Get deserializes the value on the first call and returns the cached result afterwards.
+// Tombstones deserialize to nil without calling the ValueDecoder.
+func (v *LazyValue) Get() (interface{}, error) {
+	if !v.decoded {
+		if v.raw != nil {
+			v.value, v.err = v.decode(v.raw)
+		}
+		v.decoded = true
+	}
+	return v.value, v.err
+}
+
+// Raw returns the serialized value.
+func (v *LazyValue) Raw() []byte {
+	return v.raw
+}
+
+// Decoded returns true if the value has been deserialized.
+func (v *LazyValue) Decoded() bool {
+	return v.decoded
+}
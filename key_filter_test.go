@@ -0,0 +1,57 @@
+package kasper
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyFilter(t *testing.T) {
+	compressed, err := CompressPayload(sarama.CompressionSnappy, mushu)
+	assert.Nil(t, err)
+	messages := []*sarama.ConsumerMessage{
+		{Topic: "dragons", Key: []byte("eu/mushu"), Value: compressed},
+		// Never decompressed, as decompressing an unknown codec fails
+		{Topic: "dragons", Key: []byte("us/falkor"), Value: []byte{0, 'K', 'Z', 42}},
+	}
+	processor := NewKeyFilter(
+		NewCompressingProcessor(NewRouterProcessor("european-dragons"), sarama.CompressionNone),
+		func(topic string, key []byte) bool { return bytes.HasPrefix(key, []byte("eu/")) },
+	)
+	sender := &bufferSender{}
+	assert.Nil(t, processor.Process(messages, sender))
+	assert.Len(t, sender.messages, 1)
+	value, _ := sender.messages[0].Value.Encode()
+	assert.Equal(t, mushu, value)
+}
+
+func TestLazyValue(t *testing.T) {
+	decodes := 0
+	decode := func(value []byte) (interface{}, error) {
+		decodes++
+		var dragon map[string]string
+		err := json.Unmarshal(value, &dragon)
+		return dragon, err
+	}
+	values := LazyValues([]*sarama.ConsumerMessage{{Value: saphira}, {Value: []byte("{")}, {Value: nil}}, decode)
+	assert.False(t, values[0].Decoded())
+	assert.Equal(t, saphira, values[0].Raw())
+
+	dragon, err := values[0].Get()
+	assert.Nil(t, err)
+	assert.Equal(t, "Saphira", dragon.(map[string]string)["name"])
+	_, _ = values[0].Get()
+	assert.Equal(t, 1, decodes)
+
+	_, err = values[1].Get()
+	assert.NotNil(t, err)
+
+	tombstone, err := values[2].Get()
+	assert.Nil(t, tombstone)
+	assert.Nil(t, err)
+	assert.True(t, values[2].Decoded())
+	assert.Equal(t, 2, decodes)
+}
@@ -0,0 +1,27 @@
+package kasper
+
+import (
+	"context"
+	"runtime/pprof"
+	"strconv"
+	"strings"
+)
+
+// partitionLabels returns the pprof labels of the goroutines processing partition, so that CPU and block profiles
+// can be attributed to partitions, e.g. with `go tool pprof -tagfocus partition=3`.
+func (tp *TopicProcessor) partitionLabels(partition int) pprof.LabelSet {
+	labels := []string{
+		"topic_processor", tp.config.TopicProcessorName,
+		"topics", strings.Join(tp.inputTopics, ","),
+		"partition", strconv.Itoa(partition),
+	}
+	if tp.config.ContainerID != "" {
+		labels = append(labels, "container_id", tp.config.ContainerID)
+	}
+	return pprof.Labels(labels...)
+}
+
+// withPartitionLabels calls f with the pprof labels of partition. Goroutines started by f inherit the labels.
+func (tp *TopicProcessor) withPartitionLabels(partition int, f func()) {
+	pprof.Do(context.Background(), tp.partitionLabels(partition), func(context.Context) { f() })
+}
@@ -0,0 +1,29 @@
+package kasper
+
+import (
+	"context"
+	"runtime/pprof"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTopicProcessor_PartitionLabels(t *testing.T) {
+	tp := &TopicProcessor{
+		config:      &Config{TopicProcessorName: "labels", ContainerID: "dragons-2"},
+		inputTopics: []string{"hello", "world"},
+	}
+	ctx := pprof.WithLabels(context.Background(), tp.partitionLabels(3))
+	expected := map[string]string{
+		"topic_processor": "labels",
+		"topics":          "hello,world",
+		"partition":       "3",
+		"container_id":    "dragons-2",
+	}
+	actual := make(map[string]string)
+	pprof.ForLabels(ctx, func(key, value string) bool {
+		actual[key] = value
+		return true
+	})
+	assert.Equal(t, expected, actual)
+}
@@ -0,0 +1,75 @@
+package kasper
+
+import (
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// LateRecordPolicy controls what happens to records that arrive after their window has closed.
+type LateRecordPolicy int
+
+const (
+	// LateRecordPolicyDrop discards late records.
+	LateRecordPolicyDrop LateRecordPolicy = iota
+	// LateRecordPolicySideOutput forwards late records unchanged to a "late" side-output topic.
+	LateRecordPolicySideOutput
+)
+
+// LateRecordFilter separates late records from on-time records in windowed operations.
+// A record is late when stream time (the largest timestamp seen so far) has already passed the end of
+// its tumbling window plus the grace period, i.e. when a Suppressor with the same grace period
+// would already have emitted its window.
+type LateRecordFilter struct {
+	windowSize time.Duration
+	grace      time.Duration
+	policy     LateRecordPolicy
+	lateTopic  string
+	streamTime time.Time
+
+	labelValues     []string
+	lateRecordCount Counter
+}
+
+// NewLateRecordFilter creates a LateRecordFilter. lateTopic is only used by LateRecordPolicySideOutput.
+func NewLateRecordFilter(config *Config, windowSize, grace time.Duration, policy LateRecordPolicy, lateTopic string) *LateRecordFilter {
+	metrics := config.MetricsProvider
+	return &LateRecordFilter{
+		windowSize:      windowSize,
+		grace:           grace,
+		policy:          policy,
+		lateTopic:       lateTopic,
+		labelValues:     []string{config.TopicProcessorName},
+		lateRecordCount: metrics.NewCounter("late_record_count", "Number of records received after their window closed", "topicProcessor", "topic"),
+	}
+}
+
+// StreamTime returns the current stream time.
+func (f *LateRecordFilter) StreamTime() time.Time {
+	return f.streamTime
+}
+
+// Filter returns the on-time messages of a batch and advances stream time.
+// Late messages are counted, then dropped or sent to the late topic according to the policy.
+func (f *LateRecordFilter) Filter(messages []*sarama.ConsumerMessage, sender Sender) []*sarama.ConsumerMessage {
+	onTime := make([]*sarama.ConsumerMessage, 0, len(messages))
+	for _, message := range messages {
+		if f.isLate(message.Timestamp) {
+			f.lateRecordCount.Inc(append(f.labelValues, message.Topic)...)
+			if f.policy == LateRecordPolicySideOutput {
+				sender.Send(forward(message, f.lateTopic))
+			}
+			continue
+		}
+		onTime = append(onTime, message)
+		if message.Timestamp.After(f.streamTime) {
+			f.streamTime = message.Timestamp
+		}
+	}
+	return onTime
+}
+
+func (f *LateRecordFilter) isLate(timestamp time.Time) bool {
+	window := TumblingWindow(timestamp, f.windowSize)
+	return !f.streamTime.Before(window.End.Add(f.grace))
+}
@@ -0,0 +1,41 @@
+package kasper
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+func newLateRecordTestMessages() []*sarama.ConsumerMessage {
+	return []*sarama.ConsumerMessage{
+		{Topic: "clicks", Key: []byte("a"), Timestamp: time.Unix(10, 0)},
+		{Topic: "clicks", Key: []byte("b"), Timestamp: time.Unix(75, 0)},
+		{Topic: "clicks", Key: []byte("c"), Timestamp: time.Unix(50, 0)},
+		{Topic: "clicks", Key: []byte("d"), Timestamp: time.Unix(71, 0)},
+	}
+}
+
+func TestLateRecordFilter_Filter_Drop(t *testing.T) {
+	config := &Config{TopicProcessorName: "test", MetricsProvider: &NoopMetricsProvider{}}
+	f := NewLateRecordFilter(config, time.Minute, 10*time.Second, LateRecordPolicyDrop, "")
+	lateCount := &countingMetric{}
+	f.lateRecordCount = lateCount
+	messages := newLateRecordTestMessages()
+	sender := &bufferSender{}
+	assert.Equal(t, []*sarama.ConsumerMessage{messages[0], messages[1], messages[3]}, f.Filter(messages, sender))
+	assert.Empty(t, sender.messages)
+	assert.Equal(t, 1, lateCount.count)
+	assert.Equal(t, time.Unix(75, 0), f.StreamTime())
+}
+
+func TestLateRecordFilter_Filter_SideOutput(t *testing.T) {
+	config := &Config{TopicProcessorName: "test", MetricsProvider: &NoopMetricsProvider{}}
+	f := NewLateRecordFilter(config, time.Minute, 10*time.Second, LateRecordPolicySideOutput, "clicks-late")
+	sender := &bufferSender{}
+	f.Filter(newLateRecordTestMessages(), sender)
+	assert.Equal(t, []*sarama.ProducerMessage{
+		{Topic: "clicks-late", Key: sarama.ByteEncoder("c")},
+	}, sender.messages)
+}
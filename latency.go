@@ -0,0 +1,96 @@
+package kasper
+
+import (
+	"bytes"
+	"encoding/binary"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// originStampMagic prefixes values stamped with their origin time.
+var originStampMagic = []byte{0, 'K', 'T'}
+
+const originStampLength = 3 + 8
+
+// StampOrigin prepends origin, the time a record entered the pipeline, to value.
+func StampOrigin(value []byte, origin time.Time) []byte {
+	stamped := make([]byte, originStampLength, originStampLength+len(value))
+	copy(stamped, originStampMagic)
+	binary.BigEndian.PutUint64(stamped[3:], uint64(origin.UnixNano()))
+	return append(stamped, value...)
+}
+
+// ParseOrigin returns the origin time and the original value of a value stamped by StampOrigin.
+// ok is false if value is not stamped, in which case it is returned as is.
+func ParseOrigin(value []byte) (origin time.Time, payload []byte, ok bool) {
+	if len(value) < originStampLength || !bytes.HasPrefix(value, originStampMagic) {
+		return time.Time{}, value, false
+	}
+	return time.Unix(0, int64(binary.BigEndian.Uint64(value[3:]))), value[originStampLength:], true
+}
+
+// LatencyTrackingProcessor is a MessageProcessor that measures the end-to-end latency of a pipeline of
+// TopicProcessors. The vendored sarama client has no record headers, so the origin time of records is carried
+// in a small value prefix (see StampOrigin), which every stage of the pipeline must strip by wrapping its
+// MessageProcessor in a LatencyTrackingProcessor.
+//
+// Incoming stamped messages are unstamped, and the time elapsed since their origin is observed in the
+// end_to_end_latency_seconds summary, by topic. Messages entering the pipeline are not stamped: their origin is
+// their Kafka timestamp, or the time they are processed if they have none. Outgoing messages are stamped with
+// the earliest origin of the batch they were sent from, so latencies are upper bounds.
+type LatencyTrackingProcessor struct {
+	messageProcessor MessageProcessor
+	latency          Summary
+	stampOutgoing    bool
+	now              func() time.Time
+}
+
+// NewLatencyTrackingProcessor creates a LatencyTrackingProcessor wrapping messageProcessor.
+// stampOutgoing must be false in the last stage of the pipeline, whose consumers expect unstamped values.
+func NewLatencyTrackingProcessor(messageProcessor MessageProcessor, provider MetricsProvider, stampOutgoing bool) *LatencyTrackingProcessor {
+	return &LatencyTrackingProcessor{
+		messageProcessor,
+		provider.NewSummary("end_to_end_latency_seconds", "Time elapsed between the origin of incoming messages and their processing", "topic"),
+		stampOutgoing,
+		time.Now,
+	}
+}
+
+// Process unstamps a batch of messages, records their latencies, and stamps outgoing messages.
+func (p *LatencyTrackingProcessor) Process(messages []*sarama.ConsumerMessage, sender Sender) error {
+	now := p.now()
+	origin := now
+	unstamped := make([]*sarama.ConsumerMessage, len(messages))
+	for i, message := range messages {
+		unstamped[i] = message
+		messageOrigin, payload, ok := ParseOrigin(message.Value)
+		if ok {
+			copied := *message
+			copied.Value = payload
+			unstamped[i] = &copied
+			p.latency.Observe(now.Sub(messageOrigin).Seconds(), message.Topic)
+		} else if !message.Timestamp.IsZero() {
+			messageOrigin = message.Timestamp
+		} else {
+			messageOrigin = now
+		}
+		if messageOrigin.Before(origin) {
+			origin = messageOrigin
+		}
+	}
+	if !p.stampOutgoing {
+		return p.messageProcessor.Process(unstamped, sender)
+	}
+	stampingSender := &transformingSender{
+		sender: sender,
+		transform: func(msg *sarama.ProducerMessage, value []byte) ([]byte, error) {
+			return StampOrigin(value, origin), nil
+		},
+	}
+	err := p.messageProcessor.Process(unstamped, stampingSender)
+	if err != nil {
+		return err
+	}
+	return stampingSender.err
+}
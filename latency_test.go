@@ -0,0 +1,55 @@
+package kasper
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingSummary struct {
+	observations []float64
+}
+
+func (s *recordingSummary) Observe(value float64, labelValues ...string) {
+	s.observations = append(s.observations, value)
+}
+
+func TestStampOrigin(t *testing.T) {
+	origin := time.Unix(1491000000, 42)
+	parsed, payload, ok := ParseOrigin(StampOrigin(mushu, origin))
+	assert.True(t, ok)
+	assert.Equal(t, origin, parsed)
+	assert.Equal(t, mushu, payload)
+
+	_, payload, ok = ParseOrigin(mushu)
+	assert.False(t, ok)
+	assert.Equal(t, mushu, payload)
+}
+
+func TestLatencyTrackingProcessor(t *testing.T) {
+	now := time.Unix(100, 0)
+	source := NewLatencyTrackingProcessor(NewRouterProcessor("stage-1"), &NoopMetricsProvider{}, true)
+	source.now = func() time.Time { return now }
+	sender := &bufferSender{}
+	assert.Nil(t, source.Process([]*sarama.ConsumerMessage{
+		{Topic: "dragons", Value: mushu, Timestamp: time.Unix(97, 0)},
+		{Topic: "dragons", Value: falkor, Timestamp: time.Unix(98, 0)},
+	}, sender))
+	value, _ := sender.messages[1].Value.Encode()
+	origin, payload, ok := ParseOrigin(value)
+	assert.True(t, ok)
+	assert.Equal(t, time.Unix(97, 0), origin)
+	assert.Equal(t, falkor, payload)
+
+	sink := NewLatencyTrackingProcessor(NewRouterProcessor("stage-2"), &NoopMetricsProvider{}, false)
+	latency := &recordingSummary{}
+	sink.latency = latency
+	sink.now = func() time.Time { return now.Add(2 * time.Second) }
+	sender = &bufferSender{}
+	assert.Nil(t, sink.Process([]*sarama.ConsumerMessage{{Topic: "stage-1", Value: value}}, sender))
+	assert.Equal(t, []float64{5}, latency.observations)
+	value, _ = sender.messages[0].Value.Encode()
+	assert.Equal(t, falkor, value)
+}
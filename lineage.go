@@ -0,0 +1,130 @@
+package kasper
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+
+	"github.com/Shopify/sarama"
+)
+
+// lineageMagic prefixes values carrying their Lineage.
+var lineageMagic = []byte{0, 'K', 'L'}
+
+var errInvalidLineage = errors.New("invalid lineage prefix")
+
+// LineageSource is a range of input records a message was derived from.
+type LineageSource struct {
+	Topic      string `json:"topic"`
+	Partition  int32  `json:"partition"`
+	FromOffset int64  `json:"fromOffset"`
+	ToOffset   int64  `json:"toOffset"`
+}
+
+// Lineage tells which TopicProcessor produced a message, and from which input records.
+// The input records carry their own Lineage if they were produced by a LineageProcessor, so any record can be
+// traced back to the records that entered the pipeline by following sources upstream.
+type Lineage struct {
+	TopicProcessorName string          `json:"processor"`
+	ContainerID        string          `json:"container,omitempty"`
+	Sources            []LineageSource `json:"sources"`
+}
+
+// AddLineage prepends lineage to value.
+func AddLineage(value []byte, lineage *Lineage) ([]byte, error) {
+	encoded, err := json.Marshal(lineage)
+	if err != nil {
+		return nil, err
+	}
+	prefixed := make([]byte, 0, len(lineageMagic)+binary.MaxVarintLen64+len(encoded)+len(value))
+	prefixed = append(prefixed, lineageMagic...)
+	prefixed = appendUvarint(prefixed, uint64(len(encoded)))
+	prefixed = append(prefixed, encoded...)
+	return append(prefixed, value...), nil
+}
+
+// ReadLineage returns the Lineage and the original value of a value prefixed by AddLineage.
+// If value has no lineage, it returns a nil Lineage and value as is.
+func ReadLineage(value []byte) (*Lineage, []byte, error) {
+	if !bytes.HasPrefix(value, lineageMagic) {
+		return nil, value, nil
+	}
+	rest := value[len(lineageMagic):]
+	length, n := binary.Uvarint(rest)
+	if n <= 0 || uint64(len(rest)-n) < length {
+		return nil, nil, errInvalidLineage
+	}
+	var lineage Lineage
+	err := json.Unmarshal(rest[n:n+int(length)], &lineage)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &lineage, rest[n+int(length):], nil
+}
+
+// LineageProcessor is a MessageProcessor that strips the Lineage of incoming messages before passing them to an
+// underlying MessageProcessor, and adds a Lineage to the messages it sends. The vendored sarama client has no
+// record headers, so lineage is carried in a value prefix. Outgoing messages are attributed to the offset range
+// of each input topic partition in the batch they were sent from, so batches of one message give exact lineage.
+// Tombstones carry no lineage.
+type LineageProcessor struct {
+	messageProcessor   MessageProcessor
+	topicProcessorName string
+	containerID        string
+}
+
+// NewLineageProcessor creates a LineageProcessor wrapping messageProcessor, which attributes outgoing messages to
+// Config.TopicProcessorName and Config.ContainerID.
+func NewLineageProcessor(messageProcessor MessageProcessor, config *Config) *LineageProcessor {
+	return &LineageProcessor{messageProcessor, config.TopicProcessorName, config.ContainerID}
+}
+
+// Process strips the lineage of a batch of messages, and fails if any lineage is invalid.
+func (p *LineageProcessor) Process(messages []*sarama.ConsumerMessage, sender Sender) error {
+	stripped, err := transformIncomingValues(messages, "read lineage of", func(value []byte) ([]byte, error) {
+		_, payload, err := ReadLineage(value)
+		return payload, err
+	})
+	if err != nil {
+		return err
+	}
+	lineage := &Lineage{p.topicProcessorName, p.containerID, lineageSources(messages)}
+	lineageSender := &transformingSender{
+		sender: sender,
+		transform: func(msg *sarama.ProducerMessage, value []byte) ([]byte, error) {
+			return AddLineage(value, lineage)
+		},
+	}
+	err = p.messageProcessor.Process(stripped, lineageSender)
+	if err != nil {
+		return err
+	}
+	return lineageSender.err
+}
+
+// lineageSources returns the offset range of each topic partition of messages, in order of first appearance.
+func lineageSources(messages []*sarama.ConsumerMessage) []LineageSource {
+	type topicPartition struct {
+		topic     string
+		partition int32
+	}
+	indexes := make(map[topicPartition]int)
+	var sources []LineageSource
+	for _, message := range messages {
+		tp := topicPartition{message.Topic, message.Partition}
+		i, found := indexes[tp]
+		if !found {
+			indexes[tp] = len(sources)
+			sources = append(sources, LineageSource{message.Topic, message.Partition, message.Offset, message.Offset})
+			continue
+		}
+		if message.Offset < sources[i].FromOffset {
+			sources[i].FromOffset = message.Offset
+		}
+		if message.Offset > sources[i].ToOffset {
+			sources[i].ToOffset = message.Offset
+		}
+	}
+	return sources
+}
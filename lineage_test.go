@@ -0,0 +1,41 @@
+package kasper
+
+import (
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLineageProcessor(t *testing.T) {
+	config := &Config{TopicProcessorName: "lineage", ContainerID: "dragons-1"}
+	p := NewLineageProcessor(NewRouterProcessor("colors"), config)
+	sender := &bufferSender{}
+	assert.Nil(t, p.Process([]*sarama.ConsumerMessage{
+		{Topic: "dragons", Partition: 2, Offset: 12, Value: mushu},
+		{Topic: "dragons", Partition: 2, Offset: 10, Value: falkor},
+		{Topic: "wyverns", Partition: 2, Offset: 3, Key: []byte("saphira")},
+	}, sender))
+	assert.Len(t, sender.messages, 3)
+
+	value, _ := sender.messages[0].Value.Encode()
+	lineage, payload, err := ReadLineage(value)
+	assert.Nil(t, err)
+	assert.Equal(t, mushu, payload)
+	assert.Equal(t, &Lineage{"lineage", "dragons-1", []LineageSource{
+		{"dragons", 2, 10, 12},
+		{"wyverns", 2, 3, 3},
+	}}, lineage)
+	assert.Nil(t, sender.messages[2].Value)
+
+	// Downstream stages see the original value
+	downstream := &bufferSender{}
+	assert.Nil(t, NewLineageProcessor(NewRouterProcessor("hues"), config).Process([]*sarama.ConsumerMessage{{Topic: "colors", Value: value}}, downstream))
+	value, _ = downstream.messages[0].Value.Encode()
+	_, payload, err = ReadLineage(value)
+	assert.Nil(t, err)
+	assert.Equal(t, mushu, payload)
+
+	_, _, err = ReadLineage([]byte{0, 'K', 'L', 42})
+	assert.Equal(t, errInvalidLineage, err)
+}
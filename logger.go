@@ -5,6 +5,7 @@ import (
 	"github.com/sirupsen/logrus"
 	stdlibLog "log"
 	"os"
+	"sync/atomic"
 )
 
 // Logger is a logging interface for Kasper.
@@ -22,6 +23,14 @@ type Logger interface {
 	Panicf(string, ...interface{})
 }
 
+// LevelLogger is a Logger whose debug level can be changed at runtime (see TopicProcessor.UpdateSettings).
+// The loggers created by NewJSONLogger, NewTextLogger and NewBasicLogger are LevelLoggers.
+type LevelLogger interface {
+	Logger
+	IsDebug() bool
+	SetDebug(debug bool)
+}
+
 // NewJSONLogger uses the logrus JSON formatter.
 // See https://github.com/sirupsen/logrus
 func NewJSONLogger(label string, debug bool) Logger {
@@ -42,25 +51,53 @@ func newLogrus(label string, debug bool, formatter logrus.Formatter) Logger {
 	} else {
 		logger.Level = logrus.InfoLevel
 	}
-	return logger.
+	return &logrusLogger{logger.
 		WithField("type", "kasper").
-		WithField("label", label)
+		WithField("label", label)}
+}
+
+type logrusLogger struct {
+	*logrus.Entry
+}
+
+func (l *logrusLogger) IsDebug() bool {
+	return logrus.Level(atomic.LoadUint32((*uint32)(&l.Logger.Level))) >= logrus.DebugLevel
+}
+
+func (l *logrusLogger) SetDebug(debug bool) {
+	level := logrus.InfoLevel
+	if debug {
+		level = logrus.DebugLevel
+	}
+	atomic.StoreUint32((*uint32)(&l.Logger.Level), uint32(level))
 }
 
 type stdlibLogger struct {
 	log   *stdlibLog.Logger
-	debug bool
+	debug int32
+}
+
+func (l *stdlibLogger) IsDebug() bool {
+	return atomic.LoadInt32(&l.debug) == 1
+}
+
+func (l *stdlibLogger) SetDebug(debug bool) {
+	value := int32(0)
+	if debug {
+		value = 1
+	}
+	atomic.StoreInt32(&l.debug, value)
 }
 
 func (l *stdlibLogger) Debug(vs ...interface{}) {
-	if l.debug {
+	if l.IsDebug() {
 		vs = append([]interface{}{"DEBUG "}, vs...)
 		l.log.Print(vs...)
 	}
 }
 
 func (l *stdlibLogger) Debugf(format string, vs ...interface{}) {
-	if l.debug {
+	if l.IsDebug() {
 		l.log.Printf(fmt.Sprintf("DEBUG %s", format), vs...)
 	}
 }
@@ -95,7 +132,9 @@ func (l *stdlibLogger) Panicf(format string, vs ...interface{}) {
 // NewBasicLogger uses the Go standard library logger.
 // See https://golang.org/pkg/log/
 func NewBasicLogger(debug bool) Logger {
-	return &stdlibLogger{stdlibLog.New(os.Stderr, "(KASPER) ", stdlibLog.LstdFlags), debug}
+	l := &stdlibLogger{stdlibLog.New(os.Stderr, "(KASPER) ", stdlibLog.LstdFlags), 0}
+	l.SetDebug(debug)
+	return l
 }
 
 type noopLogger struct{}
@@ -1,14 +1,18 @@
 package kasper
 
+import "bytes"
+
 // Map wraps a map[string][]byte value and implements the Store interface.
 type Map struct {
-	m map[string][]byte
+	m    map[string][]byte
+	size int64
 }
 
 // NewMap creates a new map of the given size.
 func NewMap(size int) *Map {
 	return &Map{
 		make(map[string][]byte, size),
+		0,
 	}
 }
 
@@ -35,10 +39,23 @@ func (s *Map) GetAll(keys []string) (map[string][]byte, error) {
 
 // Put inserts or updates a value by key.
 func (s *Map) Put(key string, value []byte) error {
+	if previous, found := s.m[key]; found {
+		s.size -= int64(len(key) + len(previous))
+	}
 	s.m[key] = value
+	s.size += int64(len(key) + len(value))
 	return nil
 }
 
+// CompareAndSet sets key to value if its current value is old (nil for a missing key), and returns whether it did.
+func (s *Map) CompareAndSet(key string, old, value []byte) (bool, error) {
+	current, found := s.m[key]
+	if found != (old != nil) || !bytes.Equal(current, old) {
+		return false, nil
+	}
+	return true, s.Put(key, value)
+}
+
 // PutAll inserts or updates multiple key-value pairs.
 func (s *Map) PutAll(kvs map[string][]byte) error {
 	for key, value := range kvs {
@@ -49,7 +66,10 @@ func (s *Map) PutAll(kvs map[string][]byte) error {
 
 // Delete removes a single value by key. Does not return an error if the key is not present.
 func (s *Map) Delete(key string) error {
-	delete(s.m, key)
+	if previous, found := s.m[key]; found {
+		s.size -= int64(len(key) + len(previous))
+		delete(s.m, key)
+	}
 	return nil
 }
 
@@ -58,6 +78,12 @@ func (s *Map) Flush() error {
 	return nil
 }
 
+// MemoryUsage returns the total size of the keys and values in the map.
+// Changes made directly to the map returned by GetMap are not accounted for.
+func (s *Map) MemoryUsage() int64 {
+	return s.size
+}
+
 // GetMap returns the underlying map.
 func (s *Map) GetMap() map[string][]byte {
 	return s.m
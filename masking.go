@@ -0,0 +1,158 @@
+package kasper
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/Shopify/sarama"
+)
+
+// MaskRedactedValue replaces the values of fields redacted with MaskRedact.
+const MaskRedactedValue = "[REDACTED]"
+
+// MaskAction is the way a Masker masks a field.
+type MaskAction int
+
+const (
+	// MaskRedact replaces the field value with MaskRedactedValue.
+	MaskRedact MaskAction = iota
+	// MaskHash replaces the field value with the hex-encoded HMAC-SHA256 of its JSON encoding, keyed with
+	// the Masker's secret. Equal values have equal hashes, so masked fields can still be joined or counted.
+	MaskHash
+)
+
+// MaskRule masks the field at Path, a dot-separated path in JSON objects (e.g. "customer.email").
+// When a path goes through an array, the rule applies to each of its elements.
+type MaskRule struct {
+	Path   string
+	Action MaskAction
+}
+
+// Masker masks personally identifiable information in JSON message values.
+type Masker struct {
+	secret []byte
+	rules  []MaskRule
+}
+
+// NewMasker creates a Masker applying rules, and using secret to key the hashes of MaskHash rules.
+func NewMasker(secret []byte, rules ...MaskRule) *Masker {
+	return &Masker{secret, rules}
+}
+
+// Mask returns value with all fields matching the rules masked. Missing fields are ignored.
+func (m *Masker) Mask(value []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(value))
+	decoder.UseNumber()
+	var document interface{}
+	err := decoder.Decode(&document)
+	if err != nil {
+		return nil, err
+	}
+	for _, rule := range m.rules {
+		document, err = m.mask(document, strings.Split(rule.Path, "."), rule.Action)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(document)
+}
+
+func (m *Masker) mask(node interface{}, path []string, action MaskAction) (interface{}, error) {
+	if array, ok := node.([]interface{}); ok {
+		for i, element := range array {
+			masked, err := m.mask(element, path, action)
+			if err != nil {
+				return nil, err
+			}
+			array[i] = masked
+		}
+		return array, nil
+	}
+	if len(path) == 0 {
+		return m.maskValue(node, action)
+	}
+	object, ok := node.(map[string]interface{})
+	if !ok {
+		return node, nil
+	}
+	field, found := object[path[0]]
+	if !found {
+		return node, nil
+	}
+	masked, err := m.mask(field, path[1:], action)
+	if err != nil {
+		return nil, err
+	}
+	object[path[0]] = masked
+	return object, nil
+}
+
+func (m *Masker) maskValue(value interface{}, action MaskAction) (interface{}, error) {
+	switch action {
+	case MaskRedact:
+		return MaskRedactedValue, nil
+	case MaskHash:
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		mac := hmac.New(sha256.New, m.secret)
+		_, _ = mac.Write(encoded)
+		return hex.EncodeToString(mac.Sum(nil)), nil
+	default:
+		return nil, fmt.Errorf("unknown mask action %d", action)
+	}
+}
+
+// MaskTarget selects the messages masked by a MaskingProcessor.
+type MaskTarget int
+
+const (
+	// MaskIncoming masks incoming messages before they reach the underlying MessageProcessor.
+	MaskIncoming MaskTarget = 1 << iota
+	// MaskOutgoing masks the messages sent by the underlying MessageProcessor before they are produced.
+	MaskOutgoing
+)
+
+// MaskingProcessor is a MessageProcessor that masks the JSON values of incoming and/or outgoing messages
+// with a Masker, for compliance-driven pipelines. A message whose value is not JSON fails the batch.
+type MaskingProcessor struct {
+	messageProcessor MessageProcessor
+	masker           *Masker
+	target           MaskTarget
+}
+
+// NewMaskingProcessor creates a MaskingProcessor wrapping messageProcessor.
+// target is MaskIncoming, MaskOutgoing or MaskIncoming|MaskOutgoing.
+func NewMaskingProcessor(messageProcessor MessageProcessor, masker *Masker, target MaskTarget) *MaskingProcessor {
+	return &MaskingProcessor{messageProcessor, masker, target}
+}
+
+// Process masks a batch of messages and passes it to the underlying MessageProcessor.
+func (p *MaskingProcessor) Process(messages []*sarama.ConsumerMessage, sender Sender) error {
+	if p.target&MaskIncoming != 0 {
+		var err error
+		messages, err = transformIncomingValues(messages, "mask", p.masker.Mask)
+		if err != nil {
+			return err
+		}
+	}
+	if p.target&MaskOutgoing == 0 {
+		return p.messageProcessor.Process(messages, sender)
+	}
+	maskingSender := &transformingSender{sender: sender, transform: p.maskOutgoing}
+	err := p.messageProcessor.Process(messages, maskingSender)
+	if err != nil {
+		return err
+	}
+	return maskingSender.err
+}
+
+func (p *MaskingProcessor) maskOutgoing(msg *sarama.ProducerMessage, value []byte) ([]byte, error) {
+	return p.masker.Mask(value)
+}
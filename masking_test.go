@@ -0,0 +1,35 @@
+package kasper
+
+import (
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMasker_Mask(t *testing.T) {
+	m := NewMasker([]byte("secret"),
+		MaskRule{"customer.email", MaskRedact},
+		MaskRule{"customer.phones.number", MaskHash},
+		MaskRule{"missing.field", MaskRedact},
+	)
+	masked, err := m.Mask([]byte(`{"id":12345678901234567890,"customer":{"email":"a@b.c","phones":[{"number":"123"},{"number":"123"}]}}`))
+	assert.Nil(t, err)
+	assert.Equal(t, `{"customer":{"email":"[REDACTED]","phones":[{"number":"e2bd7d5c493f0410b778849ff837d4aac5a66dab64c7a01198628da504f6cf79"},{"number":"e2bd7d5c493f0410b778849ff837d4aac5a66dab64c7a01198628da504f6cf79"}]},"id":12345678901234567890}`, string(masked))
+
+	_, err = m.Mask([]byte("not json"))
+	assert.NotNil(t, err)
+}
+
+func TestMaskingProcessor_Process(t *testing.T) {
+	m := NewMasker(nil, MaskRule{"name", MaskRedact})
+	sender := &bufferSender{}
+	assert.Nil(t, NewMaskingProcessor(NewRouterProcessor("dragons"), m, MaskOutgoing).Process([]*sarama.ConsumerMessage{
+		{Value: saphira},
+		{Key: []byte("saphira")},
+	}, sender))
+	assert.Len(t, sender.messages, 2)
+	value, _ := sender.messages[0].Value.Encode()
+	assert.Equal(t, `{"color":"blue","name":"[REDACTED]"}`, string(value))
+	assert.Nil(t, sender.messages[1].Value)
+}
@@ -0,0 +1,148 @@
+package kasper
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/Shopify/sarama"
+)
+
+// MemoryReporter is implemented by MessageProcessors and Stores which can estimate the memory they use.
+// The memory reported by the MessageProcessor of a partition is exposed by the memory_store_bytes gauge and
+// counts towards Config.MemoryBudget. It is measured after each batch, so MemoryUsage should be cheap.
+type MemoryReporter interface {
+	// MemoryUsage returns the approximate number of bytes used.
+	MemoryUsage() int64
+}
+
+// memoryAccounting tracks the approximate memory used by the in-flight messages (received but not yet processed)
+// and the in-memory stores of each partition, and applies backpressure when the total exceeds Config.MemoryBudget.
+//
+// The size of a message is the size of its key and value. A nil *memoryAccounting tracks nothing.
+type memoryAccounting struct {
+	budget   int64
+	mutex    sync.Mutex
+	inFlight map[int]int64
+	stores   map[int]int64
+	released chan struct{}
+
+	inFlightBytes Gauge
+	storeBytes    Gauge
+}
+
+func newMemoryAccounting(config *Config) *memoryAccounting {
+	provider := config.MetricsProvider
+	return &memoryAccounting{
+		budget:        config.MemoryBudget,
+		inFlight:      make(map[int]int64),
+		stores:        make(map[int]int64),
+		released:      make(chan struct{}),
+		inFlightBytes: provider.NewGauge("memory_in_flight_bytes", "Approximate memory used by messages received but not yet processed", "partition"),
+		storeBytes:    provider.NewGauge("memory_store_bytes", "Approximate memory used by in-memory stores, as reported by MessageProcessors", "partition"),
+	}
+}
+
+func messageSize(message *sarama.ConsumerMessage) int64 {
+	return int64(len(message.Key) + len(message.Value))
+}
+
+func (m *memoryAccounting) receive(message *sarama.ConsumerMessage) {
+	if m == nil {
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.inFlight[int(message.Partition)] += messageSize(message)
+}
+
+func (m *memoryAccounting) release(partition int, messages []*sarama.ConsumerMessage) {
+	if m == nil {
+		return
+	}
+	var size int64
+	for _, message := range messages {
+		size += messageSize(message)
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.inFlight[partition] -= size
+	if m.inFlight[partition] <= 0 {
+		delete(m.inFlight, partition)
+	}
+	m.notify()
+}
+
+func (m *memoryAccounting) setStoreUsage(partition int, size int64) {
+	if m == nil {
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.stores[partition] = size
+	m.notify()
+}
+
+// removePartition forgets a revoked partition.
+func (m *memoryAccounting) removePartition(partition int) {
+	if m == nil {
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.inFlight, partition)
+	delete(m.stores, partition)
+	m.notify()
+}
+
+// notify wakes up the goroutines waiting in waitUntilBelowBudget. It must be called with the mutex held.
+func (m *memoryAccounting) notify() {
+	close(m.released)
+	m.released = make(chan struct{})
+}
+
+// usage returns the total memory used by in-flight messages and by stores.
+func (m *memoryAccounting) usage() (inFlight, stores int64) {
+	for _, size := range m.inFlight {
+		inFlight += size
+	}
+	for _, size := range m.stores {
+		stores += size
+	}
+	return inFlight, stores
+}
+
+// waitUntilBelowBudget blocks while the memory budget is exceeded and some messages are in flight, so that
+// processing can always make progress even when stores alone exceed the budget.
+// It returns false if close is closed meanwhile.
+func (m *memoryAccounting) waitUntilBelowBudget(close <-chan struct{}) bool {
+	if m == nil || m.budget <= 0 {
+		return true
+	}
+	for {
+		m.mutex.Lock()
+		inFlight, stores := m.usage()
+		released := m.released
+		m.mutex.Unlock()
+		if inFlight == 0 || inFlight+stores <= m.budget {
+			return true
+		}
+		select {
+		case <-released:
+		case <-close:
+			return false
+		}
+	}
+}
+
+func (m *memoryAccounting) onMetricsTick(partitions []int) {
+	if m == nil {
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for _, partition := range partitions {
+		label := strconv.Itoa(partition)
+		m.inFlightBytes.Set(float64(m.inFlight[partition]), label)
+		m.storeBytes.Set(float64(m.stores[partition]), label)
+	}
+}
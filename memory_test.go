@@ -0,0 +1,67 @@
+package kasper
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMap_MemoryUsage(t *testing.T) {
+	s := NewMap(10)
+	_ = s.Put("mushu", []byte("dragon"))
+	_ = s.Put("falkor", []byte("luckdragon"))
+	assert.Equal(t, int64(27), s.MemoryUsage())
+	_ = s.Put("mushu", []byte("guardian"))
+	assert.Equal(t, int64(29), s.MemoryUsage())
+	_ = s.Delete("falkor")
+	_ = s.Delete("saphira")
+	assert.Equal(t, int64(13), s.MemoryUsage())
+}
+
+func TestMemoryAccounting_Backpressure(t *testing.T) {
+	m := newMemoryAccounting(&Config{MemoryBudget: 20, MetricsProvider: &NoopMetricsProvider{}})
+	stop := make(chan struct{})
+	first := &sarama.ConsumerMessage{Partition: 0, Key: []byte("mushu"), Value: []byte("dragon")}
+	second := &sarama.ConsumerMessage{Partition: 1, Key: []byte("falkor"), Value: []byte("luckdragon")}
+
+	// Stores alone never block consumption
+	m.setStoreUsage(0, 100)
+	assert.True(t, m.waitUntilBelowBudget(stop))
+	m.setStoreUsage(0, 0)
+
+	m.receive(first)
+	assert.True(t, m.waitUntilBelowBudget(stop))
+	m.receive(second)
+	waited := make(chan bool)
+	go func() {
+		waited <- m.waitUntilBelowBudget(stop)
+	}()
+	select {
+	case <-waited:
+		t.Fatal("Expected the memory budget to be exceeded")
+	case <-time.After(50 * time.Millisecond):
+	}
+	m.release(1, []*sarama.ConsumerMessage{second})
+	assert.True(t, <-waited)
+
+	m.receive(second)
+	go func() {
+		waited <- m.waitUntilBelowBudget(stop)
+	}()
+	stop <- struct{}{}
+	assert.False(t, <-waited)
+}
+
+func TestMemoryAccounting_RevokedPartition(t *testing.T) {
+	m := newMemoryAccounting(&Config{MemoryBudget: 10, MetricsProvider: &NoopMetricsProvider{}})
+	message := &sarama.ConsumerMessage{Partition: 3, Key: []byte("saphira"), Value: []byte("dragon")}
+	m.receive(message)
+	m.receive(message)
+	m.removePartition(3)
+	m.release(3, []*sarama.ConsumerMessage{message})
+	inFlight, stores := m.usage()
+	assert.Equal(t, int64(0), inFlight)
+	assert.Equal(t, int64(0), stores)
+}
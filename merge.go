@@ -0,0 +1,49 @@
+package kasper
+
+import (
+	"github.com/Shopify/sarama"
+)
+
+// TimestampMerger is a MessageProcessor that presents the messages of all input topics as a single stream
+// ordered by message timestamp. Each batch is merged before being passed to the underlying MessageProcessor:
+// the messages of each topic keep their order, and the next message is always taken from the topic whose next
+// message has the earliest timestamp (the topic appearing first in the batch on ties). The merged stream is
+// therefore ordered by timestamp as long as the timestamps of each topic are increasing; messages with out of
+// order timestamps are not moved ahead of earlier messages of their topic.
+// Ordering is only guaranteed within a batch: use a BatchWaitDuration large enough for all input topics to
+// contribute to each batch. Message timestamps require Kafka 0.10+ and sarama.Config.Version >= V0_10_0_0.
+type TimestampMerger struct {
+	messageProcessor MessageProcessor
+}
+
+// NewTimestampMerger creates a TimestampMerger wrapping messageProcessor.
+func NewTimestampMerger(messageProcessor MessageProcessor) *TimestampMerger {
+	return &TimestampMerger{messageProcessor}
+}
+
+// Process merges messages by timestamp and passes them to the underlying MessageProcessor.
+func (m *TimestampMerger) Process(messages []*sarama.ConsumerMessage, sender Sender) error {
+	var topics [][]*sarama.ConsumerMessage
+	index := make(map[string]int)
+	for _, message := range messages {
+		i, found := index[message.Topic]
+		if !found {
+			i = len(topics)
+			index[message.Topic] = i
+			topics = append(topics, nil)
+		}
+		topics[i] = append(topics[i], message)
+	}
+	merged := make([]*sarama.ConsumerMessage, 0, len(messages))
+	for len(merged) < len(messages) {
+		next := -1
+		for i, topic := range topics {
+			if len(topic) > 0 && (next == -1 || topic[0].Timestamp.Before(topics[next][0].Timestamp)) {
+				next = i
+			}
+		}
+		merged = append(merged, topics[next][0])
+		topics[next] = topics[next][1:]
+	}
+	return m.messageProcessor.Process(merged, sender)
+}
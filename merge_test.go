@@ -0,0 +1,42 @@
+package kasper
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimestampMerger_Process(t *testing.T) {
+	mp := &recordingMessageProcessor{}
+	m := NewTimestampMerger(mp)
+	at := func(seconds int64) time.Time { return time.Unix(seconds, 0) }
+	messages := []*sarama.ConsumerMessage{
+		{Topic: "characters", Offset: 0, Timestamp: at(3)},
+		{Topic: "characters", Offset: 1, Timestamp: at(5)},
+		{Topic: "fictions", Offset: 0, Timestamp: at(1)},
+		{Topic: "fictions", Offset: 1, Timestamp: at(3)},
+		{Topic: "fictions", Offset: 2, Timestamp: at(4)},
+	}
+	assert.Nil(t, m.Process(messages, nil))
+	expected := []*sarama.ConsumerMessage{messages[2], messages[0], messages[3], messages[4], messages[1]}
+	assert.Equal(t, expected, mp.messages)
+	assert.Equal(t, "characters", messages[0].Topic)
+}
+
+func TestTimestampMerger_Process_PerTopicOrder(t *testing.T) {
+	mp := &recordingMessageProcessor{}
+	m := NewTimestampMerger(mp)
+	at := func(seconds int64) time.Time { return time.Unix(seconds, 0) }
+	messages := []*sarama.ConsumerMessage{
+		{Topic: "characters", Offset: 0, Timestamp: at(2)},
+		{Topic: "characters", Offset: 1, Timestamp: at(6)},
+		{Topic: "characters", Offset: 2, Timestamp: at(1)},
+		{Topic: "fictions", Offset: 0, Timestamp: at(3)},
+	}
+	assert.Nil(t, m.Process(messages, nil))
+	// The late message of characters is not moved ahead of the earlier messages of its topic
+	expected := []*sarama.ConsumerMessage{messages[0], messages[3], messages[1], messages[2]}
+	assert.Equal(t, expected, mp.messages)
+}
@@ -0,0 +1,228 @@
+package kasper
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// ContainerMetadata describes a running TopicProcessor instance. Each instance publishes it to
+// Config.MetadataTopic on start and after reassignments, and deletes it on close, so that the fleet
+// serving a TopicProcessorName can be discovered with a MetadataClient, e.g. to route interactive queries.
+type ContainerMetadata struct {
+	TopicProcessorName string    `json:"topicProcessorName"`
+	ContainerID        string    `json:"containerId"`
+	Version            string    `json:"version,omitempty"`
+	URL                string    `json:"url,omitempty"`
+	InputTopics        []string  `json:"inputTopics"`
+	Partitions         []int     `json:"partitions"`
+	UpdatedAt          time.Time `json:"updatedAt"`
+}
+
+// containerID returns Config.ContainerID, or the hostname if it is not set.
+func (config *Config) containerID() string {
+	if config.ContainerID != "" {
+		return config.ContainerID
+	}
+	hostname, _ := os.Hostname()
+	return hostname
+}
+
+// metadataKey identifies the instance in Config.MetadataTopic, which is compacted by key.
+func (config *Config) metadataKey() string {
+	return config.TopicProcessorName + "/" + config.containerID()
+}
+
+func (tp *TopicProcessor) publishMetadata() {
+	if tp.config.MetadataTopic == "" || tp.producer == nil {
+		return
+	}
+	tp.partitionsMutex.RLock()
+	partitions := append([]int{}, tp.partitions...)
+	tp.partitionsMutex.RUnlock()
+	sort.Ints(partitions)
+	value, err := json.Marshal(&ContainerMetadata{
+		TopicProcessorName: tp.config.TopicProcessorName,
+		ContainerID:        tp.config.containerID(),
+		Version:            tp.config.Version,
+		URL:                tp.config.AdvertisedURL,
+		InputTopics:        tp.inputTopics,
+		Partitions:         partitions,
+		UpdatedAt:          tp.config.clock().Now(),
+	})
+	if err == nil {
+		_, _, err = tp.producer.SendMessage(&sarama.ProducerMessage{
+			Topic: tp.config.MetadataTopic,
+			Key:   sarama.StringEncoder(tp.config.metadataKey()),
+			Value: sarama.ByteEncoder(value),
+		})
+	}
+	if err != nil {
+		tp.logger.Errorf("Cannot publish container metadata to %s: %s", tp.config.MetadataTopic, err)
+	}
+}
+
+func (tp *TopicProcessor) unpublishMetadata() error {
+	if tp.config.MetadataTopic == "" || tp.producer == nil {
+		return nil
+	}
+	_, _, err := tp.producer.SendMessage(&sarama.ProducerMessage{
+		Topic: tp.config.MetadataTopic,
+		Key:   sarama.StringEncoder(tp.config.metadataKey()),
+	})
+	return err
+}
+
+// MetadataClient discovers the containers of a fleet of TopicProcessors from their metadata topic
+// (see Config.MetadataTopic). It consumes the whole topic in the background and is safe for concurrent use.
+type MetadataClient struct {
+	partitions         func(topic string) ([]int32, error)
+	consumer           sarama.Consumer
+	partitionConsumers []sarama.PartitionConsumer
+	mutex              sync.RWMutex
+	containers map[string]*ContainerMetadata
+	logger     Logger
+	waitGroup  sync.WaitGroup
+}
+
+// NewMetadataClient creates a MetadataClient consuming topic with client.
+// Containers are only known once their metadata has been consumed.
+func NewMetadataClient(client sarama.Client, topic string, logger Logger) (*MetadataClient, error) {
+	consumer, err := sarama.NewConsumerFromClient(client)
+	if err != nil {
+		return nil, err
+	}
+	c := newMetadataClient(client, logger)
+	err = c.startConsuming(consumer, topic)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// startConsuming consumes all partitions of topic with consumer, and closes the consumer on error.
+func (c *MetadataClient) startConsuming(consumer sarama.Consumer, topic string) error {
+	c.consumer = consumer
+	partitions, err := consumer.Partitions(topic)
+	if err != nil {
+		_ = c.Close()
+		return err
+	}
+	for _, partition := range partitions {
+		pc, err := consumer.ConsumePartition(topic, partition, sarama.OffsetOldest)
+		if err != nil {
+			_ = c.Close()
+			return err
+		}
+		c.partitionConsumers = append(c.partitionConsumers, pc)
+		c.waitGroup.Add(1)
+		go c.consume(pc.Messages())
+	}
+	return nil
+}
+
+func newMetadataClient(client sarama.Client, logger Logger) *MetadataClient {
+	c := &MetadataClient{
+		containers: make(map[string]*ContainerMetadata),
+		logger:     logger,
+	}
+	if client != nil {
+		c.partitions = client.Partitions
+	}
+	return c
+}
+
+func (c *MetadataClient) consume(messages <-chan *sarama.ConsumerMessage) {
+	defer c.waitGroup.Done()
+	for message := range messages {
+		c.apply(message)
+	}
+}
+
+func (c *MetadataClient) apply(message *sarama.ConsumerMessage) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if IsTombstone(message) {
+		delete(c.containers, string(message.Key))
+		return
+	}
+	var metadata ContainerMetadata
+	err := json.Unmarshal(message.Value, &metadata)
+	if err != nil {
+		c.logger.Errorf("Cannot read container metadata at offset %d of %s-%d: %s", message.Offset, message.Topic, message.Partition, err)
+		return
+	}
+	c.containers[string(message.Key)] = &metadata
+}
+
+// Containers returns the known containers of a TopicProcessor, sorted by container ID.
+func (c *MetadataClient) Containers(topicProcessorName string) []*ContainerMetadata {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	var containers []*ContainerMetadata
+	for _, metadata := range c.containers {
+		if metadata.TopicProcessorName == topicProcessorName {
+			containers = append(containers, metadata)
+		}
+	}
+	sort.Slice(containers, func(i, j int) bool { return containers[i].ContainerID < containers[j].ContainerID })
+	return containers
+}
+
+// ContainerForPartition returns the container of a TopicProcessor processing an input partition,
+// or nil if none is known. If several containers claim the partition during a reassignment,
+// the most recently updated one is returned.
+func (c *MetadataClient) ContainerForPartition(topicProcessorName string, partition int) *ContainerMetadata {
+	var found *ContainerMetadata
+	for _, metadata := range c.Containers(topicProcessorName) {
+		for _, p := range metadata.Partitions {
+			if p == partition && (found == nil || metadata.UpdatedAt.After(found.UpdatedAt)) {
+				found = metadata
+			}
+		}
+	}
+	return found
+}
+
+// ContainerForKey returns the container of a TopicProcessor processing the messages with key in inputTopic,
+// assuming messages are partitioned with sarama's default hash partitioner. Returns nil if none is known.
+func (c *MetadataClient) ContainerForKey(topicProcessorName, inputTopic string, key []byte) (*ContainerMetadata, error) {
+	partitions, err := c.partitions(inputTopic)
+	if err != nil {
+		return nil, err
+	}
+	partition, err := keyPartition(inputTopic, key, len(partitions))
+	if err != nil {
+		return nil, err
+	}
+	return c.ContainerForPartition(topicProcessorName, partition), nil
+}
+
+func keyPartition(topic string, key []byte, partitionCount int) (int, error) {
+	partitioner := sarama.NewHashPartitioner(topic)
+	partition, err := partitioner.Partition(&sarama.ProducerMessage{Topic: topic, Key: sarama.ByteEncoder(key)}, int32(partitionCount))
+	return int(partition), err
+}
+
+// Close stops consuming the metadata topic.
+// The partition consumers are closed one by one, since closing a consumer created from an existing client
+// does not close its partition consumers.
+func (c *MetadataClient) Close() error {
+	var err error
+	for _, pc := range c.partitionConsumers {
+		closeErr := pc.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}
+	c.waitGroup.Wait()
+	closeErr := c.consumer.Close()
+	if err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,153 @@
+package kasper
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTopicProcessor_publishMetadata(t *testing.T) {
+	producer := &fakeSyncProducer{}
+	tp := &TopicProcessor{
+		config: &Config{
+			TopicProcessorName: "hoard",
+			ContainerID:        "hoard-1",
+			MetadataTopic:      "kasper-metadata",
+			Version:            "1.2.3",
+			AdvertisedURL:      "http://hoard-1:8080",
+			Clock:              NewFakeClock(time.Unix(0, 0).UTC()),
+		},
+		producer:    producer,
+		inputTopics: []string{"dragons"},
+		partitions:  []int{4, 1},
+		logger:      &noopLogger{},
+	}
+	tp.publishMetadata()
+	assert.Nil(t, tp.unpublishMetadata())
+
+	assert.Len(t, producer.messages, 2)
+	assert.Equal(t, "kasper-metadata", producer.messages[0].Topic)
+	assert.Equal(t, sarama.StringEncoder("hoard/hoard-1"), producer.messages[0].Key)
+	var metadata ContainerMetadata
+	value, _ := producer.messages[0].Value.Encode()
+	assert.Nil(t, json.Unmarshal(value, &metadata))
+	assert.Equal(t, ContainerMetadata{
+		TopicProcessorName: "hoard",
+		ContainerID:        "hoard-1",
+		Version:            "1.2.3",
+		URL:                "http://hoard-1:8080",
+		InputTopics:        []string{"dragons"},
+		Partitions:         []int{1, 4},
+		UpdatedAt:          time.Unix(0, 0).UTC(),
+	}, metadata)
+	assert.Equal(t, sarama.StringEncoder("hoard/hoard-1"), producer.messages[1].Key)
+	assert.Nil(t, producer.messages[1].Value)
+}
+
+func newMetadataTestMessage(key string, metadata *ContainerMetadata) *sarama.ConsumerMessage {
+	message := &sarama.ConsumerMessage{Topic: "kasper-metadata", Key: []byte(key)}
+	if metadata != nil {
+		message.Value, _ = json.Marshal(metadata)
+	}
+	return message
+}
+
+func TestMetadataClient(t *testing.T) {
+	c := newMetadataClient(nil, &noopLogger{})
+	c.apply(newMetadataTestMessage("hoard/2", &ContainerMetadata{TopicProcessorName: "hoard", ContainerID: "2", Partitions: []int{1, 3}, UpdatedAt: time.Unix(10, 0)}))
+	c.apply(newMetadataTestMessage("hoard/1", &ContainerMetadata{TopicProcessorName: "hoard", ContainerID: "1", Partitions: []int{0, 2}, UpdatedAt: time.Unix(10, 0)}))
+	c.apply(newMetadataTestMessage("count/1", &ContainerMetadata{TopicProcessorName: "count", ContainerID: "1", Partitions: []int{0}}))
+	c.apply(&sarama.ConsumerMessage{Key: []byte("broken"), Value: []byte("{")})
+
+	containers := c.Containers("hoard")
+	assert.Len(t, containers, 2)
+	assert.Equal(t, "1", containers[0].ContainerID)
+	assert.Equal(t, "2", c.ContainerForPartition("hoard", 3).ContainerID)
+	assert.Nil(t, c.ContainerForPartition("hoard", 4))
+
+	// During a reassignment, the most recent claim wins
+	c.apply(newMetadataTestMessage("hoard/3", &ContainerMetadata{TopicProcessorName: "hoard", ContainerID: "3", Partitions: []int{3}, UpdatedAt: time.Unix(20, 0)}))
+	assert.Equal(t, "3", c.ContainerForPartition("hoard", 3).ContainerID)
+
+	c.apply(newMetadataTestMessage("hoard/3", nil))
+	assert.Equal(t, "2", c.ContainerForPartition("hoard", 3).ContainerID)
+	assert.Len(t, c.Containers("hoard"), 2)
+}
+
+func TestKeyPartition(t *testing.T) {
+	partition, err := keyPartition("dragons", []byte("mushu"), 8)
+	assert.Nil(t, err)
+	expected, _ := sarama.NewHashPartitioner("dragons").Partition(&sarama.ProducerMessage{Key: sarama.StringEncoder("mushu")}, 8)
+	assert.Equal(t, int(expected), partition)
+}
+
+// closablePartitionConsumer closes its messages channel when closed, like sarama's PartitionConsumer.
+type closablePartitionConsumer struct {
+	fakePartitionConsumer
+	closed bool
+}
+
+func (c *closablePartitionConsumer) AsyncClose() {
+	if !c.closed {
+		c.closed = true
+		close(c.messages)
+	}
+}
+
+func (c *closablePartitionConsumer) Close() error {
+	c.AsyncClose()
+	return nil
+}
+
+// partitionedConsumer consumes the given partitions with closablePartitionConsumers, failing for partition fail.
+// Closing it does not close its partition consumers, like a sarama Consumer created from an existing client.
+type partitionedConsumer struct {
+	fakeConsumer
+	partitions []int32
+	fail       int32
+	started    []*closablePartitionConsumer
+}
+
+func (c *partitionedConsumer) Partitions(topic string) ([]int32, error) { return c.partitions, nil }
+
+func (c *partitionedConsumer) ConsumePartition(topic string, partition int32, offset int64) (sarama.PartitionConsumer, error) {
+	if partition == c.fail {
+		return nil, errors.New("leader not available")
+	}
+	pc := &closablePartitionConsumer{fakePartitionConsumer: fakePartitionConsumer{make(chan *sarama.ConsumerMessage)}}
+	c.started = append(c.started, pc)
+	return pc, nil
+}
+
+func TestMetadataClient_Close(t *testing.T) {
+	c := newMetadataClient(nil, &noopLogger{})
+	consumer := &partitionedConsumer{partitions: []int32{0, 1}, fail: -1}
+	assert.Nil(t, c.startConsuming(consumer, "kasper-metadata"))
+	consumer.started[1].messages <- newMetadataTestMessage("hoard/1", &ContainerMetadata{TopicProcessorName: "hoard", ContainerID: "1"})
+
+	closed := make(chan error)
+	go func() {
+		closed <- c.Close()
+	}()
+	select {
+	case err := <-closed:
+		assert.Nil(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not return")
+	}
+	assert.Len(t, c.Containers("hoard"), 1)
+}
+
+func TestMetadataClient_startConsuming_Error(t *testing.T) {
+	c := newMetadataClient(nil, &noopLogger{})
+	consumer := &partitionedConsumer{partitions: []int32{0, 1, 2}, fail: 2}
+	assert.NotNil(t, c.startConsuming(consumer, "kasper-metadata"))
+	assert.Len(t, consumer.started, 2)
+	for _, pc := range consumer.started {
+		assert.True(t, pc.closed)
+	}
+}
@@ -0,0 +1,90 @@
+package kasper
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// StoreMigration upgrades the contents of a Store by exactly one schema version.
+type StoreMigration func(store Store) error
+
+// StoreMigrator declares the schema version of a Store and how to migrate it from older versions.
+// The current schema version is persisted in the Store itself, under VersionKey.
+// A Store without a recorded version is considered to be at version 0.
+type StoreMigrator struct {
+	// Store to migrate
+	Store Store
+	// Key under which the schema version is stored
+	VersionKey string
+	// Schema version expected by the application
+	Version int
+	// Migrations[v] upgrades the Store from version v to version v+1
+	Migrations map[int]StoreMigration
+}
+
+// CurrentVersion returns the schema version currently recorded in the Store.
+func (m *StoreMigrator) CurrentVersion() (int, error) {
+	value, err := m.Store.Get(m.VersionKey)
+	if err != nil {
+		return 0, err
+	}
+	if value == nil {
+		return 0, nil
+	}
+	version, err := strconv.Atoi(string(value))
+	if err != nil {
+		return 0, fmt.Errorf("invalid schema version under key %s: %s", m.VersionKey, err)
+	}
+	return version, nil
+}
+
+// Migrate runs all migrations needed to bring the Store up to Version.
+// The recorded version is updated and flushed after each successful migration,
+// so an interrupted migration resumes where it left off.
+// Migrate returns an error if the Store is newer than Version or if a migration is missing.
+func (m *StoreMigrator) Migrate() error {
+	current, err := m.CurrentVersion()
+	if err != nil {
+		return err
+	}
+	if current > m.Version {
+		return fmt.Errorf("store schema version %d is newer than expected version %d", current, m.Version)
+	}
+	for version := current; version < m.Version; version++ {
+		migration, found := m.Migrations[version]
+		if !found {
+			return fmt.Errorf("no migration from store schema version %d to %d", version, version+1)
+		}
+		err = migration(m.Store)
+		if err != nil {
+			return err
+		}
+		err = m.Store.Put(m.VersionKey, []byte(strconv.Itoa(version+1)))
+		if err != nil {
+			return err
+		}
+		err = m.Store.Flush()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func mustMigrateStores(config *Config) {
+	for _, migrator := range config.StoreMigrators {
+		current, err := migrator.CurrentVersion()
+		if err != nil {
+			config.Logger.Panic(err)
+		}
+		if current == migrator.Version {
+			continue
+		}
+		config.Logger.Infof("Migrating store %s from schema version %d to %d", migrator.VersionKey, current, migrator.Version)
+		err = migrator.Migrate()
+		if err != nil {
+			config.Logger.Panic(err)
+		}
+		config.emitEvent(Event{Type: EventStoreMigrated, VersionKey: migrator.VersionKey, Version: migrator.Version})
+	}
+}
@@ -0,0 +1,60 @@
+package kasper
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStoreMigrator_Migrate(t *testing.T) {
+	store := NewMap(10)
+	store.Put("dragon", []byte("green"))
+	migrator := &StoreMigrator{
+		Store:      store,
+		VersionKey: "__version",
+		Version:    2,
+		Migrations: map[int]StoreMigration{
+			0: func(s Store) error {
+				value, _ := s.Get("dragon")
+				return s.Put("dragon", append([]byte("color:"), value...))
+			},
+			1: func(s Store) error {
+				return s.Put("unicorn", []byte("color:white"))
+			},
+		},
+	}
+	version, err := migrator.CurrentVersion()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, version)
+
+	assert.Nil(t, migrator.Migrate())
+	version, err = migrator.CurrentVersion()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, version)
+	dragon, _ := store.Get("dragon")
+	assert.Equal(t, []byte("color:green"), dragon)
+	unicorn, _ := store.Get("unicorn")
+	assert.Equal(t, []byte("color:white"), unicorn)
+
+	// Running again is a no-op
+	assert.Nil(t, migrator.Migrate())
+	dragon, _ = store.Get("dragon")
+	assert.Equal(t, []byte("color:green"), dragon)
+}
+
+func TestStoreMigrator_Migrate_Errors(t *testing.T) {
+	store := NewMap(10)
+	migrator := &StoreMigrator{
+		Store:      store,
+		VersionKey: "__version",
+		Version:    1,
+	}
+	assert.NotNil(t, migrator.Migrate())
+
+	store.Put("__version", []byte("3"))
+	assert.NotNil(t, migrator.Migrate())
+
+	store.Put("__version", []byte("three"))
+	_, err := migrator.CurrentVersion()
+	assert.NotNil(t, err)
+}
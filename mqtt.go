@@ -0,0 +1,154 @@
+package kasper
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// MQTTMessage is a message received from an MQTT broker. It is a subset of the Message interface of the
+// Eclipse Paho client, so Paho messages can be used as is (with auto-acknowledgement disabled).
+type MQTTMessage interface {
+	Topic() string
+	Payload() []byte
+	Qos() byte
+	// Ack acknowledges the message to the broker (PUBACK), for QoS 1 and 2.
+	Ack()
+}
+
+// MQTTClient is the subset of an MQTT client used by MQTTSource and MQTTSink, e.g. a thin adapter around Paho.
+type MQTTClient interface {
+	// Subscribe subscribes to a topic filter with the given maximum QoS and calls handler for each message.
+	Subscribe(topic string, qos byte, handler func(MQTTMessage)) error
+	// Publish publishes payload to topic and waits until the broker has acknowledged it, as required by qos.
+	Publish(topic string, qos byte, payload []byte) error
+}
+
+// MQTTSource is a Source of messages received from MQTT topics, for IoT pipelines bridging MQTT and Kafka
+// in a single process (see SourceProcessor). Incoming messages carry the MQTT topic, the payload as value,
+// and a sequence number as offset.
+//
+// MQTT delivery guarantees map to Kasper's as follows: QoS 0 messages are processed at most once, while
+// QoS 1 and 2 messages are only acknowledged on Commit, i.e. once they have been processed and their
+// outgoing messages produced, so that the broker redelivers them if the process dies (at least once).
+type MQTTSource struct {
+	messages chan MQTTMessage
+	mutex    sync.Mutex
+	pending  map[int64]MQTTMessage
+	offset   int64
+	closed   chan struct{}
+}
+
+// NewMQTTSource subscribes client to topics, which map topic filters to their maximum QoS.
+// Up to bufferSize received messages are buffered before the client's handler blocks.
+func NewMQTTSource(client MQTTClient, topics map[string]byte, bufferSize int) (*MQTTSource, error) {
+	s := &MQTTSource{
+		messages: make(chan MQTTMessage, bufferSize),
+		pending:  make(map[int64]MQTTMessage),
+		closed:   make(chan struct{}),
+	}
+	for topic, qos := range topics {
+		err := client.Subscribe(topic, qos, s.receive)
+		if err != nil {
+			return nil, fmt.Errorf("cannot subscribe to MQTT topic %s: %s", topic, err)
+		}
+	}
+	return s, nil
+}
+
+func (s *MQTTSource) receive(message MQTTMessage) {
+	select {
+	case s.messages <- message:
+	case <-s.closed:
+	}
+}
+
+// NextBatch returns up to max messages received within wait, or io.EOF once the source is closed.
+func (s *MQTTSource) NextBatch(max int, wait time.Duration) ([]*sarama.ConsumerMessage, error) {
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	var batch []*sarama.ConsumerMessage
+	for len(batch) < max {
+		select {
+		case message := <-s.messages:
+			batch = append(batch, s.track(message))
+		case <-timer.C:
+			return batch, nil
+		case <-s.closed:
+			return nil, io.EOF
+		}
+	}
+	return batch, nil
+}
+
+func (s *MQTTSource) track(message MQTTMessage) *sarama.ConsumerMessage {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	offset := s.offset
+	s.offset++
+	if message.Qos() > 0 {
+		s.pending[offset] = message
+	} else {
+		message.Ack()
+	}
+	return &sarama.ConsumerMessage{Topic: message.Topic(), Value: message.Payload(), Offset: offset, Timestamp: time.Now()}
+}
+
+// Commit acknowledges the QoS 1 and 2 messages of a processed batch to the broker.
+func (s *MQTTSource) Commit(messages []*sarama.ConsumerMessage) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, message := range messages {
+		if pending, found := s.pending[message.Offset]; found {
+			pending.Ack()
+			delete(s.pending, message.Offset)
+		}
+	}
+	return nil
+}
+
+// Close stops delivering messages. Unacknowledged messages are redelivered by the broker on reconnection.
+// The MQTTClient is not disconnected.
+func (s *MQTTSource) Close() error {
+	close(s.closed)
+	return nil
+}
+
+// MQTTTopicFunc returns the MQTT topic an incoming Kafka message is published to.
+type MQTTTopicFunc func(message *sarama.ConsumerMessage) string
+
+// MQTTSink is a MessageProcessor that publishes incoming messages to MQTT, bridging Kafka topics to MQTT.
+// Publish waits for the broker's acknowledgement, so with QoS 1 or 2 offsets are only committed once the
+// messages have been accepted by the broker (at least once). With QoS 0, messages are delivered at most once.
+type MQTTSink struct {
+	client MQTTClient
+	topic  MQTTTopicFunc
+	qos    byte
+}
+
+// NewMQTTSink creates an MQTTSink publishing with the given QoS to the topics returned by topic.
+// If topic is nil, messages are published to an MQTT topic named after their Kafka topic.
+func NewMQTTSink(client MQTTClient, topic MQTTTopicFunc, qos byte) *MQTTSink {
+	if topic == nil {
+		topic = func(message *sarama.ConsumerMessage) string { return message.Topic }
+	}
+	return &MQTTSink{client, topic, qos}
+}
+
+// Process publishes a batch of messages in order, and fails on the first message that cannot be published.
+// Tombstones are not published.
+func (s *MQTTSink) Process(messages []*sarama.ConsumerMessage, sender Sender) error {
+	for _, message := range messages {
+		if IsTombstone(message) {
+			continue
+		}
+		err := s.client.Publish(s.topic(message), s.qos, message.Value)
+		if err != nil {
+			return fmt.Errorf("cannot publish message at offset %d of %s/%d to MQTT: %s", message.Offset, message.Topic, message.Partition, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package kasper
+
+import (
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeMQTTMessage struct {
+	topic   string
+	payload []byte
+	qos     byte
+	acked   bool
+}
+
+func (m *fakeMQTTMessage) Topic() string   { return m.topic }
+func (m *fakeMQTTMessage) Payload() []byte { return m.payload }
+func (m *fakeMQTTMessage) Qos() byte       { return m.qos }
+func (m *fakeMQTTMessage) Ack()            { m.acked = true }
+
+type fakeMQTTClient struct {
+	handlers  map[string]func(MQTTMessage)
+	published []string
+	err       error
+}
+
+func (c *fakeMQTTClient) Subscribe(topic string, qos byte, handler func(MQTTMessage)) error {
+	c.handlers[topic] = handler
+	return c.err
+}
+
+func (c *fakeMQTTClient) Publish(topic string, qos byte, payload []byte) error {
+	c.published = append(c.published, topic+" "+string(payload))
+	return c.err
+}
+
+func TestMQTTSource(t *testing.T) {
+	client := &fakeMQTTClient{handlers: make(map[string]func(MQTTMessage))}
+	source, err := NewMQTTSource(client, map[string]byte{"sensors/#": 1}, 10)
+	assert.Nil(t, err)
+	atMostOnce := &fakeMQTTMessage{"sensors/a", []byte("1"), 0, false}
+	atLeastOnce := &fakeMQTTMessage{"sensors/b", []byte("2"), 1, false}
+	client.handlers["sensors/#"](atMostOnce)
+	client.handlers["sensors/#"](atLeastOnce)
+
+	batch, err := source.NextBatch(10, 10*time.Millisecond)
+	assert.Nil(t, err)
+	assert.Len(t, batch, 2)
+	assert.Equal(t, "sensors/b", batch[1].Topic)
+	assert.Equal(t, int64(1), batch[1].Offset)
+	assert.True(t, atMostOnce.acked)
+	assert.False(t, atLeastOnce.acked)
+
+	// QoS 1 messages are acknowledged once processed
+	assert.Nil(t, source.Commit(batch))
+	assert.True(t, atLeastOnce.acked)
+
+	assert.Nil(t, source.Close())
+	_, err = source.NextBatch(10, time.Second)
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestNewMQTTSource_Error(t *testing.T) {
+	client := &fakeMQTTClient{handlers: make(map[string]func(MQTTMessage)), err: errors.New("not authorized")}
+	_, err := NewMQTTSource(client, map[string]byte{"sensors": 1}, 10)
+	assert.EqualError(t, err, "cannot subscribe to MQTT topic sensors: not authorized")
+}
+
+func TestMQTTSink_Process(t *testing.T) {
+	client := &fakeMQTTClient{}
+	sink := NewMQTTSink(client, nil, 1)
+	assert.Nil(t, sink.Process([]*sarama.ConsumerMessage{
+		{Topic: "dragons", Value: []byte("mushu")},
+		{Topic: "dragons", Key: []byte("falkor")},
+	}, &bufferSender{}))
+	assert.Equal(t, []string{"dragons mushu"}, client.published)
+
+	client.err = errors.New("disconnected")
+	err := sink.Process([]*sarama.ConsumerMessage{{Topic: "dragons", Value: []byte("saphira"), Offset: 3}}, &bufferSender{})
+	assert.EqualError(t, err, "cannot publish message at offset 3 of dragons/0 to MQTT: disconnected")
+}
@@ -0,0 +1,108 @@
+package kasper
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/Shopify/sarama"
+)
+
+// PartitionOffsetCheck is the result of Admin.CheckOffsets for a single topic partition.
+type PartitionOffsetCheck struct {
+	Topic     string `json:"topic"`
+	Partition int32  `json:"partition"`
+	// Offset committed by the consumer group, or sarama.OffsetNewest (-1) if none or if an OffsetStore is checked
+	CommittedOffset int64 `json:"committedOffset"`
+	// Offset committed in the OffsetStore alongside the Stores, or sarama.OffsetNewest (-1) if none or not checked
+	StoreOffset   int64 `json:"storeOffset"`
+	OldestOffset  int64 `json:"oldestOffset"`
+	HighWaterMark int64 `json:"highWaterMark"`
+	// Inconsistencies found, empty if the partition is consistent
+	Problems []string `json:"problems"`
+}
+
+// Consistent returns true if no problem was found.
+func (c *PartitionOffsetCheck) Consistent() bool {
+	return len(c.Problems) == 0
+}
+
+// CheckOffsets compares the committed offsets of a consumer group with the offsets available in the brokers,
+// to detect drift or state corruption after incidents. When offsetStore is not nil, the offsets of the OffsetStore
+// are checked instead, since TopicProcessors using an OffsetStore (see Config.OffsetStore) do not commit consumer
+// group offsets. Topics typically include the input topics of a TopicProcessor and the changelog topics materialized
+// in its Stores (see TableMaterializer). The following are reported as problems:
+//
+//   - an offset beyond the high water mark, e.g. after a topic was recreated or an unclean leader election
+//   - an offset before the oldest available offset, i.e. messages deleted by retention before processing
+//
+// Results are sorted by topic and partition.
+func (admin *Admin) CheckOffsets(group string, offsetStore OffsetStore, topics ...string) ([]*PartitionOffsetCheck, error) {
+	var committed map[string]map[int32]int64
+	if offsetStore == nil {
+		var err error
+		committed, err = admin.ConsumerGroupOffsets(group, topics...)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var checks []*PartitionOffsetCheck
+	for _, topic := range topics {
+		partitions, err := admin.client.Partitions(topic)
+		if err != nil {
+			return nil, err
+		}
+		for _, partition := range partitions {
+			check := &PartitionOffsetCheck{
+				Topic:           topic,
+				Partition:       partition,
+				CommittedOffset: sarama.OffsetNewest,
+				StoreOffset:     sarama.OffsetNewest,
+			}
+			if offset, found := committed[topic][partition]; found {
+				check.CommittedOffset = offset
+			}
+			check.OldestOffset, err = admin.client.GetOffset(topic, partition, sarama.OffsetOldest)
+			if err != nil {
+				return nil, err
+			}
+			check.HighWaterMark, err = admin.client.GetOffset(topic, partition, sarama.OffsetNewest)
+			if err != nil {
+				return nil, err
+			}
+			if offsetStore != nil {
+				offset, found, err := offsetStore.FetchOffset(topic, int(partition))
+				if err != nil {
+					return nil, err
+				}
+				if found {
+					check.StoreOffset = offset
+				}
+			}
+			check.findProblems(offsetStore != nil)
+			checks = append(checks, check)
+		}
+	}
+	sort.Slice(checks, func(i, j int) bool {
+		if checks[i].Topic != checks[j].Topic {
+			return checks[i].Topic < checks[j].Topic
+		}
+		return checks[i].Partition < checks[j].Partition
+	})
+	return checks, nil
+}
+
+func (c *PartitionOffsetCheck) findProblems(checkStore bool) {
+	name, offset := "committed", c.CommittedOffset
+	if checkStore {
+		name, offset = "store", c.StoreOffset
+	}
+	if offset < 0 {
+		return
+	}
+	if offset > c.HighWaterMark {
+		c.Problems = append(c.Problems, fmt.Sprintf("%s offset %d is beyond the high water mark %d", name, offset, c.HighWaterMark))
+	}
+	if offset < c.OldestOffset {
+		c.Problems = append(c.Problems, fmt.Sprintf("%s offset %d is before the oldest available offset %d, %d messages were never processed", name, offset, c.OldestOffset, c.OldestOffset-offset))
+	}
+}
@@ -0,0 +1,42 @@
+package kasper
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPartitionOffsetCheck_findProblems(t *testing.T) {
+	check := &PartitionOffsetCheck{CommittedOffset: 42, StoreOffset: -1, OldestOffset: 10, HighWaterMark: 50}
+	check.findProblems(false)
+	assert.True(t, check.Consistent())
+
+	check = &PartitionOffsetCheck{CommittedOffset: 60, StoreOffset: -1, OldestOffset: 10, HighWaterMark: 50}
+	check.findProblems(false)
+	assert.Equal(t, []string{"committed offset 60 is beyond the high water mark 50"}, check.Problems)
+
+	check = &PartitionOffsetCheck{CommittedOffset: 5, StoreOffset: -1, OldestOffset: 10, HighWaterMark: 50}
+	check.findProblems(false)
+	assert.Equal(t, []string{"committed offset 5 is before the oldest available offset 10, 5 messages were never processed"}, check.Problems)
+}
+
+func TestPartitionOffsetCheck_findProblems_OffsetStore(t *testing.T) {
+	offsetStore := NewStoreOffsetStore(NewMap(10), "hello")
+	assert.Nil(t, offsetStore.CommitOffset("dragons", 0, 42))
+	assert.Nil(t, offsetStore.CommitOffset("dragons", 1, 5))
+	checks := make([]*PartitionOffsetCheck, 3)
+	for partition := range checks {
+		check := &PartitionOffsetCheck{Topic: "dragons", Partition: int32(partition), CommittedOffset: -1, StoreOffset: -1, OldestOffset: 10, HighWaterMark: 50}
+		offset, found, err := offsetStore.FetchOffset("dragons", partition)
+		assert.Nil(t, err)
+		if found {
+			check.StoreOffset = offset
+		}
+		check.findProblems(true)
+		checks[partition] = check
+	}
+	// Consumer group offsets are not committed when an OffsetStore is used
+	assert.True(t, checks[0].Consistent())
+	assert.Equal(t, []string{"store offset 5 is before the oldest available offset 10, 5 messages were never processed"}, checks[1].Problems)
+	assert.True(t, checks[2].Consistent())
+}
@@ -0,0 +1,75 @@
+package kasper
+
+import (
+	"strconv"
+
+	"github.com/Shopify/sarama"
+)
+
+// offsetAnomalyDetector tracks the continuity of the offsets of incoming messages, see
+// Config.DetectOffsetAnomalies. For each input topic partition, the next expected offset is the committed offset
+// when the partition is assigned, then the offset following the last processed message. A message beyond the
+// expected offset means that offsets were skipped, e.g. after an offset reset to the newest offset.
+// A message before it is reprocessed, e.g. after its offset failed to be committed before an unclean shutdown.
+type offsetAnomalyDetector struct {
+	gaps       Counter
+	duplicates Counter
+}
+
+func newOffsetAnomalyDetector(config *Config) *offsetAnomalyDetector {
+	if !config.DetectOffsetAnomalies {
+		return nil
+	}
+	provider := config.MetricsProvider
+	return &offsetAnomalyDetector{
+		gaps:       provider.NewCounter("offset_gap_count", "Number of input offsets skipped between processed messages", "topic", "partition"),
+		duplicates: provider.NewCounter("offset_duplicate_count", "Number of incoming messages whose offset was already processed", "topic", "partition"),
+	}
+}
+
+// initExpectedOffsets expects the first message of each input topic at its committed offset. When the start
+// offsets are deliberately moved (see Config.ReplayMode and Config.RewindMessages), the first message is not checked.
+func (pp *partitionProcessor) initExpectedOffsets() {
+	config := pp.topicProcessor.config
+	pp.expectedOffsets = make(map[string]int64)
+	if config.ReplayMode || config.RewindMessages > 0 || config.RewindDuration > 0 {
+		return
+	}
+	for topic, pom := range pp.offsetManagers {
+		offset, _ := pom.NextOffset()
+		if offset >= 0 {
+			pp.expectedOffsets[topic] = offset
+		}
+	}
+}
+
+// checkOffsetContinuity counts and logs the offsets skipped and reprocessed by a batch of messages.
+func (pp *partitionProcessor) checkOffsetContinuity(messages []*sarama.ConsumerMessage) {
+	d := pp.topicProcessor.offsetAnomalies
+	if d == nil || pp.expectedOffsets == nil {
+		return
+	}
+	gaps := make(map[string]int64)
+	duplicates := make(map[string]int64)
+	for _, message := range messages {
+		expected, found := pp.expectedOffsets[message.Topic]
+		switch {
+		case !found:
+		case message.Offset > expected:
+			gaps[message.Topic] += message.Offset - expected
+		case message.Offset < expected:
+			duplicates[message.Topic]++
+			continue
+		}
+		pp.expectedOffsets[message.Topic] = message.Offset + 1
+	}
+	partition := strconv.Itoa(pp.partition)
+	for topic, count := range gaps {
+		d.gaps.Add(float64(count), topic, partition)
+		pp.logger.Errorf("Skipped %d offsets of topic partition %s-%d", count, topic, pp.partition)
+	}
+	for topic, count := range duplicates {
+		d.duplicates.Add(float64(count), topic, partition)
+		pp.logger.Errorf("Reprocessing %d messages of topic partition %s-%d", count, topic, pp.partition)
+	}
+}
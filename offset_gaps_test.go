@@ -0,0 +1,52 @@
+package kasper
+
+import (
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPartitionProcessor_checkOffsetContinuity(t *testing.T) {
+	config := &Config{DetectOffsetAnomalies: true, MetricsProvider: &NoopMetricsProvider{}}
+	tp := &TopicProcessor{config: config, logger: &noopLogger{}, offsetAnomalies: newOffsetAnomalyDetector(config)}
+	gaps := &countingMetric{}
+	duplicates := &countingMetric{}
+	tp.offsetAnomalies.gaps = gaps
+	tp.offsetAnomalies.duplicates = duplicates
+	pp, _, _ := newReassignTestPartitionProcessor(tp, 0, nil)
+	pp.offsetManagers = map[string]sarama.PartitionOffsetManager{
+		"dragons": &fakePartitionOffsetManager{offset: 10},
+		"riders":  &fakePartitionOffsetManager{offset: sarama.OffsetNewest},
+	}
+	pp.initExpectedOffsets()
+	assert.Equal(t, map[string]int64{"dragons": 10}, pp.expectedOffsets)
+
+	pp.checkOffsetContinuity([]*sarama.ConsumerMessage{
+		{Topic: "dragons", Offset: 10},
+		{Topic: "riders", Offset: 500},
+		{Topic: "dragons", Offset: 11},
+		{Topic: "riders", Offset: 501},
+	})
+	assert.Equal(t, 0, gaps.count)
+	assert.Equal(t, 0, duplicates.count)
+
+	pp.checkOffsetContinuity([]*sarama.ConsumerMessage{
+		{Topic: "dragons", Offset: 15},
+		{Topic: "riders", Offset: 500},
+		{Topic: "riders", Offset: 501},
+		{Topic: "riders", Offset: 502},
+	})
+	assert.Equal(t, 3, gaps.count)
+	assert.Equal(t, 2, duplicates.count)
+	assert.Equal(t, map[string]int64{"dragons": 16, "riders": 503}, pp.expectedOffsets)
+}
+
+func TestPartitionProcessor_initExpectedOffsets_Rewind(t *testing.T) {
+	config := &Config{DetectOffsetAnomalies: true, RewindMessages: 100, MetricsProvider: &NoopMetricsProvider{}}
+	tp := &TopicProcessor{config: config, logger: &noopLogger{}, offsetAnomalies: newOffsetAnomalyDetector(config)}
+	pp, _, _ := newReassignTestPartitionProcessor(tp, 0, nil)
+	pp.offsetManagers = map[string]sarama.PartitionOffsetManager{"dragons": &fakePartitionOffsetManager{offset: 10}}
+	pp.initExpectedOffsets()
+	assert.Empty(t, pp.expectedOffsets)
+}
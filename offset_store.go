@@ -0,0 +1,128 @@
+package kasper
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/Shopify/sarama"
+)
+
+// OffsetStore persists the offsets of the input partitions of a TopicProcessor.
+// When Config.OffsetStore is nil, offsets are committed to Kafka under the TopicProcessor's consumer group.
+// Keeping offsets in the system a MessageProcessor writes to (e.g. Redis) allows writing them atomically with
+// the processing results, which gives exactly-once processing into that system (see StoreOffsetStore).
+type OffsetStore interface {
+	// FetchOffset returns the next offset to consume. found is false if no offset has been committed yet.
+	FetchOffset(topic string, partition int) (offset int64, found bool, err error)
+	// CommitOffset persists the next offset to consume.
+	CommitOffset(topic string, partition int, offset int64) error
+}
+
+// StoreOffsetStore is an OffsetStore that keeps offsets in a Store.
+type StoreOffsetStore struct {
+	store              Store
+	topicProcessorName string
+}
+
+// NewStoreOffsetStore creates an OffsetStore keeping the offsets of the given TopicProcessor in store.
+func NewStoreOffsetStore(store Store, topicProcessorName string) *StoreOffsetStore {
+	return &StoreOffsetStore{store, topicProcessorName}
+}
+
+// OffsetKey returns the key under which the offset of a topic partition is stored.
+func (s *StoreOffsetStore) OffsetKey(topic string, partition int) string {
+	return fmt.Sprintf("kasper-offset/%s/%s/%d", s.topicProcessorName, topic, partition)
+}
+
+// FetchOffset returns the next offset to consume.
+func (s *StoreOffsetStore) FetchOffset(topic string, partition int) (int64, bool, error) {
+	value, err := s.store.Get(s.OffsetKey(topic, partition))
+	if err != nil || value == nil {
+		return 0, false, err
+	}
+	offset, err := strconv.ParseInt(string(value), 10, 64)
+	if err != nil {
+		return 0, false, err
+	}
+	return offset, true, nil
+}
+
+// CommitOffset puts the next offset to consume in the Store and flushes it.
+func (s *StoreOffsetStore) CommitOffset(topic string, partition int, offset int64) error {
+	err := s.store.Put(s.OffsetKey(topic, partition), []byte(strconv.FormatInt(offset, 10)))
+	if err != nil {
+		return err
+	}
+	return s.store.Flush()
+}
+
+// OffsetEntries returns the offsets to commit once messages have been processed, as key-value pairs.
+// A MessageProcessor writing to the same Store can add them to its own PutAll() call, so that its writes and
+// the offsets are committed atomically (Redis.PutAll uses a MULTI/EXEC transaction).
+func (s *StoreOffsetStore) OffsetEntries(messages []*sarama.ConsumerMessage) map[string][]byte {
+	entries := make(map[string][]byte)
+	for _, message := range messages {
+		key := s.OffsetKey(message.Topic, int(message.Partition))
+		entries[key] = []byte(strconv.FormatInt(message.Offset+1, 10))
+	}
+	return entries
+}
+
+// storePartitionOffsetManager adapts an OffsetStore to sarama.PartitionOffsetManager.
+type storePartitionOffsetManager struct {
+	mutex       sync.Mutex
+	offsetStore OffsetStore
+	topic       string
+	partition   int
+	offset      int64
+	logger      Logger
+}
+
+func newStorePartitionOffsetManager(tp *TopicProcessor, topic string, partition int) *storePartitionOffsetManager {
+	offset, found, err := tp.config.OffsetStore.FetchOffset(topic, partition)
+	if err != nil {
+		tp.logger.Panic(err)
+	}
+	if !found {
+		offset = tp.config.Client.Config().Consumer.Offsets.Initial
+	}
+	return &storePartitionOffsetManager{
+		offsetStore: tp.config.OffsetStore,
+		topic:       topic,
+		partition:   partition,
+		offset:      offset,
+		logger:      tp.logger,
+	}
+}
+
+func (m *storePartitionOffsetManager) NextOffset() (int64, string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.offset, ""
+}
+
+// MarkOffset commits offset to the OffsetStore. Like sarama's offset manager, it never moves the offset backwards.
+func (m *storePartitionOffsetManager) MarkOffset(offset int64, metadata string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if offset <= m.offset {
+		return
+	}
+	err := m.offsetStore.CommitOffset(m.topic, m.partition, offset)
+	if err != nil {
+		m.logger.Errorf("Cannot commit offset %d of topic partition %s-%d: %s", offset, m.topic, m.partition, err)
+		return
+	}
+	m.offset = offset
+}
+
+func (m *storePartitionOffsetManager) Errors() <-chan *sarama.ConsumerError {
+	return nil
+}
+
+func (m *storePartitionOffsetManager) AsyncClose() {}
+
+func (m *storePartitionOffsetManager) Close() error {
+	return nil
+}
@@ -0,0 +1,52 @@
+package kasper
+
+import (
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStoreOffsetStore(t *testing.T) {
+	store := NewMap(10)
+	offsetStore := NewStoreOffsetStore(store, "test")
+	_, found, err := offsetStore.FetchOffset("hello", 3)
+	assert.Nil(t, err)
+	assert.False(t, found)
+
+	assert.Nil(t, offsetStore.CommitOffset("hello", 3, 42))
+	offset, found, err := offsetStore.FetchOffset("hello", 3)
+	assert.Nil(t, err)
+	assert.True(t, found)
+	assert.Equal(t, int64(42), offset)
+
+	entries := offsetStore.OffsetEntries([]*sarama.ConsumerMessage{
+		{Topic: "hello", Partition: 3, Offset: 42},
+		{Topic: "hello", Partition: 3, Offset: 43},
+		{Topic: "world", Partition: 3, Offset: 7},
+	})
+	assert.Equal(t, map[string][]byte{
+		"kasper-offset/test/hello/3": []byte("44"),
+		"kasper-offset/test/world/3": []byte("8"),
+	}, entries)
+	assert.Nil(t, store.PutAll(entries))
+	offset, _, _ = offsetStore.FetchOffset("world", 3)
+	assert.Equal(t, int64(8), offset)
+}
+
+func TestStorePartitionOffsetManager_MarkOffset(t *testing.T) {
+	offsetStore := NewStoreOffsetStore(NewMap(10), "test")
+	pom := &storePartitionOffsetManager{
+		offsetStore: offsetStore,
+		topic:       "hello",
+		partition:   0,
+		offset:      sarama.OffsetOldest,
+		logger:      &noopLogger{},
+	}
+	pom.MarkOffset(10, "")
+	pom.MarkOffset(5, "")
+	offset, _ := pom.NextOffset()
+	assert.Equal(t, int64(10), offset)
+	stored, _, _ := offsetStore.FetchOffset("hello", 0)
+	assert.Equal(t, int64(10), stored)
+}
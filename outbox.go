@@ -0,0 +1,116 @@
+package kasper
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/Shopify/sarama"
+)
+
+// OutboxEvent is an event read from a transactional outbox, to be forwarded to a domain topic.
+type OutboxEvent struct {
+	// Unique ID of the event in the outbox, used for deduplication
+	ID string
+	// Domain topic the event is forwarded to
+	Topic string
+	Key   []byte
+	Value []byte
+}
+
+// OutboxEventFunc extracts the outbox event of an incoming message. A nil event skips the message.
+type OutboxEventFunc func(message *sarama.ConsumerMessage) (*OutboxEvent, error)
+
+type outboxJSONEvent struct {
+	ID      string          `json:"id"`
+	Topic   string          `json:"topic"`
+	Key     string          `json:"key"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// ParseOutboxJSON is an OutboxEventFunc for outbox rows captured as JSON objects with "id", "topic", "key"
+// and "payload" fields. The payload is forwarded as is, as JSON.
+func ParseOutboxJSON(message *sarama.ConsumerMessage) (*OutboxEvent, error) {
+	var row outboxJSONEvent
+	err := json.Unmarshal(message.Value, &row)
+	if err != nil {
+		return nil, err
+	}
+	if row.ID == "" || row.Topic == "" {
+		return nil, fmt.Errorf("outbox row at offset %d of %s/%d has no id or topic", message.Offset, message.Topic, message.Partition)
+	}
+	return &OutboxEvent{row.ID, row.Topic, []byte(row.Key), row.Payload}, nil
+}
+
+// OutboxForwarder is a MessageProcessor implementing the relay side of the transactional outbox pattern:
+// it consumes outbox (or CDC) topics, where applications write events in the same database transaction as
+// their state changes, and forwards each event to its domain topic, with the timestamp of the outbox message.
+//
+// CDC connectors deliver outbox rows at least once, so events are deduplicated by ID: the IDs of forwarded
+// events are kept in a TTLStore, and an event whose ID is still present is dropped. Call TTLStore.Expire
+// periodically to delete expired IDs. Tombstones are ignored.
+//
+// The vendored sarama client predates Kafka record headers, so there are no headers to preserve.
+type OutboxForwarder struct {
+	store *TTLStore
+	event OutboxEventFunc
+}
+
+// NewOutboxForwarder creates an OutboxForwarder keeping forwarded IDs in store.
+// If event is nil, ParseOutboxJSON is used.
+func NewOutboxForwarder(store *TTLStore, event OutboxEventFunc) *OutboxForwarder {
+	if event == nil {
+		event = ParseOutboxJSON
+	}
+	return &OutboxForwarder{store, event}
+}
+
+// Process forwards the events of a batch of outbox messages that have not been forwarded yet.
+func (f *OutboxForwarder) Process(messages []*sarama.ConsumerMessage, sender Sender) error {
+	var events []*OutboxEvent
+	var sources []*sarama.ConsumerMessage
+	var ids []string
+	for _, message := range messages {
+		if IsTombstone(message) {
+			continue
+		}
+		f.store.ObserveStreamTime(message.Timestamp)
+		event, err := f.event(message)
+		if err != nil {
+			return err
+		}
+		if event == nil {
+			continue
+		}
+		events = append(events, event)
+		sources = append(sources, message)
+		ids = append(ids, f.idKey(event.ID))
+	}
+	if len(events) == 0 {
+		return nil
+	}
+	forwarded, err := f.store.GetAll(ids)
+	if err != nil {
+		return err
+	}
+	updates := make(map[string][]byte)
+	for i, event := range events {
+		if _, found := forwarded[ids[i]]; found {
+			continue
+		}
+		if _, found := updates[ids[i]]; found {
+			continue
+		}
+		sender.Send(&sarama.ProducerMessage{
+			Topic:     event.Topic,
+			Key:       sarama.ByteEncoder(event.Key),
+			Value:     sarama.ByteEncoder(event.Value),
+			Timestamp: sources[i].Timestamp,
+		})
+		updates[ids[i]] = []byte(event.Topic)
+	}
+	return f.store.PutAll(updates)
+}
+
+func (f *OutboxForwarder) idKey(id string) string {
+	return "kasper-outbox/" + id
+}
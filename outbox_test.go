@@ -0,0 +1,40 @@
+package kasper
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+func newOutboxTestMessage(value string) *sarama.ConsumerMessage {
+	return &sarama.ConsumerMessage{Topic: "outbox", Value: []byte(value), Timestamp: time.Unix(1500000000, 0)}
+}
+
+func TestOutboxForwarder_Process(t *testing.T) {
+	f := NewOutboxForwarder(NewTTLStore(NewMap(10), time.Hour, TTLStreamTime), nil)
+	sender := &bufferSender{}
+	assert.Nil(t, f.Process([]*sarama.ConsumerMessage{
+		newOutboxTestMessage(`{"id":"1","topic":"orders","key":"o-1","payload":{"total":10}}`),
+		newOutboxTestMessage(`{"id":"1","topic":"orders","key":"o-1","payload":{"total":10}}`),
+		newOutboxTestMessage(`{"id":"2","topic":"payments","key":"p-1","payload":"paid"}`),
+	}, sender))
+	assert.Len(t, sender.messages, 2)
+	assert.Equal(t, "orders", sender.messages[0].Topic)
+	key, _ := sender.messages[0].Key.Encode()
+	assert.Equal(t, []byte("o-1"), key)
+	value, _ := sender.messages[0].Value.Encode()
+	assert.Equal(t, []byte(`{"total":10}`), value)
+	assert.Equal(t, time.Unix(1500000000, 0), sender.messages[0].Timestamp)
+	assert.Equal(t, "payments", sender.messages[1].Topic)
+
+	// Redelivered events are dropped
+	sender = &bufferSender{}
+	assert.Nil(t, f.Process([]*sarama.ConsumerMessage{
+		newOutboxTestMessage(`{"id":"2","topic":"payments","key":"p-1","payload":"paid"}`),
+	}, sender))
+	assert.Empty(t, sender.messages)
+
+	assert.NotNil(t, f.Process([]*sarama.ConsumerMessage{newOutboxTestMessage(`{"payload":1}`)}, sender))
+}
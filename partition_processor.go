@@ -1,6 +1,8 @@
 package kasper
 
 import (
+	"context"
+	"fmt"
 	"strconv"
 
 	"github.com/Shopify/sarama"
@@ -11,10 +13,17 @@ type partitionProcessor struct {
 	consumer           sarama.Consumer
 	partitionConsumers []sarama.PartitionConsumer
 	offsetManagers     map[string]sarama.PartitionOffsetManager
+	offsetTrackers     map[string]*offsetTracker
 	messageProcessor   MessageProcessor
 	inputTopics        []string
 	partition          int
 	logger             Logger
+	stopped            int32
+	generation         int64
+	offsetBounds       map[string]*offsetBound
+	resumeOffsets      map[string]int64
+	prefetchBuffers    []*prefetchBuffer
+	expectedOffsets    map[string]int64
 }
 
 func (pp *partitionProcessor) consumerMessageChannels() []<-chan *sarama.ConsumerMessage {
@@ -22,10 +31,16 @@ func (pp *partitionProcessor) consumerMessageChannels() []<-chan *sarama.Consume
 	for i, consumer := range pp.partitionConsumers {
 		chans[i] = consumer.Messages()
 	}
+	for i, buffer := range pp.prefetchBuffers {
+		chans[i] = buffer.output
+	}
 	return chans
 }
 
 func getPartitionOffsetManager(tp *TopicProcessor, topic string, partition int) sarama.PartitionOffsetManager {
+	if tp.config.OffsetStore != nil {
+		return newStorePartitionOffsetManager(tp, topic, partition)
+	}
 	pom, err := tp.offsetManager.ManagePartition(topic, int32(partition))
 	if err != nil {
 		tp.logger.Panic(err)
@@ -39,6 +54,11 @@ func getPartitionConsumer(tp *TopicProcessor, consumer sarama.Consumer, pom sara
 		tp.logger.Panic(err)
 	}
 	nextOffset, _ := pom.NextOffset()
+	if tp.config.ReplayMode {
+		tp.logger.Infof("Replaying topic partition %s-%d from offset '%s'", topic, partition, offsetToString(tp.config.ReplayFromOffset))
+		nextOffset = tp.config.ReplayFromOffset
+	}
+	nextOffset = tp.rewindOffset(topic, partition, nextOffset)
 	if nextOffset > newestOffset {
 		nextOffset = sarama.OffsetNewest
 	}
@@ -57,27 +77,55 @@ func newPartitionProcessor(tp *TopicProcessor, mp MessageProcessor, partition in
 	}
 	partitionConsumers := make([]sarama.PartitionConsumer, len(tp.inputTopics))
 	partitionOffsetManagers := make(map[string]sarama.PartitionOffsetManager)
+	offsetTrackers := make(map[string]*offsetTracker)
 	for i, topic := range tp.inputTopics {
 		partitionOffsetManager := getPartitionOffsetManager(tp, topic, partition)
 		partitionConsumer := getPartitionConsumer(tp, consumer, partitionOffsetManager, topic, partition)
 		partitionConsumers[i] = partitionConsumer
 		partitionOffsetManagers[topic] = partitionOffsetManager
+		offsetTrackers[topic] = newOffsetTracker(partitionOffsetManager)
 	}
 	pp := &partitionProcessor{
 		tp,
 		consumer,
 		partitionConsumers,
 		partitionOffsetManagers,
+		offsetTrackers,
 		mp,
 		tp.inputTopics,
 		partition,
 		tp.logger,
+		0,
+		mustAcquireGeneration(tp.config, partition),
+		mustGetOffsetBounds(tp, partitionOffsetManagers, partition),
+		nil,
+		newPrefetchBuffers(tp.config, partitionConsumers),
+		nil,
 	}
+	pp.fenceOffsetTrackers()
+	if tp.config.CommitBarrier {
+		pp.setCommitBarrier()
+	}
+	if tp.offsetAnomalies != nil {
+		pp.initExpectedOffsets()
+	}
+	tp.config.emitEvent(Event{Type: EventPartitionStarted, Partition: partition})
 	return pp
 }
 
 func (pp *partitionProcessor) process(msgs []*sarama.ConsumerMessage) ([]*sarama.ProducerMessage, error) {
+	if pp.topicProcessor.config.ProcessTimeout > 0 {
+		return pp.processWithTimeout(msgs)
+	}
+	return pp.processWithContext(context.Background(), msgs)
+}
+
+func (pp *partitionProcessor) processWithContext(ctx context.Context, msgs []*sarama.ConsumerMessage) ([]*sarama.ProducerMessage, error) {
+	if pp.topicProcessor.config.SampleHook != nil && pp.topicProcessor.settings.getSampleRate(pp.topicProcessor.config) > 0 {
+		return pp.processSampled(ctx, msgs)
+	}
 	sender := newSender(pp)
+	sender.ctx = ctx
 	err := pp.messageProcessor.Process(msgs, sender)
 	if err != nil {
 		pp.logger.Errorf("Message processor returned error: %s", err)
@@ -86,9 +134,50 @@ func (pp *partitionProcessor) process(msgs []*sarama.ConsumerMessage) ([]*sarama
 	return sender.producerMessages, nil
 }
 
+// runLoop is the processing loop of a single partition, used when Config.IndependentPartitionLoops is set.
+// It returns nil when stop or TopicProcessor.close is closed, or in bounded mode when the partition is complete.
+func (pp *partitionProcessor) runLoop(stop <-chan struct{}) error {
+	tp := pp.topicProcessor
+	consumerChan := tp.getConsumerMessagesChan(pp.consumerMessageChannels())
+	batchTicker := tp.config.clock().NewTicker(tp.config.BatchWaitDuration)
+	defer batchTicker.Stop()
+	batch := make([]*sarama.ConsumerMessage, 0, tp.config.BatchSize)
+
+	for !pp.isComplete() {
+		select {
+		case consumerMessage := <-consumerChan:
+			pp.logger.Debugf("Received: %s", consumerMessage)
+			batch = append(batch, consumerMessage)
+			if len(batch) < tp.batchSize() {
+				continue
+			}
+		case <-batchTicker.C():
+			if len(batch) == 0 {
+				continue
+			}
+		case <-stop:
+			return nil
+		case <-tp.close:
+			if (tp.config.GracefulHandoff || tp.isDraining()) && len(batch) > 0 {
+				return tp.processConsumerMessages(batch, pp.partition)
+			}
+			return nil
+		}
+		pp.logger.Debugf("Processing batch of %d messages for partition %d...", len(batch), pp.partition)
+		err := tp.processConsumerMessages(batch, pp.partition)
+		if err != nil {
+			return err
+		}
+		batch = batch[:0]
+		pp.logger.Debug("Processing of batch complete")
+	}
+	return nil
+}
+
 func (pp *partitionProcessor) countMessagesBehindHighWaterMark() {
 	partition := strconv.Itoa(pp.partition)
 	highWaterMarks := pp.consumer.HighWaterMarks()
+	var lag int64
 	for _, topic := range pp.topicProcessor.inputTopics {
 		offsetManager := pp.offsetManagers[topic]
 		currentOffset, _ := offsetManager.NextOffset()
@@ -98,8 +187,10 @@ func (pp *partitionProcessor) countMessagesBehindHighWaterMark() {
 		} else if currentOffset != sarama.OffsetOldest {
 			messagesBehindHighWaterMark := highWaterMark - currentOffset
 			pp.topicProcessor.messagesBehindHighWaterMark.Set(float64(messagesBehindHighWaterMark), topic, partition)
+			lag += messagesBehindHighWaterMark
 		}
 	}
+	pp.topicProcessor.scaling.setLag(pp.partition, lag)
 }
 
 func (pp *partitionProcessor) hasConsumedAllMessages() bool {
@@ -127,31 +218,92 @@ func (pp *partitionProcessor) markOffsets(messages []*sarama.ConsumerMessage) {
 		latestOffset[message.Topic] = message.Offset
 	}
 	for topic, offset := range latestOffset {
+		if pp.topicProcessor.config.FaultInjection.injectCommitFailure() {
+			pp.logger.Errorf("Injected failure of the commit of offset %s:%d", topic, offset+1)
+			continue
+		}
 		pp.logger.Debugf("Marking offset %s:%d", topic, offset+1)
 		pp.offsetManagers[topic].MarkOffset(offset+1, "")
+		pp.topicProcessor.config.emitEvent(Event{Type: EventOffsetCommitted, Partition: pp.partition, Topic: topic, Offset: offset + 1})
 	}
 }
 
 func (pp *partitionProcessor) onClose() {
-	var err error
-	for topic, pom := range pp.offsetManagers {
-		offset, _ := pom.NextOffset()
-		pp.logger.Infof("Stopping consumption of topic partition %s-%d (last offset read was '%s')", topic, pp.partition, offsetToString(offset))
-		err = pom.Close()
-		if err != nil {
-			pp.logger.Panicf("Cannot close offset manager: %s", err)
-		}
+	errs := append(pp.stopConsuming(), pp.closeOffsetManagers()...)
+	for _, err := range errs {
+		pp.logger.Error(err)
 	}
+}
+
+// stopConsuming closes the partition consumers and the consumer of pp.
+func (pp *partitionProcessor) stopConsuming() []error {
+	var errs []error
 	for _, pc := range pp.partitionConsumers {
-		err = pc.Close()
+		err := pc.Close()
 		if err != nil {
-			pp.logger.Panicf("Cannot close partition consumer: %s", err)
+			errs = append(errs, fmt.Errorf("cannot close partition consumer of partition %d: %s", pp.partition, err))
 		}
 	}
-	err = pp.consumer.Close()
+	err := pp.consumer.Close()
 	if err != nil {
-		pp.logger.Panic(err)
+		errs = append(errs, fmt.Errorf("cannot close consumer of partition %d: %s", pp.partition, err))
+	}
+	return errs
+}
+
+// commitOffsets commits the offsets marked in the sarama offset managers of pp, see TopicProcessor.commitOffsets.
+func (pp *partitionProcessor) commitOffsets() error {
+	offsetManagers := make(map[string]map[int32]sarama.PartitionOffsetManager, len(pp.offsetManagers))
+	for topic, pom := range pp.offsetManagers {
+		offsetManagers[topic] = map[int32]sarama.PartitionOffsetManager{int32(pp.partition): pom}
+	}
+	err := pp.topicProcessor.commitOffsets(offsetManagers)
+	if err != nil {
+		return fmt.Errorf("cannot commit offsets of partition %d: %s", pp.partition, err)
+	}
+	return nil
+}
+
+// commitOffsets commits the offsets marked in sarama offset managers with an explicit OffsetCommitRequest,
+// because closing them doesn't flush the offsets marked since their last periodic commit.
+// Offset managers backed by Config.OffsetStore commit on MarkOffset and are left alone.
+func (tp *TopicProcessor) commitOffsets(offsetManagers map[string]map[int32]sarama.PartitionOffsetManager) error {
+	if tp.offsetManager == nil {
+		return nil
+	}
+	offsets := make(map[string]map[int32]int64)
+	for topic, poms := range offsetManagers {
+		for partition, pom := range poms {
+			offset, _ := pom.NextOffset()
+			if offset < 0 {
+				continue
+			}
+			if offsets[topic] == nil {
+				offsets[topic] = make(map[int32]int64)
+			}
+			offsets[topic][partition] = offset
+		}
+	}
+	if len(offsets) == 0 {
+		return nil
+	}
+	return NewAdmin(tp.config.Client).ResetConsumerGroupOffsets(tp.config.kafkaConsumerGroup(), offsets)
+}
+
+// closeOffsetManagers closes the offset managers of pp.
+// Offsets marked since the last periodic commit are not flushed, see commitOffsets.
+func (pp *partitionProcessor) closeOffsetManagers() []error {
+	var errs []error
+	for topic, pom := range pp.offsetManagers {
+		offset, _ := pom.NextOffset()
+		pp.logger.Infof("Stopping consumption of topic partition %s-%d (last offset read was '%s')", topic, pp.partition, offsetToString(offset))
+		err := pom.Close()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("cannot close offset manager of topic partition %s-%d: %s", topic, pp.partition, err))
+		}
 	}
+	pp.topicProcessor.config.emitEvent(Event{Type: EventPartitionStopped, Partition: pp.partition})
+	return errs
 }
 
 func offsetToString(offset int64) string {
@@ -0,0 +1,107 @@
+package kasper
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakePartitionConsumer struct {
+	messages chan *sarama.ConsumerMessage
+}
+
+func (c *fakePartitionConsumer) AsyncClose() {}
+
+func (c *fakePartitionConsumer) Close() error { return nil }
+
+func (c *fakePartitionConsumer) Messages() <-chan *sarama.ConsumerMessage { return c.messages }
+
+func (c *fakePartitionConsumer) Errors() <-chan *sarama.ConsumerError { return nil }
+
+func (c *fakePartitionConsumer) HighWaterMarkOffset() int64 { return 0 }
+
+type blockingMessageProcessor struct {
+	release   chan struct{}
+	processed chan *sarama.ConsumerMessage
+}
+
+func (p *blockingMessageProcessor) Process(messages []*sarama.ConsumerMessage, sender Sender) error {
+	if p.release != nil {
+		<-p.release
+	}
+	for _, message := range messages {
+		p.processed <- message
+	}
+	return nil
+}
+
+func TestPartitionProcessor_runLoop_Isolation(t *testing.T) {
+	tp := &TopicProcessor{
+		config:               &Config{BatchSize: 1, BatchWaitDuration: time.Hour},
+		close:                make(chan struct{}),
+		logger:               &noopLogger{},
+		incomingMessageCount: &noopMetric{},
+		outgoingMessageCount: &noopMetric{},
+	}
+	processed := make(chan *sarama.ConsumerMessage, 10)
+	release := make(chan struct{})
+	processors := []*blockingMessageProcessor{
+		{release, processed},
+		{nil, processed},
+	}
+	tp.partitionProcessors = make(map[int32]*partitionProcessor)
+	consumers := make([]*fakePartitionConsumer, len(processors))
+	for i, mp := range processors {
+		consumers[i] = &fakePartitionConsumer{make(chan *sarama.ConsumerMessage, 10)}
+		tp.partitionProcessors[int32(i)] = &partitionProcessor{
+			topicProcessor:     tp,
+			partitionConsumers: []sarama.PartitionConsumer{consumers[i]},
+			offsetManagers:     map[string]sarama.PartitionOffsetManager{"hello": &fakePartitionOffsetManager{}},
+			messageProcessor:   mp,
+			partition:          i,
+			logger:             tp.logger,
+		}
+	}
+	stop := make(chan struct{})
+	done := make(chan error, len(processors))
+	for _, pp := range tp.partitionProcessors {
+		go func(pp *partitionProcessor) {
+			done <- pp.runLoop(stop)
+		}(pp)
+	}
+
+	consumers[0].messages <- &sarama.ConsumerMessage{Topic: "hello", Partition: 0}
+	consumers[1].messages <- &sarama.ConsumerMessage{Topic: "hello", Partition: 1}
+	select {
+	case message := <-processed:
+		assert.Equal(t, int32(1), message.Partition)
+	case <-time.After(5 * time.Second):
+		t.Fatal("partition 1 is blocked by partition 0")
+	}
+	close(release)
+	message := <-processed
+	assert.Equal(t, int32(0), message.Partition)
+
+	close(stop)
+	assert.Nil(t, <-done)
+	assert.Nil(t, <-done)
+	close(tp.close)
+}
+
+type fakeConsumer struct {
+	highWaterMarks map[string]map[int32]int64
+}
+
+func (c *fakeConsumer) Topics() ([]string, error) { return nil, nil }
+
+func (c *fakeConsumer) Partitions(topic string) ([]int32, error) { return nil, nil }
+
+func (c *fakeConsumer) ConsumePartition(topic string, partition int32, offset int64) (sarama.PartitionConsumer, error) {
+	return &fakePartitionConsumer{make(chan *sarama.ConsumerMessage)}, nil
+}
+
+func (c *fakeConsumer) HighWaterMarks() map[string]map[int32]int64 { return c.highWaterMarks }
+
+func (c *fakeConsumer) Close() error { return nil }
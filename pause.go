@@ -0,0 +1,47 @@
+package kasper
+
+// Pause stops delivering the messages of the given input partitions to the run loop, until they are resumed.
+// Messages already received are still processed. Consumption of paused partitions stops once the buffers of
+// their partition consumers are full. Unknown partitions are ignored.
+func (tp *TopicProcessor) Pause(partitions ...int) {
+	tp.pausedMutex.Lock()
+	defer tp.pausedMutex.Unlock()
+	if tp.paused == nil {
+		tp.paused = make(map[int]chan struct{})
+	}
+	for _, partition := range partitions {
+		if _, found := tp.paused[partition]; !found {
+			tp.logger.Infof("Pausing partition %d", partition)
+			tp.paused[partition] = make(chan struct{})
+		}
+	}
+}
+
+// Resume resumes the delivery of the messages of the given paused input partitions.
+func (tp *TopicProcessor) Resume(partitions ...int) {
+	tp.pausedMutex.Lock()
+	defer tp.pausedMutex.Unlock()
+	for _, partition := range partitions {
+		if resumed, found := tp.paused[partition]; found {
+			tp.logger.Infof("Resuming partition %d", partition)
+			close(resumed)
+			delete(tp.paused, partition)
+		}
+	}
+}
+
+// waitUntilResumed blocks while partition is paused. It returns false if the TopicProcessor is closed meanwhile.
+func (tp *TopicProcessor) waitUntilResumed(partition int) bool {
+	tp.pausedMutex.Lock()
+	resumed, paused := tp.paused[partition]
+	tp.pausedMutex.Unlock()
+	if !paused {
+		return true
+	}
+	select {
+	case <-resumed:
+		return true
+	case <-tp.close:
+		return false
+	}
+}
@@ -0,0 +1,68 @@
+package kasper
+
+import (
+	"github.com/Shopify/sarama"
+)
+
+// prefetchBuffer reads ahead the messages of a partition consumer, so that fetching carries on while a batch
+// is being processed. Once the buffer holds Config.PrefetchHighWatermark messages, it stops reading from the
+// partition consumer, which in turn stops fetching from Kafka once its own channel is full (see
+// sarama.Config.ChannelBufferSize). Reading resumes when the buffer is down to Config.PrefetchLowWatermark
+// messages. This smooths throughput for MessageProcessors with variable latency while capping memory usage.
+//
+// Buffered messages are discarded when the partition consumer is closed.
+type prefetchBuffer struct {
+	input  <-chan *sarama.ConsumerMessage
+	output chan *sarama.ConsumerMessage
+	high   int
+	low    int
+}
+
+func newPrefetchBuffers(config *Config, partitionConsumers []sarama.PartitionConsumer) []*prefetchBuffer {
+	if config.PrefetchHighWatermark <= 0 {
+		return nil
+	}
+	buffers := make([]*prefetchBuffer, len(partitionConsumers))
+	for i, pc := range partitionConsumers {
+		buffers[i] = newPrefetchBuffer(pc.Messages(), config.PrefetchHighWatermark, config.PrefetchLowWatermark)
+	}
+	return buffers
+}
+
+func newPrefetchBuffer(input <-chan *sarama.ConsumerMessage, high, low int) *prefetchBuffer {
+	b := &prefetchBuffer{input, make(chan *sarama.ConsumerMessage), high, low}
+	go b.run()
+	return b
+}
+
+func (b *prefetchBuffer) run() {
+	defer close(b.output)
+	var queue []*sarama.ConsumerMessage
+	paused := false
+	for {
+		input := b.input
+		if paused {
+			input = nil
+		}
+		var output chan *sarama.ConsumerMessage
+		var head *sarama.ConsumerMessage
+		if len(queue) > 0 {
+			output = b.output
+			head = queue[0]
+		}
+		select {
+		case message, ok := <-input:
+			if !ok {
+				return
+			}
+			queue = append(queue, message)
+			paused = len(queue) >= b.high
+		case output <- head:
+			queue[0] = nil
+			queue = queue[1:]
+			if paused && len(queue) <= b.low {
+				paused = false
+			}
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package kasper
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrefetchBuffer(t *testing.T) {
+	input := make(chan *sarama.ConsumerMessage)
+	b := newPrefetchBuffer(input, 3, 1)
+	for offset := int64(0); offset < 3; offset++ {
+		input <- &sarama.ConsumerMessage{Offset: offset}
+	}
+
+	// Reading is paused at the high watermark
+	select {
+	case input <- &sarama.ConsumerMessage{Offset: 3}:
+		t.Fatal("Expected the prefetch buffer to be paused")
+	case <-time.After(50 * time.Millisecond):
+	}
+	assert.Equal(t, int64(0), (<-b.output).Offset)
+	select {
+	case input <- &sarama.ConsumerMessage{Offset: 3}:
+		t.Fatal("Expected the prefetch buffer to be paused")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Reading resumes at the low watermark
+	assert.Equal(t, int64(1), (<-b.output).Offset)
+	input <- &sarama.ConsumerMessage{Offset: 3}
+	assert.Equal(t, int64(2), (<-b.output).Offset)
+	assert.Equal(t, int64(3), (<-b.output).Offset)
+
+	close(input)
+	_, ok := <-b.output
+	assert.False(t, ok)
+}
@@ -0,0 +1,94 @@
+package kasper
+
+import (
+	"github.com/Shopify/sarama"
+)
+
+// priorityChannels receive the messages of high priority and other input topics before they are merged,
+// with priority, into a channel consumed by a run loop (see Config.HighPriorityTopics).
+type priorityChannels struct {
+	topics map[string]bool
+	high   chan *sarama.ConsumerMessage
+	low    chan *sarama.ConsumerMessage
+}
+
+// forMessage returns the channel to which message must be forwarded.
+func (p *priorityChannels) forMessage(message *sarama.ConsumerMessage, out chan<- *sarama.ConsumerMessage) chan<- *sarama.ConsumerMessage {
+	if p == nil {
+		return out
+	}
+	if p.topics[message.Topic] {
+		return p.high
+	}
+	return p.low
+}
+
+func (tp *TopicProcessor) getPriorityChannels(out chan<- *sarama.ConsumerMessage) *priorityChannels {
+	tp.priorityMutex.Lock()
+	defer tp.priorityMutex.Unlock()
+	return tp.priorityChannels[out]
+}
+
+// prioritizeConsumerMessages starts merging the messages forwarded to out, so that available messages
+// of high priority topics are received first. At most Config.PriorityStarvationLimit high priority
+// messages are received in a row while other messages are waiting.
+func (tp *TopicProcessor) prioritizeConsumerMessages(out chan<- *sarama.ConsumerMessage) {
+	if len(tp.config.HighPriorityTopics) == 0 {
+		return
+	}
+	p := &priorityChannels{
+		make(map[string]bool),
+		make(chan *sarama.ConsumerMessage),
+		make(chan *sarama.ConsumerMessage),
+	}
+	for _, topic := range tp.config.HighPriorityTopics {
+		p.topics[topic] = true
+	}
+	tp.priorityMutex.Lock()
+	if tp.priorityChannels == nil {
+		tp.priorityChannels = make(map[chan<- *sarama.ConsumerMessage]*priorityChannels)
+	}
+	tp.priorityChannels[out] = p
+	tp.priorityMutex.Unlock()
+	tp.waitGroup.Add(1)
+	go func() {
+		defer tp.waitGroup.Done()
+		p.merge(out, tp.config.PriorityStarvationLimit, tp.close)
+	}()
+}
+
+func (p *priorityChannels) merge(out chan<- *sarama.ConsumerMessage, starvationLimit int, close <-chan struct{}) {
+	streak := 0
+	for {
+		var message *sarama.ConsumerMessage
+		if streak >= starvationLimit {
+			select {
+			case message = <-p.low:
+				streak = 0
+			default:
+			}
+		}
+		if message == nil {
+			select {
+			case message = <-p.high:
+				streak++
+			default:
+			}
+		}
+		if message == nil {
+			select {
+			case message = <-p.high:
+				streak++
+			case message = <-p.low:
+				streak = 0
+			case <-close:
+				return
+			}
+		}
+		select {
+		case out <- message:
+		case <-close:
+			return
+		}
+	}
+}
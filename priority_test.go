@@ -0,0 +1,39 @@
+package kasper
+
+import (
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPriorityChannels_merge(t *testing.T) {
+	p := &priorityChannels{
+		map[string]bool{"control": true},
+		make(chan *sarama.ConsumerMessage, 10),
+		make(chan *sarama.ConsumerMessage, 10),
+	}
+	out := make(chan *sarama.ConsumerMessage)
+	for offset := int64(0); offset < 3; offset++ {
+		for _, topic := range []string{"data", "control"} {
+			message := &sarama.ConsumerMessage{Topic: topic, Offset: offset}
+			p.forMessage(message, out) <- message
+		}
+	}
+	closeChan := make(chan struct{})
+	defer close(closeChan)
+	go p.merge(out, 2, closeChan)
+
+	// High priority messages are received first, up to the starvation limit
+	var topics []string
+	for i := 0; i < 6; i++ {
+		topics = append(topics, (<-out).Topic)
+	}
+	assert.Equal(t, []string{"control", "control", "data", "control", "data", "data"}, topics)
+}
+
+func TestPriorityChannels_Disabled(t *testing.T) {
+	var p *priorityChannels
+	out := make(chan *sarama.ConsumerMessage)
+	assert.Equal(t, (chan<- *sarama.ConsumerMessage)(out), p.forMessage(&sarama.ConsumerMessage{Topic: "control"}, out))
+}
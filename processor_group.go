@@ -0,0 +1,97 @@
+package kasper
+
+import (
+	"sync"
+)
+
+// ProcessorHealth is the state of a TopicProcessor of a ProcessorGroup.
+type ProcessorHealth struct {
+	TopicProcessorName string
+	Partitions         []int
+	Running            bool
+	// Error returned by RunLoop, if any
+	Err error
+}
+
+// ProcessorGroup runs several TopicProcessors in the same process, e.g. the stages of a pipeline.
+// The TopicProcessors can share a single sarama Client (Config.Client) and producer (Config.Producer).
+//
+// Failures are isolated: when the RunLoop of a TopicProcessor returns an error, the other TopicProcessors
+// keep running. Use Health or Healthy to detect failed TopicProcessors, e.g. in a liveness probe.
+type ProcessorGroup struct {
+	processors []*TopicProcessor
+	mutex      sync.Mutex
+	health     []ProcessorHealth
+	stopped    sync.WaitGroup
+}
+
+// NewProcessorGroup creates a ProcessorGroup for the given TopicProcessors.
+func NewProcessorGroup(processors ...*TopicProcessor) *ProcessorGroup {
+	health := make([]ProcessorHealth, len(processors))
+	for i, tp := range processors {
+		health[i] = ProcessorHealth{
+			TopicProcessorName: tp.config.TopicProcessorName,
+			Partitions:         tp.config.InputPartitions,
+		}
+	}
+	return &ProcessorGroup{processors: processors, health: health}
+}
+
+// Start runs the RunLoop of each TopicProcessor in its own goroutine and returns immediately.
+func (g *ProcessorGroup) Start() {
+	for i, tp := range g.processors {
+		g.mutex.Lock()
+		g.health[i].Running = true
+		g.mutex.Unlock()
+		g.stopped.Add(1)
+		go g.run(i, tp)
+	}
+}
+
+func (g *ProcessorGroup) run(i int, tp *TopicProcessor) {
+	defer g.stopped.Done()
+	err := tp.RunLoop()
+	if err != nil {
+		tp.logger.Errorf("Topic processor %s stopped with error: %s", tp.config.TopicProcessorName, err)
+	}
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.health[i].Running = false
+	g.health[i].Err = err
+}
+
+// Shutdown drains all TopicProcessors concurrently (see TopicProcessor.Drain) and waits until they have stopped.
+func (g *ProcessorGroup) Shutdown() {
+	var drains sync.WaitGroup
+	for _, tp := range g.processors {
+		drains.Add(1)
+		go func(tp *TopicProcessor) {
+			defer drains.Done()
+			tp.Drain()
+		}(tp)
+	}
+	drains.Wait()
+	g.Wait()
+}
+
+// Wait blocks until all TopicProcessors have stopped.
+func (g *ProcessorGroup) Wait() {
+	g.stopped.Wait()
+}
+
+// Health returns the state of each TopicProcessor, in the order they were given to NewProcessorGroup.
+func (g *ProcessorGroup) Health() []ProcessorHealth {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return append([]ProcessorHealth(nil), g.health...)
+}
+
+// Healthy returns true if no TopicProcessor has stopped with an error.
+func (g *ProcessorGroup) Healthy() bool {
+	for _, health := range g.Health() {
+		if health.Err != nil {
+			return false
+		}
+	}
+	return true
+}
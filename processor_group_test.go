@@ -0,0 +1,66 @@
+package kasper
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+type closingPartitionConsumer struct {
+	fakePartitionConsumer
+}
+
+func (c *closingPartitionConsumer) Close() error {
+	close(c.messages)
+	return nil
+}
+
+func newProcessorGroupTestTopicProcessor(name string, mp MessageProcessor) (*TopicProcessor, chan *sarama.ConsumerMessage) {
+	tp := &TopicProcessor{
+		config:               &Config{TopicProcessorName: name, InputPartitions: []int{0}, BatchSize: 1, BatchWaitDuration: time.Hour, MetricsUpdateInterval: time.Hour},
+		partitions:           []int{0},
+		close:                make(chan struct{}),
+		loopDone:             make(chan struct{}),
+		logger:               &noopLogger{},
+		incomingMessageCount: &noopMetric{},
+		outgoingMessageCount: &noopMetric{},
+	}
+	pp, _, _ := newReassignTestPartitionProcessor(tp, 0, nil)
+	pc := &closingPartitionConsumer{fakePartitionConsumer{make(chan *sarama.ConsumerMessage, 10)}}
+	pp.partitionConsumers = []sarama.PartitionConsumer{pc}
+	pp.messageProcessor = mp
+	tp.partitionProcessors = map[int32]*partitionProcessor{0: pp}
+	return tp, pc.messages
+}
+
+func TestProcessorGroup(t *testing.T) {
+	processed := make(chan *sarama.ConsumerMessage, 10)
+	healthy, healthyMessages := newProcessorGroupTestTopicProcessor("healthy", &blockingMessageProcessor{nil, processed})
+	failing, failingMessages := newProcessorGroupTestTopicProcessor("failing", failingMessageProcessor{})
+	g := NewProcessorGroup(healthy, failing)
+	g.Start()
+	assert.True(t, g.Healthy())
+
+	// A failing processor doesn't stop the others
+	failingMessages <- &sarama.ConsumerMessage{Topic: "hello"}
+	for g.Healthy() {
+		time.Sleep(time.Millisecond)
+	}
+	healthyMessages <- &sarama.ConsumerMessage{Topic: "hello"}
+	select {
+	case <-processed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("healthy processor stopped")
+	}
+	health := g.Health()
+	assert.True(t, health[0].Running)
+	assert.Nil(t, health[0].Err)
+	assert.Equal(t, "failing", health[1].TopicProcessorName)
+	assert.False(t, health[1].Running)
+	assert.NotNil(t, health[1].Err)
+
+	g.Shutdown()
+	assert.False(t, g.Health()[0].Running)
+}
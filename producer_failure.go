@@ -0,0 +1,143 @@
+package kasper
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+
+	"github.com/Shopify/sarama"
+)
+
+// ProducerFailurePolicy controls what happens to outgoing messages that could not be produced
+// after Config.ProducerRetryMax retries.
+type ProducerFailurePolicy int
+
+const (
+	// ProducerFailurePolicyFail stops all processing. The producer error is returned by TopicProcessor.RunLoop().
+	ProducerFailurePolicyFail ProducerFailurePolicy = iota
+	// ProducerFailurePolicyDeadLetterFile appends the messages to a file in Config.DeadLetterDirectory
+	// and resumes processing as if they had been produced.
+	ProducerFailurePolicyDeadLetterFile
+	// ProducerFailurePolicyCallback invokes Config.ProducerFailureCallback. Processing resumes if the callback
+	// returns nil, otherwise all processing stops and the callback's error is returned by TopicProcessor.RunLoop().
+	ProducerFailurePolicyCallback
+	// ProducerFailurePolicyStopPartition stops processing the partition whose messages could not be produced.
+	// Its offsets are no longer committed and the other partitions keep being processed.
+	ProducerFailurePolicyStopPartition
+)
+
+// ProducerFailureCallback is invoked with the messages that could not be produced and the last producer error.
+type ProducerFailureCallback func(messages []*sarama.ProducerMessage, err error) error
+
+// ErrProducerDisabled is returned when a MessageProcessor sends messages while Config.DisableProducer is set.
+// It is returned by Sender.Flush() or, for messages sent during Process, by TopicProcessor.RunLoop().
+var ErrProducerDisabled = errors.New("cannot send messages: the producer is disabled")
+
+var errPartitionStopped = errors.New("partition processing has been stopped after a producer failure")
+
+type deadLetter struct {
+	Topic     string `json:"topic"`
+	Key       []byte `json:"key"`
+	Value     []byte `json:"value"`
+	Error     string `json:"error"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// produce sends messages to Kafka, retrying up to Config.ProducerRetryMax times,
+// and applies Config.ProducerFailurePolicy when all attempts have failed.
+func (tp *TopicProcessor) produce(messages []*sarama.ProducerMessage, partition int) error {
+	if tp.producer == nil {
+		return ErrProducerDisabled
+	}
+	err := tp.sendMessages(messages, partition)
+	for retry := 1; err != nil && retry <= tp.config.ProducerRetryMax; retry++ {
+		messages = failedMessages(messages, err)
+		tp.config.emitEvent(Event{Type: EventProducerError, Partition: partition, Messages: len(messages), Err: err})
+		tp.logger.Errorf("Failed to produce %d messages (retry %d of %d in %s): %s", len(messages), retry, tp.config.ProducerRetryMax, tp.config.ProducerRetryBackoff, err)
+		select {
+		case <-tp.config.clock().After(tp.config.ProducerRetryBackoff):
+		case <-tp.close:
+			// The offsets of the messages are not marked, so they are produced again after a restart
+			return err
+		}
+		err = tp.sendMessages(messages, partition)
+	}
+	if err == nil {
+		return nil
+	}
+	messages = failedMessages(messages, err)
+	tp.config.emitEvent(Event{Type: EventProducerError, Partition: partition, Messages: len(messages), Err: err})
+	tp.config.emitEvent(Event{Type: EventProducerRetriesExhausted, Partition: partition, Messages: len(messages), Err: err})
+	switch tp.config.ProducerFailurePolicy {
+	case ProducerFailurePolicyDeadLetterFile:
+		tp.logger.Errorf("Writing %d messages that could not be produced to dead letter file: %s", len(messages), err)
+		return tp.writeDeadLetters(messages, partition, err)
+	case ProducerFailurePolicyCallback:
+		return tp.config.ProducerFailureCallback(messages, err)
+	case ProducerFailurePolicyStopPartition:
+		tp.logger.Errorf("Stopping processing of partition %d: %s", partition, err)
+		tp.getPartitionProcessor(partition).stop()
+		return errPartitionStopped
+	default:
+		return err
+	}
+}
+
+// failedMessages returns the messages which could not be produced when err reports individual failures
+// (see sarama.ProducerErrors), so that messages which were produced are not retried, and all messages otherwise.
+func failedMessages(messages []*sarama.ProducerMessage, err error) []*sarama.ProducerMessage {
+	producerErrors, ok := err.(sarama.ProducerErrors)
+	if !ok || len(producerErrors) == 0 {
+		return messages
+	}
+	failed := make([]*sarama.ProducerMessage, len(producerErrors))
+	for i, producerError := range producerErrors {
+		failed[i] = producerError.Msg
+	}
+	return failed
+}
+
+func (tp *TopicProcessor) writeDeadLetters(messages []*sarama.ProducerMessage, partition int, cause error) error {
+	name := fmt.Sprintf("%s-%d.dlq", tp.config.TopicProcessorName, partition)
+	file, err := os.OpenFile(filepath.Join(tp.config.DeadLetterDirectory, name), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(file)
+	now := tp.config.clock().Now().UnixNano()
+	for _, message := range messages {
+		letter := deadLetter{Topic: message.Topic, Error: cause.Error(), Timestamp: now}
+		if message.Key != nil {
+			letter.Key, err = message.Key.Encode()
+			if err != nil {
+				file.Close()
+				return err
+			}
+		}
+		if message.Value != nil {
+			letter.Value, err = message.Value.Encode()
+			if err != nil {
+				file.Close()
+				return err
+			}
+		}
+		err = encoder.Encode(&letter)
+		if err != nil {
+			file.Close()
+			return err
+		}
+	}
+	return file.Close()
+}
+
+// stop stops the processing of pp after a producer failure, see ProducerFailurePolicyStopPartition.
+func (pp *partitionProcessor) stop() {
+	atomic.StoreInt32(&pp.stopped, 1)
+}
+
+func (pp *partitionProcessor) isStopped() bool {
+	return atomic.LoadInt32(&pp.stopped) == 1
+}
@@ -0,0 +1,141 @@
+package kasper
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+func newProducerFailureFixture(policy ProducerFailurePolicy, errs ...error) *fixture {
+	f := newFixture()
+	f.pp.topicProcessor.producer = &fakeSyncProducer{errs: errs}
+	f.pp.topicProcessor.config.ProducerFailurePolicy = policy
+	f.pp.topicProcessor.config.TopicProcessorName = "test"
+	f.pp.topicProcessor.partitionProcessors = map[int32]*partitionProcessor{0: f.pp}
+	return f
+}
+
+func newProducerFailureTestMessages() []*sarama.ProducerMessage {
+	return []*sarama.ProducerMessage{
+		{Topic: "hello", Key: sarama.StringEncoder("AAA"), Value: sarama.StringEncoder("BBB")},
+	}
+}
+
+func TestProduce_Retry(t *testing.T) {
+	failure := errors.New("broker unavailable")
+	f := newProducerFailureFixture(ProducerFailurePolicyFail, failure, failure)
+	tp := f.pp.topicProcessor
+	tp.config.ProducerRetryMax = 1
+	assert.Equal(t, failure, tp.produce(newProducerFailureTestMessages(), 0))
+
+	f = newProducerFailureFixture(ProducerFailurePolicyFail, failure, failure)
+	tp = f.pp.topicProcessor
+	tp.config.ProducerRetryMax = 2
+	assert.Nil(t, tp.produce(newProducerFailureTestMessages(), 0))
+	assert.Len(t, tp.producer.(*fakeSyncProducer).messages, 1)
+}
+
+func TestProduce_Retry_Close(t *testing.T) {
+	failure := errors.New("broker unavailable")
+	f := newProducerFailureFixture(ProducerFailurePolicyFail, failure, failure)
+	tp := f.pp.topicProcessor
+	tp.config.ProducerRetryMax = 1
+	tp.config.ProducerRetryBackoff = time.Hour
+	tp.close = make(chan struct{})
+	close(tp.close)
+	assert.Equal(t, failure, tp.produce(newProducerFailureTestMessages(), 0))
+	assert.Empty(t, tp.producer.(*fakeSyncProducer).messages)
+}
+
+// partialFailureSyncProducer fails to produce the messages of topic "flaky" once, like sarama.SyncProducer does.
+type partialFailureSyncProducer struct {
+	fakeSyncProducer
+	failed bool
+}
+
+func (p *partialFailureSyncProducer) SendMessages(msgs []*sarama.ProducerMessage) error {
+	var errs sarama.ProducerErrors
+	for _, msg := range msgs {
+		if msg.Topic == "flaky" && !p.failed {
+			errs = append(errs, &sarama.ProducerError{Msg: msg, Err: sarama.ErrNotLeaderForPartition})
+			continue
+		}
+		p.messages = append(p.messages, msg)
+	}
+	if len(errs) > 0 {
+		p.failed = true
+		return errs
+	}
+	return nil
+}
+
+func TestProduce_RetryFailedMessagesOnly(t *testing.T) {
+	f := newProducerFailureFixture(ProducerFailurePolicyFail)
+	tp := f.pp.topicProcessor
+	producer := &partialFailureSyncProducer{}
+	tp.producer = producer
+	tp.config.ProducerRetryMax = 1
+	messages := []*sarama.ProducerMessage{{Topic: "hello"}, {Topic: "flaky"}, {Topic: "world"}}
+	assert.Nil(t, tp.produce(messages, 0))
+	assert.Equal(t, []*sarama.ProducerMessage{messages[0], messages[2], messages[1]}, producer.messages)
+}
+
+func TestProduce_DeadLetterFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kasper")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	f := newProducerFailureFixture(ProducerFailurePolicyDeadLetterFile, errors.New("broker unavailable"))
+	tp := f.pp.topicProcessor
+	tp.config.DeadLetterDirectory = dir
+	assert.Nil(t, tp.produce(newProducerFailureTestMessages(), 0))
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "test-0.dlq"))
+	assert.Nil(t, err)
+	var letter deadLetter
+	assert.Nil(t, json.Unmarshal(data, &letter))
+	assert.Equal(t, "hello", letter.Topic)
+	assert.Equal(t, []byte("AAA"), letter.Key)
+	assert.Equal(t, []byte("BBB"), letter.Value)
+	assert.Equal(t, "broker unavailable", letter.Error)
+}
+
+func TestProduce_Callback(t *testing.T) {
+	failure := errors.New("broker unavailable")
+	f := newProducerFailureFixture(ProducerFailurePolicyCallback, failure)
+	tp := f.pp.topicProcessor
+	var failed []*sarama.ProducerMessage
+	tp.config.ProducerFailureCallback = func(messages []*sarama.ProducerMessage, err error) error {
+		assert.Equal(t, failure, err)
+		failed = messages
+		return nil
+	}
+	messages := newProducerFailureTestMessages()
+	assert.Nil(t, tp.produce(messages, 0))
+	assert.Equal(t, messages, failed)
+}
+
+func TestProduce_StopPartition(t *testing.T) {
+	f := newProducerFailureFixture(ProducerFailurePolicyStopPartition, errors.New("broker unavailable"))
+	tp := f.pp.topicProcessor
+	assert.Equal(t, errPartitionStopped, tp.produce(newProducerFailureTestMessages(), 0))
+	assert.True(t, f.pp.isStopped())
+}
+
+func TestProduce_DisableProducer(t *testing.T) {
+	f := newFixture()
+	f.pp.logger = &noopLogger{}
+	f.pp.topicProcessor.config.DisableProducer = true
+	assert.Nil(t, mustSetupProducer(f.pp.topicProcessor.config))
+
+	sender := newSender(f.pp)
+	assert.Nil(t, sender.Flush())
+	sender.Send(newProducerFailureTestMessages()[0])
+	assert.Equal(t, ErrProducerDisabled, sender.Flush())
+}
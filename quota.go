@@ -0,0 +1,176 @@
+package kasper
+
+import (
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// QuotaPolicy controls what happens to the messages of a tenant that exceeds its TenantQuota.
+type QuotaPolicy int
+
+const (
+	// QuotaPolicyThrottle delays processing of the tenant's messages until the tenant is back under its quota.
+	// Since the run loop is shared, this also delays the other tenants of the partition.
+	QuotaPolicyThrottle QuotaPolicy = iota
+	// QuotaPolicySideline forwards excess messages unchanged to TenantQuota.SidelineTopic
+	// instead of processing them, so they can be replayed later.
+	QuotaPolicySideline
+)
+
+// TenantQuota limits the throughput of a tenant of a TenantProcessor. A zero rate means unlimited.
+// The size of a message is the length of its key plus the length of its value.
+// Tenants may burst up to one second's worth of their quota.
+type TenantQuota struct {
+	// Maximum number of incoming messages per second
+	MessagesPerSecond float64
+	// Maximum number of incoming bytes per second
+	BytesPerSecond float64
+	// What to do with messages over quota
+	Policy QuotaPolicy
+	// Topic receiving messages over quota when Policy is QuotaPolicySideline
+	SidelineTopic string
+}
+
+type tokenBucket struct {
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, now time.Time) *tokenBucket {
+	return &tokenBucket{rate, rate, now}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.rate {
+		b.tokens = b.rate
+	}
+	b.last = now
+}
+
+// debt returns how long it takes to refill the bucket back to zero tokens.
+func (b *tokenBucket) debt() time.Duration {
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+type tenantQuotaState struct {
+	quota    *TenantQuota
+	messages *tokenBucket
+	bytes    *tokenBucket
+}
+
+func newTenantQuotaState(quota *TenantQuota, now time.Time) *tenantQuotaState {
+	state := &tenantQuotaState{quota: quota}
+	if quota.MessagesPerSecond > 0 {
+		state.messages = newTokenBucket(quota.MessagesPerSecond, now)
+	}
+	if quota.BytesPerSecond > 0 {
+		state.bytes = newTokenBucket(quota.BytesPerSecond, now)
+	}
+	return state
+}
+
+func (s *tenantQuotaState) refill(now time.Time) {
+	if s.messages != nil {
+		s.messages.refill(now)
+	}
+	if s.bytes != nil {
+		s.bytes.refill(now)
+	}
+}
+
+func (s *tenantQuotaState) exhausted() bool {
+	return (s.messages != nil && s.messages.tokens <= 0) || (s.bytes != nil && s.bytes.tokens <= 0)
+}
+
+func (s *tenantQuotaState) take(message *sarama.ConsumerMessage) {
+	if s.messages != nil {
+		s.messages.tokens--
+	}
+	if s.bytes != nil {
+		s.bytes.tokens -= float64(len(message.Key) + len(message.Value))
+	}
+}
+
+func (s *tenantQuotaState) debt() time.Duration {
+	var debt time.Duration
+	if s.messages != nil {
+		debt = s.messages.debt()
+	}
+	if s.bytes != nil && s.bytes.debt() > debt {
+		debt = s.bytes.debt()
+	}
+	return debt
+}
+
+// SetDefaultQuota sets the quota of all tenants without a quota of their own.
+func (p *TenantProcessor) SetDefaultQuota(quota *TenantQuota) {
+	p.defaultQuota = quota
+	for tenant := range p.quotaStates {
+		if _, found := p.quotas[tenant]; !found {
+			delete(p.quotaStates, tenant)
+		}
+	}
+}
+
+// SetQuota sets the quota of a single tenant, overriding the default quota.
+func (p *TenantProcessor) SetQuota(tenant string, quota *TenantQuota) {
+	p.quotas[tenant] = quota
+	delete(p.quotaStates, tenant)
+}
+
+// applyQuota returns the messages of a tenant which are within its quota.
+// Depending on the policy, it either waits until the tenant is back under quota or sidelines excess messages.
+func (p *TenantProcessor) applyQuota(tenant string, messages []*sarama.ConsumerMessage, sender Sender) []*sarama.ConsumerMessage {
+	state := p.quotaState(tenant)
+	if state == nil {
+		return messages
+	}
+	labelValues := append(p.labelValues, tenant)
+	state.refill(p.now())
+	if state.quota.Policy == QuotaPolicySideline {
+		admitted := make([]*sarama.ConsumerMessage, 0, len(messages))
+		for _, message := range messages {
+			if state.exhausted() {
+				p.tenantQuotaExceededCount.Inc(labelValues...)
+				sender.Send(forward(message, state.quota.SidelineTopic))
+				continue
+			}
+			state.take(message)
+			admitted = append(admitted, message)
+		}
+		return admitted
+	}
+	for _, message := range messages {
+		state.take(message)
+	}
+	debt := state.debt()
+	if debt > 0 {
+		p.tenantQuotaExceededCount.Inc(labelValues...)
+		p.sleep(debt)
+		state.refill(p.now())
+	}
+	return messages
+}
+
+func (p *TenantProcessor) quotaState(tenant string) *tenantQuotaState {
+	state, found := p.quotaStates[tenant]
+	if found {
+		return state
+	}
+	quota, found := p.quotas[tenant]
+	if !found {
+		quota = p.defaultQuota
+	}
+	if quota == nil {
+		return nil
+	}
+	state = newTenantQuotaState(quota, p.now())
+	p.quotaStates[tenant] = state
+	return state
+}
@@ -0,0 +1,69 @@
+package kasper
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+func newQuotaTestTenantProcessor() (*TenantProcessor, *recordingMessageProcessor, *time.Time, *[]time.Duration) {
+	config := &Config{TopicProcessorName: "test", MetricsProvider: &NoopMetricsProvider{}}
+	mp := &recordingMessageProcessor{}
+	p := NewTenantProcessor(config, NewMultiMap(10), func(tenant string, store Store) MessageProcessor {
+		return mp
+	})
+	now := time.Unix(1000, 0)
+	var sleeps []time.Duration
+	p.now = func() time.Time { return now }
+	p.sleep = func(d time.Duration) {
+		sleeps = append(sleeps, d)
+		now = now.Add(d)
+	}
+	return p, mp, &now, &sleeps
+}
+
+func newQuotaTestMessages(topic string, n int) []*sarama.ConsumerMessage {
+	messages := make([]*sarama.ConsumerMessage, n)
+	for i := range messages {
+		messages[i] = &sarama.ConsumerMessage{Topic: topic, Key: []byte("k"), Value: []byte("value"), Offset: int64(i)}
+	}
+	return messages
+}
+
+func TestTenantProcessor_Quota_Throttle(t *testing.T) {
+	p, mp, _, sleeps := newQuotaTestTenantProcessor()
+	p.SetDefaultQuota(&TenantQuota{MessagesPerSecond: 10, Policy: QuotaPolicyThrottle})
+	p.SetQuota("globex", &TenantQuota{})
+
+	assert.Nil(t, p.Process(newQuotaTestMessages("tenant.acme.events", 10), &bufferSender{}))
+	assert.Empty(t, *sleeps)
+
+	assert.Nil(t, p.Process(newQuotaTestMessages("tenant.acme.events", 5), &bufferSender{}))
+	assert.Equal(t, []time.Duration{500 * time.Millisecond}, *sleeps)
+
+	assert.Nil(t, p.Process(newQuotaTestMessages("tenant.globex.events", 100), &bufferSender{}))
+	assert.Len(t, *sleeps, 1)
+	assert.Len(t, mp.messages, 115)
+}
+
+func TestTenantProcessor_Quota_Sideline(t *testing.T) {
+	p, mp, now, _ := newQuotaTestTenantProcessor()
+	p.SetQuota("acme", &TenantQuota{BytesPerSecond: 18, Policy: QuotaPolicySideline, SidelineTopic: "acme-sideline"})
+	sidelined := &countingMetric{}
+	p.tenantQuotaExceededCount = sidelined
+
+	sender := &bufferSender{}
+	assert.Nil(t, p.Process(newQuotaTestMessages("tenant.acme.events", 5), sender))
+	assert.Len(t, mp.messages, 3)
+	assert.Len(t, sender.messages, 2)
+	assert.Equal(t, "acme-sideline", sender.messages[0].Topic)
+	assert.Equal(t, 2, sidelined.count)
+
+	*now = now.Add(time.Second)
+	sender = &bufferSender{}
+	assert.Nil(t, p.Process(newQuotaTestMessages("tenant.acme.events", 2), sender))
+	assert.Len(t, mp.messages, 5)
+	assert.Empty(t, sender.messages)
+}
@@ -0,0 +1,196 @@
+package kasper
+
+import (
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// RateProcessor is a MessageProcessor that computes the rate of messages per key over a sliding interval,
+// e.g. events per minute over the last 5 minutes, which is useful for anomaly detection.
+//
+// Messages are counted by timestamp in buckets of the given resolution, kept in a TumblingWindowStore.
+// Each time stream time (the largest timestamp seen so far) passes the end of a bucket, the rate of every
+// active key over the preceding interval is sent to the output topic as a decimal number, keyed by message key
+// and timestamped with the end of the bucket. A key stops being reported after its rate has dropped to 0.
+// Messages older than the interval are dropped.
+//
+// Active keys are tracked in memory: after a restart, keys are only reported again once they receive messages.
+type RateProcessor struct {
+	buckets    *TumblingWindowStore
+	topic      string
+	interval   time.Duration
+	resolution time.Duration
+	unit       time.Duration
+	active     map[string]*rateKey
+	nextEmit   time.Time
+	streamTime time.Time
+}
+
+// NewRateProcessor creates a RateProcessor counting messages in store and sending rates to topic.
+// Rates are computed over interval, updated every resolution, and expressed in messages per unit.
+// interval must be a multiple of resolution.
+func NewRateProcessor(store Store, topic string, interval, resolution, unit time.Duration) *RateProcessor {
+	return &RateProcessor{
+		buckets:    NewTumblingWindowStore(store, resolution),
+		topic:      topic,
+		interval:   interval,
+		resolution: resolution,
+		unit:       unit,
+		active:     make(map[string]*rateKey),
+	}
+}
+
+// rateKey records the first and last buckets of an active key.
+type rateKey struct {
+	first Window
+	last  Window
+}
+
+// StreamTime returns the current stream time.
+func (p *RateProcessor) StreamTime() time.Time {
+	return p.streamTime
+}
+
+// Process counts a batch of messages and sends the rates of all buckets closed by the batch.
+func (p *RateProcessor) Process(messages []*sarama.ConsumerMessage, sender Sender) error {
+	type bucketKey struct {
+		key   string
+		start int64
+	}
+	counts := make(map[bucketKey]int)
+	for _, message := range messages {
+		bucket := TumblingWindow(message.Timestamp, p.resolution)
+		if !p.nextEmit.IsZero() && bucket.Start.Before(p.nextEmit.Add(-p.interval)) {
+			continue
+		}
+		if p.nextEmit.IsZero() {
+			p.nextEmit = bucket.End
+		}
+		key := string(message.Key)
+		counts[bucketKey{key, bucket.Start.UnixNano()}]++
+		p.track(key, bucket)
+		if message.Timestamp.After(p.streamTime) {
+			p.streamTime = message.Timestamp
+		}
+	}
+	for k, count := range counts {
+		start := time.Unix(0, k.start)
+		bucket := Window{start, start.Add(p.resolution)}
+		current, err := p.count(k.key, bucket)
+		if err != nil {
+			return err
+		}
+		err = p.buckets.Put(k.key, bucket, []byte(strconv.Itoa(current+count)))
+		if err != nil {
+			return err
+		}
+	}
+	return p.emitClosedBuckets(sender)
+}
+
+// AdvanceStreamTime moves stream time forward to t if t is later, and sends the rates of all buckets closed by t.
+func (p *RateProcessor) AdvanceStreamTime(t time.Time, sender Sender) error {
+	if t.After(p.streamTime) {
+		p.streamTime = t
+	}
+	return p.emitClosedBuckets(sender)
+}
+
+func (p *RateProcessor) emitClosedBuckets(sender Sender) error {
+	for !p.nextEmit.IsZero() && !p.streamTime.Before(p.nextEmit) {
+		p.skipIdleTime()
+		if p.streamTime.Before(p.nextEmit) {
+			break
+		}
+		err := p.emit(sender)
+		if err != nil {
+			return err
+		}
+		p.nextEmit = p.nextEmit.Add(p.resolution)
+	}
+	return p.buckets.Flush()
+}
+
+func (p *RateProcessor) track(key string, bucket Window) {
+	k, found := p.active[key]
+	if !found {
+		p.active[key] = &rateKey{bucket, bucket}
+		return
+	}
+	if bucket.Start.Before(k.first.Start) {
+		k.first = bucket
+	}
+	if bucket.Start.After(k.last.Start) {
+		k.last = bucket
+	}
+}
+
+// skipIdleTime moves the next emission forward to the end of the earliest bucket of an active key,
+// so that periods without any active key are not iterated over.
+func (p *RateProcessor) skipIdleTime() {
+	var earliest time.Time
+	for _, k := range p.active {
+		if earliest.IsZero() || k.first.End.Before(earliest) {
+			earliest = k.first.End
+		}
+	}
+	if earliest.IsZero() {
+		earliest = TumblingWindow(p.streamTime, p.resolution).End
+	}
+	if earliest.After(p.nextEmit) {
+		p.nextEmit = earliest
+	}
+}
+
+func (p *RateProcessor) count(key string, bucket Window) (int, error) {
+	value, err := p.buckets.Get(key, bucket)
+	if err != nil || value == nil {
+		return 0, err
+	}
+	return strconv.Atoi(string(value))
+}
+
+// emit sends the rates at p.nextEmit and deletes the buckets which slid out of the interval.
+func (p *RateProcessor) emit(sender Sender) error {
+	keys := make([]string, 0, len(p.active))
+	for key, k := range p.active {
+		if !k.first.End.After(p.nextEmit) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	from := p.nextEmit.Add(-p.interval)
+	expired := Window{from.Add(-p.resolution), from}
+	for _, key := range keys {
+		err := p.buckets.Delete(key, expired)
+		if err != nil {
+			return err
+		}
+		values, err := p.buckets.Fetch(key, from, p.nextEmit.Add(-p.resolution))
+		if err != nil {
+			return err
+		}
+		total := 0
+		for _, value := range values {
+			count, err := strconv.Atoi(string(value.Value))
+			if err != nil {
+				return err
+			}
+			total += count
+		}
+		rate := float64(total) / p.interval.Seconds() * p.unit.Seconds()
+		sender.Send(&sarama.ProducerMessage{
+			Topic:     p.topic,
+			Key:       sarama.StringEncoder(key),
+			Value:     sarama.StringEncoder(strconv.FormatFloat(rate, 'g', -1, 64)),
+			Timestamp: p.nextEmit,
+		})
+		if !p.active[key].last.End.Add(p.interval).After(p.nextEmit) {
+			delete(p.active, key)
+		}
+	}
+	return nil
+}
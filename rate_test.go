@@ -0,0 +1,51 @@
+package kasper
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+func newRateTestMessage(key string, seconds int64) *sarama.ConsumerMessage {
+	return &sarama.ConsumerMessage{Key: []byte(key), Timestamp: time.Unix(seconds, 0)}
+}
+
+func rateTestOutput(messages []*sarama.ProducerMessage) []string {
+	var output []string
+	for _, message := range messages {
+		key, _ := message.Key.Encode()
+		value, _ := message.Value.Encode()
+		output = append(output, string(key)+"="+string(value)+"@"+strconv.FormatInt(message.Timestamp.Unix(), 10))
+	}
+	return output
+}
+
+func TestRateProcessor_Process(t *testing.T) {
+	p := NewRateProcessor(NewMap(10), "rates", 30*time.Second, 10*time.Second, time.Minute)
+
+	sender := &bufferSender{}
+	assert.Nil(t, p.Process([]*sarama.ConsumerMessage{
+		newRateTestMessage("a", 0),
+		newRateTestMessage("a", 5),
+		newRateTestMessage("a", 15),
+	}, sender))
+	assert.Equal(t, []string{"a=4@10"}, rateTestOutput(sender.messages))
+
+	// Rates of "a" slide down to 0, then "a" stops being reported
+	sender = &bufferSender{}
+	assert.Nil(t, p.Process([]*sarama.ConsumerMessage{newRateTestMessage("b", 100)}, sender))
+	assert.Equal(t, []string{"a=6@20", "a=6@30", "a=2@40", "a=0@50"}, rateTestOutput(sender.messages))
+	assert.Len(t, p.active, 1)
+
+	// Messages older than the interval are dropped
+	sender = &bufferSender{}
+	assert.Nil(t, p.Process([]*sarama.ConsumerMessage{
+		newRateTestMessage("a", 70),
+		newRateTestMessage("b", 112),
+	}, sender))
+	assert.Equal(t, []string{"b=2@110"}, rateTestOutput(sender.messages))
+	assert.Equal(t, time.Unix(112, 0), p.StreamTime())
+}
@@ -0,0 +1,132 @@
+package kasper
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/Shopify/sarama"
+)
+
+var errReassignUnsupported = errors.New("partitions cannot be reassigned when Config.IndependentPartitionLoops is set")
+
+var errTopicProcessorClosed = errors.New("topic processor is closed")
+
+var errRunLoopNotRunning = errors.New("RunLoop is not running")
+
+type reassignment struct {
+	partitions []int
+	added      map[int]*partitionProcessor
+	revoked    []int
+	done       chan error
+}
+
+// Reassign changes the input partitions of a running TopicProcessor without restarting it.
+// The handover is incremental: only the partitions being added or revoked are affected, the other partitions
+// keep being processed. Consumers of added partitions are set up before RunLoop is interrupted, and revoked
+// partitions have their pending messages processed before they are closed, then their offsets committed
+// (and handed off, when Config.GracefulHandoff is set).
+//
+// messageProcessors must contain an entry for each added partition. Reassign blocks until RunLoop has applied the
+// new assignment, and returns the processing error of a revoked partition, if any, which also stops RunLoop.
+// It returns an error without blocking if RunLoop is not running or returns before applying the assignment.
+// It must not be called concurrently and is not supported with Config.IndependentPartitionLoops.
+func (tp *TopicProcessor) Reassign(partitions []int, messageProcessors map[int]MessageProcessor) error {
+	if tp.config.IndependentPartitionLoops {
+		return errReassignUnsupported
+	}
+	if atomic.LoadInt32(&tp.looping) == 0 {
+		return errRunLoopNotRunning
+	}
+	r := &reassignment{
+		partitions: partitions,
+		added:      make(map[int]*partitionProcessor),
+		done:       make(chan error, 1),
+	}
+	tp.partitionsMutex.RLock()
+	current := tp.partitions
+	tp.partitionsMutex.RUnlock()
+	for _, partition := range partitions {
+		if containsPartition(current, partition) {
+			continue
+		}
+		if _, found := messageProcessors[partition]; !found {
+			return fmt.Errorf("messageProcessors doesn't contain an entry for partition %d", partition)
+		}
+		r.added[partition] = nil
+	}
+	for _, partition := range current {
+		if !containsPartition(partitions, partition) {
+			r.revoked = append(r.revoked, partition)
+		}
+	}
+	for partition := range r.added {
+		tp.logger.Infof("Assigning partition %d", partition)
+		r.added[partition] = newPartitionProcessor(tp, messageProcessors[partition], partition)
+	}
+	select {
+	case tp.reassignments <- r:
+		return <-r.done
+	case <-tp.close:
+		for _, pp := range r.added {
+			pp.onClose()
+		}
+		return errTopicProcessorClosed
+	case <-tp.loopDone:
+		for _, pp := range r.added {
+			pp.onClose()
+		}
+		return errRunLoopNotRunning
+	}
+}
+
+// reassign applies a reassignment from within RunLoop.
+func (tp *TopicProcessor) reassign(r *reassignment, consumerChan chan *sarama.ConsumerMessage, batches map[int][]*sarama.ConsumerMessage, lengths map[int]int) error {
+	for _, partition := range r.revoked {
+		if lengths[partition] > 0 {
+			err := tp.processConsumerMessages(batches[partition][0:lengths[partition]], partition)
+			if err != nil {
+				for _, pp := range r.added {
+					pp.onClose()
+				}
+				return err
+			}
+		}
+		tp.logger.Infof("Revoking partition %d", partition)
+		pp := tp.getPartitionProcessor(partition)
+		pp.onClose()
+		err := pp.handOff()
+		if err != nil {
+			tp.logger.Error(err)
+		}
+		// Removed right away, so that it is not closed again on shutdown if a later revocation fails
+		tp.partitionsMutex.Lock()
+		delete(tp.partitionProcessors, int32(partition))
+		tp.partitionsMutex.Unlock()
+		delete(batches, partition)
+		delete(lengths, partition)
+		tp.memory.removePartition(partition)
+	}
+	tp.partitionsMutex.Lock()
+	for partition, pp := range r.added {
+		tp.partitionProcessors[int32(partition)] = pp
+		batches[partition] = make([]*sarama.ConsumerMessage, tp.config.BatchSize)
+	}
+	tp.partitions = r.partitions
+	tp.partitionsMutex.Unlock()
+	for _, pp := range r.added {
+		tp.forwardConsumerMessages(pp.consumerMessageChannels(), consumerChan)
+	}
+	tp.logger.Infof("Reassigned partitions: %d added, %d revoked", len(r.added), len(r.revoked))
+	tp.publishMetadata()
+	return nil
+}
+
+func containsPartition(partitions []int, partition int) bool {
+	for _, p := range partitions {
+		if p == partition {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,137 @@
+package kasper
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+func newReassignTestPartitionProcessor(tp *TopicProcessor, partition int, processed chan *sarama.ConsumerMessage) (*partitionProcessor, *fakePartitionConsumer, *fakePartitionOffsetManager) {
+	pc := &fakePartitionConsumer{make(chan *sarama.ConsumerMessage, 10)}
+	pom := &fakePartitionOffsetManager{}
+	pp := &partitionProcessor{
+		topicProcessor:     tp,
+		consumer:           &fakeConsumer{},
+		partitionConsumers: []sarama.PartitionConsumer{pc},
+		offsetManagers:     map[string]sarama.PartitionOffsetManager{"hello": pom},
+		offsetTrackers:     map[string]*offsetTracker{"hello": newOffsetTracker(pom)},
+		messageProcessor:   &blockingMessageProcessor{nil, processed},
+		inputTopics:        []string{"hello"},
+		partition:          partition,
+		logger:             tp.logger,
+	}
+	return pp, pc, pom
+}
+
+func TestTopicProcessor_reassign(t *testing.T) {
+	tp := &TopicProcessor{
+		config:               &Config{BatchSize: 2},
+		partitions:           []int{0, 1},
+		close:                make(chan struct{}),
+		logger:               &noopLogger{},
+		incomingMessageCount: &noopMetric{},
+		outgoingMessageCount: &noopMetric{},
+	}
+	processed := make(chan *sarama.ConsumerMessage, 10)
+	pp0, _, pom0 := newReassignTestPartitionProcessor(tp, 0, processed)
+	pp1, _, _ := newReassignTestPartitionProcessor(tp, 1, processed)
+	tp.partitionProcessors = map[int32]*partitionProcessor{0: pp0, 1: pp1}
+	batches := tp.getBatches()
+	batches[0][0] = &sarama.ConsumerMessage{Topic: "hello", Partition: 0, Offset: 41}
+	lengths := map[int]int{0: 1}
+	consumerChan := make(chan *sarama.ConsumerMessage)
+
+	pp2, pc2, _ := newReassignTestPartitionProcessor(tp, 2, processed)
+	r := &reassignment{
+		partitions: []int{1, 2},
+		added:      map[int]*partitionProcessor{2: pp2},
+		revoked:    []int{0},
+	}
+	assert.Nil(t, tp.reassign(r, consumerChan, batches, lengths))
+
+	// The pending message of the revoked partition is processed and committed
+	message := <-processed
+	assert.Equal(t, int64(41), message.Offset)
+	assert.Equal(t, int64(42), pom0.offset)
+	assert.Nil(t, batches[0])
+	assert.Len(t, batches[2], 2)
+	assert.Equal(t, []int{1, 2}, tp.partitions)
+	assert.Len(t, tp.Diagnostics().Partitions, 2)
+
+	// Messages of the added partition are forwarded to the running loop
+	pc2.messages <- &sarama.ConsumerMessage{Topic: "hello", Partition: 2, Offset: 1}
+	select {
+	case message = <-consumerChan:
+		assert.Equal(t, int32(2), message.Partition)
+	case <-time.After(5 * time.Second):
+		t.Fatal("added partition is not consumed")
+	}
+	close(tp.close)
+}
+
+// closeOncePartitionConsumer panics when closed twice, like sarama's PartitionConsumer.
+type closeOncePartitionConsumer struct {
+	fakePartitionConsumer
+	closed bool
+}
+
+func (c *closeOncePartitionConsumer) AsyncClose() {
+	if c.closed {
+		panic("partition consumer closed twice")
+	}
+	c.closed = true
+}
+
+func (c *closeOncePartitionConsumer) Close() error {
+	c.AsyncClose()
+	return nil
+}
+
+func TestTopicProcessor_reassign_Error(t *testing.T) {
+	tp := newShutdownTestTopicProcessor(&Config{BatchSize: 2})
+	pc0 := &closeOncePartitionConsumer{}
+	tp.partitionProcessors[0].partitionConsumers = []sarama.PartitionConsumer{pc0}
+	tp.partitions = []int{0, 1}
+	tp.incomingMessageCount = &noopMetric{}
+	pp1, _, _ := newReassignTestPartitionProcessor(tp, 1, nil)
+	pp1.messageProcessor = failingMessageProcessor{}
+	tp.partitionProcessors[1] = pp1
+	batches := tp.getBatches()
+	batches[1][0] = &sarama.ConsumerMessage{Topic: "hello", Partition: 1, Offset: 7}
+	lengths := map[int]int{1: 1}
+	pp2, _, _ := newReassignTestPartitionProcessor(tp, 2, nil)
+	r := &reassignment{
+		partitions: []int{2},
+		added:      map[int]*partitionProcessor{2: pp2},
+		revoked:    []int{0, 1},
+	}
+	assert.NotNil(t, tp.reassign(r, make(chan *sarama.ConsumerMessage), batches, lengths))
+
+	// The revoked partition closed before the failure is no longer registered, and is not closed again on shutdown
+	assert.Len(t, tp.partitionProcessors, 1)
+	assert.Equal(t, pp1, tp.partitionProcessors[1])
+	assert.Nil(t, tp.shutdown())
+	assert.True(t, pc0.closed)
+}
+
+func TestTopicProcessor_Reassign_IndependentPartitionLoops(t *testing.T) {
+	tp := &TopicProcessor{config: &Config{IndependentPartitionLoops: true}}
+	assert.Equal(t, errReassignUnsupported, tp.Reassign([]int{0}, nil))
+}
+
+func TestTopicProcessor_Reassign_RunLoopNotRunning(t *testing.T) {
+	tp := &TopicProcessor{
+		config:   &Config{},
+		close:    make(chan struct{}),
+		loopDone: make(chan struct{}),
+		logger:   &noopLogger{},
+	}
+	assert.Equal(t, errRunLoopNotRunning, tp.Reassign(nil, nil))
+
+	// RunLoop returned with an error, without closing the TopicProcessor
+	tp.looping = 1
+	close(tp.loopDone)
+	assert.Equal(t, errRunLoopNotRunning, tp.Reassign(nil, nil))
+}
@@ -0,0 +1,169 @@
+package kasper
+
+import (
+	"sort"
+	"time"
+)
+
+// PartitionToContainerID maps input partitions to the ID of the container processing them,
+// e.g. the StatefulSet ordinal of a pod (see ContainerIDFromHostname).
+type PartitionToContainerID map[int]int
+
+// Partitions returns the partitions assigned to containerID, sorted, e.g. for Config.InputPartitions.
+func (m PartitionToContainerID) Partitions(containerID int) []int {
+	var partitions []int
+	for partition, id := range m {
+		if id == containerID {
+			partitions = append(partitions, partition)
+		}
+	}
+	sort.Ints(partitions)
+	return partitions
+}
+
+// Moves returns the partitions assigned to a different container in m than in previous, sorted.
+func (m PartitionToContainerID) Moves(previous PartitionToContainerID) []int {
+	var moved []int
+	for partition, id := range m {
+		if previousID, found := previous[partition]; !found || previousID != id {
+			moved = append(moved, partition)
+		}
+	}
+	sort.Ints(moved)
+	return moved
+}
+
+// PartitionLoad is the load of an input partition, e.g. measured from ScalingSignal.Lag and the
+// incoming_message_count metric.
+type PartitionLoad struct {
+	Partition int `json:"partition"`
+	// Number of messages behind the high water mark
+	Lag int64 `json:"lag"`
+	// Incoming messages per second
+	Throughput float64 `json:"throughput"`
+}
+
+// ReassignmentPlanner proposes balanced assignments of input partitions to containers, to be applied by
+// an orchestrator (e.g. with TopicProcessor.Reassign on each container) or by the kasper command.
+//
+// The load of a partition is the rate it needs to be processed at: its throughput, plus its lag divided by
+// LagTarget. Partitions of removed containers and unassigned partitions are first assigned to the least loaded
+// containers, heaviest first. Partitions are then moved one at a time from the most to the least loaded
+// container, as long as each move reduces the load of the most loaded one by more than Tolerance, so that
+// nearly balanced assignments are left as is. When no partition has any load, partitions are balanced by count.
+type ReassignmentPlanner struct {
+	// Time within which lag should be consumed (defaults to 1 minute)
+	LagTarget time.Duration
+	// Minimum reduction of the load of the most loaded container for a move, as a fraction of the average
+	// container load (defaults to 0.1)
+	Tolerance float64
+}
+
+// Plan returns a new assignment of the partitions of loads to containerCount containers (with IDs from 0 to
+// containerCount-1), starting from current. Partitions of current without a load are dropped.
+func (p *ReassignmentPlanner) Plan(current PartitionToContainerID, loads []PartitionLoad, containerCount int) PartitionToContainerID {
+	plan := make(PartitionToContainerID, len(loads))
+	if containerCount <= 0 {
+		return plan
+	}
+	weights := p.weights(loads)
+	containerLoads := make([]float64, containerCount)
+	containerPartitions := make([]int, containerCount)
+	assign := func(partition, containerID int) {
+		plan[partition] = containerID
+		containerLoads[containerID] += weights[partition]
+		containerPartitions[containerID]++
+	}
+	unassign := func(partition int) {
+		containerID := plan[partition]
+		containerLoads[containerID] -= weights[partition]
+		containerPartitions[containerID]--
+		delete(plan, partition)
+	}
+	// least returns the least loaded container, breaking ties by number of partitions and ID.
+	least := func() int {
+		best := 0
+		for id := 1; id < containerCount; id++ {
+			if containerLoads[id] < containerLoads[best] ||
+				(containerLoads[id] == containerLoads[best] && containerPartitions[id] < containerPartitions[best]) {
+				best = id
+			}
+		}
+		return best
+	}
+
+	var unassigned []int
+	for _, load := range loads {
+		if id, found := current[load.Partition]; found && id >= 0 && id < containerCount {
+			assign(load.Partition, id)
+		} else {
+			unassigned = append(unassigned, load.Partition)
+		}
+	}
+	sort.Slice(unassigned, func(i, j int) bool {
+		if weights[unassigned[i]] != weights[unassigned[j]] {
+			return weights[unassigned[i]] > weights[unassigned[j]]
+		}
+		return unassigned[i] < unassigned[j]
+	})
+	for _, partition := range unassigned {
+		assign(partition, least())
+	}
+
+	var total float64
+	for _, weight := range weights {
+		total += weight
+	}
+	threshold := p.tolerance() * total / float64(containerCount)
+	for moves := 0; moves < len(loads)*containerCount; moves++ {
+		most := 0
+		for id := 1; id < containerCount; id++ {
+			if containerLoads[id] > containerLoads[most] {
+				most = id
+			}
+		}
+		target := least()
+		best, bestLoad := -1, containerLoads[most]
+		for _, partition := range plan.Partitions(most) {
+			load := containerLoads[most] - weights[partition]
+			if other := containerLoads[target] + weights[partition]; other > load {
+				load = other
+			}
+			if load < bestLoad {
+				best, bestLoad = partition, load
+			}
+		}
+		if best == -1 || containerLoads[most]-bestLoad <= threshold {
+			break
+		}
+		unassign(best)
+		assign(best, target)
+	}
+	return plan
+}
+
+func (p *ReassignmentPlanner) weights(loads []PartitionLoad) map[int]float64 {
+	lagTarget := p.LagTarget
+	if lagTarget <= 0 {
+		lagTarget = time.Minute
+	}
+	weights := make(map[int]float64, len(loads))
+	var total float64
+	for _, load := range loads {
+		weights[load.Partition] = load.Throughput + float64(load.Lag)/lagTarget.Seconds()
+		total += weights[load.Partition]
+	}
+	if total == 0 {
+		for partition := range weights {
+			weights[partition] = 1
+		}
+	}
+	return weights
+}
+
+func (p *ReassignmentPlanner) tolerance() float64 {
+	if p.Tolerance <= 0 {
+		return 0.1
+	}
+	return p.Tolerance
+}
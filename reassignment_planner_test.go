@@ -0,0 +1,63 @@
+package kasper
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReassignmentPlanner_ScaleOut(t *testing.T) {
+	planner := &ReassignmentPlanner{}
+	current := PartitionToContainerID{0: 0, 1: 0, 2: 0, 3: 0}
+	loads := []PartitionLoad{{Partition: 0}, {Partition: 1}, {Partition: 2}, {Partition: 3}}
+	plan := planner.Plan(current, loads, 2)
+	assert.Len(t, plan.Partitions(0), 2)
+	assert.Len(t, plan.Partitions(1), 2)
+	assert.Len(t, plan.Moves(current), 2)
+}
+
+func TestReassignmentPlanner_ScaleIn(t *testing.T) {
+	planner := &ReassignmentPlanner{}
+	current := PartitionToContainerID{0: 0, 1: 1, 2: 2, 3: 0, 4: 1, 5: 2}
+	loads := []PartitionLoad{
+		{Partition: 0, Throughput: 10},
+		{Partition: 1, Throughput: 10},
+		{Partition: 2, Throughput: 30},
+		{Partition: 3, Throughput: 10},
+		{Partition: 4, Throughput: 10},
+		{Partition: 5, Throughput: 10},
+	}
+	plan := planner.Plan(current, loads, 2)
+	// Partitions of container 2 go to the least loaded containers, heaviest first (loads are then 50 and 30),
+	// then partition 0 is moved to balance loads
+	assert.Equal(t, PartitionToContainerID{0: 1, 1: 1, 2: 0, 3: 0, 4: 1, 5: 1}, plan)
+	assert.Equal(t, []int{0, 2, 5}, plan.Moves(current))
+}
+
+func TestReassignmentPlanner_Lag(t *testing.T) {
+	planner := &ReassignmentPlanner{LagTarget: 10 * time.Second}
+	current := PartitionToContainerID{0: 0, 1: 0, 2: 1, 3: 1}
+	loads := []PartitionLoad{
+		{Partition: 0, Throughput: 10, Lag: 600},
+		{Partition: 1, Throughput: 10, Lag: 300},
+		{Partition: 2, Throughput: 10},
+		{Partition: 3, Throughput: 10},
+	}
+	// Loads are 70 and 40 on container 0, 10 and 10 on container 1: moving partition 1 balances best
+	plan := planner.Plan(current, loads, 2)
+	assert.Equal(t, PartitionToContainerID{0: 0, 1: 1, 2: 1, 3: 1}, plan)
+}
+
+func TestReassignmentPlanner_Tolerance(t *testing.T) {
+	current := PartitionToContainerID{0: 0, 1: 1, 2: 1}
+	loads := []PartitionLoad{{Partition: 0, Throughput: 12}, {Partition: 1, Throughput: 5}, {Partition: 2, Throughput: 5}}
+	// Moving any partition would not reduce the load of container 0
+	assert.Equal(t, current, (&ReassignmentPlanner{}).Plan(current, loads, 2))
+
+	current = PartitionToContainerID{0: 0, 1: 0, 2: 1}
+	loads = []PartitionLoad{{Partition: 0, Throughput: 11}, {Partition: 1, Throughput: 1}, {Partition: 2, Throughput: 10}}
+	// Moving partition 1 reduces the maximum load from 12 to 11, less than 10% of the average load
+	assert.Equal(t, current, (&ReassignmentPlanner{}).Plan(current, loads, 2))
+	assert.Equal(t, PartitionToContainerID{0: 0, 1: 1, 2: 1}, (&ReassignmentPlanner{Tolerance: 0.01}).Plan(current, loads, 2))
+}
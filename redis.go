@@ -115,6 +115,25 @@ func (s *Redis) Put(key string, value []byte) error {
 	return err
 }
 
+// compareAndSetScript sets KEYS[1] to ARGV[2] if its value is ARGV[1], or if it is missing and ARGV[1] is empty.
+var compareAndSetScript = redis.NewScript(1, `
+local current = redis.call('GET', KEYS[1])
+if (current == false and ARGV[1] == '') or current == ARGV[1] then
+	redis.call('SET', KEYS[1], ARGV[2])
+	return 1
+end
+return 0
+`)
+
+// CompareAndSet sets key to value if its current value is old (nil for a missing key), and returns whether it did.
+// It is implemented with a Lua script, see https://redis.io/commands/eval
+// Empty values cannot be told apart from missing keys.
+func (s *Redis) CompareAndSet(key string, old, value []byte) (bool, error) {
+	s.logger.Debugf("Redis CompareAndSet: %s %#v %#v", s.getPrefixedKey(key), old, value)
+	s.putCounter.Inc(s.labelValues...)
+	return redis.Bool(compareAndSetScript.Do(s.conn, s.getPrefixedKey(key), old, value))
+}
+
 // PutAll inserts or updates multiple values by key.
 // It is implemented by using the MULTI and SET commands.
 // See https://redis.io/commands/multi
@@ -0,0 +1,155 @@
+package kasper
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+)
+
+// ErrNoContainer is returned by RemoteQueryClient when no known container processes the partition of a key.
+var ErrNoContainer = errors.New("no known container processes the partition of the key")
+
+// RemoteQueryClient looks up keys in a Store spread across a fleet of TopicProcessors as if it were a single
+// store: each key is routed to the container processing its partition of the input topic, as published to the
+// metadata topic (see MetadataClient), and queried through the NewStoreQueryHandler served at a path of its
+// embedded HTTP server. Keys owned by the local container are read from the local Store directly (see SetLocal).
+//
+// Keys are assumed to be partitioned with sarama's default hash partitioner. During reassignments, lookups may
+// fail or be answered by the previous owner of a partition until the metadata topic is up to date.
+type RemoteQueryClient struct {
+	metadata           *MetadataClient
+	topicProcessorName string
+	inputTopic         string
+	path               string
+	localContainerID   string
+	localStore         Store
+	httpClient         *http.Client
+}
+
+// NewRemoteQueryClient creates a RemoteQueryClient for the Store served at path (e.g. "/stores/hoards") by the
+// containers of topicProcessorName, whose state is partitioned like inputTopic.
+func NewRemoteQueryClient(metadata *MetadataClient, topicProcessorName, inputTopic, path string) *RemoteQueryClient {
+	return &RemoteQueryClient{
+		metadata:           metadata,
+		topicProcessorName: topicProcessorName,
+		inputTopic:         inputTopic,
+		path:               path,
+		httpClient:         http.DefaultClient,
+	}
+}
+
+// SetLocal short-circuits the keys owned by containerID, which are read from store instead of over HTTP.
+// Use it when the client runs in a container of the fleet, with that container's Config.ContainerID.
+func (c *RemoteQueryClient) SetLocal(containerID string, store Store) {
+	c.localContainerID = containerID
+	c.localStore = store
+}
+
+// SetHTTPClient sets the HTTP client used for remote queries, e.g. to set a timeout (defaults to http.DefaultClient).
+func (c *RemoteQueryClient) SetHTTPClient(client *http.Client) {
+	c.httpClient = client
+}
+
+// Get returns the value of key, or nil if it is not found.
+func (c *RemoteQueryClient) Get(key string) ([]byte, error) {
+	container, err := c.container(key)
+	if err != nil {
+		return nil, err
+	}
+	if c.isLocal(container) {
+		return c.localStore.Get(key)
+	}
+	response, err := c.httpClient.Get(c.queryURL(container, []string{key}))
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	switch response.StatusCode {
+	case http.StatusOK:
+		return body, nil
+	case http.StatusNotFound:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("cannot query key %s from container %s: %s", key, container.ContainerID, response.Status)
+	}
+}
+
+// GetAll returns the values of keys, with a single request per container. Missing keys are not in the result.
+func (c *RemoteQueryClient) GetAll(keys []string) (map[string][]byte, error) {
+	byContainer := make(map[*ContainerMetadata][]string)
+	for _, key := range keys {
+		container, err := c.container(key)
+		if err != nil {
+			return nil, err
+		}
+		byContainer[container] = append(byContainer[container], key)
+	}
+	values := make(map[string][]byte, len(keys))
+	for container, containerKeys := range byContainer {
+		found, err := c.getAll(container, containerKeys)
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range found {
+			values[key] = value
+		}
+	}
+	return values, nil
+}
+
+func (c *RemoteQueryClient) getAll(container *ContainerMetadata, keys []string) (map[string][]byte, error) {
+	if c.isLocal(container) {
+		return c.localStore.GetAll(keys)
+	}
+	if len(keys) == 1 {
+		value, err := c.Get(keys[0])
+		if err != nil || value == nil {
+			return nil, err
+		}
+		return map[string][]byte{keys[0]: value}, nil
+	}
+	response, err := c.httpClient.Get(c.queryURL(container, keys))
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("cannot query %d keys from container %s: %s", len(keys), container.ContainerID, response.Status)
+	}
+	var result map[string]string
+	err = json.NewDecoder(response.Body).Decode(&result)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read query result from container %s: %s", container.ContainerID, err)
+	}
+	values := make(map[string][]byte, len(result))
+	for key, value := range result {
+		values[key] = []byte(value)
+	}
+	return values, nil
+}
+
+func (c *RemoteQueryClient) container(key string) (*ContainerMetadata, error) {
+	container, err := c.metadata.ContainerForKey(c.topicProcessorName, c.inputTopic, []byte(key))
+	if err != nil {
+		return nil, err
+	}
+	if container == nil {
+		return nil, ErrNoContainer
+	}
+	return container, nil
+}
+
+func (c *RemoteQueryClient) isLocal(container *ContainerMetadata) bool {
+	return c.localStore != nil && container.ContainerID == c.localContainerID
+}
+
+func (c *RemoteQueryClient) queryURL(container *ContainerMetadata, keys []string) string {
+	return container.URL + c.path + "?" + url.Values{"key": keys}.Encode()
+}
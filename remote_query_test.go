@@ -0,0 +1,54 @@
+package kasper
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRemoteQueryClient(t *testing.T) {
+	keys := []string{"mushu", "falkor", "saphira", "smaug", "toothless", "drogon"}
+	remoteStore := NewMap(10)
+	localStore := NewMap(10)
+	for _, key := range keys {
+		_ = remoteStore.Put(key, []byte("remote"))
+		_ = localStore.Put(key, []byte("local"))
+	}
+	_ = remoteStore.Delete("drogon")
+	_ = localStore.Delete("saphira")
+	mux := http.NewServeMux()
+	mux.Handle("/stores/dragons", NewStoreQueryHandler(remoteStore))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	metadata := newMetadataClient(nil, &noopLogger{})
+	metadata.partitions = func(topic string) ([]int32, error) { return []int32{0, 1}, nil }
+	metadata.apply(newMetadataTestMessage("hoard/1", &ContainerMetadata{TopicProcessorName: "hoard", ContainerID: "1", URL: server.URL, Partitions: []int{0}}))
+	metadata.apply(newMetadataTestMessage("hoard/2", &ContainerMetadata{TopicProcessorName: "hoard", ContainerID: "2", Partitions: []int{1}}))
+	client := NewRemoteQueryClient(metadata, "hoard", "dragons", "/stores/dragons")
+	client.SetLocal("2", localStore)
+
+	expected := make(map[string][]byte)
+	for _, key := range keys {
+		partition, _ := keyPartition("dragons", []byte(key), 2)
+		value := []byte("remote")
+		if partition == 1 {
+			value = []byte("local")
+		}
+		if key != "drogon" && key != "saphira" {
+			expected[key] = value
+		}
+		actual, err := client.Get(key)
+		assert.Nil(t, err)
+		assert.Equal(t, expected[key], actual, key)
+	}
+	values, err := client.GetAll(keys)
+	assert.Nil(t, err)
+	assert.Equal(t, expected, values)
+
+	metadata.apply(newMetadataTestMessage("hoard/2", nil))
+	_, err = client.GetAll(keys)
+	assert.Equal(t, ErrNoContainer, err)
+}
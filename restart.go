@@ -0,0 +1,108 @@
+package kasper
+
+import (
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// mayRestartPartition returns true and records a restart if the restart policy allows to restart a failed partition.
+func (tp *TopicProcessor) mayRestartPartition(partition int) bool {
+	max := tp.config.PartitionRestartMax
+	if max <= 0 {
+		return false
+	}
+	tp.restartsMutex.Lock()
+	defer tp.restartsMutex.Unlock()
+	if tp.restarts == nil {
+		tp.restarts = make(map[int][]time.Time)
+	}
+	now := tp.config.clock().Now()
+	restarts := tp.restarts[partition][:0]
+	for _, restart := range tp.restarts[partition] {
+		if tp.config.PartitionRestartWindow == 0 || now.Sub(restart) < tp.config.PartitionRestartWindow {
+			restarts = append(restarts, restart)
+		}
+	}
+	if len(restarts) >= max {
+		tp.restarts[partition] = restarts
+		return false
+	}
+	tp.restarts[partition] = append(restarts, now)
+	return true
+}
+
+// restartPartition replaces the processor of a failed partition with a new one, which resumes consumption
+// from the last committed offsets. Received messages which have not been processed successfully are discarded.
+// The failed processor is closed and removed first, so that it is not closed again on shutdown if the restart
+// is aborted.
+func (tp *TopicProcessor) restartPartition(partition int, cause error) (*partitionProcessor, error) {
+	tp.logger.Errorf("Restarting partition %d after error: %s", partition, cause)
+	tp.partitionsMutex.RLock()
+	failed := tp.partitionProcessors[int32(partition)]
+	tp.partitionsMutex.RUnlock()
+	failed.onClose()
+	err := failed.handOff()
+	if err != nil {
+		tp.logger.Error(err)
+	}
+	tp.partitionsMutex.Lock()
+	delete(tp.partitionProcessors, int32(partition))
+	tp.partitionsMutex.Unlock()
+	select {
+	case <-tp.config.clock().After(tp.config.PartitionRestartBackoff):
+	case <-tp.close:
+		return nil, cause
+	}
+	if tp.config.OnPartitionRestart != nil {
+		err := tp.config.OnPartitionRestart(partition)
+		if err != nil {
+			return nil, err
+		}
+	}
+	pp := newPartitionProcessor(tp, failed.messageProcessor, partition)
+	pp.resumeOffsets = make(map[string]int64)
+	for topic, pom := range pp.offsetManagers {
+		offset, _ := pom.NextOffset()
+		if offset >= 0 {
+			pp.resumeOffsets[topic] = offset
+		}
+	}
+	tp.partitionsMutex.Lock()
+	tp.partitionProcessors[int32(partition)] = pp
+	tp.partitionsMutex.Unlock()
+	tp.config.emitEvent(Event{Type: EventPartitionRestarted, Partition: partition, Err: cause})
+	return pp, nil
+}
+
+// restartFailedPartition restarts partition if err is a processing error and the restart policy allows it,
+// and forwards the messages of the new partition consumers to consumerChan. It returns err if the partition
+// is not restarted, and nil otherwise.
+func (tp *TopicProcessor) restartFailedPartition(err error, partition int, consumerChan chan *sarama.ConsumerMessage) error {
+	if err == nil || err == ErrFenced || !tp.mayRestartPartition(partition) {
+		return err
+	}
+	pp, err := tp.restartPartition(partition, err)
+	if err != nil {
+		return err
+	}
+	tp.forwardConsumerMessages(pp.consumerMessageChannels(), consumerChan)
+	return nil
+}
+
+// isStale returns true for messages received from the consumers of a partition before it was restarted,
+// and for messages received again after a restart, which are dropped to preserve processing order.
+func (pp *partitionProcessor) isStale(message *sarama.ConsumerMessage) bool {
+	if pp.resumeOffsets == nil {
+		return false
+	}
+	next, found := pp.resumeOffsets[message.Topic]
+	if !found {
+		return false
+	}
+	if message.Offset < next {
+		return true
+	}
+	pp.resumeOffsets[message.Topic] = message.Offset + 1
+	return false
+}
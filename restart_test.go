@@ -0,0 +1,51 @@
+package kasper
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTopicProcessor_mayRestartPartition(t *testing.T) {
+	tp := &TopicProcessor{config: &Config{PartitionRestartMax: 2, PartitionRestartWindow: 50 * time.Millisecond}}
+	assert.True(t, tp.mayRestartPartition(0))
+	assert.True(t, tp.mayRestartPartition(0))
+	assert.False(t, tp.mayRestartPartition(0))
+	assert.True(t, tp.mayRestartPartition(1))
+
+	// Restarts older than the window are no longer counted
+	time.Sleep(60 * time.Millisecond)
+	assert.True(t, tp.mayRestartPartition(0))
+}
+
+func TestTopicProcessor_mayRestartPartition_Disabled(t *testing.T) {
+	tp := &TopicProcessor{config: &Config{}}
+	assert.False(t, tp.mayRestartPartition(0))
+}
+
+func TestPartitionProcessor_isStale(t *testing.T) {
+	pp := &partitionProcessor{}
+	assert.False(t, pp.isStale(&sarama.ConsumerMessage{Topic: "hello", Offset: 3}))
+
+	pp.resumeOffsets = map[string]int64{"hello": 5}
+	assert.True(t, pp.isStale(&sarama.ConsumerMessage{Topic: "hello", Offset: 4}))
+	assert.False(t, pp.isStale(&sarama.ConsumerMessage{Topic: "hello", Offset: 5}))
+	assert.True(t, pp.isStale(&sarama.ConsumerMessage{Topic: "hello", Offset: 5}))
+	assert.False(t, pp.isStale(&sarama.ConsumerMessage{Topic: "hello", Offset: 6}))
+	assert.False(t, pp.isStale(&sarama.ConsumerMessage{Topic: "world", Offset: 0}))
+}
+
+func TestTopicProcessor_restartPartition_Aborted(t *testing.T) {
+	cause := errors.New("processing failed")
+	tp := newShutdownTestTopicProcessor(&Config{
+		OnPartitionRestart: func(partition int) error { return errors.New("restart vetoed") },
+	})
+	_, err := tp.restartPartition(0, cause)
+	assert.EqualError(t, err, "restart vetoed")
+	// The closed processor is not closed again on shutdown
+	assert.Empty(t, tp.partitionProcessors)
+	assert.Nil(t, tp.getPartitionProcessor(0))
+}
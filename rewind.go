@@ -0,0 +1,51 @@
+package kasper
+
+import (
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// rewindOffset returns the offset from which a TopicProcessor starts consuming a topic partition whose next
+// committed offset is committed, see Config.RewindMessages and Config.RewindDuration. Rewinding only applies
+// when the TopicProcessor is created, not to partitions assigned later by Reassign, SeekToTimestamp or restarts.
+//
+// Committed offsets are not moved back: they only move forward again once the rewound messages are processed.
+func (tp *TopicProcessor) rewindOffset(topic string, partition int, committed int64) int64 {
+	config := tp.config
+	if tp.started || config.ReplayMode || committed < 0 || (config.RewindMessages <= 0 && config.RewindDuration <= 0) {
+		return committed
+	}
+	atTime := int64(-1)
+	if config.RewindDuration > 0 {
+		t := config.clock().Now().Add(-config.RewindDuration)
+		var err error
+		atTime, err = config.Client.GetOffset(topic, int32(partition), t.UnixNano()/int64(time.Millisecond))
+		if err != nil {
+			tp.logger.Panic(err)
+		}
+	}
+	oldest, err := config.Client.GetOffset(topic, int32(partition), sarama.OffsetOldest)
+	if err != nil {
+		tp.logger.Panic(err)
+	}
+	offset := rewoundOffset(committed, config.RewindMessages, atTime, oldest)
+	tp.logger.Infof("Rewinding topic partition %s-%d from offset %d to %d", topic, partition, committed, offset)
+	return offset
+}
+
+// rewoundOffset moves committed back by messages, or to offsetAtTime if it is earlier (-1 if there is none),
+// without going past the oldest available offset.
+func rewoundOffset(committed, messages, offsetAtTime, oldest int64) int64 {
+	offset := committed
+	if messages > 0 {
+		offset -= messages
+	}
+	if offsetAtTime >= 0 && offsetAtTime < offset {
+		offset = offsetAtTime
+	}
+	if offset < oldest {
+		offset = oldest
+	}
+	return offset
+}
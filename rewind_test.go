@@ -0,0 +1,28 @@
+package kasper
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRewoundOffset(t *testing.T) {
+	assert.Equal(t, int64(90), rewoundOffset(100, 10, -1, 0))
+	assert.Equal(t, int64(80), rewoundOffset(100, 10, 80, 0))
+	assert.Equal(t, int64(90), rewoundOffset(100, 10, 95, 0))
+	assert.Equal(t, int64(95), rewoundOffset(100, 0, 95, 0))
+	// Offsets at time after the committed offset are ignored
+	assert.Equal(t, int64(100), rewoundOffset(100, 0, 120, 0))
+	assert.Equal(t, int64(50), rewoundOffset(100, 1000, -1, 50))
+}
+
+func TestTopicProcessor_rewindOffset_Disabled(t *testing.T) {
+	tp := &TopicProcessor{config: &Config{}, logger: &noopLogger{}}
+	assert.Equal(t, int64(100), tp.rewindOffset("dragons", 0, 100))
+
+	// Rewinding only applies on start, and never to committed offsets which are not actual offsets
+	tp.config.RewindMessages = 10
+	assert.Equal(t, int64(-1), tp.rewindOffset("dragons", 0, -1))
+	tp.started = true
+	assert.Equal(t, int64(100), tp.rewindOffset("dragons", 0, 100))
+}
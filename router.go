@@ -0,0 +1,69 @@
+package kasper
+
+import (
+	"bytes"
+
+	"github.com/Shopify/sarama"
+)
+
+// MessagePredicate is a condition on an incoming message.
+type MessagePredicate func(*sarama.ConsumerMessage) bool
+
+// KeyPrefix returns a MessagePredicate matching messages whose key starts with prefix.
+func KeyPrefix(prefix []byte) MessagePredicate {
+	return func(msg *sarama.ConsumerMessage) bool {
+		return bytes.HasPrefix(msg.Key, prefix)
+	}
+}
+
+// FromTopic returns a MessagePredicate matching messages consumed from topic.
+func FromTopic(topic string) MessagePredicate {
+	return func(msg *sarama.ConsumerMessage) bool {
+		return msg.Topic == topic
+	}
+}
+
+// Route sends incoming messages matching Predicate to the Topic output topic.
+type Route struct {
+	Predicate MessagePredicate
+	Topic     string
+}
+
+// RouterProcessor is a MessageProcessor that forwards incoming messages to output topics according to a list
+// of routes, for content-based routing pipelines that don't require custom Process code.
+// Each message is forwarded unchanged (same key and value) to the topic of the first matching route,
+// or to the default topic if no route matches. Messages matching no route are dropped if the default topic is empty.
+//
+// Kafka message headers are not supported by the sarama version Kasper uses, so predicates can only
+// inspect the topic, key, value, and timestamp of messages.
+type RouterProcessor struct {
+	routes       []Route
+	defaultTopic string
+}
+
+// NewRouterProcessor creates a RouterProcessor.
+func NewRouterProcessor(defaultTopic string, routes ...Route) *RouterProcessor {
+	return &RouterProcessor{routes, defaultTopic}
+}
+
+// Process forwards messages to their output topics.
+func (r *RouterProcessor) Process(messages []*sarama.ConsumerMessage, sender Sender) error {
+	for _, message := range messages {
+		if Branch(message, sender, BranchFirstMatch, r.routes...) == 0 && r.defaultTopic != "" {
+			sender.Send(forward(message, r.defaultTopic))
+		}
+	}
+	return nil
+}
+
+// forward creates an outgoing copy of an incoming message for the given topic.
+func forward(message *sarama.ConsumerMessage, topic string) *sarama.ProducerMessage {
+	out := &sarama.ProducerMessage{
+		Topic: topic,
+		Key:   sarama.ByteEncoder(message.Key),
+	}
+	if message.Value != nil {
+		out.Value = sarama.ByteEncoder(message.Value)
+	}
+	return out
+}
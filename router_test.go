@@ -0,0 +1,35 @@
+package kasper
+
+import (
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouterProcessor_Process(t *testing.T) {
+	r := NewRouterProcessor("others",
+		Route{KeyPrefix([]byte("dragon-")), "dragons"},
+		Route{FromTopic("planets"), "planets-out"},
+	)
+	s := &bufferSender{}
+	err := r.Process([]*sarama.ConsumerMessage{
+		{Topic: "planets", Key: []byte("dragon-saphira"), Value: saphira},
+		{Topic: "planets", Key: []byte("mars"), Value: mars},
+		{Topic: "moons", Key: []byte("io")},
+	}, s)
+	assert.Nil(t, err)
+	expected := []*sarama.ProducerMessage{
+		{Topic: "dragons", Key: sarama.ByteEncoder("dragon-saphira"), Value: sarama.ByteEncoder(saphira)},
+		{Topic: "planets-out", Key: sarama.ByteEncoder("mars"), Value: sarama.ByteEncoder(mars)},
+		{Topic: "others", Key: sarama.ByteEncoder("io")},
+	}
+	assert.Equal(t, expected, s.messages)
+}
+
+func TestRouterProcessor_Process_NoDefault(t *testing.T) {
+	r := NewRouterProcessor("", Route{FromTopic("planets"), "planets-out"})
+	s := &bufferSender{}
+	assert.Nil(t, r.Process([]*sarama.ConsumerMessage{{Topic: "moons"}}, s))
+	assert.Empty(t, s.messages)
+}
@@ -0,0 +1,58 @@
+package kasper
+
+import (
+	"context"
+	"math/rand"
+
+	"github.com/Shopify/sarama"
+)
+
+// SampleHook receives a sampled incoming message and the outgoing messages sent by the MessageProcessor while
+// processing it, before they are validated or produced. It is useful to debug production behavior without
+// logging every message. Neither slice may be modified or held after SampleHook returns.
+//
+// Sampled messages are passed to MessageProcessor.Process on their own, so that their outgoing messages can
+// be told apart from the rest of the batch. Batches are therefore smaller when Config.SampleRate is high.
+type SampleHook func(incoming *sarama.ConsumerMessage, outgoing []*sarama.ProducerMessage)
+
+// processSampled processes msgs like process, except that messages selected with probability Config.SampleRate
+// are processed on their own and passed to Config.SampleHook.
+func (pp *partitionProcessor) processSampled(ctx context.Context, msgs []*sarama.ConsumerMessage) ([]*sarama.ProducerMessage, error) {
+	config := pp.topicProcessor.config
+	sender := newSender(pp)
+	sender.ctx = ctx
+	processRun := func(run []*sarama.ConsumerMessage) error {
+		if len(run) == 0 {
+			return nil
+		}
+		err := pp.messageProcessor.Process(run, sender)
+		if err != nil {
+			pp.logger.Errorf("Message processor returned error: %s", err)
+		}
+		return err
+	}
+	sampleRate := pp.topicProcessor.settings.getSampleRate(config)
+	start := 0
+	for i, msg := range msgs {
+		if rand.Float64() >= sampleRate {
+			continue
+		}
+		err := processRun(msgs[start:i])
+		if err != nil {
+			return nil, err
+		}
+		sender.sampled, sender.sampling = nil, true
+		err = processRun(msgs[i : i+1])
+		sender.sampling = false
+		if err != nil {
+			return nil, err
+		}
+		config.SampleHook(msg, sender.sampled)
+		start = i + 1
+	}
+	err := processRun(msgs[start:])
+	if err != nil {
+		return nil, err
+	}
+	return sender.producerMessages, nil
+}
@@ -0,0 +1,71 @@
+package kasper
+
+import (
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPartitionProcessor_processSampled(t *testing.T) {
+	tp := &TopicProcessor{config: &Config{}, logger: &noopLogger{}}
+	pp := &partitionProcessor{
+		topicProcessor:   tp,
+		messageProcessor: &upperCaseMessageProcessor{"upper"},
+		logger:           tp.logger,
+	}
+	messages := []*sarama.ConsumerMessage{
+		{Topic: "words", Key: []byte("a"), Value: []byte("hello")},
+		{Topic: "words", Key: []byte("b"), Value: []byte("world")},
+	}
+	samples := make(map[string][]*sarama.ProducerMessage)
+	tp.config.SampleHook = func(incoming *sarama.ConsumerMessage, outgoing []*sarama.ProducerMessage) {
+		samples[string(incoming.Key)] = outgoing
+	}
+
+	out, err := pp.process(messages)
+	assert.Nil(t, err)
+	assert.Len(t, out, 4)
+	assert.Empty(t, samples)
+
+	tp.config.SampleRate = 1
+	out, err = pp.process(messages)
+	assert.Nil(t, err)
+	assert.Len(t, out, 4)
+	assert.Len(t, samples, 2)
+	assert.Len(t, samples["b"], 2)
+	value, _ := samples["b"][0].Value.Encode()
+	assert.Equal(t, []byte("WORLD"), value)
+}
+
+// flushingMessageProcessor sends each message as is and flushes the Sender after each message.
+type flushingMessageProcessor struct{}
+
+func (flushingMessageProcessor) Process(messages []*sarama.ConsumerMessage, sender Sender) error {
+	for _, message := range messages {
+		sender.Send(&sarama.ProducerMessage{Topic: "out", Value: sarama.ByteEncoder(message.Value)})
+		err := sender.Flush()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestPartitionProcessor_processSampled_Flush(t *testing.T) {
+	f := newFixture()
+	producer := &fakeSyncProducer{}
+	f.pp.topicProcessor.producer = producer
+	f.pp.messageProcessor = flushingMessageProcessor{}
+	f.pp.logger = &noopLogger{}
+	var sampled []*sarama.ProducerMessage
+	f.pp.topicProcessor.config.SampleRate = 1
+	f.pp.topicProcessor.config.SampleHook = func(incoming *sarama.ConsumerMessage, outgoing []*sarama.ProducerMessage) {
+		sampled = append(sampled, outgoing...)
+	}
+	out, err := f.pp.process([]*sarama.ConsumerMessage{{Value: mushu}, {Value: falkor}})
+	assert.Nil(t, err)
+	assert.Empty(t, out)
+	assert.Len(t, producer.messages, 2)
+	assert.Len(t, sampled, 2)
+}
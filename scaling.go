@@ -0,0 +1,177 @@
+package kasper
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ScalingSignal summarizes the load of a TopicProcessor instance for autoscalers, see TopicProcessor.ScalingSignal.
+// It is updated every Config.MetricsUpdateInterval.
+type ScalingSignal struct {
+	TopicProcessorName string `json:"topicProcessorName"`
+	ContainerID        string `json:"containerId,omitempty"`
+	// Number of messages behind the high water mark, summed over input topics, by input partition
+	Lag map[int]int64 `json:"lag"`
+	// Sum of Lag over all partitions
+	TotalLag int64 `json:"totalLag"`
+	// Messages processed per second over the last interval
+	ProcessingRate float64 `json:"processingRate"`
+	// Fraction of the last interval during which the instance was not processing messages, between 0 and 1.
+	// With Config.IndependentPartitionLoops, processing time is divided by the number of Config.InputPartitions.
+	Headroom float64 `json:"headroom"`
+	// Estimated time to consume TotalLag at ProcessingRate, or 0 when the rate is unknown
+	CatchUpSeconds float64 `json:"catchUpSeconds"`
+	// Normalized load: 1 means the instance is at capacity. It is the largest of 1 - Headroom and
+	// CatchUpSeconds / Config.ScalingLagTarget, or 1 when there is lag but no message was processed.
+	// An autoscaler targeting an average load below 1 (e.g. 0.8) keeps each instance below capacity.
+	Load float64 `json:"load"`
+}
+
+// scalingTracker computes the ScalingSignal from the lag measured on each metrics tick and from the
+// number and processing time of the messages processed in between. A nil *scalingTracker tracks nothing.
+type scalingTracker struct {
+	sync.Mutex
+	lagTarget   time.Duration
+	parallelism int
+	lastTick    time.Time
+	processed   int
+	busy        time.Duration
+	lag         map[int]int64
+	signal      ScalingSignal
+
+	lagGauge  Gauge
+	rateGauge Gauge
+	headroom  Gauge
+	load      Gauge
+}
+
+func newScalingTracker(config *Config) *scalingTracker {
+	provider := config.MetricsProvider
+	parallelism := 1
+	if config.IndependentPartitionLoops && len(config.InputPartitions) > 0 {
+		parallelism = len(config.InputPartitions)
+	}
+	return &scalingTracker{
+		lagTarget:   config.ScalingLagTarget,
+		parallelism: parallelism,
+		lastTick:    config.clock().Now(),
+		lag:         make(map[int]int64),
+		signal: ScalingSignal{
+			TopicProcessorName: config.TopicProcessorName,
+			ContainerID:        config.ContainerID,
+			Lag:                make(map[int]int64),
+			Headroom:           1,
+		},
+		lagGauge:  provider.NewGauge("scaling_lag_messages", "Number of messages behind the high water mark, summed over input topics", "partition"),
+		rateGauge: provider.NewGauge("scaling_processing_rate", "Messages processed per second over the last metrics interval"),
+		headroom:  provider.NewGauge("scaling_headroom", "Fraction of the last metrics interval not spent processing messages"),
+		load:      provider.NewGauge("scaling_load", "Normalized load of the instance, 1 meaning at capacity"),
+	}
+}
+
+// observe records the processing of a batch of n messages.
+func (s *scalingTracker) observe(n int, latency time.Duration) {
+	if s == nil {
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+	s.processed += n
+	s.busy += latency
+}
+
+// setLag records the lag of a partition, measured on the current metrics tick.
+func (s *scalingTracker) setLag(partition int, lag int64) {
+	if s == nil {
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+	s.lag[partition] = lag
+}
+
+// update computes the signal of the interval ending at now, for the given partitions.
+func (s *scalingTracker) update(now time.Time, partitions []int) {
+	if s == nil {
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+	elapsed := now.Sub(s.lastTick)
+	if elapsed <= 0 {
+		return
+	}
+	lag := make(map[int]int64, len(partitions))
+	var totalLag int64
+	for _, partition := range partitions {
+		lag[partition] = s.lag[partition]
+		totalLag += s.lag[partition]
+		s.lagGauge.Set(float64(s.lag[partition]), strconv.Itoa(partition))
+	}
+	rate := float64(s.processed) / elapsed.Seconds()
+	utilization := float64(s.busy) / float64(elapsed) / float64(s.parallelism)
+	if utilization > 1 {
+		utilization = 1
+	}
+	signal := s.signal
+	signal.Lag = lag
+	signal.TotalLag = totalLag
+	signal.ProcessingRate = rate
+	signal.Headroom = 1 - utilization
+	signal.CatchUpSeconds = 0
+	signal.Load = utilization
+	if totalLag > 0 {
+		if rate > 0 {
+			signal.CatchUpSeconds = float64(totalLag) / rate
+			if s.lagTarget > 0 && signal.CatchUpSeconds/s.lagTarget.Seconds() > signal.Load {
+				signal.Load = signal.CatchUpSeconds / s.lagTarget.Seconds()
+			}
+		} else {
+			signal.Load = 1
+		}
+	}
+	s.signal = signal
+	s.rateGauge.Set(signal.ProcessingRate)
+	s.headroom.Set(signal.Headroom)
+	s.load.Set(signal.Load)
+	s.lastTick = now
+	s.processed = 0
+	s.busy = 0
+}
+
+// ScalingSignal returns the load of the instance measured on the last metrics tick, to drive autoscaling on lag
+// rather than CPU. It is also exported as the scaling_* metrics, e.g. for the HPA through a Prometheus adapter,
+// and served as JSON at /scaling by the embedded HTTP server, e.g. for the KEDA metrics-api scaler with
+// valueLocation "load". Per-partition lag is reported for the partitions currently assigned, so the signal is
+// meaningful with both static and dynamic assignment.
+func (tp *TopicProcessor) ScalingSignal() ScalingSignal {
+	s := tp.scaling
+	if s == nil {
+		return ScalingSignal{TopicProcessorName: tp.config.TopicProcessorName}
+	}
+	s.Lock()
+	defer s.Unlock()
+	signal := s.signal
+	signal.Lag = make(map[int]int64, len(s.signal.Lag))
+	for partition, lag := range s.signal.Lag {
+		signal.Lag[partition] = lag
+	}
+	return signal
+}
+
+func (tp *TopicProcessor) scalingHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(tp.ScalingSignal())
+}
+
+func (tp *TopicProcessor) updateScalingSignal() {
+	tp.partitionsMutex.RLock()
+	partitions := append([]int{}, tp.partitions...)
+	tp.partitionsMutex.RUnlock()
+	sort.Ints(partitions)
+	tp.scaling.update(tp.config.clock().Now(), partitions)
+}
@@ -0,0 +1,62 @@
+package kasper
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScalingTracker(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	config := &Config{
+		TopicProcessorName: "hoard",
+		InputPartitions:    []int{0, 1},
+		ScalingLagTarget:   10 * time.Second,
+		MetricsProvider:    &NoopMetricsProvider{},
+		Clock:              clock,
+	}
+	tp := &TopicProcessor{config: config, partitions: []int{1, 0}, scaling: newScalingTracker(config)}
+	assert.Equal(t, 1.0, tp.ScalingSignal().Headroom)
+
+	// 100 messages in 2.5 seconds out of 10: 10 messages per second, 75% headroom, 5 seconds to catch up
+	tp.scaling.observe(60, 1500*time.Millisecond)
+	tp.scaling.observe(40, time.Second)
+	tp.scaling.setLag(0, 20)
+	tp.scaling.setLag(1, 30)
+	clock.Advance(10 * time.Second)
+	tp.updateScalingSignal()
+	assert.Equal(t, ScalingSignal{
+		TopicProcessorName: "hoard",
+		Lag:                map[int]int64{0: 20, 1: 30},
+		TotalLag:           50,
+		ProcessingRate:     10,
+		Headroom:           0.75,
+		CatchUpSeconds:     5,
+		Load:               0.5,
+	}, tp.ScalingSignal())
+
+	// Busy but not lagging
+	tp.scaling.observe(1000, 8*time.Second)
+	tp.scaling.setLag(0, 0)
+	tp.scaling.setLag(1, 0)
+	clock.Advance(10 * time.Second)
+	tp.updateScalingSignal()
+	assert.InDelta(t, 0.8, tp.ScalingSignal().Load, 1e-9)
+	assert.Equal(t, int64(0), tp.ScalingSignal().TotalLag)
+
+	// Lagging without progress
+	tp.scaling.setLag(1, 5)
+	clock.Advance(10 * time.Second)
+	tp.updateScalingSignal()
+	assert.Equal(t, 1.0, tp.ScalingSignal().Load)
+	assert.Equal(t, 0.0, tp.ScalingSignal().CatchUpSeconds)
+
+	recorder := httptest.NewRecorder()
+	tp.scalingHandler(recorder, httptest.NewRequest("GET", "/scaling", nil))
+	var signal ScalingSignal
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &signal))
+	assert.Equal(t, tp.ScalingSignal(), signal)
+}
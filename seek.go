@@ -0,0 +1,96 @@
+package kasper
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+var errSeekUnsupported = errors.New("input partitions cannot be repositioned when Config.IndependentPartitionLoops is set")
+
+// SeekToTimestamp repositions all input partitions of a running TopicProcessor to the first message produced
+// at or after t (as found by a ListOffsets request), for time-bounded backfills. Partitions without such
+// a message are positioned at their newest offset.
+//
+// The TopicProcessor first releases all its partitions as Reassign does, processing their pending messages and
+// committing their offsets. The committed offsets are then moved to their new position (in Config.OffsetStore
+// if set, in Kafka otherwise) and the partitions are assigned again with their current MessageProcessors.
+//
+// State built from messages after t is not rolled back. If wipeStores is not nil, it is called once all partitions
+// are released and before any message is reprocessed, so that Stores can be cleared or restored from a snapshot.
+// The same restrictions as Reassign apply. If RunLoop returns between the release and the new assignment,
+// an error is returned and the partitions are left released, with their offsets already moved.
+func (tp *TopicProcessor) SeekToTimestamp(t time.Time, wipeStores func() error) error {
+	if tp.config.IndependentPartitionLoops {
+		return errSeekUnsupported
+	}
+	if atomic.LoadInt32(&tp.looping) == 0 {
+		return errRunLoopNotRunning
+	}
+	tp.partitionsMutex.RLock()
+	partitions := append([]int(nil), tp.partitions...)
+	messageProcessors := make(map[int]MessageProcessor, len(partitions))
+	for _, partition := range partitions {
+		messageProcessors[partition] = tp.partitionProcessors[int32(partition)].messageProcessor
+	}
+	tp.partitionsMutex.RUnlock()
+
+	offsets, err := tp.offsetsAtTime(partitions, t)
+	if err != nil {
+		return err
+	}
+	tp.logger.Infof("Seeking partitions %v to %s", partitions, t)
+	err = tp.Reassign(nil, nil)
+	if err != nil {
+		return err
+	}
+	err = tp.resetOffsets(offsets)
+	if err != nil {
+		return err
+	}
+	if wipeStores != nil {
+		err = wipeStores()
+		if err != nil {
+			return err
+		}
+	}
+	return tp.Reassign(partitions, messageProcessors)
+}
+
+func (tp *TopicProcessor) offsetsAtTime(partitions []int, t time.Time) (map[string]map[int32]int64, error) {
+	client := tp.config.Client
+	millis := t.UnixNano() / int64(time.Millisecond)
+	offsets := make(map[string]map[int32]int64)
+	for _, topic := range tp.inputTopics {
+		offsets[topic] = make(map[int32]int64, len(partitions))
+		for _, partition := range partitions {
+			offset, err := client.GetOffset(topic, int32(partition), millis)
+			if err == nil && offset == sarama.OffsetNewest {
+				offset, err = client.GetOffset(topic, int32(partition), sarama.OffsetNewest)
+			}
+			if err != nil {
+				return nil, err
+			}
+			offsets[topic][int32(partition)] = offset
+		}
+	}
+	return offsets, nil
+}
+
+func (tp *TopicProcessor) resetOffsets(offsets map[string]map[int32]int64) error {
+	store := tp.config.OffsetStore
+	if store == nil {
+		return NewAdmin(tp.config.Client).ResetConsumerGroupOffsets(tp.config.kafkaConsumerGroup(), offsets)
+	}
+	for topic, partitionOffsets := range offsets {
+		for partition, offset := range partitionOffsets {
+			err := store.CommitOffset(topic, int(partition), offset)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
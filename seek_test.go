@@ -0,0 +1,55 @@
+package kasper
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTopicProcessor_SeekToTimestamp_IndependentPartitionLoops(t *testing.T) {
+	tp := &TopicProcessor{config: &Config{IndependentPartitionLoops: true}}
+	assert.Equal(t, errSeekUnsupported, tp.SeekToTimestamp(time.Now(), nil))
+}
+
+func TestTopicProcessor_resetOffsets(t *testing.T) {
+	offsetStore := NewStoreOffsetStore(NewMap(10), "seek")
+	assert.Nil(t, offsetStore.CommitOffset("hello", 0, 100))
+	tp := &TopicProcessor{config: &Config{OffsetStore: offsetStore}}
+	assert.Nil(t, tp.resetOffsets(map[string]map[int32]int64{"hello": {0: 42, 1: 7}}))
+	offset, found, err := offsetStore.FetchOffset("hello", 0)
+	assert.Nil(t, err)
+	assert.True(t, found)
+	assert.Equal(t, int64(42), offset)
+	offset, _, _ = offsetStore.FetchOffset("hello", 1)
+	assert.Equal(t, int64(7), offset)
+}
+
+func TestTopicProcessor_SeekToTimestamp_RunLoopNotRunning(t *testing.T) {
+	tp := &TopicProcessor{
+		config:        &Config{OffsetStore: NewStoreOffsetStore(NewMap(10), "seek")},
+		close:         make(chan struct{}),
+		reassignments: make(chan *reassignment),
+		loopDone:      make(chan struct{}),
+		logger:        &noopLogger{},
+	}
+	assert.Equal(t, errRunLoopNotRunning, tp.SeekToTimestamp(time.Now(), nil))
+
+	// RunLoop applies the release, then returns before the partitions are assigned again
+	tp.looping = 1
+	go func() {
+		r := <-tp.reassignments
+		r.done <- nil
+		close(tp.loopDone)
+	}()
+	done := make(chan error)
+	go func() {
+		done <- tp.SeekToTimestamp(time.Now(), nil)
+	}()
+	select {
+	case err := <-done:
+		assert.Equal(t, errRunLoopNotRunning, err)
+	case <-time.After(time.Second):
+		t.Fatal("SeekToTimestamp blocked after RunLoop returned")
+	}
+}
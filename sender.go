@@ -1,6 +1,8 @@
 package kasper
 
 import (
+	"context"
+
 	"github.com/Shopify/sarama"
 )
 
@@ -15,6 +17,10 @@ type Sender interface {
 	// These messages are sent in bulk when Process() returns or when Flush() is called.
 	Send(msg *sarama.ProducerMessage)
 
+	// SendTombstone appends a message with the given key and a nil value to the slice held by the sender instance.
+	// On compacted topics, tombstones delete all previous messages with the same key.
+	SendTombstone(topic string, key sarama.Encoder)
+
 	// Flush immediately sends all messages held in the sender slice in bulk, and empties the slice. See Send() above.
 	Flush() error
 }
@@ -22,29 +28,60 @@ type Sender interface {
 type sender struct {
 	pp               *partitionProcessor
 	producerMessages []*sarama.ProducerMessage
+	ctx              context.Context
+	// Outgoing messages of the sampled message being processed, if any (see processSampled)
+	sampled  []*sarama.ProducerMessage
+	sampling bool
 }
 
 func newSender(pp *partitionProcessor) *sender {
 	return &sender{
 		pp,
 		[]*sarama.ProducerMessage{},
+		context.Background(),
+		nil,
+		false,
 	}
 }
 
 func (sender *sender) Send(msg *sarama.ProducerMessage) {
+	if sender.ctx.Err() != nil {
+		sender.pp.logger.Debugf("Dropping message sent after processing timed out: %s", msg)
+		return
+	}
 	sender.producerMessages = append(sender.producerMessages, msg)
+	if sender.sampling {
+		sender.sampled = append(sender.sampled, msg)
+	}
+}
+
+func (sender *sender) SendTombstone(topic string, key sarama.Encoder) {
+	sender.Send(&sarama.ProducerMessage{
+		Topic: topic,
+		Key:   key,
+	})
 }
 
 func (sender *sender) Flush() error {
+	if sender.ctx.Err() != nil {
+		return ErrProcessTimeout
+	}
 	if len(sender.producerMessages) == 0 {
 		return nil
 	}
 
-	err := sender.pp.topicProcessor.producer.SendMessages(sender.producerMessages)
+	tp := sender.pp.topicProcessor
+	messages, err := tp.prepareOutgoingMessages(sender.producerMessages)
 	if err != nil {
-		sender.pp.logger.Errorf("Message Sender returned error: %s", err)
 		return err
 	}
+	if len(messages) > 0 {
+		err = tp.produce(messages, sender.pp.partition)
+		if err != nil {
+			sender.pp.logger.Errorf("Message Sender returned error: %s", err)
+			return err
+		}
+	}
 	sender.producerMessages = []*sarama.ProducerMessage{}
 
 	return nil
@@ -3,6 +3,7 @@ package kasper
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/Shopify/sarama"
 	"github.com/stretchr/testify/assert"
@@ -17,7 +18,11 @@ func newFixture() *fixture {
 	return &fixture{
 		&partitionProcessor{
 			topicProcessor: &TopicProcessor{
-				config: &Config{},
+				config:                   &Config{},
+				logger:                   &noopLogger{},
+				producerInFlightMessages: &noopMetric{},
+				producerAckLatency:       &noopMetric{},
+				producerStallCount:       &noopMetric{},
 			},
 		},
 		&sarama.ConsumerMessage{},
@@ -149,3 +154,76 @@ func BenchmarkSender_Send(b *testing.B) {
 		sender.Send(out)
 	}
 }
+
+type fakeSyncProducer struct {
+	delay    time.Duration
+	errs     []error
+	messages []*sarama.ProducerMessage
+}
+
+func (p *fakeSyncProducer) SendMessage(msg *sarama.ProducerMessage) (int32, int64, error) {
+	return 0, 0, p.SendMessages([]*sarama.ProducerMessage{msg})
+}
+
+func (p *fakeSyncProducer) SendMessages(msgs []*sarama.ProducerMessage) error {
+	time.Sleep(p.delay)
+	if len(p.errs) > 0 {
+		err := p.errs[0]
+		p.errs = p.errs[1:]
+		if err != nil {
+			return err
+		}
+	}
+	p.messages = append(p.messages, msgs...)
+	return nil
+}
+
+func (p *fakeSyncProducer) Close() error {
+	return nil
+}
+
+type countingMetric struct {
+	noopMetric
+	count int
+}
+
+func (m *countingMetric) Inc(labelValues ...string) {
+	m.count++
+}
+
+func (m *countingMetric) Add(value float64, labelValues ...string) {
+	m.count += int(value)
+}
+
+func TestSender_Flush_ProducerStall(t *testing.T) {
+	f := newFixture()
+	stallCount := &countingMetric{}
+	tp := f.pp.topicProcessor
+	tp.producer = &fakeSyncProducer{delay: 10 * time.Millisecond}
+	tp.producerStallCount = stallCount
+	tp.config.ProducerStallThreshold = time.Millisecond
+
+	sender := newSender(f.pp)
+	sender.Send(&sarama.ProducerMessage{Topic: "hello"})
+	assert.NoError(t, sender.Flush())
+	assert.Equal(t, 1, stallCount.count)
+
+	tp.config.ProducerStallThreshold = time.Minute
+	sender.Send(&sarama.ProducerMessage{Topic: "hello"})
+	assert.NoError(t, sender.Flush())
+	assert.Equal(t, 1, stallCount.count)
+}
+
+func TestSender_SendTombstone(t *testing.T) {
+	f := newFixture()
+	sender := newSender(f.pp)
+	sender.SendTombstone("hello", sarama.StringEncoder("AAA"))
+	expected := []*sarama.ProducerMessage{
+		{
+			Topic: "hello",
+			Key:   sarama.StringEncoder("AAA"),
+		},
+	}
+	assert.Equal(t, expected, sender.producerMessages)
+	assert.Nil(t, sender.producerMessages[0].Value)
+}
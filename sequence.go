@@ -0,0 +1,83 @@
+package kasper
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// SequenceGenerator generates monotonic sequence numbers per partition, persisted in a Store,
+// so that processors can assign IDs to output messages that never collide, even across restarts.
+//
+// Sequence numbers are reserved in blocks: the end of each block is written to the Store and flushed before
+// any number of the block is handed out. After a restart, generation resumes at the end of the last reserved
+// block, so unused numbers of that block are skipped but never reused. Larger blocks mean fewer Store writes
+// and larger gaps after restarts.
+//
+// Sequence numbers are only unique within a partition: combine them with the partition number
+// for IDs that are unique across the topic. SequenceGenerator is not safe for concurrent use.
+type SequenceGenerator struct {
+	store     Store
+	name      string
+	blockSize int64
+	next      map[int32]int64
+	limit     map[int32]int64
+}
+
+// NewSequenceGenerator creates a SequenceGenerator storing its blocks in store under the given name,
+// which must be unique among the generators sharing store.
+func NewSequenceGenerator(store Store, name string, blockSize int64) *SequenceGenerator {
+	if blockSize < 1 {
+		blockSize = 1
+	}
+	return &SequenceGenerator{
+		store,
+		name,
+		blockSize,
+		make(map[int32]int64),
+		make(map[int32]int64),
+	}
+}
+
+func (g *SequenceGenerator) blockKey(partition int32) string {
+	return fmt.Sprintf("kasper-sequence/%s/%d", g.name, partition)
+}
+
+// Next returns the next sequence number of partition, starting at 0.
+func (g *SequenceGenerator) Next(partition int32) (int64, error) {
+	if _, found := g.limit[partition]; !found || g.next[partition] >= g.limit[partition] {
+		err := g.reserveBlock(partition)
+		if err != nil {
+			return 0, err
+		}
+	}
+	sequence := g.next[partition]
+	g.next[partition]++
+	return sequence, nil
+}
+
+func (g *SequenceGenerator) reserveBlock(partition int32) error {
+	key := g.blockKey(partition)
+	value, err := g.store.Get(key)
+	if err != nil {
+		return err
+	}
+	var start int64
+	if value != nil {
+		start, err = strconv.ParseInt(string(value), 10, 64)
+		if err != nil {
+			return err
+		}
+	}
+	limit := start + g.blockSize
+	err = g.store.Put(key, []byte(strconv.FormatInt(limit, 10)))
+	if err != nil {
+		return err
+	}
+	err = g.store.Flush()
+	if err != nil {
+		return err
+	}
+	g.next[partition] = start
+	g.limit[partition] = limit
+	return nil
+}
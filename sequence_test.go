@@ -0,0 +1,29 @@
+package kasper
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSequenceGenerator_Next(t *testing.T) {
+	store := NewMap(10)
+	g := NewSequenceGenerator(store, "ids", 3)
+	for i := int64(0); i < 4; i++ {
+		sequence, err := g.Next(0)
+		assert.Nil(t, err)
+		assert.Equal(t, i, sequence)
+	}
+	sequence, err := g.Next(1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), sequence)
+
+	value, _ := store.Get("kasper-sequence/ids/0")
+	assert.Equal(t, []byte("6"), value)
+
+	// After a restart, the rest of the reserved block is skipped
+	g = NewSequenceGenerator(store, "ids", 3)
+	sequence, err = g.Next(0)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(6), sequence)
+}
@@ -0,0 +1,183 @@
+package kasper
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RuntimeSettings are the settings of a TopicProcessor which can be changed while it is running,
+// see TopicProcessor.UpdateSettings(). They are JSON-encoded by the diagnostics server and in control commands.
+type RuntimeSettings struct {
+	// "debug" or "info", empty if Config.Logger is not a LevelLogger
+	LogLevel string `json:"log_level"`
+	// See Config.ProducerStallThreshold, e.g. "1s"
+	ProducerStallThreshold string `json:"producer_stall_threshold"`
+	// See Config.SampleRate
+	SampleRate float64 `json:"sample_rate"`
+	// See Config.MaxMessagesPerSecond
+	MaxMessagesPerSecond float64 `json:"max_messages_per_second"`
+}
+
+// runtimeSettings holds the current value of the Config fields which can be changed at runtime.
+// A nil runtimeSettings uses the Config values.
+type runtimeSettings struct {
+	sync.Mutex
+	producerStallThreshold time.Duration
+	sampleRate             float64
+	rateLimit              *tokenBucket
+}
+
+func newRuntimeSettings(config *Config) *runtimeSettings {
+	s := &runtimeSettings{
+		producerStallThreshold: config.ProducerStallThreshold,
+		sampleRate:             config.SampleRate,
+	}
+	if config.MaxMessagesPerSecond > 0 {
+		s.rateLimit = newTokenBucket(config.MaxMessagesPerSecond, config.clock().Now())
+	}
+	return s
+}
+
+func (s *runtimeSettings) getProducerStallThreshold(config *Config) time.Duration {
+	if s == nil {
+		return config.ProducerStallThreshold
+	}
+	s.Lock()
+	defer s.Unlock()
+	return s.producerStallThreshold
+}
+
+func (s *runtimeSettings) getSampleRate(config *Config) float64 {
+	if s == nil {
+		return config.SampleRate
+	}
+	s.Lock()
+	defer s.Unlock()
+	return s.sampleRate
+}
+
+// Settings returns the current RuntimeSettings.
+func (tp *TopicProcessor) Settings() RuntimeSettings {
+	settings := RuntimeSettings{
+		ProducerStallThreshold: tp.config.ProducerStallThreshold.String(),
+		SampleRate:             tp.config.SampleRate,
+		MaxMessagesPerSecond:   tp.config.MaxMessagesPerSecond,
+	}
+	if logger, ok := tp.logger.(LevelLogger); ok {
+		settings.LogLevel = "info"
+		if logger.IsDebug() {
+			settings.LogLevel = "debug"
+		}
+	}
+	s := tp.settings
+	if s == nil {
+		return settings
+	}
+	s.Lock()
+	defer s.Unlock()
+	settings.ProducerStallThreshold = s.producerStallThreshold.String()
+	settings.SampleRate = s.sampleRate
+	settings.MaxMessagesPerSecond = 0
+	if s.rateLimit != nil {
+		settings.MaxMessagesPerSecond = s.rateLimit.rate
+	}
+	return settings
+}
+
+// UpdateSettings changes the RuntimeSettings of a running TopicProcessor, e.g. to turn on debug logging or
+// to throttle processing during an incident. Settings are validated first, so that either all or none of
+// them are applied. To change a subset of the settings, update the result of Settings().
+//
+// Runtime settings are not persisted: a restarted TopicProcessor starts again from its Config.
+func (tp *TopicProcessor) UpdateSettings(settings RuntimeSettings) error {
+	producerStallThreshold, err := time.ParseDuration(settings.ProducerStallThreshold)
+	if err != nil {
+		return err
+	}
+	if settings.SampleRate < 0 || settings.SampleRate > 1 {
+		return fmt.Errorf("sample rate must be between 0 and 1, got %g", settings.SampleRate)
+	}
+	if settings.MaxMessagesPerSecond < 0 {
+		return fmt.Errorf("max messages per second cannot be negative, got %g", settings.MaxMessagesPerSecond)
+	}
+	logger, ok := tp.logger.(LevelLogger)
+	switch {
+	case settings.LogLevel == tp.Settings().LogLevel:
+		ok = false
+	case settings.LogLevel != "debug" && settings.LogLevel != "info":
+		return fmt.Errorf("unsupported log level %q", settings.LogLevel)
+	case !ok:
+		return errors.New("logger does not support changing the log level")
+	}
+	if ok {
+		logger.SetDebug(settings.LogLevel == "debug")
+	}
+	if tp.settings == nil {
+		tp.settings = newRuntimeSettings(tp.config)
+	}
+	s := tp.settings
+	s.Lock()
+	defer s.Unlock()
+	s.producerStallThreshold = producerStallThreshold
+	s.sampleRate = settings.SampleRate
+	if settings.MaxMessagesPerSecond == 0 {
+		s.rateLimit = nil
+	} else if s.rateLimit == nil || s.rateLimit.rate != settings.MaxMessagesPerSecond {
+		s.rateLimit = newTokenBucket(settings.MaxMessagesPerSecond, tp.config.clock().Now())
+	}
+	tp.logger.Infof("Updated runtime settings: %+v", settings)
+	return nil
+}
+
+// throttle waits until n incoming messages can be processed within Config.MaxMessagesPerSecond.
+// It returns false if the TopicProcessor is closed meanwhile.
+func (tp *TopicProcessor) throttle(n int) bool {
+	s := tp.settings
+	if s == nil {
+		return true
+	}
+	s.Lock()
+	bucket := s.rateLimit
+	var debt time.Duration
+	if bucket != nil {
+		bucket.refill(tp.config.clock().Now())
+		bucket.tokens -= float64(n)
+		debt = bucket.debt()
+	}
+	s.Unlock()
+	if debt == 0 {
+		return true
+	}
+	tp.logger.Debugf("Throttling %d messages for %s", n, debt)
+	select {
+	case <-tp.config.clock().After(debt):
+		return true
+	case <-tp.close:
+		return false
+	}
+}
+
+// settingsHandler serves the current RuntimeSettings on GET, and updates them with a JSON-encoded subset
+// of RuntimeSettings on PUT or POST.
+func (tp *TopicProcessor) settingsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPut || r.Method == http.MethodPost {
+		settings := tp.Settings()
+		err := json.NewDecoder(r.Body).Decode(&settings)
+		if err == nil {
+			err = tp.UpdateSettings(settings)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(tp.Settings())
+	if err != nil {
+		tp.logger.Errorf("Cannot encode runtime settings: %s", err)
+	}
+}
@@ -0,0 +1,82 @@
+package kasper
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newSettingsTestTopicProcessor() *TopicProcessor {
+	config := &Config{ProducerStallThreshold: time.Second, SampleRate: 0.5}
+	return &TopicProcessor{
+		config:   config,
+		close:    make(chan struct{}),
+		logger:   &stdlibLogger{log.New(ioutil.Discard, "", 0), 0},
+		settings: newRuntimeSettings(config),
+	}
+}
+
+func TestTopicProcessor_UpdateSettings(t *testing.T) {
+	tp := newSettingsTestTopicProcessor()
+	assert.Equal(t, RuntimeSettings{"info", "1s", 0.5, 0}, tp.Settings())
+
+	assert.Nil(t, tp.UpdateSettings(RuntimeSettings{"debug", "2s", 0.1, 100}))
+	assert.Equal(t, RuntimeSettings{"debug", "2s", 0.1, 100}, tp.Settings())
+	assert.True(t, tp.logger.(LevelLogger).IsDebug())
+	assert.Equal(t, 2*time.Second, tp.settings.getProducerStallThreshold(tp.config))
+	assert.Equal(t, 0.1, tp.settings.getSampleRate(tp.config))
+
+	// Invalid settings are not applied
+	assert.EqualError(t, tp.UpdateSettings(RuntimeSettings{"trace", "2s", 0.1, 100}), `unsupported log level "trace"`)
+	assert.EqualError(t, tp.UpdateSettings(RuntimeSettings{"info", "2s", 2, 100}), "sample rate must be between 0 and 1, got 2")
+	assert.NotNil(t, tp.UpdateSettings(RuntimeSettings{"info", "soon", 0.1, 100}))
+	assert.Equal(t, RuntimeSettings{"debug", "2s", 0.1, 100}, tp.Settings())
+}
+
+func TestTopicProcessor_UpdateSettings_UnsupportedLogger(t *testing.T) {
+	tp := newSettingsTestTopicProcessor()
+	tp.logger = &noopLogger{}
+	assert.Equal(t, "", tp.Settings().LogLevel)
+	assert.Nil(t, tp.UpdateSettings(RuntimeSettings{"", "1s", 1, 0}))
+	assert.EqualError(t, tp.UpdateSettings(RuntimeSettings{"debug", "1s", 1, 0}), "logger does not support changing the log level")
+}
+
+func TestTopicProcessor_throttle(t *testing.T) {
+	tp := newSettingsTestTopicProcessor()
+	assert.Nil(t, tp.UpdateSettings(RuntimeSettings{"info", "1s", 0, 100}))
+	start := time.Now()
+	assert.True(t, tp.throttle(100))
+	assert.True(t, tp.throttle(10))
+	assert.True(t, time.Since(start) >= 90*time.Millisecond)
+
+	close(tp.close)
+	assert.False(t, tp.throttle(1000))
+}
+
+func TestTopicProcessor_settingsHandler(t *testing.T) {
+	tp := newSettingsTestTopicProcessor()
+	handler := tp.DiagnosticsHandler()
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/debug/kasper/settings", strings.NewReader(`{"log_level": "debug"}`)))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"log_level": "debug", "producer_stall_threshold": "1s", "sample_rate": 0.5, "max_messages_per_second": 0}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/debug/kasper/settings", strings.NewReader(`{"sample_rate": -1}`)))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestTopicProcessor_applyControlCommand_Settings(t *testing.T) {
+	tp := newSettingsTestTopicProcessor()
+	assert.Nil(t, tp.applyControlCommand(ControlCommand{Command: ControlSetLogLevel, Value: "debug"}))
+	assert.Equal(t, "debug", tp.Settings().LogLevel)
+	assert.Nil(t, tp.applyControlCommand(ControlCommand{Command: ControlUpdateSettings, Value: `{"max_messages_per_second": 10}`}))
+	assert.Equal(t, RuntimeSettings{"debug", "1s", 0.5, 10}, tp.Settings())
+}
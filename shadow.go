@@ -0,0 +1,58 @@
+package kasper
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+
+	"github.com/Shopify/sarama"
+)
+
+// OutputDiff is a difference between the production and shadow outputs of a single key.
+// Production or Shadow is nil when the key is missing from the corresponding output.
+type OutputDiff struct {
+	Key        string
+	Production []byte
+	Shadow     []byte
+}
+
+// DiffOutputs compares messages consumed from a production output topic with messages consumed from
+// the corresponding shadow topic (see Config.ShadowTopicSuffix). Only the latest value of each key is compared.
+// The returned diffs are sorted by key; an empty result means both outputs agree.
+func DiffOutputs(production, shadow []*sarama.ConsumerMessage) []OutputDiff {
+	productionValues := latestValues(production)
+	shadowValues := latestValues(shadow)
+	var diffs []OutputDiff
+	for key, productionValue := range productionValues {
+		shadowValue, found := shadowValues[key]
+		if !found || !bytes.Equal(productionValue, shadowValue) {
+			diffs = append(diffs, OutputDiff{key, productionValue, shadowValue})
+		}
+	}
+	for key, shadowValue := range shadowValues {
+		if _, found := productionValues[key]; !found {
+			diffs = append(diffs, OutputDiff{key, nil, shadowValue})
+		}
+	}
+	sort.Slice(diffs, func(i, j int) bool {
+		return diffs[i].Key < diffs[j].Key
+	})
+	return diffs
+}
+
+func latestValues(messages []*sarama.ConsumerMessage) map[string][]byte {
+	values := make(map[string][]byte, len(messages))
+	for _, message := range messages {
+		values[string(message.Key)] = message.Value
+	}
+	return values
+}
+
+// shadowName returns the TopicProcessorName of a processor running in shadow mode, which must differ from the name
+// of the production processor so that it doesn't commit the offsets of its consumer group or fence it off.
+func (config *Config) shadowName() string {
+	if config.ShadowTopicSuffix == "" || strings.HasSuffix(config.TopicProcessorName, config.ShadowTopicSuffix) {
+		return config.TopicProcessorName
+	}
+	return config.TopicProcessorName + config.ShadowTopicSuffix
+}
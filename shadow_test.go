@@ -0,0 +1,45 @@
+package kasper
+
+import (
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffOutputs(t *testing.T) {
+	production := []*sarama.ConsumerMessage{
+		{Key: []byte("earth"), Value: []byte("1")},
+		{Key: []byte("mars"), Value: []byte("1")},
+		{Key: []byte("mars"), Value: []byte("2")},
+		{Key: []byte("venus"), Value: []byte("1")},
+	}
+	shadow := []*sarama.ConsumerMessage{
+		{Key: []byte("earth"), Value: []byte("1")},
+		{Key: []byte("mars"), Value: []byte("3")},
+		{Key: []byte("jupiter"), Value: []byte("1")},
+	}
+	expected := []OutputDiff{
+		{"jupiter", nil, []byte("1")},
+		{"mars", []byte("2"), []byte("3")},
+		{"venus", []byte("1"), nil},
+	}
+	assert.Equal(t, expected, DiffOutputs(production, shadow))
+	assert.Empty(t, DiffOutputs(production, production))
+}
+
+func TestPrepareOutgoingMessages_ShadowTopicSuffix(t *testing.T) {
+	tp := &TopicProcessor{config: &Config{ShadowTopicSuffix: "-shadow"}}
+	actual, err := tp.prepareOutgoingMessages([]*sarama.ProducerMessage{{Topic: "hello"}})
+	assert.Nil(t, err)
+	assert.Equal(t, "hello-shadow", actual[0].Topic)
+}
+
+func TestConfig_shadowName(t *testing.T) {
+	assert.Equal(t, "word-count", (&Config{TopicProcessorName: "word-count"}).shadowName())
+	config := &Config{TopicProcessorName: "word-count", ShadowTopicSuffix: "-shadow"}
+	config.TopicProcessorName = config.shadowName()
+	assert.Equal(t, "word-count-shadow", config.TopicProcessorName)
+	assert.Equal(t, "word-count-shadow", config.shadowName())
+	assert.NotEqual(t, TopicProcessorConsumerGroup("word-count"), config.kafkaConsumerGroup())
+}
@@ -0,0 +1,151 @@
+package kasper
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ShutdownStage is a stage of the shutdown of a TopicProcessor. Stages run in the order of their declaration,
+// after the messages being processed have been drained, and each stage runs its built-in steps first and then
+// the hooks registered for it in Config.ShutdownHooks.
+type ShutdownStage int
+
+const (
+	// ShutdownStopConsuming closes the partition consumers, so that no more messages are received.
+	ShutdownStopConsuming ShutdownStage = iota
+	// ShutdownFlushSinks has no built-in step. Hooks flush external sinks written to by MessageProcessors.
+	ShutdownFlushSinks
+	// ShutdownCommit closes the offset managers, commits the offsets of processed messages with an explicit
+	// OffsetCommitRequest (closing a sarama offset manager doesn't flush them), and then releases the partitions
+	// held in Config.FencingStore.
+	ShutdownCommit
+	// ShutdownCloseStores has no built-in step. Hooks close the stores used by MessageProcessors.
+	ShutdownCloseStores
+	// ShutdownCloseClients deletes the container metadata from Config.MetadataTopic, then closes the producer
+	// (unless provided in Config.Producer) once timed out Process calls have returned, the embedded HTTP server
+	// and the control topic consumer.
+	ShutdownCloseClients
+)
+
+var shutdownStageNames = []string{
+	"StopConsuming",
+	"FlushSinks",
+	"Commit",
+	"CloseStores",
+	"CloseClients",
+}
+
+func (s ShutdownStage) String() string {
+	if int(s) < len(shutdownStageNames) {
+		return shutdownStageNames[s]
+	}
+	return "Unknown"
+}
+
+// ShutdownHook is a step of a shutdown stage, see Config.ShutdownHooks.
+type ShutdownHook func() error
+
+// ShutdownError is returned by RunLoop when some shutdown steps failed or timed out.
+// The remaining steps still run after a failure.
+type ShutdownError struct {
+	Errors []error
+}
+
+func (e *ShutdownError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		messages[i] = err.Error()
+	}
+	return fmt.Sprintf("shutdown failed: %s", strings.Join(messages, "; "))
+}
+
+func (tp *TopicProcessor) shutdown() error {
+	builtins := []func() []error{
+		tp.stopConsuming,
+		nil,
+		tp.commitOnShutdown,
+		nil,
+		tp.closeClients,
+	}
+	var errs []error
+	for stage, builtin := range builtins {
+		errs = append(errs, tp.runShutdownStage(ShutdownStage(stage), builtin)...)
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	for _, err := range errs {
+		tp.logger.Error(err)
+	}
+	return &ShutdownError{errs}
+}
+
+// runShutdownStage runs the built-in steps and hooks of stage, giving up after Config.ShutdownStageTimeout.
+// The steps of a stage which timed out keep running in the background.
+func (tp *TopicProcessor) runShutdownStage(stage ShutdownStage, builtin func() []error) []error {
+	tp.logger.Debugf("Running shutdown stage %s", stage)
+	done := make(chan []error, 1)
+	go func() {
+		var errs []error
+		if builtin != nil {
+			errs = builtin()
+		}
+		for _, hook := range tp.config.ShutdownHooks[stage] {
+			err := hook()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("shutdown hook of stage %s failed: %s", stage, err))
+			}
+		}
+		done <- errs
+	}()
+	var timeout <-chan time.Time
+	if tp.config.ShutdownStageTimeout > 0 {
+		timeout = tp.config.clock().After(tp.config.ShutdownStageTimeout)
+	}
+	select {
+	case errs := <-done:
+		return errs
+	case <-timeout:
+		return []error{fmt.Errorf("shutdown stage %s timed out after %s", stage, tp.config.ShutdownStageTimeout)}
+	}
+}
+
+func (tp *TopicProcessor) stopConsuming() []error {
+	var errs []error
+	for _, pp := range tp.partitionProcessors {
+		errs = append(errs, pp.stopConsuming()...)
+	}
+	return errs
+}
+
+func (tp *TopicProcessor) commitOnShutdown() []error {
+	var errs []error
+	for _, pp := range tp.partitionProcessors {
+		errs = append(errs, pp.closeOffsetManagers()...)
+		err := pp.handOff()
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+func (tp *TopicProcessor) closeClients() []error {
+	var errs []error
+	err := tp.unpublishMetadata()
+	if err != nil {
+		errs = append(errs, fmt.Errorf("cannot delete container metadata: %s", err))
+	}
+	if tp.producer != nil && tp.config.Producer == nil {
+		// Process calls which timed out may still be producing (see ContextSource)
+		tp.processing.Wait()
+		err = tp.producer.Close()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("cannot close producer: %s", err))
+		}
+	}
+	tp.stopHTTPServer()
+	tp.stopControlConsumer()
+	return errs
+}
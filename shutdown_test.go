@@ -0,0 +1,115 @@
+package kasper
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+type failingPartitionOffsetManager struct {
+	fakePartitionOffsetManager
+}
+
+func (m *failingPartitionOffsetManager) Close() error {
+	return errors.New("coordinator unavailable")
+}
+
+func newShutdownTestTopicProcessor(config *Config) *TopicProcessor {
+	tp := &TopicProcessor{
+		config:   config,
+		close:    make(chan struct{}),
+		loopDone: make(chan struct{}),
+		logger:   &noopLogger{},
+	}
+	pp, _, _ := newReassignTestPartitionProcessor(tp, 0, nil)
+	tp.partitionProcessors = map[int32]*partitionProcessor{0: pp}
+	return tp
+}
+
+func TestTopicProcessor_shutdown_StageOrder(t *testing.T) {
+	var stages []string
+	hook := func(name string) ShutdownHook {
+		return func() error {
+			stages = append(stages, name)
+			return nil
+		}
+	}
+	tp := newShutdownTestTopicProcessor(&Config{
+		ShutdownHooks: map[ShutdownStage][]ShutdownHook{
+			ShutdownCloseClients:  {hook("clients")},
+			ShutdownFlushSinks:    {hook("sinks"), hook("more sinks")},
+			ShutdownCloseStores:   {hook("stores")},
+			ShutdownStopConsuming: {hook("consuming")},
+			ShutdownCommit:        {hook("commit")},
+		},
+	})
+	assert.Nil(t, tp.shutdown())
+	assert.Equal(t, []string{"consuming", "sinks", "more sinks", "commit", "stores", "clients"}, stages)
+}
+
+func TestTopicProcessor_shutdown_AggregatesErrors(t *testing.T) {
+	closed := false
+	tp := newShutdownTestTopicProcessor(&Config{
+		ShutdownHooks: map[ShutdownStage][]ShutdownHook{
+			ShutdownFlushSinks: {func() error { return errors.New("sink unreachable") }},
+			ShutdownCloseStores: {func() error {
+				closed = true
+				return nil
+			}},
+		},
+	})
+	tp.partitionProcessors[0].offsetManagers = map[string]sarama.PartitionOffsetManager{"hello": &failingPartitionOffsetManager{}}
+	err := tp.shutdown()
+	assert.True(t, closed)
+	assert.IsType(t, &ShutdownError{}, err)
+	assert.Len(t, err.(*ShutdownError).Errors, 2)
+	assert.Equal(t, "shutdown failed: shutdown hook of stage FlushSinks failed: sink unreachable; "+
+		"cannot close offset manager of topic partition hello-0: coordinator unavailable", err.Error())
+}
+
+func TestTopicProcessor_shutdown_StageTimeout(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	flushing := make(chan struct{})
+	release := make(chan struct{})
+	committed := false
+	tp := newShutdownTestTopicProcessor(&Config{
+		Clock:                clock,
+		ShutdownStageTimeout: time.Minute,
+		ShutdownHooks: map[ShutdownStage][]ShutdownHook{
+			ShutdownFlushSinks: {func() error {
+				close(flushing)
+				<-release
+				return nil
+			}},
+			ShutdownCommit: {func() error {
+				committed = true
+				return nil
+			}},
+		},
+	})
+	done := make(chan error)
+	go func() {
+		done <- tp.shutdown()
+	}()
+	<-flushing
+	// The timer of the StopConsuming stage was not fired and is still pending
+	for clock.Waiters() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	clock.Advance(time.Minute)
+	err := <-done
+	close(release)
+	assert.True(t, committed)
+	assert.Equal(t, "shutdown failed: shutdown stage FlushSinks timed out after 1m0s", err.Error())
+}
+
+func TestTopicProcessor_onClose_ReturnsProcessingError(t *testing.T) {
+	failure := errors.New("processing failed")
+	tp := newShutdownTestTopicProcessor(&Config{})
+	tp.partitionProcessors[0].offsetManagers = map[string]sarama.PartitionOffsetManager{"hello": &failingPartitionOffsetManager{}}
+	assert.Equal(t, failure, tp.onClose(failure))
+	assert.IsType(t, &ShutdownError{}, tp.onClose(nil))
+}
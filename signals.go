@@ -0,0 +1,48 @@
+package kasper
+
+import (
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// ErrShutdownTimeout is returned by RunUntilSignal when the TopicProcessor did not shut down in time,
+// or when a second signal forced the shutdown.
+var ErrShutdownTimeout = errors.New("topic processor did not shut down in time")
+
+// RunUntilSignal runs tp.RunLoop() until it returns or until the process receives SIGINT or SIGTERM.
+// On the first signal, the TopicProcessor is drained (see TopicProcessor.Drain) and RunUntilSignal returns
+// the error returned by RunLoop, i.e. nil after a clean shutdown. If RunLoop does not return within timeout,
+// or if a second signal is received, RunUntilSignal returns ErrShutdownTimeout without waiting any longer,
+// and the caller should exit.
+func RunUntilSignal(tp *TopicProcessor, timeout time.Duration) error {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	return runUntilSignal(tp.RunLoop, tp.Drain, tp.logger, signals, timeout)
+}
+
+func runUntilSignal(run func() error, drain func(), logger Logger, signals <-chan os.Signal, timeout time.Duration) error {
+	result := make(chan error, 1)
+	go func() {
+		result <- run()
+	}()
+	select {
+	case err := <-result:
+		return err
+	case sig := <-signals:
+		logger.Infof("Received signal %s, shutting down (timeout is %s)", sig, timeout)
+	}
+	go drain()
+	select {
+	case err := <-result:
+		return err
+	case sig := <-signals:
+		logger.Errorf("Received signal %s again, forcing shutdown", sig)
+	case <-time.After(timeout):
+		logger.Errorf("Shutdown did not complete within %s", timeout)
+	}
+	return ErrShutdownTimeout
+}
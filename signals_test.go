@@ -0,0 +1,32 @@
+package kasper
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunUntilSignal(t *testing.T) {
+	signals := make(chan os.Signal, 2)
+	stop := make(chan struct{})
+	run := func() error {
+		<-stop
+		return nil
+	}
+	drain := func() { close(stop) }
+	signals <- syscall.SIGTERM
+	assert.Nil(t, runUntilSignal(run, drain, &noopLogger{}, signals, time.Minute))
+
+	// RunLoop errors are propagated
+	expected := errors.New("processing failed")
+	assert.Equal(t, expected, runUntilSignal(func() error { return expected }, nil, &noopLogger{}, signals, time.Minute))
+
+	// Shutdowns time out
+	blocked := func() error { select {} }
+	signals <- syscall.SIGINT
+	assert.Equal(t, ErrShutdownTimeout, runUntilSignal(blocked, func() {}, &noopLogger{}, signals, time.Millisecond))
+}
@@ -0,0 +1,174 @@
+package kasper
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/Shopify/sarama"
+)
+
+// signedPayloadMagic prefixes payloads signed by a SigningProcessor, followed by the signature length.
+var signedPayloadMagic = []byte{0, 'K', 'S'}
+
+// ErrInvalidSignature is returned by a SigningProcessor for incoming messages that are not signed
+// or whose signature does not match, with SignatureFailurePolicyFail.
+var ErrInvalidSignature = errors.New("message signature is missing or invalid")
+
+// MessageSigner signs and verifies message data.
+type MessageSigner interface {
+	// Sign returns the signature of data.
+	Sign(data []byte) ([]byte, error)
+	// Verify returns true if signature is a valid signature of data.
+	Verify(data, signature []byte) bool
+}
+
+type hmacSigner struct {
+	key []byte
+}
+
+// NewHMACSigner creates a MessageSigner using HMAC-SHA256 with a secret shared by producers and consumers.
+func NewHMACSigner(key []byte) MessageSigner {
+	return &hmacSigner{key}
+}
+
+func (s *hmacSigner) Sign(data []byte) ([]byte, error) {
+	mac := hmac.New(sha256.New, s.key)
+	_, _ = mac.Write(data)
+	return mac.Sum(nil), nil
+}
+
+func (s *hmacSigner) Verify(data, signature []byte) bool {
+	expected, _ := s.Sign(data)
+	return hmac.Equal(expected, signature)
+}
+
+type ed25519Signer struct {
+	privateKey ed25519.PrivateKey
+	publicKey  ed25519.PublicKey
+}
+
+// NewEd25519Signer creates a MessageSigner using Ed25519 signatures, so that consumers only need the public key
+// of producers. privateKey may be nil for processors that only verify incoming messages.
+func NewEd25519Signer(privateKey ed25519.PrivateKey, publicKey ed25519.PublicKey) MessageSigner {
+	return &ed25519Signer{privateKey, publicKey}
+}
+
+func (s *ed25519Signer) Sign(data []byte) ([]byte, error) {
+	if len(s.privateKey) != ed25519.PrivateKeySize {
+		return nil, errors.New("no Ed25519 private key to sign messages with")
+	}
+	return ed25519.Sign(s.privateKey, data), nil
+}
+
+func (s *ed25519Signer) Verify(data, signature []byte) bool {
+	return len(s.publicKey) == ed25519.PublicKeySize && ed25519.Verify(s.publicKey, data, signature)
+}
+
+// SignatureFailurePolicy controls what a SigningProcessor does with incoming messages that fail verification.
+type SignatureFailurePolicy int
+
+const (
+	// SignatureFailurePolicyFail stops all processing: Process returns an error wrapping ErrInvalidSignature.
+	SignatureFailurePolicyFail SignatureFailurePolicy = iota
+	// SignatureFailurePolicyDrop discards messages that fail verification and processes the others.
+	SignatureFailurePolicyDrop
+)
+
+// signedData returns the data covered by message signatures: the length-prefixed key, then the value.
+func signedData(key, value []byte) []byte {
+	data := make([]byte, binary.MaxVarintLen64, binary.MaxVarintLen64+len(key)+len(value))
+	data = data[:binary.PutUvarint(data, uint64(len(key)))]
+	data = append(data, key...)
+	return append(data, value...)
+}
+
+// SigningProcessor is a MessageProcessor that verifies the signatures of incoming messages before passing them
+// to an underlying MessageProcessor, and signs the messages it sends, to detect tampered or foreign records.
+//
+// Signatures cover both the key and the value of messages. As the vendored sarama client does not support
+// record headers, signatures are prepended to values, and removed from incoming values after verification.
+// Tombstones are neither signed nor verified.
+type SigningProcessor struct {
+	messageProcessor MessageProcessor
+	signer           MessageSigner
+	policy           SignatureFailurePolicy
+}
+
+// NewSigningProcessor creates a SigningProcessor wrapping messageProcessor.
+func NewSigningProcessor(messageProcessor MessageProcessor, signer MessageSigner, policy SignatureFailurePolicy) *SigningProcessor {
+	return &SigningProcessor{messageProcessor, signer, policy}
+}
+
+// Process verifies a batch of messages and passes the valid ones to the underlying MessageProcessor.
+func (p *SigningProcessor) Process(messages []*sarama.ConsumerMessage, sender Sender) error {
+	verified := make([]*sarama.ConsumerMessage, 0, len(messages))
+	for _, message := range messages {
+		if IsTombstone(message) {
+			verified = append(verified, message)
+			continue
+		}
+		value, ok := p.verify(message.Key, message.Value)
+		if !ok {
+			if p.policy == SignatureFailurePolicyFail {
+				return fmt.Errorf("message at offset %d of %s/%d: %s", message.Offset, message.Topic, message.Partition, ErrInvalidSignature)
+			}
+			continue
+		}
+		copied := *message
+		copied.Value = value
+		verified = append(verified, &copied)
+	}
+	if len(verified) == 0 {
+		return nil
+	}
+	signingSender := &transformingSender{sender: sender, transform: p.sign}
+	err := p.messageProcessor.Process(verified, signingSender)
+	if err != nil {
+		return err
+	}
+	return signingSender.err
+}
+
+func (p *SigningProcessor) verify(key, payload []byte) ([]byte, bool) {
+	prefixLength := len(signedPayloadMagic) + 1
+	if len(payload) < prefixLength || !bytes.HasPrefix(payload, signedPayloadMagic) {
+		return nil, false
+	}
+	signatureEnd := prefixLength + int(payload[prefixLength-1])
+	if len(payload) < signatureEnd {
+		return nil, false
+	}
+	value := payload[signatureEnd:]
+	if !p.signer.Verify(signedData(key, value), payload[prefixLength:signatureEnd]) {
+		return nil, false
+	}
+	return value, true
+}
+
+func (p *SigningProcessor) sign(msg *sarama.ProducerMessage, value []byte) ([]byte, error) {
+	var key []byte
+	if msg.Key != nil {
+		var err error
+		key, err = msg.Key.Encode()
+		if err != nil {
+			return nil, err
+		}
+	}
+	signature, err := p.signer.Sign(signedData(key, value))
+	if err != nil {
+		return nil, err
+	}
+	if len(signature) > 255 {
+		return nil, fmt.Errorf("message signatures are limited to 255 bytes (got %d bytes)", len(signature))
+	}
+	payload := make([]byte, 0, len(signedPayloadMagic)+1+len(signature)+len(value))
+	payload = append(payload, signedPayloadMagic...)
+	payload = append(payload, byte(len(signature)))
+	payload = append(payload, signature...)
+	return append(payload, value...), nil
+}
@@ -0,0 +1,44 @@
+package kasper
+
+import (
+	"crypto/ed25519"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSigningProcessor_Process(t *testing.T) {
+	p := NewSigningProcessor(NewRouterProcessor("dragons"), NewHMACSigner([]byte("secret")), SignatureFailurePolicyFail)
+	sender := &bufferSender{}
+	assert.NotNil(t, p.Process([]*sarama.ConsumerMessage{{Key: []byte("mushu"), Value: mushu}}, sender))
+
+	signed, err := p.sign(&sarama.ProducerMessage{Key: sarama.StringEncoder("mushu")}, mushu)
+	assert.Nil(t, err)
+	assert.Nil(t, p.Process([]*sarama.ConsumerMessage{{Key: []byte("mushu"), Value: signed}, {Key: []byte("falkor")}}, sender))
+	assert.Len(t, sender.messages, 2)
+	value, _ := sender.messages[0].Value.Encode()
+	assert.Equal(t, signed, value)
+	assert.Nil(t, sender.messages[1].Value)
+}
+
+func TestSigningProcessor_Ed25519(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	assert.Nil(t, err)
+	signer := NewSigningProcessor(nil, NewEd25519Signer(privateKey, publicKey), SignatureFailurePolicyFail)
+	signed, err := signer.sign(&sarama.ProducerMessage{Key: sarama.StringEncoder("mushu")}, mushu)
+	assert.Nil(t, err)
+
+	// Tampered keys fail verification
+	verifier := NewEd25519Signer(nil, publicKey)
+	p := NewSigningProcessor(NewRouterProcessor(""), verifier, SignatureFailurePolicyDrop)
+	value, ok := p.verify([]byte("mushu"), signed)
+	assert.True(t, ok)
+	assert.Equal(t, mushu, value)
+	_, ok = p.verify([]byte("falkor"), signed)
+	assert.False(t, ok)
+
+	// Verification-only signers cannot sign outgoing messages
+	p = NewSigningProcessor(NewRouterProcessor("dragons"), verifier, SignatureFailurePolicyFail)
+	assert.NotNil(t, p.Process([]*sarama.ConsumerMessage{{Key: []byte("mushu"), Value: signed}}, &bufferSender{}))
+}
@@ -0,0 +1,130 @@
+package kasper
+
+import (
+	"sort"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// StreamTimeAdvancer is implemented by MessageProcessors whose windows are closed by stream time, such as
+// TopKAggregator and RateProcessor, so that stream time can be advanced without new messages.
+type StreamTimeAdvancer interface {
+	// AdvanceStreamTime moves stream time forward to t and sends the results of the windows closed by t.
+	AdvanceStreamTime(t time.Time, sender Sender) error
+}
+
+// PunctuateFunc is invoked by a Simulator at regular intervals of virtual time.
+type PunctuateFunc func(now time.Time, sender Sender) error
+
+// Simulator replays timestamped messages through a MessageProcessor in virtual time, so that event-time logic
+// (window closes, punctuations, TTLs) can be tested deterministically and without sleeping.
+//
+// Virtual time starts at the given time and only moves forward, when messages are sent or AdvanceTo is called.
+// Its FakeClock can be injected where wall clock time is used, e.g. with TTLStore.SetClock or Config.Clock.
+// Each message is processed in its own batch, and outgoing messages are collected in Output.
+type Simulator struct {
+	messageProcessor MessageProcessor
+	clock            *FakeClock
+	sender           *bufferSender
+	punctuations     []*simulatorPunctuation
+	offsets          map[string]map[int32]int64
+}
+
+type simulatorPunctuation struct {
+	interval  time.Duration
+	next      time.Time
+	punctuate PunctuateFunc
+}
+
+// NewSimulator creates a Simulator for messageProcessor, with virtual time set to start.
+func NewSimulator(messageProcessor MessageProcessor, start time.Time) *Simulator {
+	return &Simulator{
+		messageProcessor: messageProcessor,
+		clock:            NewFakeClock(start),
+		sender:           &bufferSender{},
+		offsets:          make(map[string]map[int32]int64),
+	}
+}
+
+// Clock returns the FakeClock of virtual time.
+func (s *Simulator) Clock() *FakeClock {
+	return s.clock
+}
+
+// Schedule invokes punctuate each time virtual time passes a multiple of interval from now.
+func (s *Simulator) Schedule(interval time.Duration, punctuate PunctuateFunc) {
+	s.punctuations = append(s.punctuations, &simulatorPunctuation{interval, s.clock.Now().Add(interval), punctuate})
+}
+
+// Send advances virtual time to the message timestamp if it is later, and processes the message.
+// Its offset is assigned in sequence for its topic and partition.
+func (s *Simulator) Send(message *sarama.ConsumerMessage) error {
+	err := s.advance(message.Timestamp)
+	if err != nil {
+		return err
+	}
+	if s.offsets[message.Topic] == nil {
+		s.offsets[message.Topic] = make(map[int32]int64)
+	}
+	message.Offset = s.offsets[message.Topic][message.Partition]
+	s.offsets[message.Topic][message.Partition]++
+	err = s.messageProcessor.Process([]*sarama.ConsumerMessage{message}, s.sender)
+	if err != nil {
+		return err
+	}
+	return s.sender.Flush()
+}
+
+// AdvanceTo advances virtual time to t, invoking due punctuations in order, and advances the stream time of the
+// MessageProcessor to t if it is a StreamTimeAdvancer, which closes the windows ending before t.
+func (s *Simulator) AdvanceTo(t time.Time) error {
+	err := s.advance(t)
+	if err != nil {
+		return err
+	}
+	if advancer, ok := s.messageProcessor.(StreamTimeAdvancer); ok {
+		err = advancer.AdvanceStreamTime(t, s.sender)
+		if err != nil {
+			return err
+		}
+	}
+	return s.sender.Flush()
+}
+
+// Output returns the messages sent by the MessageProcessor and punctuations so far.
+func (s *Simulator) Output() []*sarama.ProducerMessage {
+	return s.sender.messages
+}
+
+func (s *Simulator) advance(t time.Time) error {
+	for {
+		due := s.duePunctuations(t)
+		if len(due) == 0 {
+			break
+		}
+		p := due[0]
+		s.clock.Advance(p.next.Sub(s.clock.Now()))
+		p.next = p.next.Add(p.interval)
+		err := p.punctuate(s.clock.Now(), s.sender)
+		if err != nil {
+			return err
+		}
+	}
+	if now := s.clock.Now(); t.After(now) {
+		s.clock.Advance(t.Sub(now))
+	}
+	return nil
+}
+
+// duePunctuations returns the punctuations due at or before t, earliest first.
+func (s *Simulator) duePunctuations(t time.Time) []*simulatorPunctuation {
+	var due []*simulatorPunctuation
+	for _, p := range s.punctuations {
+		if !p.next.After(t) {
+			due = append(due, p)
+		}
+	}
+	sort.SliceStable(due, func(i, j int) bool { return due[i].next.Before(due[j].next) })
+	return due
+}
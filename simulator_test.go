@@ -0,0 +1,34 @@
+package kasper
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSimulator(t *testing.T) {
+	song := func(message *sarama.ConsumerMessage) []byte { return message.Value }
+	a := NewTopKAggregator(NewTumblingWindowStore(NewMap(10), time.Minute), "top-songs", 2, time.Minute, 10*time.Second, nil, song)
+	simulator := NewSimulator(a, time.Unix(0, 0))
+	var punctuations []time.Time
+	simulator.Schedule(30*time.Second, func(now time.Time, sender Sender) error {
+		punctuations = append(punctuations, now)
+		return nil
+	})
+
+	assert.Nil(t, simulator.Send(newTopKTestMessage("nz", "a", 10)))
+	assert.Nil(t, simulator.Send(newTopKTestMessage("nz", "b", 45)))
+	assert.Equal(t, []time.Time{time.Unix(30, 0)}, punctuations)
+	assert.Equal(t, time.Unix(45, 0), simulator.Clock().Now())
+	assert.Empty(t, simulator.Output())
+
+	// The window closes once stream time passes its end and grace period, without new messages
+	assert.Nil(t, simulator.AdvanceTo(time.Unix(69, 0)))
+	assert.Empty(t, simulator.Output())
+	assert.Nil(t, simulator.AdvanceTo(time.Unix(70, 0)))
+	assert.Len(t, simulator.Output(), 1)
+	assert.Equal(t, time.Unix(60, 0), simulator.Output()[0].Timestamp)
+	assert.Equal(t, []time.Time{time.Unix(30, 0), time.Unix(60, 0)}, punctuations)
+}
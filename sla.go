@@ -0,0 +1,67 @@
+package kasper
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// slaTracker checks the processing latency of incoming messages against Config.SLAs: the time between the
+// timestamp of a message (its production time, unless the producer set it) and the end of its processing,
+// including the production of outgoing messages. Messages without a timestamp are not checked.
+type slaTracker struct {
+	slas       map[string]time.Duration
+	violations Counter
+	latency    Gauge
+}
+
+func newSLATracker(config *Config) *slaTracker {
+	if len(config.SLAs) == 0 {
+		return nil
+	}
+	provider := config.MetricsProvider
+	return &slaTracker{
+		slas:       config.SLAs,
+		violations: provider.NewCounter("sla_violation_count", "Number of incoming messages processed later than the SLA of their topic", "topic", "partition"),
+		latency:    provider.NewGauge("sla_latency_seconds", "Time between the production and the end of processing of the latest message of the last batch", "topic", "partition"),
+	}
+}
+
+// checkSLAs updates the SLA metrics with a batch of messages whose processing ended at now, and emits an
+// EventSLAViolated per topic with late messages.
+func (tp *TopicProcessor) checkSLAs(messages []*sarama.ConsumerMessage, partition int, now time.Time) {
+	s := tp.sla
+	if s == nil {
+		return
+	}
+	partitionLabel := strconv.Itoa(partition)
+	latest := make(map[string]*sarama.ConsumerMessage)
+	late := make(map[string][]*sarama.ConsumerMessage)
+	for _, message := range messages {
+		sla, found := s.slas[message.Topic]
+		if !found || message.Timestamp.IsZero() {
+			continue
+		}
+		latest[message.Topic] = message
+		if now.Sub(message.Timestamp) > sla {
+			late[message.Topic] = append(late[message.Topic], message)
+		}
+	}
+	for topic, message := range latest {
+		s.latency.Set(now.Sub(message.Timestamp).Seconds(), topic, partitionLabel)
+	}
+	for topic, messages := range late {
+		last := messages[len(messages)-1]
+		s.violations.Add(float64(len(messages)), topic, partitionLabel)
+		tp.logger.Errorf("%d messages of %s-%d were processed later than their SLA of %s", len(messages), topic, partition, s.slas[topic])
+		tp.config.emitEvent(Event{
+			Type:      EventSLAViolated,
+			Partition: partition,
+			Topic:     topic,
+			Offset:    last.Offset,
+			Messages:  len(messages),
+			Latency:   now.Sub(last.Timestamp),
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package kasper
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTopicProcessor_checkSLAs(t *testing.T) {
+	events := make(chan Event, 10)
+	config := &Config{
+		SLAs:            map[string]time.Duration{"dragons": time.Minute},
+		MetricsProvider: &NoopMetricsProvider{},
+		EventListener:   ChannelEventListener(events),
+		Clock:           NewFakeClock(time.Unix(1000, 0)),
+	}
+	violations := &countingMetric{}
+	tp := &TopicProcessor{config: config, logger: &noopLogger{}, sla: newSLATracker(config)}
+	tp.sla.violations = violations
+
+	now := time.Unix(1000, 0)
+	tp.checkSLAs([]*sarama.ConsumerMessage{
+		{Topic: "dragons", Offset: 1, Timestamp: now.Add(-3 * time.Minute)},
+		{Topic: "dragons", Offset: 2, Timestamp: now.Add(-2 * time.Minute)},
+		{Topic: "dragons", Offset: 3},
+		{Topic: "dragons", Offset: 4, Timestamp: now.Add(-time.Second)},
+		{Topic: "riders", Offset: 5, Timestamp: now.Add(-time.Hour)},
+	}, 7, now)
+	assert.Equal(t, 2, violations.count)
+	assert.Len(t, events, 1)
+	event := <-events
+	assert.Equal(t, EventSLAViolated, event.Type)
+	assert.Equal(t, "dragons", event.Topic)
+	assert.Equal(t, 7, event.Partition)
+	assert.Equal(t, int64(2), event.Offset)
+	assert.Equal(t, 2, event.Messages)
+	assert.Equal(t, 2*time.Minute, event.Latency)
+
+	tp.checkSLAs([]*sarama.ConsumerMessage{{Topic: "dragons", Offset: 6, Timestamp: now.Add(-time.Second)}}, 7, now)
+	assert.Equal(t, 2, violations.count)
+	assert.Len(t, events, 0)
+
+	assert.Nil(t, newSLATracker(&Config{}))
+}
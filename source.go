@@ -0,0 +1,258 @@
+package kasper
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// Source is a source of incoming messages, so that sources other than Kafka (files, SQS, NATS...) can reuse
+// Kasper's processing, state and sink machinery through a SourceProcessor. Messages of other sources are
+// represented as sarama.ConsumerMessages, with whatever topic, partition and offset make sense for the source.
+type Source interface {
+	// NextBatch returns up to max messages, waiting at most wait for the batch to fill up.
+	// It may return an empty batch, and returns io.EOF once the source is exhausted.
+	NextBatch(max int, wait time.Duration) ([]*sarama.ConsumerMessage, error)
+	// Commit acknowledges messages returned by NextBatch once they have been processed and their outgoing
+	// messages have been produced.
+	Commit(messages []*sarama.ConsumerMessage) error
+	// Close releases the resources of the source.
+	Close() error
+}
+
+// KafkaSource is the Kafka implementation of Source. It consumes Config.InputTopics and Config.InputPartitions
+// from the committed offsets of the Kafka consumer group (or Config.OffsetStore) and commits offsets the same way
+// as a TopicProcessor. TopicProcessor remains the fully-featured way of processing Kafka topics: fencing,
+// reassignment, bounded mode and the other TopicProcessor features are not available through KafkaSource.
+type KafkaSource struct {
+	tp                 *TopicProcessor
+	consumer           sarama.Consumer
+	partitionConsumers []sarama.PartitionConsumer
+	offsetManagers     map[string]map[int32]sarama.PartitionOffsetManager
+	messages           chan *sarama.ConsumerMessage
+	close              chan struct{}
+	waitGroup          sync.WaitGroup
+	closeOnce          sync.Once
+	closeErr           error
+}
+
+// NewKafkaSource creates a KafkaSource. Only the name, client, logging, input and offset settings of config are used.
+func NewKafkaSource(config *Config) *KafkaSource {
+	config.setDefaults()
+	tp := &TopicProcessor{
+		config:        config,
+		offsetManager: mustSetupOffsetManager(config),
+		inputTopics:   config.InputTopics,
+		logger:        config.Logger,
+	}
+	consumer, err := sarama.NewConsumerFromClient(config.Client)
+	if err != nil {
+		config.Logger.Panic(err)
+	}
+	s := &KafkaSource{
+		tp:             tp,
+		consumer:       consumer,
+		offsetManagers: make(map[string]map[int32]sarama.PartitionOffsetManager),
+		messages:       make(chan *sarama.ConsumerMessage),
+		close:          make(chan struct{}),
+	}
+	for _, topic := range config.InputTopics {
+		s.offsetManagers[topic] = make(map[int32]sarama.PartitionOffsetManager)
+		for _, partition := range config.InputPartitions {
+			pom := getPartitionOffsetManager(tp, topic, partition)
+			pc := getPartitionConsumer(tp, consumer, pom, topic, partition)
+			s.offsetManagers[topic][int32(partition)] = pom
+			s.partitionConsumers = append(s.partitionConsumers, pc)
+			s.waitGroup.Add(1)
+			go s.forward(pc.Messages())
+		}
+	}
+	return s
+}
+
+func (s *KafkaSource) forward(messages <-chan *sarama.ConsumerMessage) {
+	defer s.waitGroup.Done()
+	for message := range messages {
+		select {
+		case s.messages <- message:
+		case <-s.close:
+			return
+		}
+	}
+}
+
+// NextBatch returns up to max messages received within wait, or io.EOF once the source is closed.
+func (s *KafkaSource) NextBatch(max int, wait time.Duration) ([]*sarama.ConsumerMessage, error) {
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	var batch []*sarama.ConsumerMessage
+	for len(batch) < max {
+		select {
+		case message := <-s.messages:
+			batch = append(batch, message)
+		case <-timer.C:
+			return batch, nil
+		case <-s.close:
+			return nil, io.EOF
+		}
+	}
+	return batch, nil
+}
+
+// Commit marks the offsets of messages as processed.
+func (s *KafkaSource) Commit(messages []*sarama.ConsumerMessage) error {
+	for _, message := range messages {
+		s.offsetManagers[message.Topic][message.Partition].MarkOffset(message.Offset+1, "")
+	}
+	return nil
+}
+
+// Close stops consumption and commits marked offsets. Calling Close again returns the error of the first call.
+func (s *KafkaSource) Close() error {
+	s.closeOnce.Do(func() {
+		s.closeErr = s.stop()
+	})
+	return s.closeErr
+}
+
+func (s *KafkaSource) stop() error {
+	close(s.close)
+	for _, pc := range s.partitionConsumers {
+		err := pc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	s.waitGroup.Wait()
+	err := s.tp.commitOffsets(s.offsetManagers)
+	if err != nil {
+		return err
+	}
+	for _, poms := range s.offsetManagers {
+		for _, pom := range poms {
+			err := pom.Close()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	err = s.consumer.Close()
+	if err == nil && s.tp.offsetManager != nil {
+		err = s.tp.offsetManager.Close()
+	}
+	return err
+}
+
+// RecordSource is a Source reading the records of a RecordReader, e.g. an archived file.
+// Commit does nothing: replaying a file again starts from its first record.
+type RecordSource struct {
+	reader RecordReader
+	closer io.Closer
+}
+
+// NewRecordSource creates a RecordSource reading from reader. closer may be nil.
+func NewRecordSource(reader RecordReader, closer io.Closer) *RecordSource {
+	return &RecordSource{reader, closer}
+}
+
+// NextBatch reads up to max records, or returns io.EOF after the last record.
+func (s *RecordSource) NextBatch(max int, wait time.Duration) ([]*sarama.ConsumerMessage, error) {
+	var batch []*sarama.ConsumerMessage
+	for len(batch) < max {
+		message, err := s.reader.Next()
+		if err == io.EOF && len(batch) > 0 {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		batch = append(batch, message)
+	}
+	return batch, nil
+}
+
+// Commit does nothing.
+func (s *RecordSource) Commit(messages []*sarama.ConsumerMessage) error {
+	return nil
+}
+
+// Close closes the underlying io.Closer, if any.
+func (s *RecordSource) Close() error {
+	if s.closer == nil {
+		return nil
+	}
+	return s.closer.Close()
+}
+
+// SourceProcessor runs a MessageProcessor over the messages of any Source. Outgoing messages go through
+// a StandaloneSender, so they are validated, retried and counted as with a TopicProcessor.
+// Batches are committed to the Source once their outgoing messages have been produced.
+type SourceProcessor struct {
+	config           *Config
+	source           Source
+	messageProcessor MessageProcessor
+	sender           Sender
+	close            chan struct{}
+	closeOnce        sync.Once
+}
+
+// NewSourceProcessor creates a SourceProcessor. Batches are sized with Config.BatchSize and Config.BatchWaitDuration,
+// and outgoing messages are sent with a StandaloneSender created from config (see NewSender).
+func NewSourceProcessor(config *Config, source Source, messageProcessor MessageProcessor) *SourceProcessor {
+	return &SourceProcessor{config, source, messageProcessor, NewSender(config), make(chan struct{}), sync.Once{}}
+}
+
+// RunLoop processes batches of messages until the Source is exhausted, Close() is called or an error occurs.
+// The Source and the StandaloneSender are closed when RunLoop returns.
+func (p *SourceProcessor) RunLoop() error {
+	err := p.runLoop()
+	closeErr := p.source.Close()
+	if closer, ok := p.sender.(io.Closer); ok {
+		if senderErr := closer.Close(); closeErr == nil {
+			closeErr = senderErr
+		}
+	}
+	if err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (p *SourceProcessor) runLoop() error {
+	for {
+		select {
+		case <-p.close:
+			return nil
+		default:
+		}
+		batch, err := p.source.NextBatch(p.config.BatchSize, p.config.BatchWaitDuration)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			continue
+		}
+		err = p.messageProcessor.Process(batch, p.sender)
+		if err == nil {
+			err = p.sender.Flush()
+		}
+		if err == nil {
+			err = p.source.Commit(batch)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Close makes RunLoop() return after the current batch. It can be called several times.
+func (p *SourceProcessor) Close() {
+	p.closeOnce.Do(func() {
+		close(p.close)
+	})
+}
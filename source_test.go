@@ -0,0 +1,109 @@
+package kasper
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeSource struct {
+	batches   [][]*sarama.ConsumerMessage
+	committed []*sarama.ConsumerMessage
+	closed    bool
+}
+
+func (s *fakeSource) NextBatch(max int, wait time.Duration) ([]*sarama.ConsumerMessage, error) {
+	if len(s.batches) == 0 {
+		return nil, io.EOF
+	}
+	batch := s.batches[0]
+	s.batches = s.batches[1:]
+	return batch, nil
+}
+
+func (s *fakeSource) Commit(messages []*sarama.ConsumerMessage) error {
+	s.committed = append(s.committed, messages...)
+	return nil
+}
+
+func (s *fakeSource) Close() error {
+	s.closed = true
+	return nil
+}
+
+func TestSourceProcessor_RunLoop(t *testing.T) {
+	source := &fakeSource{batches: [][]*sarama.ConsumerMessage{
+		{{Value: mushu}, {Value: falkor}},
+		{},
+		{{Value: saphira}},
+	}}
+	sender := &bufferSender{}
+	p := &SourceProcessor{&Config{BatchSize: 2}, source, NewRouterProcessor("dragons"), sender, make(chan struct{}), sync.Once{}}
+	assert.Nil(t, p.RunLoop())
+	assert.Len(t, sender.messages, 3)
+	assert.Len(t, source.committed, 3)
+	assert.True(t, source.closed)
+}
+
+func TestSourceProcessor_RunLoop_Error(t *testing.T) {
+	source := &fakeSource{batches: [][]*sarama.ConsumerMessage{{{Value: mushu}}}}
+	p := &SourceProcessor{&Config{BatchSize: 2}, source, failingMessageProcessor{}, &bufferSender{}, make(chan struct{}), sync.Once{}}
+	assert.NotNil(t, p.RunLoop())
+	assert.Len(t, source.committed, 0)
+	assert.True(t, source.closed)
+}
+
+func TestRecordSource_NextBatch(t *testing.T) {
+	reader, err := NewLineReader(bytes.NewReader([]byte("mushu\nfalkor\nsaphira")), "dragons", 100)
+	assert.Nil(t, err)
+	source := NewRecordSource(reader, nil)
+	batch, err := source.NextBatch(2, time.Second)
+	assert.Nil(t, err)
+	assert.Len(t, batch, 2)
+	batch, err = source.NextBatch(2, time.Second)
+	assert.Nil(t, err)
+	assert.Len(t, batch, 1)
+	_, err = source.NextBatch(2, time.Second)
+	assert.Equal(t, io.EOF, err)
+	assert.Nil(t, source.Close())
+}
+
+type failingRecordReader struct{}
+
+func (failingRecordReader) Next() (*sarama.ConsumerMessage, error) {
+	return nil, errors.New("corrupted")
+}
+
+func TestRecordSource_NextBatch_Error(t *testing.T) {
+	_, err := NewRecordSource(failingRecordReader{}, nil).NextBatch(2, time.Second)
+	assert.EqualError(t, err, "corrupted")
+}
+
+func TestSourceProcessor_Close(t *testing.T) {
+	source := &fakeSource{batches: [][]*sarama.ConsumerMessage{{{Value: mushu}}}}
+	p := &SourceProcessor{&Config{BatchSize: 2}, source, NewRouterProcessor("dragons"), &bufferSender{}, make(chan struct{}), sync.Once{}}
+	p.Close()
+	p.Close()
+	assert.Nil(t, p.RunLoop())
+	assert.Len(t, source.committed, 0)
+}
+
+func TestKafkaSource_Close(t *testing.T) {
+	pc := &closablePartitionConsumer{fakePartitionConsumer: fakePartitionConsumer{make(chan *sarama.ConsumerMessage)}}
+	s := &KafkaSource{
+		tp:                 &TopicProcessor{},
+		consumer:           &fakeConsumer{},
+		partitionConsumers: []sarama.PartitionConsumer{pc},
+		offsetManagers:     map[string]map[int32]sarama.PartitionOffsetManager{"hello": {0: &fakePartitionOffsetManager{}}},
+		close:              make(chan struct{}),
+	}
+	assert.Nil(t, s.Close())
+	assert.True(t, pc.closed)
+	assert.Nil(t, s.Close())
+}
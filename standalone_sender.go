@@ -0,0 +1,102 @@
+package kasper
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/Shopify/sarama"
+)
+
+// standaloneSenderPartition is used as the partition label of the producer metrics of a StandaloneSender.
+const standaloneSenderPartition = -1
+
+// StandaloneSender is a Sender that can be used outside of a TopicProcessor, e.g. by batch jobs writing to Kafka.
+// Outgoing messages go through the same steps as the messages of a TopicProcessor: Config.MessageValidator,
+// Config.SuppressOutput, Config.ShadowTopicSuffix, producer retries, Config.ProducerFailurePolicy and producer metrics
+// (with a partition label of -1).
+//
+// Unlike the Sender given to MessageProcessor.Process, messages are only sent when Flush is called.
+// StandaloneSender is safe for concurrent use.
+type StandaloneSender struct {
+	tp       *TopicProcessor
+	mutex    sync.Mutex
+	messages []*sarama.ProducerMessage
+}
+
+// NewSender creates a StandaloneSender. Only the name, client, logging, metrics, producer and validation settings
+// of config are used. ProducerFailurePolicyStopPartition and Config.DisableProducer are not supported.
+func NewSender(config *Config) *StandaloneSender {
+	config.setDefaults()
+	if config.DisableProducer {
+		config.Logger.Panic("a StandaloneSender cannot be created when Config.DisableProducer is set")
+	}
+	if config.ProducerFailurePolicy == ProducerFailurePolicyStopPartition {
+		config.Logger.Panic("ProducerFailurePolicyStopPartition is not supported by StandaloneSender")
+	}
+	provider := config.MetricsProvider
+	return &StandaloneSender{
+		tp: &TopicProcessor{
+			config:                   config,
+			producer:                 mustSetupProducer(config),
+			logger:                   config.Logger,
+			outgoingMessageCount:     provider.NewCounter("outgoing_message_count", "Number of outgoing messages sent", "topic", "partition"),
+			rejectedMessageCount:     provider.NewCounter("rejected_message_count", "Number of outgoing messages rejected by the message validator", "topic"),
+			producerInFlightMessages: provider.NewGauge("producer_in_flight_message_count", "Number of outgoing messages waiting to be acknowledged by Kafka", "partition"),
+			producerAckLatency:       provider.NewSummary("producer_ack_latency_seconds", "Time spent waiting for outgoing messages to be acknowledged by Kafka", "partition"),
+			producerStallCount:       provider.NewCounter("producer_stall_count", "Number of times producing outgoing messages took longer than the producer stall threshold", "partition"),
+		},
+	}
+}
+
+// Send appends a message to the messages to be sent by Flush.
+func (s *StandaloneSender) Send(msg *sarama.ProducerMessage) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.messages = append(s.messages, msg)
+}
+
+// SendTombstone appends a message with the given key and a nil value to the messages to be sent by Flush.
+func (s *StandaloneSender) SendTombstone(topic string, key sarama.Encoder) {
+	s.Send(&sarama.ProducerMessage{Topic: topic, Key: key})
+}
+
+// Flush sends all pending messages in bulk and waits for the configured number of acks.
+// Pending messages are discarded even if Flush returns an error, since Config.ProducerRetryMax
+// and Config.ProducerFailurePolicy have already been applied.
+func (s *StandaloneSender) Flush() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if len(s.messages) == 0 {
+		return nil
+	}
+	messages, err := s.tp.prepareOutgoingMessages(s.messages)
+	s.messages = nil
+	if err != nil {
+		return err
+	}
+	if len(messages) > 0 {
+		err = s.tp.produce(messages, standaloneSenderPartition)
+		if err != nil {
+			return err
+		}
+	}
+	for _, message := range messages {
+		s.tp.outgoingMessageCount.Inc(message.Topic, strconv.Itoa(int(message.Partition)))
+	}
+	return nil
+}
+
+// Close flushes pending messages and closes the underlying producer, unless it is a shared Config.Producer.
+// The Kafka client is not closed.
+func (s *StandaloneSender) Close() error {
+	err := s.Flush()
+	if err != nil || s.tp.config.Producer != nil {
+		return err
+	}
+	err = s.tp.producer.Close()
+	if err != nil {
+		return fmt.Errorf("cannot close producer: %s", err)
+	}
+	return nil
+}
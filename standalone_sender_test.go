@@ -0,0 +1,41 @@
+package kasper
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+func newStandaloneTestSender(errs ...error) *StandaloneSender {
+	tp := newFixture().pp.topicProcessor
+	tp.producer = &fakeSyncProducer{errs: errs}
+	tp.outgoingMessageCount = &noopMetric{}
+	tp.rejectedMessageCount = &noopMetric{}
+	return &StandaloneSender{tp: tp}
+}
+
+func TestStandaloneSender_Flush(t *testing.T) {
+	s := newStandaloneTestSender()
+	s.tp.config.ShadowTopicSuffix = "-shadow"
+	assert.Nil(t, s.Flush())
+
+	s.Send(&sarama.ProducerMessage{Topic: "hello", Value: sarama.StringEncoder("world")})
+	s.SendTombstone("hello", sarama.StringEncoder("AAA"))
+	assert.Nil(t, s.Flush())
+	produced := s.tp.producer.(*fakeSyncProducer).messages
+	assert.Len(t, produced, 2)
+	assert.Equal(t, "hello-shadow", produced[0].Topic)
+	assert.Nil(t, produced[1].Value)
+
+	assert.Nil(t, s.Close())
+}
+
+func TestStandaloneSender_Flush_Error(t *testing.T) {
+	failure := errors.New("broker unavailable")
+	s := newStandaloneTestSender(failure)
+	s.Send(&sarama.ProducerMessage{Topic: "hello"})
+	assert.Equal(t, failure, s.Flush())
+	assert.Nil(t, s.Flush())
+}
@@ -0,0 +1,46 @@
+package kasper
+
+import (
+	"github.com/Shopify/sarama"
+)
+
+// IsTombstone returns true if msg is a tombstone, i.e. a message with a nil value.
+// On compacted topics, tombstones mark the deletion of their key.
+func IsTombstone(msg *sarama.ConsumerMessage) bool {
+	return msg.Value == nil
+}
+
+// TableMaterializer is a MessageProcessor that materializes a compacted topic into a Store,
+// for use as a lookup table by other processors (e.g. for joins).
+// The latest value of each key is written to the Store, and tombstones delete their key.
+// The Store is flushed at the end of each batch.
+type TableMaterializer struct {
+	store Store
+}
+
+// NewTableMaterializer creates a TableMaterializer writing to store.
+func NewTableMaterializer(store Store) *TableMaterializer {
+	return &TableMaterializer{store}
+}
+
+// Process applies a batch of messages to the Store. Sender is not used.
+func (m *TableMaterializer) Process(messages []*sarama.ConsumerMessage, sender Sender) error {
+	puts := make(map[string][]byte)
+	for _, message := range messages {
+		key := string(message.Key)
+		if IsTombstone(message) {
+			delete(puts, key)
+			err := m.store.Delete(key)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		puts[key] = message.Value
+	}
+	err := m.store.PutAll(puts)
+	if err != nil {
+		return err
+	}
+	return m.store.Flush()
+}
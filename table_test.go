@@ -0,0 +1,32 @@
+package kasper
+
+import (
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsTombstone(t *testing.T) {
+	assert.True(t, IsTombstone(&sarama.ConsumerMessage{Key: []byte("mars")}))
+	assert.False(t, IsTombstone(&sarama.ConsumerMessage{Key: []byte("mars"), Value: []byte{}}))
+}
+
+func TestTableMaterializer_Process(t *testing.T) {
+	store := NewMap(10)
+	store.Put("venus", venus)
+	m := NewTableMaterializer(store)
+	err := m.Process([]*sarama.ConsumerMessage{
+		{Key: []byte("earth"), Value: earth},
+		{Key: []byte("mars"), Value: mars},
+		{Key: []byte("venus")},
+		{Key: []byte("mars")},
+		{Key: []byte("jupiter"), Value: saturn},
+		{Key: []byte("jupiter"), Value: jupiter},
+	}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string][]byte{
+		"earth":   earth,
+		"jupiter": jupiter,
+	}, store.GetMap())
+}
@@ -0,0 +1,128 @@
+package kasper
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+const tenantTopicPrefix = "tenant."
+
+// TenantFromTopic extracts the tenant ID from a topic following the tenant.{id}.{name} convention,
+// e.g. "tenant.acme.events" belongs to tenant "acme".
+func TenantFromTopic(topic string) (string, bool) {
+	if !strings.HasPrefix(topic, tenantTopicPrefix) {
+		return "", false
+	}
+	rest := topic[len(tenantTopicPrefix):]
+	i := strings.Index(rest, ".")
+	if i <= 0 || i == len(rest)-1 {
+		return "", false
+	}
+	return rest[:i], true
+}
+
+// TenantTopic returns the topic of a tenant following the tenant.{id}.{name} convention.
+func TenantTopic(tenant, name string) string {
+	return tenantTopicPrefix + tenant + "." + name
+}
+
+// TenantProcessorFactory creates the MessageProcessor of a tenant.
+// store is the tenant's own namespace of the TenantProcessor's MultiStore.
+type TenantProcessorFactory func(tenant string, store Store) MessageProcessor
+
+// TenantProcessor is a MessageProcessor that isolates tenants from each other.
+// Incoming messages are read from topics following the tenant.{id}.{name} convention (see TenantFromTopic)
+// and dispatched to a separate MessageProcessor per tenant, created on first use by the factory.
+// Each tenant's MessageProcessor gets its own Store from the MultiStore and its own labels on the
+// tenant_incoming_message_count and tenant_error_count metrics.
+// Noisy tenants can be limited with SetDefaultQuota and SetQuota.
+//
+// All tenant topics must be listed in Config.InputTopics.
+type TenantProcessor struct {
+	stores     MultiStore
+	factory    TenantProcessorFactory
+	processors map[string]MessageProcessor
+
+	defaultQuota *TenantQuota
+	quotas       map[string]*TenantQuota
+	quotaStates  map[string]*tenantQuotaState
+	now          func() time.Time
+	sleep        func(time.Duration)
+
+	labelValues              []string
+	tenantMessageCount       Counter
+	tenantErrorCount         Counter
+	tenantQuotaExceededCount Counter
+}
+
+// NewTenantProcessor creates a TenantProcessor.
+func NewTenantProcessor(config *Config, stores MultiStore, factory TenantProcessorFactory) *TenantProcessor {
+	metrics := config.MetricsProvider
+	return &TenantProcessor{
+		stores:                   stores,
+		factory:                  factory,
+		processors:               make(map[string]MessageProcessor),
+		quotas:                   make(map[string]*TenantQuota),
+		quotaStates:              make(map[string]*tenantQuotaState),
+		now:                      config.clock().Now,
+		sleep:                    config.clock().Sleep,
+		labelValues:              []string{config.TopicProcessorName},
+		tenantMessageCount:       metrics.NewCounter("tenant_incoming_message_count", "Number of incoming messages received per tenant", "topicProcessor", "tenant"),
+		tenantErrorCount:         metrics.NewCounter("tenant_error_count", "Number of batches a tenant failed to process", "topicProcessor", "tenant"),
+		tenantQuotaExceededCount: metrics.NewCounter("tenant_quota_exceeded_count", "Number of throttled batches and sidelined messages per tenant", "topicProcessor", "tenant"),
+	}
+}
+
+// Tenants returns the tenants which have received messages so far.
+func (p *TenantProcessor) Tenants() []string {
+	tenants := make([]string, 0, len(p.processors))
+	for tenant := range p.processors {
+		tenants = append(tenants, tenant)
+	}
+	return tenants
+}
+
+// Process splits messages by tenant and passes each tenant's messages, in order, to its MessageProcessor.
+// Tenants are processed in order of their first message in the batch.
+// It returns an error if a message is not read from a tenant topic or if a tenant fails to process its messages.
+func (p *TenantProcessor) Process(messages []*sarama.ConsumerMessage, sender Sender) error {
+	var tenants []string
+	batches := make(map[string][]*sarama.ConsumerMessage)
+	for _, message := range messages {
+		tenant, ok := TenantFromTopic(message.Topic)
+		if !ok {
+			return fmt.Errorf("topic %s does not follow the tenant.{id}.{name} convention", message.Topic)
+		}
+		if _, found := batches[tenant]; !found {
+			tenants = append(tenants, tenant)
+		}
+		batches[tenant] = append(batches[tenant], message)
+	}
+	for _, tenant := range tenants {
+		batch := batches[tenant]
+		labelValues := append(p.labelValues, tenant)
+		p.tenantMessageCount.Add(float64(len(batch)), labelValues...)
+		batch = p.applyQuota(tenant, batch, sender)
+		if len(batch) == 0 {
+			continue
+		}
+		err := p.processor(tenant).Process(batch, sender)
+		if err != nil {
+			p.tenantErrorCount.Inc(labelValues...)
+			return fmt.Errorf("tenant %s: %s", tenant, err)
+		}
+	}
+	return nil
+}
+
+func (p *TenantProcessor) processor(tenant string) MessageProcessor {
+	processor, found := p.processors[tenant]
+	if !found {
+		processor = p.factory(tenant, p.stores.Tenant(tenant))
+		p.processors[tenant] = processor
+	}
+	return processor
+}
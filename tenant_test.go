@@ -0,0 +1,93 @@
+package kasper
+
+import (
+	"errors"
+	"sort"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+type tenantTestProcessor struct {
+	store Store
+	err   error
+}
+
+func (p *tenantTestProcessor) Process(messages []*sarama.ConsumerMessage, sender Sender) error {
+	if p.err != nil {
+		return p.err
+	}
+	for _, message := range messages {
+		err := p.store.Put(string(message.Key), message.Value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestTenantFromTopic(t *testing.T) {
+	tenant, ok := TenantFromTopic("tenant.acme.events")
+	assert.True(t, ok)
+	assert.Equal(t, "acme", tenant)
+	assert.Equal(t, "tenant.acme.events", TenantTopic("acme", "events"))
+
+	for _, topic := range []string{"events", "tenant.acme", "tenant..events", "tenant.acme.", "tenants.acme.events"} {
+		_, ok = TenantFromTopic(topic)
+		assert.False(t, ok, topic)
+	}
+}
+
+func TestTenantProcessor_Process(t *testing.T) {
+	config := &Config{TopicProcessorName: "test", MetricsProvider: &NoopMetricsProvider{}}
+	stores := NewMultiMap(10)
+	var created []string
+	p := NewTenantProcessor(config, stores, func(tenant string, store Store) MessageProcessor {
+		created = append(created, tenant)
+		return &tenantTestProcessor{store: store}
+	})
+	tenantCount := &countingMetric{}
+	p.tenantMessageCount = tenantCount
+
+	err := p.Process([]*sarama.ConsumerMessage{
+		{Topic: "tenant.acme.events", Key: []byte("dragon"), Value: []byte("green")},
+		{Topic: "tenant.globex.events", Key: []byte("dragon"), Value: []byte("red")},
+		{Topic: "tenant.acme.events", Key: []byte("unicorn"), Value: []byte("white")},
+	}, &bufferSender{})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"acme", "globex"}, created)
+	assert.Equal(t, 3, tenantCount.count)
+
+	acme, _ := stores.Tenant("acme").Get("dragon")
+	assert.Equal(t, []byte("green"), acme)
+	globex, _ := stores.Tenant("globex").Get("dragon")
+	assert.Equal(t, []byte("red"), globex)
+	unicorn, _ := stores.Tenant("globex").Get("unicorn")
+	assert.Nil(t, unicorn)
+
+	err = p.Process([]*sarama.ConsumerMessage{
+		{Topic: "tenant.acme.events", Key: []byte("dragon"), Value: []byte("blue")},
+	}, &bufferSender{})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"acme", "globex"}, created)
+	tenants := p.Tenants()
+	sort.Strings(tenants)
+	assert.Equal(t, []string{"acme", "globex"}, tenants)
+}
+
+func TestTenantProcessor_Process_Errors(t *testing.T) {
+	config := &Config{TopicProcessorName: "test", MetricsProvider: &NoopMetricsProvider{}}
+	p := NewTenantProcessor(config, NewMultiMap(10), func(tenant string, store Store) MessageProcessor {
+		return &tenantTestProcessor{store: store, err: errors.New("boom")}
+	})
+	errorCount := &countingMetric{}
+	p.tenantErrorCount = errorCount
+
+	err := p.Process([]*sarama.ConsumerMessage{{Topic: "events"}}, &bufferSender{})
+	assert.NotNil(t, err)
+
+	err = p.Process([]*sarama.ConsumerMessage{{Topic: "tenant.acme.events"}}, &bufferSender{})
+	assert.EqualError(t, err, "tenant acme: boom")
+	assert.Equal(t, 1, errorCount.count)
+}
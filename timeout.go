@@ -0,0 +1,83 @@
+package kasper
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Shopify/sarama"
+)
+
+// ErrProcessTimeout is returned by TopicProcessor.RunLoop() when MessageProcessor.Process has run for longer
+// than Config.ProcessTimeout and Config.ProcessTimeoutPolicy is ProcessTimeoutPolicyFail.
+var ErrProcessTimeout = errors.New("message processor timed out")
+
+// ProcessTimeoutPolicy controls what happens to a batch of incoming messages whose processing timed out.
+type ProcessTimeoutPolicy int
+
+const (
+	// ProcessTimeoutPolicyFail stops processing and returns ErrProcessTimeout from TopicProcessor.RunLoop(),
+	// unless the partition is restarted (see Config.PartitionRestartMax).
+	ProcessTimeoutPolicyFail ProcessTimeoutPolicy = iota
+	// ProcessTimeoutPolicySkip drops the batch, including the messages sent while processing it,
+	// and commits its offsets.
+	ProcessTimeoutPolicySkip
+)
+
+// ContextSource gives MessageProcessors the context of the current Process call, which is cancelled after
+// Config.ProcessTimeout. The Sender given to MessageProcessor.Process, as well as the Senders Kasper passes to
+// wrapped MessageProcessors, implement ContextSource, see ContextOf:
+//
+//	ctx := kasper.ContextOf(sender)
+//	response, err := client.Do(request.WithContext(ctx))
+//
+// Kasper cannot interrupt a Process call: it stops waiting for it and applies Config.ProcessTimeoutPolicy.
+// MessageProcessors must therefore return promptly once the context is done, since the next batch may be
+// processed while they are still running. Once the context is done, messages sent are dropped and Flush returns
+// ErrProcessTimeout, and shutdown waits for the Process call to return before closing the producer.
+type ContextSource interface {
+	Context() context.Context
+}
+
+// ContextOf returns the context of the current Process call if sender implements ContextSource,
+// and context.Background() otherwise.
+func ContextOf(sender Sender) context.Context {
+	source, ok := sender.(ContextSource)
+	if !ok {
+		return context.Background()
+	}
+	return source.Context()
+}
+
+// Context returns the context of the current Process call, see ContextSource.
+func (sender *sender) Context() context.Context {
+	return sender.ctx
+}
+
+// processWithTimeout processes msgs like process, and returns ErrProcessTimeout if processing takes longer
+// than Config.ProcessTimeout.
+func (pp *partitionProcessor) processWithTimeout(msgs []*sarama.ConsumerMessage) ([]*sarama.ProducerMessage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), pp.topicProcessor.config.ProcessTimeout)
+	defer cancel()
+	type result struct {
+		messages []*sarama.ProducerMessage
+		err      error
+	}
+	done := make(chan result, 1)
+	tp := pp.topicProcessor
+	tp.processing.Add(1)
+	go func() {
+		defer tp.processing.Done()
+		messages, err := pp.processWithContext(ctx, msgs)
+		done <- result{messages, err}
+	}()
+	// The outcome is decided by the context, since a MessageProcessor honouring it may return as soon as it is done
+	select {
+	case r := <-done:
+		if ctx.Err() == nil {
+			return r.messages, r.err
+		}
+	case <-ctx.Done():
+	}
+	pp.logger.Errorf("Processing %d messages of partition %d timed out after %s", len(msgs), pp.partition, pp.topicProcessor.config.ProcessTimeout)
+	return nil, ErrProcessTimeout
+}
@@ -0,0 +1,132 @@
+package kasper
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+type contextMessageProcessor struct {
+	cancelled chan struct{}
+}
+
+func (p *contextMessageProcessor) Process(messages []*sarama.ConsumerMessage, sender Sender) error {
+	<-ContextOf(sender).Done()
+	close(p.cancelled)
+	return nil
+}
+
+func newTimeoutTestTopicProcessor(policy ProcessTimeoutPolicy) (*TopicProcessor, *partitionProcessor, *fakePartitionOffsetManager) {
+	tp := &TopicProcessor{
+		config:               &Config{ProcessTimeout: 20 * time.Millisecond, ProcessTimeoutPolicy: policy},
+		partitions:           []int{0},
+		close:                make(chan struct{}),
+		logger:               &noopLogger{},
+		incomingMessageCount: &noopMetric{},
+		outgoingMessageCount: &noopMetric{},
+	}
+	pp, _, pom := newReassignTestPartitionProcessor(tp, 0, nil)
+	tp.partitionProcessors = map[int32]*partitionProcessor{0: pp}
+	return tp, pp, pom
+}
+
+func TestTopicProcessor_processConsumerMessages_Timeout(t *testing.T) {
+	tp, pp, pom := newTimeoutTestTopicProcessor(ProcessTimeoutPolicyFail)
+	p := &contextMessageProcessor{make(chan struct{})}
+	pp.messageProcessor = p
+	err := tp.processConsumerMessages([]*sarama.ConsumerMessage{{Topic: "hello", Offset: 3}}, 0)
+	assert.Equal(t, ErrProcessTimeout, err)
+	<-p.cancelled
+	assert.Equal(t, int64(0), pom.offset)
+}
+
+func TestTopicProcessor_processConsumerMessages_TimeoutSkip(t *testing.T) {
+	tp, pp, pom := newTimeoutTestTopicProcessor(ProcessTimeoutPolicySkip)
+	var events []Event
+	tp.config.EventListener = func(event Event) { events = append(events, event) }
+	pp.messageProcessor = &contextMessageProcessor{make(chan struct{})}
+	err := tp.processConsumerMessages([]*sarama.ConsumerMessage{{Topic: "hello", Offset: 3}}, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(4), pom.offset)
+	assert.Equal(t, EventProcessTimeout, events[0].Type)
+	assert.Equal(t, 1, events[0].Messages)
+}
+
+func TestTopicProcessor_processConsumerMessages_WithinTimeout(t *testing.T) {
+	tp, pp, pom := newTimeoutTestTopicProcessor(ProcessTimeoutPolicyFail)
+	processed := make(chan *sarama.ConsumerMessage, 1)
+	pp.messageProcessor = &blockingMessageProcessor{nil, processed}
+	err := tp.processConsumerMessages([]*sarama.ConsumerMessage{{Topic: "hello", Offset: 3}}, 0)
+	assert.Nil(t, err)
+	assert.Len(t, processed, 1)
+	assert.Equal(t, int64(4), pom.offset)
+}
+
+type contextRecordingMessageProcessor struct {
+	ctx context.Context
+}
+
+func (p *contextRecordingMessageProcessor) Process(messages []*sarama.ConsumerMessage, sender Sender) error {
+	p.ctx = ContextOf(sender)
+	return nil
+}
+
+func TestContextOf(t *testing.T) {
+	assert.Equal(t, context.Background(), ContextOf(&bufferSender{}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sender := newSender(&partitionProcessor{topicProcessor: &TopicProcessor{}})
+	sender.ctx = ctx
+	assert.Equal(t, ctx, ContextOf(&chunkingSender{sender: sender}))
+
+	// Wrapped MessageProcessors see the context of the Process call
+	p := &contextRecordingMessageProcessor{}
+	keyAffinity, err := NewKeyAffinityProcessor(p)
+	assert.Nil(t, err)
+	err = keyAffinity.Process([]*sarama.ConsumerMessage{{Value: mushu}}, sender)
+	assert.Nil(t, err)
+	assert.Equal(t, ctx, p.ctx)
+}
+
+// lateMessageProcessor keeps running after its context is done, then sends and flushes a message.
+type lateMessageProcessor struct {
+	release chan struct{}
+	flushed chan error
+}
+
+func (p *lateMessageProcessor) Process(messages []*sarama.ConsumerMessage, sender Sender) error {
+	<-ContextOf(sender).Done()
+	<-p.release
+	sender.Send(&sarama.ProducerMessage{Topic: "late"})
+	p.flushed <- sender.Flush()
+	return nil
+}
+
+func TestTopicProcessor_processConsumerMessages_TimeoutExpiresSender(t *testing.T) {
+	tp, pp, _ := newTimeoutTestTopicProcessor(ProcessTimeoutPolicySkip)
+	producer := &fakeSyncProducer{}
+	tp.producer = producer
+	p := &lateMessageProcessor{make(chan struct{}), make(chan error, 1)}
+	pp.messageProcessor = p
+	err := tp.processConsumerMessages([]*sarama.ConsumerMessage{{Topic: "hello", Offset: 3}}, 0)
+	assert.Nil(t, err)
+
+	// The producer is only closed once the timed out Process call has returned
+	closed := make(chan []error)
+	go func() {
+		closed <- tp.closeClients()
+	}()
+	select {
+	case <-closed:
+		t.Fatal("producer closed while a Process call is running")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(p.release)
+	assert.Equal(t, ErrProcessTimeout, <-p.flushed)
+	assert.Empty(t, <-closed)
+	assert.Empty(t, producer.messages)
+}
@@ -73,8 +73,10 @@ all instances in order to easily scale the processing up or down.
 package kasper
 
 import (
+	"net/http"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/Shopify/sarama"
@@ -91,11 +93,40 @@ type TopicProcessor struct {
 	partitions          []int
 	close               chan struct{}
 	waitGroup           sync.WaitGroup
+	running             sync.WaitGroup
+	partitionsMutex     sync.RWMutex
+	reassignments       chan *reassignment
 
 	logger                      Logger
 	incomingMessageCount        Counter
 	outgoingMessageCount        Counter
 	messagesBehindHighWaterMark Gauge
+	rejectedMessageCount        Counter
+	producerInFlightMessages    Gauge
+	producerAckLatency          Summary
+	producerStallCount          Counter
+	inFlightMessages            int64
+	draining                    int32
+	httpServer                  *http.Server
+	restartsMutex               sync.Mutex
+	restarts                    map[int][]time.Time
+	batchSizeController         *batchSizeController
+	priorityMutex               sync.Mutex
+	priorityChannels            map[chan<- *sarama.ConsumerMessage]*priorityChannels
+	pausedMutex                 sync.Mutex
+	paused                      map[int]chan struct{}
+	controlConsumer             sarama.Consumer
+	controlPartitionConsumers   []sarama.PartitionConsumer
+	settings                    *runtimeSettings
+	flags                       *Flags
+	memory                      *memoryAccounting
+	scaling                     *scalingTracker
+	sla                         *slaTracker
+	offsetAnomalies             *offsetAnomalyDetector
+	processing                  sync.WaitGroup
+	started                     bool
+	looping                     int32
+	loopDone                    chan struct{}
 }
 
 // MessageProcessor is the interface that encapsulates application business logic.
@@ -114,6 +145,11 @@ type MessageProcessor interface {
 // all instances in order to easily scale the processing up or down.
 func NewTopicProcessor(config *Config, messageProcessors map[int]MessageProcessor) *TopicProcessor {
 	config.setDefaults()
+	err := config.validate()
+	if err != nil {
+		config.Logger.Panic(err)
+	}
+	mustMigrateStores(config)
 	inputTopics := config.InputTopics
 	partitions := config.InputPartitions
 	offsetManager := mustSetupOffsetManager(config)
@@ -129,10 +165,39 @@ func NewTopicProcessor(config *Config, messageProcessors map[int]MessageProcesso
 		partitions,
 		make(chan struct{}),
 		sync.WaitGroup{},
+		sync.WaitGroup{},
+		sync.RWMutex{},
+		make(chan *reassignment),
 		config.Logger,
 		provider.NewCounter("incoming_message_count", "Number of incoming messages received", "topic", "partition"),
 		provider.NewCounter("outgoing_message_count", "Number of outgoing messages sent", "topic", "partition"),
 		provider.NewGauge("messages_behind_high_water_mark_count", "Number of messages remaining to consume on the topic/partition", "topic", "partition"),
+		provider.NewCounter("rejected_message_count", "Number of outgoing messages rejected by the message validator", "topic"),
+		provider.NewGauge("producer_in_flight_message_count", "Number of outgoing messages waiting to be acknowledged by Kafka", "partition"),
+		provider.NewSummary("producer_ack_latency_seconds", "Time spent waiting for outgoing messages to be acknowledged by Kafka", "partition"),
+		provider.NewCounter("producer_stall_count", "Number of times producing outgoing messages took longer than the producer stall threshold", "partition"),
+		0,
+		0,
+		nil,
+		sync.Mutex{},
+		make(map[int][]time.Time),
+		newBatchSizeController(config),
+		sync.Mutex{},
+		make(map[chan<- *sarama.ConsumerMessage]*priorityChannels),
+		sync.Mutex{},
+		make(map[int]chan struct{}),
+		nil,
+		nil,
+		newRuntimeSettings(config),
+		nil,
+		newMemoryAccounting(config),
+		newScalingTracker(config),
+		newSLATracker(config),
+		newOffsetAnomalyDetector(config),
+		sync.WaitGroup{},
+		false,
+		0,
+		make(chan struct{}),
 	}
 	for _, partition := range partitions {
 		mp, found := messageProcessors[partition]
@@ -141,10 +206,18 @@ func NewTopicProcessor(config *Config, messageProcessors map[int]MessageProcesso
 		}
 		partitionProcessors[int32(partition)] = newPartitionProcessor(&topicProcessor, mp, partition)
 	}
+	topicProcessor.startHTTPServer()
+	topicProcessor.mustStartControlConsumer()
+	topicProcessor.mustStartFlagRefresh()
+	topicProcessor.publishMetadata()
+	topicProcessor.started = true
 	return &topicProcessor
 }
 
 func mustSetupOffsetManager(config *Config) sarama.OffsetManager {
+	if config.OffsetStore != nil {
+		return nil
+	}
 	offsetManager, err := sarama.NewOffsetManagerFromClient(config.kafkaConsumerGroup(), config.Client)
 	if err != nil {
 		config.Logger.Panic(err)
@@ -165,8 +238,11 @@ func (tp *TopicProcessor) Close() {
 // Kasper checks all high water marks and offsets for all topics before returning.
 func (tp *TopicProcessor) HasConsumedAllMessages() bool {
 	tp.logger.Debugf("Checking wheter we have more messages to consume")
+	tp.partitionsMutex.RLock()
+	defer tp.partitionsMutex.RUnlock()
 	for _, partition := range tp.partitions {
-		if !tp.partitionProcessors[int32(partition)].hasConsumedAllMessages() {
+		pp := tp.partitionProcessors[int32(partition)]
+		if pp == nil || !pp.hasConsumedAllMessages() {
 			return false
 		}
 	}
@@ -187,10 +263,26 @@ func (tp *TopicProcessor) getBatches() map[int][]*sarama.ConsumerMessage {
 // RunLoop is the main processing loop of Kasper. It does not spawn any goroutines and runs a single-threaded
 // event loop instead. RunLoop will block the current goroutine and will run forever until an error occurs or until
 // Close() is called. RunLoop propagates the error returned by MessageProcessor.Process if not nil.
+//
+// In bounded mode (see Config.StopAtOffsets and Config.StopAtHighWaterMark), RunLoop calls Config.OnComplete
+// and returns nil once all input partitions have been processed up to their stop offsets.
+//
+// When Config.IndependentPartitionLoops is set, RunLoop spawns one goroutine per input partition instead,
+// see runPartitionLoops().
 func (tp *TopicProcessor) RunLoop() error {
-	consumerChan := tp.getConsumerMessagesChan()
-	metricsTicker := time.NewTicker(tp.config.MetricsUpdateInterval)
-	batchTicker := time.NewTicker(tp.config.BatchWaitDuration)
+	tp.running.Add(1)
+	defer tp.running.Done()
+	atomic.StoreInt32(&tp.looping, 1)
+	defer func() {
+		atomic.StoreInt32(&tp.looping, 0)
+		close(tp.loopDone)
+	}()
+	if tp.config.IndependentPartitionLoops {
+		return tp.runPartitionLoops()
+	}
+	consumerChan := tp.getConsumerMessagesChan(tp.consumerMessageChannels())
+	metricsTicker := tp.config.clock().NewTicker(tp.config.MetricsUpdateInterval)
+	batchTicker := tp.config.clock().NewTicker(tp.config.BatchWaitDuration)
 
 	batches := tp.getBatches()
 	lengths := make(map[int]int)
@@ -202,81 +294,294 @@ func (tp *TopicProcessor) RunLoop() error {
 		case consumerMessage := <-consumerChan:
 			tp.logger.Debugf("Received: %s", consumerMessage)
 			partition := int(consumerMessage.Partition)
+			if batches[partition] == nil {
+				tp.logger.Debugf("Ignoring message of revoked partition %d", partition)
+				tp.memory.release(partition, []*sarama.ConsumerMessage{consumerMessage})
+				continue
+			}
+			if tp.getPartitionProcessor(partition).isStale(consumerMessage) {
+				tp.memory.release(partition, []*sarama.ConsumerMessage{consumerMessage})
+				continue
+			}
 			batches[partition][lengths[partition]] = consumerMessage
 			lengths[partition]++
-			if lengths[partition] == tp.config.BatchSize {
-				tp.logger.Debugf("Processing batch of %d messages...", tp.config.BatchSize)
-				err := tp.processConsumerMessages(batches[partition], partition)
+			if lengths[partition] >= tp.batchSize() {
+				tp.logger.Debugf("Processing batch of %d messages...", lengths[partition])
+				err := tp.processConsumerMessages(batches[partition][:lengths[partition]], partition)
+				err = tp.restartFailedPartition(err, partition, consumerChan)
 				if err != nil {
-					tp.onClose(metricsTicker, batchTicker)
-					return err
+					return tp.onClose(err, metricsTicker, batchTicker)
 				}
 				lengths[partition] = 0
 				tp.logger.Debug("Processing of batch complete")
+				if tp.isComplete() {
+					tp.onComplete()
+					return tp.onClose(nil, metricsTicker, batchTicker)
+				}
 			}
-		case <-metricsTicker.C:
+		case <-metricsTicker.C():
 			tp.onMetricsTick()
-		case <-batchTicker.C:
+		case r := <-tp.reassignments:
+			err := tp.reassign(r, consumerChan, batches, lengths)
+			r.done <- err
+			if err != nil {
+				return tp.onClose(err, metricsTicker, batchTicker)
+			}
+		case <-batchTicker.C():
 			for _, partition := range tp.partitions {
 				if lengths[partition] == 0 {
 					continue
 				}
 				tp.logger.Debugf("Processing batch of %d messages...", lengths[partition])
 				err := tp.processConsumerMessages(batches[partition][0:lengths[partition]], partition)
+				err = tp.restartFailedPartition(err, partition, consumerChan)
 				if err != nil {
-					tp.onClose(metricsTicker, batchTicker)
-					return err
+					return tp.onClose(err, metricsTicker, batchTicker)
 				}
 				lengths[partition] = 0
 				tp.logger.Debug("Processing of batch complete")
 			}
+			if tp.isComplete() {
+				tp.onComplete()
+				return tp.onClose(nil, metricsTicker, batchTicker)
+			}
 		case <-tp.close:
-			tp.onClose(metricsTicker, batchTicker)
-			return nil
+			if tp.config.GracefulHandoff || tp.isDraining() {
+				for _, partition := range tp.partitions {
+					if lengths[partition] == 0 {
+						continue
+					}
+					err := tp.processConsumerMessages(batches[partition][0:lengths[partition]], partition)
+					if err != nil {
+						return tp.onClose(err, metricsTicker, batchTicker)
+					}
+				}
+			}
+			return tp.onClose(nil, metricsTicker, batchTicker)
+		}
+	}
+}
+
+// runPartitionLoops runs an independent processing loop for each input partition in its own goroutine,
+// so that a slow partition does not hold back the others. The first error returned by a partition loop
+// stops all other loops and is returned. MessageProcessor instances shared across partitions must be safe
+// for concurrent use in this mode.
+func (tp *TopicProcessor) runPartitionLoops() error {
+	metricsTicker := tp.config.clock().NewTicker(tp.config.MetricsUpdateInterval)
+	stop := make(chan struct{})
+	errs := make(chan error, len(tp.partitionProcessors))
+	var loops sync.WaitGroup
+	complete := make(chan struct{})
+
+	tp.logger.Info("Entering partition run loops")
+
+	for _, pp := range tp.partitionProcessors {
+		loops.Add(1)
+		go func(pp *partitionProcessor) {
+			defer loops.Done()
+			tp.withPartitionLabels(pp.partition, func() {
+				err := pp.runLoop(stop)
+				for err != nil && err != ErrFenced && tp.mayRestartPartition(pp.partition) {
+					pp, err = tp.restartPartition(pp.partition, err)
+					if err == nil {
+						err = pp.runLoop(stop)
+					}
+				}
+				if err != nil {
+					errs <- err
+				}
+			})
+		}(pp)
+	}
+	go func() {
+		loops.Wait()
+		close(complete)
+	}()
+	var err error
+	for done := false; !done; {
+		select {
+		case <-metricsTicker.C():
+			tp.onMetricsTick()
+		case err = <-errs:
+			done = true
+		case <-complete:
+			select {
+			case err = <-errs:
+			default:
+				if tp.isComplete() {
+					tp.onComplete()
+				}
+			}
+			done = true
+		case <-tp.close:
+			done = true
 		}
 	}
+	close(stop)
+	loops.Wait()
+	return tp.onClose(err, metricsTicker)
+}
+
+func (tp *TopicProcessor) processConsumerMessages(messages []*sarama.ConsumerMessage, partition int) (err error) {
+	defer tp.memory.release(partition, messages)
+	tp.withPartitionLabels(partition, func() {
+		err = tp.processPartitionMessages(messages, partition)
+	})
+	return err
 }
 
-func (tp *TopicProcessor) processConsumerMessages(messages []*sarama.ConsumerMessage, partition int) error {
+func (tp *TopicProcessor) processPartitionMessages(messages []*sarama.ConsumerMessage, partition int) error {
 	for _, message := range messages {
 		tp.incomingMessageCount.Inc(message.Topic, strconv.Itoa(int(message.Partition)))
 	}
-	pp := tp.partitionProcessors[int32(partition)]
-	producerMessages, err := pp.process(messages)
+	pp := tp.getPartitionProcessor(partition)
+	if pp.isStopped() {
+		tp.logger.Debugf("Ignoring %d messages of stopped partition %d", len(messages), partition)
+		return nil
+	}
+	pp.checkOffsetContinuity(messages)
+	messages = pp.dropBeyondBounds(messages)
+	if len(messages) == 0 {
+		return nil
+	}
+	if !tp.throttle(len(messages)) {
+		return nil
+	}
+	clock := tp.config.clock()
+	start := clock.Now()
+	manualCommit := tp.config.ManualCommit
+	atMostOnce := tp.config.ProcessingGuarantee == ProcessingGuaranteeAtMostOnce && !manualCommit
+	if manualCommit {
+		pp.trackOffsets(messages)
+	} else if atMostOnce {
+		err := pp.checkGeneration()
+		if err != nil {
+			return err
+		}
+		pp.markOffsets(messages)
+	}
+	input := tp.config.FaultInjection.corruptMessages(messages)
+	producerMessages, err := pp.process(input)
+	for err == ErrCircuitOpen {
+		tp.logger.Infof("Circuit breaker is open, pausing partition %d for %s", partition, tp.config.CircuitBreakerRetryInterval)
+		select {
+		case <-clock.After(tp.config.CircuitBreakerRetryInterval):
+		case <-tp.close:
+			return nil
+		}
+		producerMessages, err = pp.process(input)
+	}
+	if reporter, ok := pp.messageProcessor.(MemoryReporter); ok && err == nil {
+		tp.memory.setStoreUsage(partition, reporter.MemoryUsage())
+	}
+	if err == ErrProcessTimeout {
+		tp.config.emitEvent(Event{Type: EventProcessTimeout, Partition: partition, Messages: len(messages), Err: err})
+		if tp.config.ProcessTimeoutPolicy == ProcessTimeoutPolicySkip {
+			tp.logger.Errorf("Skipping %d messages of partition %d after processing timed out", len(messages), partition)
+			producerMessages, err = nil, nil
+		}
+	}
+	if pp.isStopped() {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	producerMessages, err = tp.prepareOutgoingMessages(producerMessages)
+	if err != nil {
+		return err
+	}
+	err = pp.checkGeneration()
 	if err != nil {
 		return err
 	}
 	if len(producerMessages) > 0 {
 		tp.logger.Debugf("Producing %d Kafka messages...", len(producerMessages))
-		err := tp.producer.SendMessages(producerMessages)
+		err := tp.produce(producerMessages, partition)
 		tp.logger.Debug("Producing of Kafka messages complete")
+		if err == errPartitionStopped {
+			return nil
+		}
 		if err != nil {
 			tp.logger.Errorf("Failed to produce messages: %s", err)
 			return err
 		}
 	}
-	pp.markOffsets(messages)
+	if !atMostOnce && !manualCommit {
+		// Checked again since producing may have taken long enough for another instance to take over
+		err = pp.checkGeneration()
+		if err != nil {
+			return err
+		}
+		pp.markOffsets(messages)
+	}
 	for _, message := range producerMessages {
 		tp.outgoingMessageCount.Inc(message.Topic, strconv.Itoa(int(message.Partition)))
 	}
+	end := clock.Now()
+	latency := end.Sub(start)
+	tp.batchSizeController.observe(len(messages), latency)
+	tp.scaling.observe(len(messages), latency)
+	tp.checkSLAs(messages, partition, end)
 	return nil
 }
 
-func (tp *TopicProcessor) onClose(tickers ...*time.Ticker) {
+func (tp *TopicProcessor) sendMessages(messages []*sarama.ProducerMessage, partition int) error {
+	if tp.config.FaultInjection.injectProducerError() {
+		return ErrInjectedFault
+	}
+	partitionLabel := strconv.Itoa(partition)
+	tp.producerInFlightMessages.Set(float64(len(messages)), partitionLabel)
+	atomic.AddInt64(&tp.inFlightMessages, int64(len(messages)))
+	clock := tp.config.clock()
+	start := clock.Now()
+	err := tp.producer.SendMessages(messages)
+	latency := clock.Now().Sub(start)
+	atomic.AddInt64(&tp.inFlightMessages, -int64(len(messages)))
+	tp.producerInFlightMessages.Set(0, partitionLabel)
+	tp.producerAckLatency.Observe(latency.Seconds(), partitionLabel)
+	if latency > tp.settings.getProducerStallThreshold(tp.config) {
+		tp.producerStallCount.Inc(partitionLabel)
+		tp.logger.Infof("Producing %d messages for partition %d took %s", len(messages), partition, latency)
+	}
+	return err
+}
+
+// prepareOutgoingMessages returns the subset of messages produced by a MessageProcessor
+// that must actually be sent to Kafka.
+func (tp *TopicProcessor) prepareOutgoingMessages(messages []*sarama.ProducerMessage) ([]*sarama.ProducerMessage, error) {
+	messages, err := tp.validateMessages(messages)
+	if err != nil {
+		return nil, err
+	}
+	if tp.config.SuppressOutput {
+		if len(messages) > 0 {
+			tp.logger.Debugf("Suppressing %d outgoing messages", len(messages))
+		}
+		return nil, nil
+	}
+	if tp.config.ShadowTopicSuffix != "" {
+		for _, message := range messages {
+			message.Topic += tp.config.ShadowTopicSuffix
+		}
+	}
+	return messages, nil
+}
+
+// onClose stops tickers and shuts tp down. It returns err if it is not nil, or the shutdown error otherwise.
+func (tp *TopicProcessor) onClose(err error, tickers ...Ticker) error {
 	tp.logger.Info("Closing topic processor...")
 	for _, ticker := range tickers {
 		if ticker != nil {
 			ticker.Stop()
 		}
 	}
-	for _, pp := range tp.partitionProcessors {
-		pp.onClose()
-	}
-	err := tp.producer.Close()
+	shutdownErr := tp.shutdown()
+	tp.logger.Info("Close complete")
 	if err != nil {
-		tp.logger.Panic(err)
+		return err
 	}
-	tp.logger.Info("Close complete")
+	return shutdownErr
 }
 
 func (tp *TopicProcessor) isClosed() bool {
@@ -288,15 +593,26 @@ func (tp *TopicProcessor) isClosed() bool {
 	}
 }
 
-func (tp *TopicProcessor) getConsumerMessagesChan() <-chan *sarama.ConsumerMessage {
+func (tp *TopicProcessor) getConsumerMessagesChan(chans []<-chan *sarama.ConsumerMessage) chan *sarama.ConsumerMessage {
 	consumerMessagesChan := make(chan *sarama.ConsumerMessage)
-	for _, ch := range tp.consumerMessageChannels() {
+	tp.prioritizeConsumerMessages(consumerMessagesChan)
+	tp.forwardConsumerMessages(chans, consumerMessagesChan)
+	return consumerMessagesChan
+}
+
+func (tp *TopicProcessor) forwardConsumerMessages(chans []<-chan *sarama.ConsumerMessage, consumerMessagesChan chan<- *sarama.ConsumerMessage) {
+	priority := tp.getPriorityChannels(consumerMessagesChan)
+	for _, ch := range chans {
 		tp.waitGroup.Add(1)
 		go func(c <-chan *sarama.ConsumerMessage) {
 			defer tp.waitGroup.Done()
 			for msg := range c {
+				if !tp.waitUntilResumed(int(msg.Partition)) || !tp.memory.waitUntilBelowBudget(tp.close) {
+					return
+				}
+				tp.memory.receive(msg)
 				select {
-				case consumerMessagesChan <- msg:
+				case priority.forMessage(msg, consumerMessagesChan) <- msg:
 					continue
 				case <-tp.close:
 					return
@@ -305,13 +621,28 @@ func (tp *TopicProcessor) getConsumerMessagesChan() <-chan *sarama.ConsumerMessa
 			}
 		}(ch)
 	}
-	return consumerMessagesChan
+}
+
+// getPartitionProcessor returns the current processor of partition, which is replaced when the partition is
+// restarted, possibly from another partition loop (see Config.IndependentPartitionLoops).
+func (tp *TopicProcessor) getPartitionProcessor(partition int) *partitionProcessor {
+	tp.partitionsMutex.RLock()
+	defer tp.partitionsMutex.RUnlock()
+	return tp.partitionProcessors[int32(partition)]
 }
 
 func (tp *TopicProcessor) onMetricsTick() {
+	tp.partitionsMutex.RLock()
+	partitionProcessors := make([]*partitionProcessor, 0, len(tp.partitionProcessors))
 	for _, pp := range tp.partitionProcessors {
+		partitionProcessors = append(partitionProcessors, pp)
+	}
+	tp.partitionsMutex.RUnlock()
+	for _, pp := range partitionProcessors {
 		pp.onMetricsTick()
 	}
+	tp.memory.onMetricsTick(tp.partitions)
+	tp.updateScalingSignal()
 }
 
 func (tp *TopicProcessor) consumerMessageChannels() []<-chan *sarama.ConsumerMessage {
@@ -324,6 +655,12 @@ func (tp *TopicProcessor) consumerMessageChannels() []<-chan *sarama.ConsumerMes
 }
 
 func mustSetupProducer(config *Config) sarama.SyncProducer {
+	if config.DisableProducer {
+		return nil
+	}
+	if config.Producer != nil {
+		return config.Producer
+	}
 	producer, err := sarama.NewSyncProducerFromClient(config.Client)
 	if err != nil {
 		config.Logger.Panic(err)
@@ -3,6 +3,7 @@ package kasper
 import (
 	"testing"
 
+	"github.com/Shopify/sarama"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -19,3 +20,67 @@ func TestTopicProcessorConfig_producerClientID(t *testing.T) {
 	}
 	assert.Equal(t, "kasper-topic-processor-ford-prefect", c.producerClientID())
 }
+
+func TestTopicProcessorConfig_validate(t *testing.T) {
+	c := &Config{GracefulHandoff: true}
+	assert.EqualError(t, c.validate(), "GracefulHandoff requires a FencingStore")
+	c.FencingStore = NewMap(10)
+	assert.Nil(t, c.validate())
+
+	c = &Config{CommitBarrier: true}
+	assert.EqualError(t, c.validate(), "CommitBarrier requires ManualCommit")
+	c.ManualCommit = true
+	assert.Nil(t, c.validate())
+
+	c = &Config{ProducerFailurePolicy: ProducerFailurePolicyDeadLetterFile}
+	assert.EqualError(t, c.validate(), "ProducerFailurePolicyDeadLetterFile requires a DeadLetterDirectory")
+	c = &Config{ProducerFailurePolicy: ProducerFailurePolicyCallback}
+	assert.EqualError(t, c.validate(), "ProducerFailurePolicyCallback requires a ProducerFailureCallback")
+	c.ProducerFailureCallback = func(messages []*sarama.ProducerMessage, err error) error { return nil }
+	assert.Nil(t, c.validate())
+}
+
+type fakePartitionOffsetManager struct {
+	offset int64
+}
+
+func (m *fakePartitionOffsetManager) NextOffset() (int64, string) { return m.offset, "" }
+
+func (m *fakePartitionOffsetManager) MarkOffset(offset int64, metadata string) { m.offset = offset }
+
+func (m *fakePartitionOffsetManager) Errors() <-chan *sarama.ConsumerError { return nil }
+
+func (m *fakePartitionOffsetManager) AsyncClose() {}
+
+func (m *fakePartitionOffsetManager) Close() error { return nil }
+
+func newProcessingGuaranteeTopicProcessor(guarantee ProcessingGuarantee) (*TopicProcessor, *fakePartitionOffsetManager) {
+	pom := &fakePartitionOffsetManager{}
+	tp := &TopicProcessor{
+		config:               &Config{ProcessingGuarantee: guarantee},
+		logger:               &noopLogger{},
+		incomingMessageCount: &noopMetric{},
+		outgoingMessageCount: &noopMetric{},
+	}
+	tp.partitionProcessors = map[int32]*partitionProcessor{
+		0: {
+			topicProcessor:   tp,
+			offsetManagers:   map[string]sarama.PartitionOffsetManager{"hello": pom},
+			messageProcessor: failingMessageProcessor{},
+			logger:           tp.logger,
+		},
+	}
+	return tp, pom
+}
+
+func TestTopicProcessor_ProcessingGuarantee(t *testing.T) {
+	messages := []*sarama.ConsumerMessage{{Topic: "hello", Offset: 41}}
+
+	tp, pom := newProcessingGuaranteeTopicProcessor(ProcessingGuaranteeAtLeastOnce)
+	assert.NotNil(t, tp.processConsumerMessages(messages, 0))
+	assert.Equal(t, int64(0), pom.offset)
+
+	tp, pom = newProcessingGuaranteeTopicProcessor(ProcessingGuaranteeAtMostOnce)
+	assert.NotNil(t, tp.processConsumerMessages(messages, 0))
+	assert.Equal(t, int64(42), pom.offset)
+}
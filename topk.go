@@ -0,0 +1,219 @@
+package kasper
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// GroupFunc extracts the group of an incoming message, e.g. a region or a category.
+type GroupFunc func(message *sarama.ConsumerMessage) string
+
+// TopKItem is an item of a top-K ranking, as emitted by TopKAggregator.
+type TopKItem struct {
+	Item  string  `json:"item"`
+	Count float64 `json:"count"`
+}
+
+type topKEntry struct {
+	Item  string  `json:"i"`
+	Count float64 `json:"c"`
+	Error float64 `json:"e"`
+}
+
+type topKWindow struct {
+	group  string
+	window Window
+}
+
+// TopKAggregator is a MessageProcessor that ranks the K most frequent items per group and tumbling window,
+// for leaderboards and trending computations. Windows are assigned by message timestamp.
+//
+// Counts are maintained in a WindowStore with the Space-Saving algorithm, which bounds the state of each group
+// and window to 10*K items: rankings are exact as long as fewer distinct items are seen, and approximate
+// otherwise. When stream time (the largest timestamp seen so far) passes the end of a window plus the grace
+// period, the ranking is sent to the output topic as a JSON array of TopKItem, keyed by group and timestamped
+// with the window end, and the window's state is deleted. Messages of closed windows are dropped.
+//
+// Open windows are tracked in memory: after a restart, windows that were open are not emitted.
+type TopKAggregator struct {
+	store      WindowStore
+	topic      string
+	k          int
+	windowSize time.Duration
+	grace      time.Duration
+	group      GroupFunc
+	item       ItemFunc
+	open       map[topKWindow]bool
+	streamTime time.Time
+}
+
+// NewTopKAggregator creates a TopKAggregator keeping its state in store and sending rankings to topic.
+// If group is nil, messages are grouped by key.
+func NewTopKAggregator(store WindowStore, topic string, k int, windowSize, grace time.Duration, group GroupFunc, item ItemFunc) *TopKAggregator {
+	if group == nil {
+		group = func(message *sarama.ConsumerMessage) string { return string(message.Key) }
+	}
+	return &TopKAggregator{
+		store:      store,
+		topic:      topic,
+		k:          k,
+		windowSize: windowSize,
+		grace:      grace,
+		group:      group,
+		item:       item,
+		open:       make(map[topKWindow]bool),
+	}
+}
+
+// StreamTime returns the current stream time.
+func (a *TopKAggregator) StreamTime() time.Time {
+	return a.streamTime
+}
+
+// Process counts a batch of messages and emits the rankings of the windows closed by the batch.
+func (a *TopKAggregator) Process(messages []*sarama.ConsumerMessage, sender Sender) error {
+	updated := make(map[topKWindow][]topKEntry)
+	for _, message := range messages {
+		if IsTombstone(message) {
+			continue
+		}
+		window := TumblingWindow(message.Timestamp, a.windowSize)
+		if a.isClosed(window) {
+			continue
+		}
+		w := topKWindow{a.group(message), window}
+		entries, found := updated[w]
+		if !found {
+			var err error
+			entries, err = a.load(w)
+			if err != nil {
+				return err
+			}
+		}
+		updated[w] = a.add(entries, string(a.item(message)))
+		a.open[w] = true
+		if message.Timestamp.After(a.streamTime) {
+			a.streamTime = message.Timestamp
+		}
+	}
+	for w, entries := range updated {
+		value, err := json.Marshal(entries)
+		if err != nil {
+			return err
+		}
+		err = a.store.Put(w.group, w.window, value)
+		if err != nil {
+			return err
+		}
+	}
+	err := a.emitClosedWindows(sender)
+	if err != nil {
+		return err
+	}
+	return a.store.Flush()
+}
+
+// AdvanceStreamTime moves stream time forward to t if t is later, and emits the rankings of the windows closed by t.
+func (a *TopKAggregator) AdvanceStreamTime(t time.Time, sender Sender) error {
+	if t.After(a.streamTime) {
+		a.streamTime = t
+	}
+	err := a.emitClosedWindows(sender)
+	if err != nil {
+		return err
+	}
+	return a.store.Flush()
+}
+
+func (a *TopKAggregator) load(w topKWindow) ([]topKEntry, error) {
+	value, err := a.store.Get(w.group, w.window)
+	if err != nil || value == nil {
+		return nil, err
+	}
+	var entries []topKEntry
+	err = json.Unmarshal(value, &entries)
+	return entries, err
+}
+
+// add counts item with the Space-Saving algorithm: when all slots are taken,
+// the least frequent item is replaced and its count is inherited as an over-estimation error.
+func (a *TopKAggregator) add(entries []topKEntry, item string) []topKEntry {
+	for i := range entries {
+		if entries[i].Item == item {
+			entries[i].Count++
+			return entries
+		}
+	}
+	if len(entries) < 10*a.k {
+		return append(entries, topKEntry{item, 1, 0})
+	}
+	min := 0
+	for i := range entries {
+		if entries[i].Count < entries[min].Count {
+			min = i
+		}
+	}
+	entries[min] = topKEntry{item, entries[min].Count + 1, entries[min].Count}
+	return entries
+}
+
+func (a *TopKAggregator) emitClosedWindows(sender Sender) error {
+	var closed []topKWindow
+	for w := range a.open {
+		if a.isClosed(w.window) {
+			closed = append(closed, w)
+		}
+	}
+	sort.Slice(closed, func(i, j int) bool {
+		if !closed[i].window.End.Equal(closed[j].window.End) {
+			return closed[i].window.End.Before(closed[j].window.End)
+		}
+		return closed[i].group < closed[j].group
+	})
+	for _, w := range closed {
+		entries, err := a.load(w)
+		if err != nil {
+			return err
+		}
+		value, err := json.Marshal(a.topK(entries))
+		if err != nil {
+			return err
+		}
+		sender.Send(&sarama.ProducerMessage{
+			Topic:     a.topic,
+			Key:       sarama.StringEncoder(w.group),
+			Value:     sarama.ByteEncoder(value),
+			Timestamp: w.window.End,
+		})
+		err = a.store.Delete(w.group, w.window)
+		if err != nil {
+			return err
+		}
+		delete(a.open, w)
+	}
+	return nil
+}
+
+func (a *TopKAggregator) topK(entries []topKEntry) []TopKItem {
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Count != entries[j].Count {
+			return entries[i].Count > entries[j].Count
+		}
+		return entries[i].Item < entries[j].Item
+	})
+	if len(entries) > a.k {
+		entries = entries[:a.k]
+	}
+	items := make([]TopKItem, len(entries))
+	for i, entry := range entries {
+		items[i] = TopKItem{entry.Item, entry.Count}
+	}
+	return items
+}
+
+func (a *TopKAggregator) isClosed(window Window) bool {
+	return !a.streamTime.Before(window.End.Add(a.grace))
+}
@@ -0,0 +1,59 @@
+package kasper
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTopKTestMessage(region, song string, seconds int64) *sarama.ConsumerMessage {
+	return &sarama.ConsumerMessage{Key: []byte(region), Value: []byte(song), Timestamp: time.Unix(seconds, 0)}
+}
+
+func TestTopKAggregator_Process(t *testing.T) {
+	song := func(message *sarama.ConsumerMessage) []byte { return message.Value }
+	a := NewTopKAggregator(NewTumblingWindowStore(NewMap(10), time.Minute), "top-songs", 2, time.Minute, 10*time.Second, nil, song)
+
+	sender := &bufferSender{}
+	assert.Nil(t, a.Process([]*sarama.ConsumerMessage{
+		newTopKTestMessage("nz", "a", 0),
+		newTopKTestMessage("nz", "b", 10),
+		newTopKTestMessage("nz", "b", 20),
+		newTopKTestMessage("nz", "c", 30),
+		newTopKTestMessage("nz", "c", 40),
+		newTopKTestMessage("nz", "c", 50),
+		newTopKTestMessage("au", "a", 55),
+	}, sender))
+	assert.Empty(t, sender.messages)
+
+	assert.Nil(t, a.Process([]*sarama.ConsumerMessage{
+		newTopKTestMessage("nz", "a", 65),
+		newTopKTestMessage("nz", "a", 70),
+	}, sender))
+	assert.Len(t, sender.messages, 2)
+	key, _ := sender.messages[0].Key.Encode()
+	assert.Equal(t, []byte("au"), key)
+	value, _ := sender.messages[1].Value.Encode()
+	var items []TopKItem
+	assert.Nil(t, json.Unmarshal(value, &items))
+	assert.Equal(t, []TopKItem{{"c", 3}, {"b", 2}}, items)
+	assert.Equal(t, time.Unix(60, 0), sender.messages[1].Timestamp)
+
+	// Messages of closed windows are dropped
+	sender = &bufferSender{}
+	assert.Nil(t, a.Process([]*sarama.ConsumerMessage{newTopKTestMessage("nz", "a", 5)}, sender))
+	assert.Empty(t, sender.messages)
+}
+
+func TestTopKAggregator_SpaceSaving(t *testing.T) {
+	a := NewTopKAggregator(nil, "", 1, time.Minute, 0, nil, nil)
+	var entries []topKEntry
+	for _, item := range []string{"a", "a", "a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "k"} {
+		entries = a.add(entries, item)
+	}
+	assert.Len(t, entries, 10)
+	assert.Equal(t, []TopKItem{{"a", 3}}, a.topK(entries))
+}
@@ -0,0 +1,184 @@
+package kasper
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Topology declares the TopicProcessors of a deployment and the topics connecting them,
+// so that it can be checked before deployment (see Topology.Validate and Admin.ValidateTopology).
+// Topologies are typically kept as JSON files next to the deployment manifests (see LoadTopology).
+type Topology struct {
+	Topics     []TopologyTopic     `json:"topics"`
+	Processors []TopologyProcessor `json:"processors"`
+}
+
+// TopologyTopic declares a topic of a Topology.
+type TopologyTopic struct {
+	Name string `json:"name"`
+	// Expected number of partitions, 0 if not checked
+	Partitions int `json:"partitions"`
+	// Serialization format of keys and values, e.g. "json" or "avro"; only checked for presence
+	Format string `json:"format"`
+}
+
+// TopologyProcessor declares a TopicProcessor of a Topology.
+type TopologyProcessor struct {
+	Name         string   `json:"name"`
+	InputTopics  []string `json:"inputTopics"`
+	OutputTopics []string `json:"outputTopics"`
+	// Names of the Stores used by the processor, for documentation only
+	Stores []string `json:"stores"`
+}
+
+// LoadTopology reads a Topology from JSON.
+func LoadTopology(r io.Reader) (*Topology, error) {
+	var topology Topology
+	err := json.NewDecoder(r).Decode(&topology)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read topology: %s", err)
+	}
+	return &topology, nil
+}
+
+// Validate checks the topology on its own and returns the problems found, sorted, or nil if none:
+//
+//   - topics used by processors which are not declared or have no format
+//   - input topics of a processor with different partition counts: a TopicProcessor processes the same
+//     partition of all its input topics together, so they must be co-partitioned
+//   - cycles between processors, e.g. A reads from a topic written by B which reads from a topic written by A
+func (t *Topology) Validate() []string {
+	return t.validate(t.declaredPartitions())
+}
+
+func (t *Topology) declaredPartitions() map[string]int {
+	partitions := make(map[string]int)
+	for _, topic := range t.Topics {
+		if topic.Partitions > 0 {
+			partitions[topic.Name] = topic.Partitions
+		}
+	}
+	return partitions
+}
+
+// validate checks the topology given the partition count of each topic, when known.
+func (t *Topology) validate(partitions map[string]int) []string {
+	var problems []string
+	topics := make(map[string]TopologyTopic)
+	for _, topic := range t.Topics {
+		topics[topic.Name] = topic
+	}
+	for _, p := range t.Processors {
+		for _, name := range append(append([]string{}, p.InputTopics...), p.OutputTopics...) {
+			topic, found := topics[name]
+			if !found {
+				problems = append(problems, fmt.Sprintf("processor %s uses undeclared topic %s", p.Name, name))
+			} else if topic.Format == "" {
+				problems = append(problems, fmt.Sprintf("topic %s used by processor %s has no format", name, p.Name))
+			}
+		}
+		problems = append(problems, checkCoPartitioning(p, partitions)...)
+	}
+	problems = append(problems, t.findCycles()...)
+	sort.Strings(problems)
+	return problems
+}
+
+func checkCoPartitioning(p TopologyProcessor, partitions map[string]int) []string {
+	counts := make(map[int][]string)
+	for _, topic := range p.InputTopics {
+		if count, found := partitions[topic]; found {
+			counts[count] = append(counts[count], topic)
+		}
+	}
+	if len(counts) <= 1 {
+		return nil
+	}
+	var groups []string
+	for count, topics := range counts {
+		groups = append(groups, fmt.Sprintf("%s (%d)", strings.Join(topics, ", "), count))
+	}
+	sort.Strings(groups)
+	return []string{fmt.Sprintf("input topics of processor %s are not co-partitioned: %s", p.Name, strings.Join(groups, ", "))}
+}
+
+// findCycles reports each processor which can reach itself through the topics it writes to.
+func (t *Topology) findCycles() []string {
+	readers := make(map[string][]string)
+	for _, p := range t.Processors {
+		for _, topic := range p.InputTopics {
+			readers[topic] = append(readers[topic], p.Name)
+		}
+	}
+	next := make(map[string][]string)
+	for _, p := range t.Processors {
+		for _, topic := range p.OutputTopics {
+			next[p.Name] = append(next[p.Name], readers[topic]...)
+		}
+	}
+	var problems []string
+	for _, p := range t.Processors {
+		path := findPath(next, p.Name, p.Name, map[string]bool{})
+		if path != nil {
+			problems = append(problems, fmt.Sprintf("processor %s is part of a cycle: %s", p.Name, strings.Join(append([]string{p.Name}, path...), " -> ")))
+		}
+	}
+	return problems
+}
+
+// findPath returns the processors on a path from from to to, excluding from, or nil if there is none.
+func findPath(next map[string][]string, from, to string, visited map[string]bool) []string {
+	for _, n := range next[from] {
+		if n == to {
+			return []string{n}
+		}
+		if visited[n] {
+			continue
+		}
+		visited[n] = true
+		if path := findPath(next, n, to, visited); path != nil {
+			return append([]string{n}, path...)
+		}
+	}
+	return nil
+}
+
+// ValidateTopology validates topology against the live cluster: in addition to Topology.Validate, it reports
+// declared topics which do not exist or whose partition count differs from the declared one. Co-partitioning
+// is checked with the actual partition counts. Returns the problems found, sorted, or nil if none.
+func (admin *Admin) ValidateTopology(topology *Topology) ([]string, error) {
+	err := admin.client.RefreshMetadata()
+	if err != nil {
+		return nil, err
+	}
+	existing, err := admin.client.Topics()
+	if err != nil {
+		return nil, err
+	}
+	exists := make(map[string]bool, len(existing))
+	for _, topic := range existing {
+		exists[topic] = true
+	}
+	var problems []string
+	partitions := make(map[string]int)
+	for _, topic := range topology.Topics {
+		if !exists[topic.Name] {
+			problems = append(problems, fmt.Sprintf("topic %s does not exist", topic.Name))
+			continue
+		}
+		ids, err := admin.client.Partitions(topic.Name)
+		if err != nil {
+			return nil, err
+		}
+		partitions[topic.Name] = len(ids)
+		if topic.Partitions > 0 && topic.Partitions != len(ids) {
+			problems = append(problems, fmt.Sprintf("topic %s has %d partitions instead of %d", topic.Name, len(ids), topic.Partitions))
+		}
+	}
+	problems = append(problems, topology.validate(partitions)...)
+	sort.Strings(problems)
+	return problems, nil
+}
@@ -0,0 +1,138 @@
+package kasper
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// DiagramFormat is a graph description language supported by Topology.Describe.
+type DiagramFormat int
+
+const (
+	// DiagramFormatDOT is the GraphViz DOT language, e.g. for `dot -Tsvg`.
+	DiagramFormatDOT DiagramFormat = iota
+	// DiagramFormatMermaid is a Mermaid flowchart, which renders in Markdown on GitHub and GitLab.
+	DiagramFormatMermaid
+)
+
+// Describe returns a graph of the topology in the given format, to document and review topologies.
+// Topics are drawn according to their role: sources (not written by any processor), sinks (not read by any
+// processor) and intermediate topics. Processors are linked to the topics they read and write,
+// and to their Stores.
+func (t *Topology) Describe(format DiagramFormat) string {
+	d := newTopologyDiagram(t)
+	if format == DiagramFormatMermaid {
+		return d.mermaid()
+	}
+	return d.dot()
+}
+
+type topologyDiagram struct {
+	topology *Topology
+	topics   []string
+	stores   []string
+	read     map[string]bool
+	written  map[string]bool
+}
+
+func newTopologyDiagram(t *Topology) *topologyDiagram {
+	d := &topologyDiagram{topology: t, read: make(map[string]bool), written: make(map[string]bool)}
+	seenTopics := make(map[string]bool)
+	addTopic := func(topic string) {
+		if !seenTopics[topic] {
+			seenTopics[topic] = true
+			d.topics = append(d.topics, topic)
+		}
+	}
+	for _, topic := range t.Topics {
+		addTopic(topic.Name)
+	}
+	seenStores := make(map[string]bool)
+	for _, p := range t.Processors {
+		for _, topic := range p.InputTopics {
+			addTopic(topic)
+			d.read[topic] = true
+		}
+		for _, topic := range p.OutputTopics {
+			addTopic(topic)
+			d.written[topic] = true
+		}
+		for _, store := range p.Stores {
+			if !seenStores[store] {
+				seenStores[store] = true
+				d.stores = append(d.stores, store)
+			}
+		}
+	}
+	return d
+}
+
+func (d *topologyDiagram) dot() string {
+	var b bytes.Buffer
+	b.WriteString("digraph topology {\n\trankdir=LR;\n")
+	for _, topic := range d.topics {
+		shape := "box"
+		if !d.written[topic] {
+			shape = "invhouse"
+		} else if !d.read[topic] {
+			shape = "house"
+		}
+		fmt.Fprintf(&b, "\t%q [label=%q, shape=%s];\n", "topic:"+topic, topic, shape)
+	}
+	for _, p := range d.topology.Processors {
+		fmt.Fprintf(&b, "\t%q [label=%q, shape=ellipse];\n", "processor:"+p.Name, p.Name)
+	}
+	for _, store := range d.stores {
+		fmt.Fprintf(&b, "\t%q [label=%q, shape=cylinder];\n", "store:"+store, store)
+	}
+	for _, p := range d.topology.Processors {
+		for _, topic := range p.InputTopics {
+			fmt.Fprintf(&b, "\t%q -> %q;\n", "topic:"+topic, "processor:"+p.Name)
+		}
+		for _, topic := range p.OutputTopics {
+			fmt.Fprintf(&b, "\t%q -> %q;\n", "processor:"+p.Name, "topic:"+topic)
+		}
+		for _, store := range p.Stores {
+			fmt.Fprintf(&b, "\t%q -> %q [dir=none];\n", "processor:"+p.Name, "store:"+store)
+		}
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// mermaid identifies nodes by index, as Mermaid node IDs cannot contain arbitrary characters.
+func (d *topologyDiagram) mermaid() string {
+	topicIDs := make(map[string]string, len(d.topics))
+	storeIDs := make(map[string]string, len(d.stores))
+	var b bytes.Buffer
+	b.WriteString("flowchart LR\n")
+	for i, topic := range d.topics {
+		topicIDs[topic] = fmt.Sprintf("t%d", i)
+		format := "    %s[%q]\n"
+		if !d.written[topic] {
+			format = "    %s[/%q/]\n"
+		} else if !d.read[topic] {
+			format = "    %s[\\%q\\]\n"
+		}
+		fmt.Fprintf(&b, format, topicIDs[topic], topic)
+	}
+	for i, p := range d.topology.Processors {
+		fmt.Fprintf(&b, "    p%d(%q)\n", i, p.Name)
+	}
+	for i, store := range d.stores {
+		storeIDs[store] = fmt.Sprintf("s%d", i)
+		fmt.Fprintf(&b, "    %s[(%q)]\n", storeIDs[store], store)
+	}
+	for i, p := range d.topology.Processors {
+		for _, topic := range p.InputTopics {
+			fmt.Fprintf(&b, "    %s --> p%d\n", topicIDs[topic], i)
+		}
+		for _, topic := range p.OutputTopics {
+			fmt.Fprintf(&b, "    p%d --> %s\n", i, topicIDs[topic])
+		}
+		for _, store := range p.Stores {
+			fmt.Fprintf(&b, "    p%d --- %s\n", i, storeIDs[store])
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,53 @@
+package kasper
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newDiagramTestTopology() *Topology {
+	return &Topology{
+		Topics: []TopologyTopic{{Name: "dragons", Format: "json"}},
+		Processors: []TopologyProcessor{
+			{Name: "hoard", InputTopics: []string{"dragons"}, OutputTopics: []string{"hoards"}, Stores: []string{"gold"}},
+			{Name: "count", InputTopics: []string{"hoards"}, OutputTopics: []string{"counts"}, Stores: []string{"gold"}},
+		},
+	}
+}
+
+func TestTopology_Describe_DOT(t *testing.T) {
+	assert.Equal(t, `digraph topology {
+	rankdir=LR;
+	"topic:dragons" [label="dragons", shape=invhouse];
+	"topic:hoards" [label="hoards", shape=box];
+	"topic:counts" [label="counts", shape=house];
+	"processor:hoard" [label="hoard", shape=ellipse];
+	"processor:count" [label="count", shape=ellipse];
+	"store:gold" [label="gold", shape=cylinder];
+	"topic:dragons" -> "processor:hoard";
+	"processor:hoard" -> "topic:hoards";
+	"processor:hoard" -> "store:gold" [dir=none];
+	"topic:hoards" -> "processor:count";
+	"processor:count" -> "topic:counts";
+	"processor:count" -> "store:gold" [dir=none];
+}
+`, newDiagramTestTopology().Describe(DiagramFormatDOT))
+}
+
+func TestTopology_Describe_Mermaid(t *testing.T) {
+	assert.Equal(t, `flowchart LR
+    t0[/"dragons"/]
+    t1["hoards"]
+    t2[\"counts"\]
+    p0("hoard")
+    p1("count")
+    s0[("gold")]
+    t0 --> p0
+    p0 --> t1
+    p0 --- s0
+    t1 --> p1
+    p1 --> t2
+    p1 --- s0
+`, newDiagramTestTopology().Describe(DiagramFormatMermaid))
+}
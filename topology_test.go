@@ -0,0 +1,52 @@
+package kasper
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadTopology(t *testing.T) {
+	topology, err := LoadTopology(strings.NewReader(`{
+		"topics": [{"name": "dragons", "partitions": 4, "format": "json"}],
+		"processors": [{"name": "hoard", "inputTopics": ["dragons"], "outputTopics": []}]
+	}`))
+	assert.Nil(t, err)
+	assert.Equal(t, 4, topology.Topics[0].Partitions)
+	assert.Equal(t, []string{"dragons"}, topology.Processors[0].InputTopics)
+
+	_, err = LoadTopology(strings.NewReader("{"))
+	assert.NotNil(t, err)
+}
+
+func TestTopology_Validate(t *testing.T) {
+	topology := &Topology{
+		Topics: []TopologyTopic{
+			{Name: "dragons", Partitions: 4, Format: "json"},
+			{Name: "riders", Partitions: 8, Format: "json"},
+			{Name: "hoards", Partitions: 4},
+			{Name: "sightings", Format: "avro"},
+		},
+		Processors: []TopologyProcessor{
+			{Name: "join", InputTopics: []string{"dragons", "riders"}, OutputTopics: []string{"hoards"}},
+			{Name: "count", InputTopics: []string{"hoards"}, OutputTopics: []string{"sightings"}},
+			{Name: "spot", InputTopics: []string{"sightings"}, OutputTopics: []string{"dragons", "treasure"}},
+		},
+	}
+	assert.Equal(t, []string{
+		"input topics of processor join are not co-partitioned: dragons (4), riders (8)",
+		"processor count is part of a cycle: count -> spot -> join -> count",
+		"processor join is part of a cycle: join -> count -> spot -> join",
+		"processor spot is part of a cycle: spot -> join -> count -> spot",
+		"processor spot uses undeclared topic treasure",
+		"topic hoards used by processor count has no format",
+		"topic hoards used by processor join has no format",
+	}, topology.Validate())
+
+	valid := &Topology{
+		Topics:     []TopologyTopic{{Name: "dragons", Partitions: 4, Format: "json"}, {Name: "hoards", Format: "json"}},
+		Processors: []TopologyProcessor{{Name: "hoard", InputTopics: []string{"dragons"}, OutputTopics: []string{"hoards"}}},
+	}
+	assert.Nil(t, valid.Validate())
+}
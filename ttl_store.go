@@ -0,0 +1,180 @@
+package kasper
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// TTLClock selects the time used by a TTLStore to expire entries.
+type TTLClock int
+
+const (
+	// TTLWallClock expires entries based on the local time of the processor.
+	TTLWallClock TTLClock = iota
+	// TTLStreamTime expires entries based on stream time, i.e. the largest timestamp passed to
+	// TTLStore.ObserveStreamTime. Reprocessing old messages then expires state exactly as it did originally.
+	TTLStreamTime
+)
+
+// TTLStore is a Store that expires entries which have not been updated for a given time to live.
+// Each value is stored in the underlying Store prefixed with its 8-byte update time.
+//
+// Expired entries are never returned by Get and GetAll. They are deleted from the underlying Store by
+// Expire, which only knows about the keys written through this TTLStore since it was created; older entries
+// are deleted lazily when they are read. When the Store mirrors a compacted topic (see TableMaterializer),
+// use ExpireAndSendTombstones so that expired entries are not resurrected when the Store is rebuilt.
+type TTLStore struct {
+	store      Store
+	ttl        time.Duration
+	clock      TTLClock
+	now        func() time.Time
+	streamTime time.Time
+	updated    map[string]time.Time
+}
+
+// NewTTLStore creates a TTLStore wrapping store.
+func NewTTLStore(store Store, ttl time.Duration, clock TTLClock) *TTLStore {
+	return &TTLStore{
+		store:   store,
+		ttl:     ttl,
+		clock:   clock,
+		now:     time.Now,
+		updated: make(map[string]time.Time),
+	}
+}
+
+// SetClock sets the Clock used with TTLWallClock, e.g. a FakeClock in tests.
+func (s *TTLStore) SetClock(clock Clock) {
+	s.now = clock.Now
+}
+
+// ObserveStreamTime advances stream time to t if t is later. Only used with TTLStreamTime.
+func (s *TTLStore) ObserveStreamTime(t time.Time) {
+	if t.After(s.streamTime) {
+		s.streamTime = t
+	}
+}
+
+func (s *TTLStore) currentTime() time.Time {
+	if s.clock == TTLStreamTime {
+		return s.streamTime
+	}
+	return s.now()
+}
+
+func (s *TTLStore) isExpired(updated time.Time) bool {
+	return s.currentTime().Sub(updated) >= s.ttl
+}
+
+func (s *TTLStore) wrap(value []byte, updated time.Time) []byte {
+	wrapped := make([]byte, 8+len(value))
+	binary.BigEndian.PutUint64(wrapped, uint64(updated.UnixNano()))
+	copy(wrapped[8:], value)
+	return wrapped
+}
+
+// unwrapTTLValue returns the value and update time of a stored entry. ok is false for values not written by a TTLStore.
+func unwrapTTLValue(wrapped []byte) (value []byte, updated time.Time, ok bool) {
+	if len(wrapped) < 8 {
+		return nil, time.Time{}, false
+	}
+	return wrapped[8:], time.Unix(0, int64(binary.BigEndian.Uint64(wrapped))), true
+}
+
+// Get gets a value by key. Returns (nil, nil) if the key is not present or has expired.
+func (s *TTLStore) Get(key string) ([]byte, error) {
+	wrapped, err := s.store.Get(key)
+	if err != nil || wrapped == nil {
+		return nil, err
+	}
+	value, updated, ok := unwrapTTLValue(wrapped)
+	if !ok {
+		return nil, nil
+	}
+	if s.isExpired(updated) {
+		return nil, s.Delete(key)
+	}
+	return value, nil
+}
+
+// GetAll gets multiple values by key. The returned map does not contain entries for missing or expired keys.
+func (s *TTLStore) GetAll(keys []string) (map[string][]byte, error) {
+	kvs, err := s.store.GetAll(keys)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string][]byte, len(kvs))
+	for key, wrapped := range kvs {
+		value, updated, ok := unwrapTTLValue(wrapped)
+		if ok && !s.isExpired(updated) {
+			values[key] = value
+		}
+	}
+	return values, nil
+}
+
+// Put inserts or updates a value by key and resets its time to live.
+func (s *TTLStore) Put(key string, value []byte) error {
+	updated := s.currentTime()
+	err := s.store.Put(key, s.wrap(value, updated))
+	if err != nil {
+		return err
+	}
+	s.updated[key] = updated
+	return nil
+}
+
+// PutAll inserts or updates multiple key-value pairs and resets their time to live.
+func (s *TTLStore) PutAll(kvs map[string][]byte) error {
+	updated := s.currentTime()
+	wrapped := make(map[string][]byte, len(kvs))
+	for key, value := range kvs {
+		wrapped[key] = s.wrap(value, updated)
+	}
+	err := s.store.PutAll(wrapped)
+	if err != nil {
+		return err
+	}
+	for key := range kvs {
+		s.updated[key] = updated
+	}
+	return nil
+}
+
+// Delete deletes a key from the store.
+func (s *TTLStore) Delete(key string) error {
+	delete(s.updated, key)
+	return s.store.Delete(key)
+}
+
+// Flush flushes the underlying Store.
+func (s *TTLStore) Flush() error {
+	return s.store.Flush()
+}
+
+// Expire deletes the expired entries written through this TTLStore and returns their keys.
+func (s *TTLStore) Expire() ([]string, error) {
+	var expired []string
+	for key, updated := range s.updated {
+		if !s.isExpired(updated) {
+			continue
+		}
+		err := s.Delete(key)
+		if err != nil {
+			return expired, err
+		}
+		expired = append(expired, key)
+	}
+	return expired, nil
+}
+
+// ExpireAndSendTombstones deletes expired entries like Expire and sends a tombstone for each of them to topic.
+func (s *TTLStore) ExpireAndSendTombstones(sender Sender, topic string) error {
+	expired, err := s.Expire()
+	for _, key := range expired {
+		sender.SendTombstone(topic, sarama.StringEncoder(key))
+	}
+	return err
+}
@@ -0,0 +1,62 @@
+package kasper
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTTLStore_WallClock(t *testing.T) {
+	underlying := NewMap(10)
+	s := NewTTLStore(underlying, time.Minute, TTLWallClock)
+	now := time.Unix(1000, 0)
+	s.now = func() time.Time { return now }
+
+	assert.Nil(t, s.Put("dragon", []byte("green")))
+	now = now.Add(30 * time.Second)
+	assert.Nil(t, s.PutAll(map[string][]byte{"unicorn": []byte("white")}))
+	value, err := s.Get("dragon")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("green"), value)
+
+	now = now.Add(30 * time.Second)
+	value, err = s.Get("dragon")
+	assert.Nil(t, err)
+	assert.Nil(t, value)
+	assert.Nil(t, underlying.GetMap()["dragon"])
+	values, err := s.GetAll([]string{"dragon", "unicorn"})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string][]byte{"unicorn": []byte("white")}, values)
+
+	now = now.Add(time.Hour)
+	sender := &bufferSender{}
+	assert.Nil(t, s.ExpireAndSendTombstones(sender, "creatures"))
+	assert.Empty(t, underlying.GetMap())
+	assert.Len(t, sender.messages, 1)
+	assert.Equal(t, "creatures", sender.messages[0].Topic)
+	assert.Nil(t, sender.messages[0].Value)
+}
+
+func TestTTLStore_StreamTime(t *testing.T) {
+	s := NewTTLStore(NewMap(10), time.Minute, TTLStreamTime)
+	s.ObserveStreamTime(time.Unix(1000, 0))
+	assert.Nil(t, s.Put("dragon", []byte("green")))
+	assert.Nil(t, s.Put("unicorn", []byte("white")))
+	s.ObserveStreamTime(time.Unix(1030, 0))
+	assert.Nil(t, s.Put("unicorn", []byte("white")))
+	s.ObserveStreamTime(time.Unix(500, 0))
+
+	expired, err := s.Expire()
+	assert.Nil(t, err)
+	assert.Empty(t, expired)
+
+	s.ObserveStreamTime(time.Unix(1060, 0))
+	expired, err = s.Expire()
+	assert.Nil(t, err)
+	sort.Strings(expired)
+	assert.Equal(t, []string{"dragon"}, expired)
+	value, _ := s.Get("unicorn")
+	assert.Equal(t, []byte("white"), value)
+}
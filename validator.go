@@ -0,0 +1,80 @@
+package kasper
+
+import (
+	"fmt"
+
+	"github.com/Shopify/sarama"
+)
+
+// MessageValidator checks outgoing messages before they are produced to Kafka.
+// Typical implementations perform schema registry compatibility checks or size/format assertions.
+type MessageValidator interface {
+	// Validate returns a non-nil error if the message must not be sent to Kafka.
+	Validate(*sarama.ProducerMessage) error
+}
+
+// MessageValidatorFunc adapts an ordinary function to the MessageValidator interface.
+type MessageValidatorFunc func(*sarama.ProducerMessage) error
+
+// Validate calls f(msg).
+func (f MessageValidatorFunc) Validate(msg *sarama.ProducerMessage) error {
+	return f(msg)
+}
+
+// ValidationFailurePolicy controls what happens to outgoing messages rejected by Config.MessageValidator.
+type ValidationFailurePolicy int
+
+const (
+	// ValidationFailurePolicyFail stops all processing. The validation error is returned by TopicProcessor.RunLoop()
+	// and no messages of the rejected batch are produced.
+	ValidationFailurePolicyFail ValidationFailurePolicy = iota
+	// ValidationFailurePolicyDrop logs and discards rejected messages. The remaining messages are produced normally.
+	ValidationFailurePolicyDrop
+)
+
+type maxMessageSizeValidator struct {
+	maxBytes int
+}
+
+// NewMaxMessageSizeValidator creates a MessageValidator that rejects messages whose key and value
+// are larger than maxBytes in total. This is useful to fail early on messages that would otherwise
+// be refused by the broker (see message.max.bytes).
+func NewMaxMessageSizeValidator(maxBytes int) MessageValidator {
+	return &maxMessageSizeValidator{maxBytes}
+}
+
+func (v *maxMessageSizeValidator) Validate(msg *sarama.ProducerMessage) error {
+	size := 0
+	if msg.Key != nil {
+		size += msg.Key.Length()
+	}
+	if msg.Value != nil {
+		size += msg.Value.Length()
+	}
+	if size > v.maxBytes {
+		return fmt.Errorf("message to topic %s is %d bytes long (maximum is %d bytes)", msg.Topic, size, v.maxBytes)
+	}
+	return nil
+}
+
+func (tp *TopicProcessor) validateMessages(messages []*sarama.ProducerMessage) ([]*sarama.ProducerMessage, error) {
+	validator := tp.config.MessageValidator
+	if validator == nil {
+		return messages, nil
+	}
+	validMessages := make([]*sarama.ProducerMessage, 0, len(messages))
+	for _, message := range messages {
+		err := validator.Validate(message)
+		if err == nil {
+			validMessages = append(validMessages, message)
+			continue
+		}
+		tp.rejectedMessageCount.Inc(message.Topic)
+		if tp.config.ValidationFailurePolicy == ValidationFailurePolicyFail {
+			tp.logger.Errorf("Outgoing message to topic %s failed validation: %s", message.Topic, err)
+			return nil, err
+		}
+		tp.logger.Errorf("Dropping outgoing message to topic %s that failed validation: %s", message.Topic, err)
+	}
+	return validMessages, nil
+}
@@ -0,0 +1,82 @@
+package kasper
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+func newValidatorTestTopicProcessor(policy ValidationFailurePolicy) *TopicProcessor {
+	return &TopicProcessor{
+		config: &Config{
+			MessageValidator:        NewMaxMessageSizeValidator(6),
+			ValidationFailurePolicy: policy,
+		},
+		logger:               &noopLogger{},
+		rejectedMessageCount: &noopMetric{},
+	}
+}
+
+func newValidatorTestMessages() []*sarama.ProducerMessage {
+	return []*sarama.ProducerMessage{
+		{Topic: "hello", Key: sarama.StringEncoder("AAA"), Value: sarama.StringEncoder("BBB")},
+		{Topic: "hello", Key: sarama.StringEncoder("CCC"), Value: sarama.StringEncoder("DDDDDDDD")},
+		{Topic: "hello", Value: sarama.StringEncoder("EEE")},
+	}
+}
+
+func TestMaxMessageSizeValidator(t *testing.T) {
+	v := NewMaxMessageSizeValidator(3)
+	assert.Nil(t, v.Validate(&sarama.ProducerMessage{Value: sarama.StringEncoder("abc")}))
+	assert.Nil(t, v.Validate(&sarama.ProducerMessage{}))
+	assert.NotNil(t, v.Validate(&sarama.ProducerMessage{Key: sarama.StringEncoder("a"), Value: sarama.StringEncoder("abc")}))
+}
+
+func TestValidateMessages_NoValidator(t *testing.T) {
+	tp := &TopicProcessor{config: &Config{}}
+	messages := newValidatorTestMessages()
+	actual, err := tp.validateMessages(messages)
+	assert.Nil(t, err)
+	assert.Equal(t, messages, actual)
+}
+
+func TestValidateMessages_Drop(t *testing.T) {
+	tp := newValidatorTestTopicProcessor(ValidationFailurePolicyDrop)
+	messages := newValidatorTestMessages()
+	actual, err := tp.validateMessages(messages)
+	assert.Nil(t, err)
+	assert.Equal(t, []*sarama.ProducerMessage{messages[0], messages[2]}, actual)
+}
+
+func TestValidateMessages_Fail(t *testing.T) {
+	tp := newValidatorTestTopicProcessor(ValidationFailurePolicyFail)
+	actual, err := tp.validateMessages(newValidatorTestMessages())
+	assert.NotNil(t, err)
+	assert.Nil(t, actual)
+}
+
+func TestMessageValidatorFunc(t *testing.T) {
+	expected := errors.New("no empty values")
+	v := MessageValidatorFunc(func(msg *sarama.ProducerMessage) error {
+		if msg.Value == nil {
+			return expected
+		}
+		return nil
+	})
+	assert.Equal(t, expected, v.Validate(&sarama.ProducerMessage{}))
+}
+
+func TestPrepareOutgoingMessages_SuppressOutput(t *testing.T) {
+	tp := newValidatorTestTopicProcessor(ValidationFailurePolicyDrop)
+	tp.config.SuppressOutput = true
+	actual, err := tp.prepareOutgoingMessages(newValidatorTestMessages())
+	assert.Nil(t, err)
+	assert.Empty(t, actual)
+
+	tp = newValidatorTestTopicProcessor(ValidationFailurePolicyFail)
+	tp.config.SuppressOutput = true
+	_, err = tp.prepareOutgoingMessages(newValidatorTestMessages())
+	assert.NotNil(t, err)
+}
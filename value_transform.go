@@ -0,0 +1,79 @@
+package kasper
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Shopify/sarama"
+)
+
+// transformIncomingValues returns copies of messages whose values have been transformed, e.g. decrypted.
+// Tombstones are returned as is. action describes the transformation in error messages.
+func transformIncomingValues(messages []*sarama.ConsumerMessage, action string, transform func(value []byte) ([]byte, error)) ([]*sarama.ConsumerMessage, error) {
+	transformed := make([]*sarama.ConsumerMessage, len(messages))
+	for i, message := range messages {
+		transformed[i] = message
+		if IsTombstone(message) {
+			continue
+		}
+		value, err := transform(message.Value)
+		if err != nil {
+			return nil, fmt.Errorf("cannot %s message at offset %d of %s/%d: %s", action, message.Offset, message.Topic, message.Partition, err)
+		}
+		copied := *message
+		copied.Value = value
+		transformed[i] = &copied
+	}
+	return transformed, nil
+}
+
+// transformingSender is a Sender that transforms the values of outgoing messages, e.g. encrypts them,
+// before passing them to another Sender. Tombstones are passed as is. Messages that cannot be transformed
+// are dropped; the first error is kept in err and returned by Flush.
+type transformingSender struct {
+	sender    Sender
+	transform func(msg *sarama.ProducerMessage, value []byte) ([]byte, error)
+	err       error
+}
+
+func (s *transformingSender) Send(msg *sarama.ProducerMessage) {
+	if msg.Value == nil {
+		s.sender.Send(msg)
+		return
+	}
+	value, err := msg.Value.Encode()
+	if err == nil {
+		value, err = s.transform(msg, value)
+	}
+	if err != nil {
+		if s.err == nil {
+			s.err = err
+		}
+		return
+	}
+	msg.Value = sarama.ByteEncoder(value)
+	s.sender.Send(msg)
+}
+
+func (s *transformingSender) Context() context.Context {
+	return ContextOf(s.sender)
+}
+
+func (s *transformingSender) Committer() Committer {
+	return CommitterOf(s.sender)
+}
+
+func (s *transformingSender) Flags() *Flags {
+	return FlagsOf(s.sender)
+}
+
+func (s *transformingSender) SendTombstone(topic string, key sarama.Encoder) {
+	s.sender.SendTombstone(topic, key)
+}
+
+func (s *transformingSender) Flush() error {
+	if s.err != nil {
+		return s.err
+	}
+	return s.sender.Flush()
+}
@@ -0,0 +1,96 @@
+package kasper
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// WatermarkKey is the key of watermark control records.
+const WatermarkKey = "__kasper_watermark__"
+
+type watermarkRecord struct {
+	Source    string `json:"source"`
+	Watermark int64  `json:"watermark"`
+}
+
+// IsWatermark returns true if msg is a watermark control record.
+func IsWatermark(msg *sarama.ConsumerMessage) bool {
+	return string(msg.Key) == WatermarkKey
+}
+
+// SendWatermark sends a watermark control record to each of the given partitions of an intermediate topic,
+// telling downstream stages that source will not produce records older than watermark anymore.
+// source identifies the upstream producer, typically the TopicProcessorName and input partition.
+//
+// Watermarks must reach every partition of the topic, so the producer must honour ProducerMessage.Partition,
+// e.g. by setting sarama.Config.Producer.Partitioner to sarama.NewManualPartitioner.
+func SendWatermark(sender Sender, topic string, partitions []int32, source string, watermark time.Time) error {
+	value, err := json.Marshal(&watermarkRecord{source, watermark.UnixNano()})
+	if err != nil {
+		return err
+	}
+	for _, partition := range partitions {
+		sender.Send(&sarama.ProducerMessage{
+			Topic:     topic,
+			Partition: partition,
+			Key:       sarama.StringEncoder(WatermarkKey),
+			Value:     sarama.ByteEncoder(value),
+		})
+	}
+	return nil
+}
+
+// WatermarkTracker consumes watermark control records sent by upstream stages with SendWatermark.
+// The watermark of a partition is the smallest watermark of all upstream sources: downstream windows
+// ending before it can safely be closed, e.g. by passing it to Suppressor.Advance.
+type WatermarkTracker struct {
+	watermarks      map[string]time.Time
+	expectedSources int
+}
+
+// NewWatermarkTracker creates a WatermarkTracker expecting watermarks from expectedSources upstream sources.
+// Watermark() returns the zero time until all expected sources have sent a watermark.
+func NewWatermarkTracker(expectedSources int) *WatermarkTracker {
+	return &WatermarkTracker{
+		watermarks:      make(map[string]time.Time),
+		expectedSources: expectedSources,
+	}
+}
+
+// Filter records the watermarks of a batch and returns the remaining data records.
+// Malformed watermark records are discarded.
+func (t *WatermarkTracker) Filter(messages []*sarama.ConsumerMessage) []*sarama.ConsumerMessage {
+	records := make([]*sarama.ConsumerMessage, 0, len(messages))
+	for _, message := range messages {
+		if !IsWatermark(message) {
+			records = append(records, message)
+			continue
+		}
+		var record watermarkRecord
+		err := json.Unmarshal(message.Value, &record)
+		if err != nil {
+			continue
+		}
+		watermark := time.Unix(0, record.Watermark)
+		if watermark.After(t.watermarks[record.Source]) {
+			t.watermarks[record.Source] = watermark
+		}
+	}
+	return records
+}
+
+// Watermark returns the smallest watermark of all upstream sources.
+func (t *WatermarkTracker) Watermark() time.Time {
+	if len(t.watermarks) < t.expectedSources {
+		return time.Time{}
+	}
+	var min time.Time
+	for _, watermark := range t.watermarks {
+		if min.IsZero() || watermark.Before(min) {
+			min = watermark
+		}
+	}
+	return min
+}
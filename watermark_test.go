@@ -0,0 +1,40 @@
+package kasper
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+func toConsumerMessages(t *testing.T, messages []*sarama.ProducerMessage) []*sarama.ConsumerMessage {
+	var result []*sarama.ConsumerMessage
+	for _, message := range messages {
+		key, err := message.Key.Encode()
+		assert.Nil(t, err)
+		value, err := message.Value.Encode()
+		assert.Nil(t, err)
+		result = append(result, &sarama.ConsumerMessage{Topic: message.Topic, Partition: message.Partition, Key: key, Value: value})
+	}
+	return result
+}
+
+func TestWatermarks(t *testing.T) {
+	sender := &bufferSender{}
+	assert.Nil(t, SendWatermark(sender, "counts", []int32{0, 1}, "stage-1-0", time.Unix(60, 0)))
+	assert.Len(t, sender.messages, 2)
+	assert.Equal(t, int32(1), sender.messages[1].Partition)
+	assert.Nil(t, SendWatermark(sender, "counts", []int32{0}, "stage-1-1", time.Unix(30, 0)))
+	assert.Nil(t, SendWatermark(sender, "counts", []int32{0}, "stage-1-1", time.Unix(20, 0)))
+
+	data := &sarama.ConsumerMessage{Topic: "counts", Key: []byte("mars"), Value: []byte("1")}
+	messages := append(toConsumerMessages(t, sender.messages), data)
+	tracker := NewWatermarkTracker(3)
+	assert.Equal(t, []*sarama.ConsumerMessage{data}, tracker.Filter(messages))
+	assert.True(t, tracker.Watermark().IsZero())
+
+	tracker = NewWatermarkTracker(2)
+	tracker.Filter(messages)
+	assert.Equal(t, time.Unix(30, 0), tracker.Watermark())
+}
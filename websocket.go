@@ -0,0 +1,198 @@
+package kasper
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"golang.org/x/net/websocket"
+)
+
+// WebSocketMessage is the JSON frame sent to WebSocket clients for each broadcast message.
+type WebSocketMessage struct {
+	Topic     string    `json:"topic"`
+	Key       string    `json:"key"`
+	Value     string    `json:"value"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// WebSocketBroadcaster is an http.Handler that pushes outgoing messages to connected WebSocket clients,
+// e.g. to feed live dashboards directly from a processor. Clients select messages with the optional "topic" and
+// "key" query parameters, which may be repeated.
+//
+// Delivery is best effort: each client has a buffer of bufferSize messages, and messages are dropped for clients
+// which cannot keep up, so that slow clients never slow down processing.
+type WebSocketBroadcaster struct {
+	bufferSize int
+	mutex      sync.Mutex
+	clients    map[*webSocketClient]bool
+	handler    websocket.Handler
+}
+
+type webSocketClient struct {
+	topics   map[string]bool
+	keys     map[string]bool
+	messages chan *WebSocketMessage
+}
+
+// NewWebSocketBroadcaster creates a WebSocketBroadcaster buffering up to bufferSize messages per client.
+func NewWebSocketBroadcaster(bufferSize int) *WebSocketBroadcaster {
+	b := &WebSocketBroadcaster{
+		bufferSize: bufferSize,
+		clients:    make(map[*webSocketClient]bool),
+	}
+	b.handler = websocket.Handler(b.serve)
+	return b
+}
+
+// ServeHTTP upgrades the request to a WebSocket connection and pushes the selected messages until the client leaves.
+func (b *WebSocketBroadcaster) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b.handler.ServeHTTP(w, r)
+}
+
+func (b *WebSocketBroadcaster) serve(conn *websocket.Conn) {
+	query := conn.Request().URL.Query()
+	client := &webSocketClient{
+		topics:   toSet(query["topic"]),
+		keys:     toSet(query["key"]),
+		messages: make(chan *WebSocketMessage, b.bufferSize),
+	}
+	b.mutex.Lock()
+	b.clients[client] = true
+	b.mutex.Unlock()
+	defer func() {
+		b.mutex.Lock()
+		delete(b.clients, client)
+		b.mutex.Unlock()
+	}()
+	closed := make(chan struct{})
+	go func() {
+		// Clients are not expected to send anything: reading only detects disconnection
+		var ignored []byte
+		for websocket.Message.Receive(conn, &ignored) == nil {
+		}
+		close(closed)
+	}()
+	for {
+		select {
+		case message := <-client.messages:
+			if websocket.JSON.Send(conn, message) != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
+
+func toSet(values []string) map[string]bool {
+	if len(values) == 0 {
+		return nil
+	}
+	set := make(map[string]bool, len(values))
+	for _, value := range values {
+		set[value] = true
+	}
+	return set
+}
+
+// Clients returns the number of connected clients.
+func (b *WebSocketBroadcaster) Clients() int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return len(b.clients)
+}
+
+// Broadcast pushes a message to the clients which selected it. It never blocks.
+func (b *WebSocketBroadcaster) Broadcast(msg *sarama.ProducerMessage) {
+	var message *WebSocketMessage
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for client := range b.clients {
+		if client.topics != nil && !client.topics[msg.Topic] {
+			continue
+		}
+		if message == nil {
+			message = newWebSocketMessage(msg)
+		}
+		if client.keys != nil && !client.keys[message.Key] {
+			continue
+		}
+		select {
+		case client.messages <- message:
+		default:
+		}
+	}
+}
+
+func newWebSocketMessage(msg *sarama.ProducerMessage) *WebSocketMessage {
+	message := &WebSocketMessage{Topic: msg.Topic, Timestamp: msg.Timestamp}
+	if msg.Key != nil {
+		key, _ := msg.Key.Encode()
+		message.Key = string(key)
+	}
+	if msg.Value != nil {
+		value, _ := msg.Value.Encode()
+		message.Value = string(value)
+	}
+	return message
+}
+
+// WebSocketProcessor is a MessageProcessor that broadcasts the outgoing messages of another MessageProcessor
+// with a WebSocketBroadcaster, once the batch they belong to has been processed successfully.
+// Tombstones are not broadcast.
+type WebSocketProcessor struct {
+	messageProcessor MessageProcessor
+	broadcaster      *WebSocketBroadcaster
+}
+
+// NewWebSocketProcessor creates a WebSocketProcessor wrapping messageProcessor.
+func NewWebSocketProcessor(messageProcessor MessageProcessor, broadcaster *WebSocketBroadcaster) *WebSocketProcessor {
+	return &WebSocketProcessor{messageProcessor, broadcaster}
+}
+
+// Process passes a batch of messages to the underlying MessageProcessor and broadcasts its outgoing messages.
+func (p *WebSocketProcessor) Process(messages []*sarama.ConsumerMessage, sender Sender) error {
+	broadcastingSender := &broadcastingSender{sender: sender}
+	err := p.messageProcessor.Process(messages, broadcastingSender)
+	if err != nil {
+		return err
+	}
+	for _, msg := range broadcastingSender.sent {
+		p.broadcaster.Broadcast(msg)
+	}
+	return nil
+}
+
+// broadcastingSender is a Sender that keeps the messages it passes to another Sender.
+type broadcastingSender struct {
+	sender Sender
+	sent   []*sarama.ProducerMessage
+}
+
+func (s *broadcastingSender) Send(msg *sarama.ProducerMessage) {
+	s.sent = append(s.sent, msg)
+	s.sender.Send(msg)
+}
+
+func (s *broadcastingSender) Context() context.Context {
+	return ContextOf(s.sender)
+}
+
+func (s *broadcastingSender) Committer() Committer {
+	return CommitterOf(s.sender)
+}
+
+func (s *broadcastingSender) Flags() *Flags {
+	return FlagsOf(s.sender)
+}
+
+func (s *broadcastingSender) SendTombstone(topic string, key sarama.Encoder) {
+	s.sender.SendTombstone(topic, key)
+}
+
+func (s *broadcastingSender) Flush() error {
+	return s.sender.Flush()
+}
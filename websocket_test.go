@@ -0,0 +1,40 @@
+package kasper
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/websocket"
+)
+
+func TestWebSocketProcessor(t *testing.T) {
+	broadcaster := NewWebSocketBroadcaster(10)
+	server := httptest.NewServer(broadcaster)
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/?topic=dragons&key=mushu"
+	conn, err := websocket.Dial(url, "", server.URL)
+	assert.Nil(t, err)
+	defer conn.Close()
+	for broadcaster.Clients() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	processor := NewWebSocketProcessor(NewRouterProcessor("dragons"), broadcaster)
+	sender := &bufferSender{}
+	err = processor.Process([]*sarama.ConsumerMessage{
+		{Key: []byte("falkor"), Value: falkor},
+		{Key: []byte("mushu"), Value: mushu},
+	}, sender)
+	assert.Nil(t, err)
+	assert.Len(t, sender.messages, 2)
+
+	var message WebSocketMessage
+	assert.Nil(t, websocket.JSON.Receive(conn, &message))
+	assert.Equal(t, "dragons", message.Topic)
+	assert.Equal(t, "mushu", message.Key)
+	assert.Equal(t, string(mushu), message.Value)
+}
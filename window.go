@@ -0,0 +1,97 @@
+package kasper
+
+import (
+	"sort"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// Window is the time interval [Start, End) of a windowed aggregation.
+type Window struct {
+	Start time.Time
+	End   time.Time
+}
+
+// TumblingWindow returns the window of the given size that contains t.
+// Windows are aligned to the Unix epoch.
+func TumblingWindow(t time.Time, size time.Duration) Window {
+	start := time.Unix(0, t.UnixNano()-t.UnixNano()%int64(size))
+	return Window{start, start.Add(size)}
+}
+
+type suppressedKey struct {
+	key   string
+	start int64
+}
+
+type suppressedResult struct {
+	key    string
+	window Window
+	value  []byte
+}
+
+// Suppressor buffers updates of windowed aggregates and only emits the final result of each window,
+// once the window has closed, i.e. once stream time has passed the window end plus a grace period.
+// This avoids flooding downstream topics with intermediate results.
+// Stream time is the largest timestamp passed to Advance.
+// Buffered results are kept in memory and are lost on restart.
+type Suppressor struct {
+	topic      string
+	grace      time.Duration
+	pending    map[suppressedKey]*suppressedResult
+	streamTime time.Time
+}
+
+// NewSuppressor creates a Suppressor emitting final results to topic.
+func NewSuppressor(topic string, grace time.Duration) *Suppressor {
+	return &Suppressor{
+		topic:   topic,
+		grace:   grace,
+		pending: make(map[suppressedKey]*suppressedResult),
+	}
+}
+
+// StreamTime returns the current stream time.
+func (s *Suppressor) StreamTime() time.Time {
+	return s.streamTime
+}
+
+// Update records the latest aggregate value of key in window, replacing any previous value.
+func (s *Suppressor) Update(key string, window Window, value []byte) {
+	s.pending[suppressedKey{key, window.Start.UnixNano()}] = &suppressedResult{key, window, value}
+}
+
+// Advance moves stream time forward to t and sends the final result of every closed window to sender.
+// Results are sent in window end order, then key order. Advance returns the number of results sent.
+func (s *Suppressor) Advance(t time.Time, sender Sender) int {
+	if t.After(s.streamTime) {
+		s.streamTime = t
+	}
+	var closed []*suppressedResult
+	for k, result := range s.pending {
+		if s.isClosed(result.window) {
+			closed = append(closed, result)
+			delete(s.pending, k)
+		}
+	}
+	sort.Slice(closed, func(i, j int) bool {
+		if !closed[i].window.End.Equal(closed[j].window.End) {
+			return closed[i].window.End.Before(closed[j].window.End)
+		}
+		return closed[i].key < closed[j].key
+	})
+	for _, result := range closed {
+		sender.Send(&sarama.ProducerMessage{
+			Topic:     s.topic,
+			Key:       sarama.StringEncoder(result.key),
+			Value:     sarama.ByteEncoder(result.value),
+			Timestamp: result.window.End,
+		})
+	}
+	return len(closed)
+}
+
+func (s *Suppressor) isClosed(window Window) bool {
+	return !s.streamTime.Before(window.End.Add(s.grace))
+}
@@ -0,0 +1,92 @@
+package kasper
+
+import (
+	"fmt"
+	"time"
+)
+
+// WindowedValue is the value of a key in a window.
+type WindowedValue struct {
+	Window Window
+	Value  []byte
+}
+
+// WindowStore is a key-value store for windowed aggregations, where entries are keyed by key and window.
+type WindowStore interface {
+	// Get gets the value of key in window. Returns (nil, nil) if not present.
+	Get(key string, window Window) ([]byte, error)
+	// Put inserts or updates the value of key in window.
+	Put(key string, window Window, value []byte) error
+	// Delete deletes the value of key in window.
+	Delete(key string, window Window) error
+	// Fetch returns the values of key for all windows starting within [from, to], in window start order.
+	Fetch(key string, from, to time.Time) ([]WindowedValue, error)
+	// Flush indicates that the underlying storage must be made persistent.
+	Flush() error
+}
+
+// TumblingWindowStore is a WindowStore for tumbling windows of a fixed size (see TumblingWindow),
+// backed by any Store. Entries are stored under "<key>@<window start in Unix nanoseconds>".
+// Fetch reads all windows in the range with a single GetAll call.
+type TumblingWindowStore struct {
+	store Store
+	size  time.Duration
+}
+
+// NewTumblingWindowStore creates a TumblingWindowStore for windows of the given size, backed by store.
+func NewTumblingWindowStore(store Store, size time.Duration) *TumblingWindowStore {
+	return &TumblingWindowStore{store, size}
+}
+
+func (s *TumblingWindowStore) windowKey(key string, start time.Time) string {
+	return fmt.Sprintf("%s@%d", key, start.UnixNano())
+}
+
+// Get gets the value of key in window.
+func (s *TumblingWindowStore) Get(key string, window Window) ([]byte, error) {
+	return s.store.Get(s.windowKey(key, window.Start))
+}
+
+// Put inserts or updates the value of key in window.
+func (s *TumblingWindowStore) Put(key string, window Window, value []byte) error {
+	return s.store.Put(s.windowKey(key, window.Start), value)
+}
+
+// Delete deletes the value of key in window.
+func (s *TumblingWindowStore) Delete(key string, window Window) error {
+	return s.store.Delete(s.windowKey(key, window.Start))
+}
+
+// Fetch returns the values of key for all windows starting within [from, to], in window start order.
+func (s *TumblingWindowStore) Fetch(key string, from, to time.Time) ([]WindowedValue, error) {
+	var windows []Window
+	var keys []string
+	window := TumblingWindow(from, s.size)
+	if window.Start.Before(from) {
+		window = Window{window.End, window.End.Add(s.size)}
+	}
+	for ; !window.Start.After(to); window = (Window{window.End, window.End.Add(s.size)}) {
+		windows = append(windows, window)
+		keys = append(keys, s.windowKey(key, window.Start))
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	kvs, err := s.store.GetAll(keys)
+	if err != nil {
+		return nil, err
+	}
+	var values []WindowedValue
+	for i, window := range windows {
+		value, found := kvs[keys[i]]
+		if found {
+			values = append(values, WindowedValue{window, value})
+		}
+	}
+	return values, nil
+}
+
+// Flush flushes the underlying Store.
+func (s *TumblingWindowStore) Flush() error {
+	return s.store.Flush()
+}
@@ -0,0 +1,38 @@
+package kasper
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTumblingWindowStore(t *testing.T) {
+	s := NewTumblingWindowStore(NewMap(10), time.Minute)
+	first := TumblingWindow(time.Unix(60, 0), time.Minute)
+	third := TumblingWindow(time.Unix(185, 0), time.Minute)
+	assert.Nil(t, s.Put("mars", first, []byte("1")))
+	assert.Nil(t, s.Put("mars", third, []byte("3")))
+	assert.Nil(t, s.Put("venus", first, []byte("7")))
+
+	value, err := s.Get("mars", first)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("1"), value)
+
+	values, err := s.Fetch("mars", time.Unix(0, 0), time.Unix(300, 0))
+	assert.Nil(t, err)
+	assert.Equal(t, []WindowedValue{{first, []byte("1")}, {third, []byte("3")}}, values)
+
+	values, err = s.Fetch("mars", time.Unix(61, 0), time.Unix(180, 0))
+	assert.Nil(t, err)
+	assert.Equal(t, []WindowedValue{{third, []byte("3")}}, values)
+
+	assert.Nil(t, s.Delete("mars", third))
+	values, err = s.Fetch("mars", time.Unix(0, 0), time.Unix(300, 0))
+	assert.Nil(t, err)
+	assert.Len(t, values, 1)
+
+	values, err = s.Fetch("mars", time.Unix(300, 0), time.Unix(0, 0))
+	assert.Nil(t, err)
+	assert.Empty(t, values)
+}
@@ -0,0 +1,38 @@
+package kasper
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTumblingWindow(t *testing.T) {
+	w := TumblingWindow(time.Unix(125, 0), time.Minute)
+	assert.Equal(t, time.Unix(120, 0), w.Start)
+	assert.Equal(t, time.Unix(180, 0), w.End)
+}
+
+func TestSuppressor_Advance(t *testing.T) {
+	s := NewSuppressor("counts", 10*time.Second)
+	first := TumblingWindow(time.Unix(0, 0), time.Minute)
+	second := TumblingWindow(time.Unix(60, 0), time.Minute)
+	s.Update("mars", first, []byte("1"))
+	s.Update("mars", first, []byte("2"))
+	s.Update("earth", first, []byte("1"))
+	s.Update("mars", second, []byte("1"))
+
+	sender := &bufferSender{}
+	assert.Equal(t, 0, s.Advance(time.Unix(65, 0), sender))
+	assert.Equal(t, 2, s.Advance(time.Unix(70, 0), sender))
+	assert.Equal(t, []*sarama.ProducerMessage{
+		{Topic: "counts", Key: sarama.StringEncoder("earth"), Value: sarama.ByteEncoder("1"), Timestamp: first.End},
+		{Topic: "counts", Key: sarama.StringEncoder("mars"), Value: sarama.ByteEncoder("2"), Timestamp: first.End},
+	}, sender.messages)
+
+	// Stream time never goes backwards
+	assert.Equal(t, 0, s.Advance(time.Unix(0, 0), sender))
+	assert.Equal(t, time.Unix(70, 0), s.StreamTime())
+	assert.Equal(t, 1, s.Advance(time.Unix(130, 0), sender))
+}